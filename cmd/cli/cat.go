@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// CatCmd writes a message's media to standard output, e.g.
+// cli cat -c <chat> -m <id> | tar -x
+type CatCmd struct {
+	ChatID    int64 `help:"Chat ID, the storage chat by default" short:"c"`
+	MessageID int   `help:"Message ID; any part of a split upload streams all parts" short:"m" required:"true"`
+}
+
+func (c *CatCmd) Run(cfg *config.Config) error {
+	logger.UseStderr()
+	chatID := c.ChatID
+	if chatID == 0 {
+		chatID = cfg.Mtproto.StorageChatID
+	}
+
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	out := bufio.NewWriterSize(os.Stdout, 1<<20)
+	err = cl.Run(func(ctx context.Context) error {
+		if err := pipeline.Cat(cl, store, chatID, c.MessageID, out); err != nil {
+			return err
+		}
+		return out.Flush()
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
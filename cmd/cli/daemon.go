@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"tg-storage-assistant/internal/api"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/feed"
+	"tg-storage-assistant/internal/gateway"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/notify"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/internal/priority"
+	"tg-storage-assistant/internal/retry"
+	"time"
+)
+
+// DaemonCmd runs the daemon, or controls a running one through its socket
+type DaemonCmd struct {
+	Start  DaemonRunCmd    `cmd:"" name:"run" default:"1" help:"Run the daemon (the default)"`
+	Status DaemonStatusCmd `cmd:"" help:"Show the state of the running daemon"`
+	Scan   DaemonScanCmd   `cmd:"" help:"Queue an upload of local_dir now"`
+	Reload DaemonReloadCmd `cmd:"" help:"Make the running daemon re-read its config"`
+	Pause  DaemonPauseCmd  `cmd:"" help:"Stop the running daemon from starting jobs, letting running ones finish"`
+	Resume DaemonResumeCmd `cmd:"" help:"Start jobs again after pause"`
+}
+
+type DaemonRunCmd struct{}
+
+// server is a background listener started by the daemon
+type server interface {
+	Start()
+	Shutdown(ctx context.Context) error
+}
+
+// Run starts the daemon. path and profile locate the config so it can be
+// reloaded on SIGHUP or when the file changes, override reapplies the
+// command line flags to it.
+func (d *DaemonRunCmd) Run(cfg *config.Config, path, profile string, override func(*config.Config) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+
+	queue, err := jobs.Open(cfg.Jobs.Path, cfg.Jobs.MaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	retries, err := retry.Open(cfg.Retry.Path, cfg.Retry.MaxAttempts, cfg.Retry.DelayDuration)
+	if err != nil {
+		return err
+	}
+
+	marks, err := priority.Open(cfg.Priority.Path)
+	if err != nil {
+		return err
+	}
+
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	err = cl.Run(func(ctx context.Context) error {
+		// Job handlers are needed even without the HTTP API to drain the queue
+		api.RegisterJobHandlers(queue, cfg, store, cl, retries, marks)
+
+		notifier := notify.NewSwitch(notify.New(&cfg.Notify, &cfg.Bot, cl))
+		reload := newReloader(path, profile, cfg, override)
+		// Registered before the control socket can ask for a reload
+		reload.OnReload(func(cfg *config.Config) {
+			notifier.Set(notify.New(&cfg.Notify, &cfg.Bot, cl))
+			queue.SetMaxAttempts(cfg.Jobs.MaxAttempts)
+		})
+		control, err := api.NewControlServer(cfg.Daemon.Socket, cl, queue, reload.Reload)
+		if err != nil {
+			return err
+		}
+
+		servers := []server{control}
+		if cfg.HTTP.Enabled {
+			servers = append(servers, api.NewServer(cfg, store, cl, queue, marks))
+		} else {
+			servers = append(servers, api.NewHealthServer(cfg, cl, queue))
+		}
+		if cfg.WebDAV.Enabled {
+			servers = append(servers, gateway.NewWebDAVServer(&cfg.WebDAV, store, cl))
+		}
+		if cfg.S3.Enabled {
+			servers = append(servers, gateway.NewS3Server(cfg, store, cl))
+		}
+		if cfg.GRPC.Enabled {
+			servers = append(servers, api.NewGRPCServer(cfg, store, cl, queue))
+		}
+		for _, s := range servers {
+			s.Start()
+		}
+
+		p := pipeline.New(cl, &cfg.Mtproto, store)
+		if len(cfg.Feeds.Watch) > 0 {
+			watcher, err := feed.NewWatcher(&cfg.Feeds, cfg.Mtproto.StagingDir, p, queue)
+			if err != nil {
+				return err
+			}
+			go watcher.Run(ctx)
+		}
+
+		queue.OnFinish = func(job jobs.Job) {
+			switch job.State {
+			case jobs.StateDone:
+				text := fmt.Sprintf("✅ Job %d (%s) done", job.ID, job.Type)
+				if job.Type == "upload_local" {
+					// Like an uploader run, with its summary and quota warnings
+					text = notify.Truncate(text + "\n" + strings.Join(job.Result, "\n"))
+				}
+				notify.Send(notifier, text)
+			case jobs.StateFailed:
+				notify.Send(notifier, fmt.Sprintf("❌ Job %d (%s) failed after %d attempt(s) [%s]: %s",
+					job.ID, job.Type, job.Attempts, job.Category, job.Error))
+			}
+		}
+
+		if cfg.Retention.IntervalDuration > 0 && len(cfg.Retention.Rules) > 0 {
+			go pipeline.RunRetention(ctx, cl, store, &cfg.Retention)
+		}
+
+		go queue.Run(ctx)
+		go p.RunRetries(ctx, retries, marks, queue.Paused, func(e retry.Entry) {
+			notify.Send(notifier, fmt.Sprintf("❌ Upload of %s failed after %d attempt(s) [%s]: %s",
+				e.FileName, e.Attempts, e.Category, e.LastError))
+		})
+
+		go reload.Run(ctx)
+
+		logger.Info.Println("Daemon started, press Ctrl+C to stop")
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for _, s := range servers {
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				logger.Warn.Printf("Server shutdown failed: %v", err)
+			}
+		}
+		logger.Info.Println("Daemon stopped")
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
+
+type DaemonStatusCmd struct{}
+
+func (d *DaemonStatusCmd) Run(cfg *config.Config) error {
+	var st api.DaemonStatus
+	if err := daemonRequest(cfg, http.MethodGet, "/status", &st); err != nil {
+		return err
+	}
+
+	fmt.Println(messages.Text("cli.daemon_pid", st.PID, st.StartedAt.Format(time.DateTime)))
+	if st.Connected {
+		fmt.Println(messages.Text("cli.daemon_connected"))
+	} else {
+		fmt.Println(messages.Text("cli.daemon_disconnected", st.Error))
+	}
+	if st.Paused {
+		fmt.Println(messages.Text("cli.daemon_queue_paused", st.QueueDepth))
+	} else {
+		fmt.Println(messages.Text("cli.daemon_queue", st.QueueDepth))
+	}
+	for _, job := range st.Running {
+		fmt.Println(messages.Text("cli.daemon_job", job.ID, job.Type, job.Progress))
+	}
+	return nil
+}
+
+type DaemonScanCmd struct{}
+
+func (d *DaemonScanCmd) Run(cfg *config.Config) error {
+	var job jobs.Job
+	if err := daemonRequest(cfg, http.MethodPost, "/scan", &job); err != nil {
+		return err
+	}
+	fmt.Println(messages.Text("cli.daemon_scan", job.ID))
+	return nil
+}
+
+type DaemonReloadCmd struct{}
+
+func (d *DaemonReloadCmd) Run(cfg *config.Config) error {
+	var out struct{}
+	if err := daemonRequest(cfg, http.MethodPost, "/reload", &out); err != nil {
+		return err
+	}
+	fmt.Println(messages.Text("cli.daemon_reloaded"))
+	return nil
+}
+
+// pollInterval is how often `cli daemon pause --wait` checks the running jobs
+const pollInterval = 2 * time.Second
+
+type DaemonPauseCmd struct {
+	Wait bool `help:"Return once the running jobs finished, e.g. before a reboot"`
+}
+
+func (d *DaemonPauseCmd) Run(cfg *config.Config) error {
+	var st api.PauseState
+	if err := daemonRequest(cfg, http.MethodPost, "/pause", &st); err != nil {
+		return err
+	}
+	if st.Changed {
+		fmt.Println(messages.Text("cli.daemon_paused"))
+	} else {
+		fmt.Println(messages.Text("cli.daemon_already_paused"))
+	}
+	if !d.Wait {
+		return nil
+	}
+
+	waiting := -1
+	for {
+		var status api.DaemonStatus
+		if err := daemonRequest(cfg, http.MethodGet, "/status", &status); err != nil {
+			return err
+		}
+		if len(status.Running) == 0 {
+			fmt.Println(messages.Text("cli.daemon_idle"))
+			return nil
+		}
+		if len(status.Running) != waiting {
+			waiting = len(status.Running)
+			fmt.Println(messages.Text("cli.daemon_waiting", waiting))
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+type DaemonResumeCmd struct{}
+
+func (d *DaemonResumeCmd) Run(cfg *config.Config) error {
+	var st api.PauseState
+	if err := daemonRequest(cfg, http.MethodPost, "/resume", &st); err != nil {
+		return err
+	}
+	if st.Changed {
+		fmt.Println(messages.Text("cli.daemon_resumed"))
+	} else {
+		fmt.Println(messages.Text("cli.daemon_not_paused"))
+	}
+	return nil
+}
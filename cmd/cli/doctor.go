@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/dialer"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+// telegramDC is dialed to test the proxy (DC 2, the default production DC)
+const telegramDC = "149.154.167.50:443"
+
+// ConfigCmd groups config helpers
+type ConfigCmd struct {
+	Doctor DoctorCmd `cmd:"" help:"Validate the config and check directories, ffmpeg, proxy and MTProto"`
+	Secret SecretCmd `cmd:"" help:"Store a secret read from stdin in the OS keyring, for keyring:<name> values"`
+}
+
+// DoctorCmd reports everything that would make a real run fail
+type DoctorCmd struct {
+	Timeout time.Duration `help:"Timeout of the network checks" default:"30s"`
+}
+
+type doctor struct {
+	failed int
+}
+
+func (d *doctor) ok(name, format string, args ...any) {
+	fmt.Printf("✅ %-14s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(name, format string, args ...any) {
+	fmt.Printf("⚠️  %-14s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(name string, err error, hint string) {
+	d.failed++
+	fmt.Printf("❌ %-14s %v\n", name, err)
+	if hint != "" {
+		fmt.Printf("   %-14s → %s\n", "", hint)
+	}
+}
+
+// Run loads the config itself so that an invalid config is reported like
+// any other problem
+func (c *DoctorCmd) Run(path, profile string) error {
+	d := &doctor{}
+
+	if err := config.CheckKeys(path, profile); err != nil {
+		d.warn("config keys", "%v", err)
+	}
+	cfg, err := config.LoadProfile(path, profile)
+	if err != nil {
+		d.fail("config", err, "fix "+path+" (or the TG_ variables) and run again")
+	} else {
+		d.ok("config", "%s is valid", path)
+		if err := messages.SetLocale(cfg.Locale); err != nil {
+			return err
+		}
+	}
+
+	d.checkBinary("ffmpeg", "install ffmpeg and make sure it is in PATH")
+	d.checkBinary("ffprobe", "ffprobe ships with ffmpeg")
+
+	if cfg != nil {
+		d.checkDirs(cfg)
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		defer cancel()
+		resolver, err := client.Resolver(&cfg.Mtproto)
+		if err != nil {
+			d.fail("doh", err, "doh must be like https://1.1.1.1/dns-query")
+		}
+		d.checkProxy(ctx, "mtproto proxy", cfg.Mtproto.Proxy, resolver)
+		if cfg.Bot.Proxy != cfg.Mtproto.Proxy {
+			d.checkProxy(ctx, "bot proxy", cfg.Bot.Proxy, nil)
+		}
+		if cfg.Mtproto.Proxy == "" || cfg.Bot.Proxy == "" {
+			d.checkProxy(ctx, "environment proxy", dialer.EnvironmentProxy(), resolver)
+		}
+		d.checkMTProto(ctx, cfg)
+	}
+
+	if d.failed > 0 {
+		return fmt.Errorf("%d check(s) failed", d.failed)
+	}
+	fmt.Println(messages.Text("cli.doctor_passed"))
+	return nil
+}
+
+func (d *doctor) checkBinary(name, hint string) {
+	path, err := ffmpeg.LookPath(name)
+	if err != nil {
+		// Images and documents are still uploaded without it
+		d.warn(name, "%v, videos won't be processed (%s)", err, hint)
+		return
+	}
+	version, err := ffmpeg.Version(path)
+	if err != nil {
+		d.fail(name, err, hint)
+		return
+	}
+	d.ok(name, "%s", version)
+}
+
+func (d *doctor) checkDirs(cfg *config.Config) {
+	type dir struct {
+		name, path string
+		create     bool // created on demand, so only the parent must exist
+	}
+	dirs := []dir{
+		{"local_dir", cfg.Mtproto.LocalDir, false},
+		{"temp_dir", cfg.Mtproto.TempDir, true},
+		{"done_dir", cfg.Mtproto.DoneDir, true},
+		{"staging_dir", cfg.Mtproto.StagingDir, true},
+		{"index", filepath.Dir(cfg.Index.Path), true},
+		{"jobs", filepath.Dir(cfg.Jobs.Path), true},
+	}
+	if cfg.HTTP.Enabled {
+		dirs = append(dirs, dir{"download_dir", cfg.HTTP.DownloadDir, true})
+	}
+	if cfg.WebDAV.Enabled {
+		dirs = append(dirs, dir{"webdav cache", cfg.WebDAV.CacheDir, true})
+		dirs = append(dirs, dir{"webdav chunk cache", cfg.WebDAV.ChunkCacheDir, true})
+	}
+	if cfg.S3.Enabled {
+		dirs = append(dirs, dir{"s3 cache", cfg.S3.CacheDir, true})
+		dirs = append(dirs, dir{"s3 chunk cache", cfg.S3.ChunkCacheDir, true})
+	}
+
+	for _, dir := range dirs {
+		if err := checkWritable(dir.path, dir.create); err != nil {
+			d.fail(dir.name, err, "create the directory or fix its permissions")
+			continue
+		}
+		free, err := util.FreeSpace(dir.path)
+		if err != nil {
+			d.warn(dir.name, "%s (free space unknown: %v)", dir.path, err)
+			continue
+		}
+		detail := fmt.Sprintf("%s, %s free", dir.path, util.FormatBytesToHumanReadable(int64(free)))
+		if int64(free) < cfg.Mtproto.MaxSizeBytes*2 {
+			d.warn(dir.name, "%s; less than twice max_size, splitting large videos may fail", detail)
+			continue
+		}
+		d.ok(dir.name, "%s", detail)
+	}
+}
+
+// checkWritable creates dir if allowed and verifies a file can be written
+func checkWritable(dir string, create bool) error {
+	if create {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	} else if fi, err := os.Stat(dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (d *doctor) checkProxy(ctx context.Context, name, proxyURL string, resolver *dialer.Resolver) {
+	if proxyURL == "" || proxyURL == "direct" {
+		return
+	}
+	dial, err := dialer.CreateProxyDialerFromURL(proxyURL, resolver)
+	if err != nil {
+		d.fail(name, err, "proxy must be socks5://, http:// or https://")
+		return
+	}
+	conn, err := dial.DialContext(ctx, "tcp", telegramDC)
+	if err != nil {
+		d.fail(name, fmt.Errorf("can't reach Telegram through %s: %w", proxyURL, err), "check that the proxy is running")
+		return
+	}
+	conn.Close()
+	d.ok(name, "reached Telegram through %s", proxyURL)
+}
+
+func (d *doctor) checkMTProto(ctx context.Context, cfg *config.Config) {
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		d.fail("mtproto", err, "")
+		return
+	}
+
+	err = cl.RunWithoutLogin(func(ctx context.Context) error {
+		authorized, err := cl.Authorized(ctx)
+		if err != nil {
+			return err
+		}
+		if !authorized {
+			return errs.ErrAuthRequired
+		}
+		d.ok("mtproto", "connected, session %s is logged in", cfg.Mtproto.SessionFile)
+
+		if _, err := cl.ResolvePeer(cfg.Mtproto.StorageChatID); err != nil {
+			d.fail("storage chat", err, "")
+			return nil
+		}
+		d.ok("storage chat", "%d resolved", cfg.Mtproto.StorageChatID)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errs.ErrAuthRequired):
+		d.fail("mtproto", err, "run `cli history -c <chat id>` once to log in interactively")
+	case errors.Is(err, errs.ErrSessionInUse):
+		d.warn("mtproto", "not checked, %v", err)
+	case err != nil:
+		d.fail("mtproto", err, "check api_id/api_hash, the proxy and network access")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// DownloadCmd downloads the media of a message, or a byte range of it
+type DownloadCmd struct {
+	ChatID    int64  `help:"Chat ID, the storage chat by default" short:"c"`
+	MessageID int    `help:"Message ID" short:"m" required:"true"`
+	Offset    int64  `help:"First byte to download"`
+	Length    int64  `help:"Bytes to download from --offset, all up to the end by default"`
+	Out       string `help:"File to write, the name of the media in the current directory by default" short:"o"`
+}
+
+func (d *DownloadCmd) Run(cfg *config.Config) error {
+	if d.Offset < 0 || d.Length < 0 {
+		return errors.New("--offset and --length can't be negative")
+	}
+	chatID := d.ChatID
+	if chatID == 0 {
+		chatID = cfg.Mtproto.StorageChatID
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	err = cl.Run(func(ctx context.Context) error {
+		msgs, err := cl.GetMessages(chatID, []int{d.MessageID})
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return fmt.Errorf("message %d not found in chat %d", d.MessageID, chatID)
+		}
+		out := d.Out
+		if out == "" {
+			out = client.MediaName(msgs[0])
+		}
+
+		if d.Offset == 0 && d.Length == 0 {
+			if err := cl.DownloadMessageMediaTo(msgs[0], out); err != nil {
+				return err
+			}
+			// Known from the caption with caption_mtime
+			pipeline.SetModTime(out, fileprocessor.CaptionModTime(msgs[0].Message))
+		} else {
+			length := d.Length
+			if length == 0 {
+				length = -1
+			}
+			f, err := os.Create(out)
+			if err != nil {
+				return err
+			}
+			if err := cl.DownloadRange(msgs[0], d.Offset, length, f); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+		logger.Info.Printf("Downloaded message %d to %s", d.MessageID, out)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
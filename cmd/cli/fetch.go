@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fetch"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// FetchCmd downloads a remote file and uploads it to the storage chat
+type FetchCmd struct {
+	URL  string `help:"HTTP(S) URL of the file" name:"url" required:"true"`
+	Tag  string `help:"Tag" short:"t" required:"true"`
+	Desc string `help:"Description" short:"d" required:"true"`
+}
+
+func (f *FetchCmd) Run(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Staged outside temp_dir, which ProcessVideo cleans, so it can resume
+	path, err := fetch.Download(ctx, f.URL, filepath.Join(cfg.Mtproto.StagingDir, "fetch"))
+	if err != nil {
+		return err
+	}
+
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	err = cl.Run(func(ctx context.Context) error {
+		entry, err := pipeline.New(cl, &cfg.Mtproto, store).Upload(path, f.Tag, f.Desc, "fetch")
+		if err != nil {
+			return err
+		}
+		logger.Info.Printf("Uploaded %s as index entry %d", filepath.Base(path), entry.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+
+	if err := fetch.RemoveStaged(path); err != nil {
+		logger.Warn.Printf("Failed to remove downloaded file %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// ImportCmd copies media the account can already see in another chat into
+// the storage chat by reference and indexes it
+type ImportCmd struct {
+	ChatID     int64  `help:"Chat ID the media is in" short:"c" required:"true"`
+	MessageIDs []int  `help:"Message IDs, each imported as its own item" short:"m" required:"true" name:"message-ids"`
+	Tag        string `help:"Tag" short:"t" default:"inbox"`
+	Desc       string `help:"Description, the caption, file name or date of the media by default" short:"d"`
+}
+
+func (i *ImportCmd) Run(cfg *config.Config) error {
+	tag := fileprocessor.SanitizeTag(i.Tag, false)
+	if tag == "" {
+		return fmt.Errorf("invalid tag %q", i.Tag)
+	}
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	err = cl.Run(func(ctx context.Context) error {
+		entries, err := pipeline.New(cl, &cfg.Mtproto, store).Import(i.ChatID, i.MessageIDs, tag, i.Desc)
+		for _, entry := range entries {
+			logger.Info.Printf("Imported %s as index entry %d", entry.Caption, entry.ID)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"tg-storage-assistant/internal/catalog"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/internal/util"
+)
+
+// getMessagesLimit is how many messages Telegram returns per request
+const getMessagesLimit = 100
+
+// IndexCmd maintains the media index
+type IndexCmd struct {
+	Rebuild    IndexRebuildCmd    `cmd:"" help:"Write a new index from the history of the storage chat"`
+	ExportHTML IndexExportHTMLCmd `cmd:"" name:"export-html" help:"Write the index as a browsable HTML page"`
+	Usage      IndexUsageCmd      `cmd:"" help:"Show the bytes stored per chat against the quota"`
+}
+
+type IndexUsageCmd struct{}
+
+func (u *IndexUsageCmd) Run(cfg *config.Config) error {
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+	usage := store.Usage()
+	chats := append([]int64{cfg.Mtproto.StorageChatID}, cfg.Mtproto.Mirrors...)
+	for id := range usage {
+		if !slices.Contains(chats, id) {
+			chats = append(chats, id)
+		}
+	}
+	for _, id := range chats {
+		line := fmt.Sprintf("%-16d %s", id, util.FormatBytesToHumanReadable(usage[id]))
+		if quota := cfg.Mtproto.QuotaBytes; quota > 0 {
+			line += fmt.Sprintf(" of %s (%.0f%%)", cfg.Mtproto.Quota, float64(usage[id])*100/float64(quota))
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+type IndexRebuildCmd struct {
+	ChatID int64 `help:"Chat to read (defaults to mtproto.storage_chat_id)" short:"c"`
+	Force  bool  `help:"Replace an index that already has entries"`
+}
+
+func (r *IndexRebuildCmd) Run(cfg *config.Config) error {
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+	if _, total := store.Search(index.Query{}); total > 0 && !r.Force {
+		return fmt.Errorf("index %s has %d entries, pass --force to replace them", cfg.Index.Path, total)
+	}
+	chatID := r.ChatID
+	if chatID == 0 {
+		chatID = cfg.Mtproto.StorageChatID
+	}
+
+	cl, err := client.NewClient(context.Background(), &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+	err = cl.Run(func(ctx context.Context) error {
+		logger.Info.Printf("Reading the history of chat %d...", chatID)
+		entries, err := pipeline.RebuildIndex(cl, chatID)
+		if err != nil {
+			return err
+		}
+		if err := store.Replace(entries); err != nil {
+			return err
+		}
+		logger.Info.Printf("Wrote %d entries to %s", len(entries), cfg.Index.Path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
+
+type IndexExportHTMLCmd struct {
+	Out      string `help:"HTML file to write" short:"o" default:"catalog.html"`
+	Tag      string `help:"Only export the media with this tag"`
+	Title    string `help:"Page title" default:"TG Storage"`
+	NoThumbs bool   `help:"Don't download previews from Telegram" name:"no-thumbs"`
+}
+
+func (e *IndexExportHTMLCmd) Run(cfg *config.Config) error {
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+	entries, _ := store.Search(index.Query{Tag: e.Tag})
+	items := make([]catalog.Item, len(entries))
+	for i, entry := range entries {
+		items[i].Entry = entry
+	}
+
+	if !e.NoThumbs {
+		cl, err := client.NewClient(context.Background(), &cfg.Mtproto)
+		if err != nil {
+			return fmt.Errorf("new client failed: %w", err)
+		}
+		err = cl.Run(func(ctx context.Context) error {
+			return downloadThumbs(cl, items)
+		})
+		if err != nil {
+			return fmt.Errorf("run failed: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := catalog.Write(&buf, e.Title, items); err != nil {
+		return err
+	}
+	tmp := e.Out + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := util.ReplaceFile(tmp, e.Out); err != nil {
+		return err
+	}
+	logger.Info.Printf("Wrote %d media to %s", len(items), e.Out)
+	return nil
+}
+
+// downloadThumbs fills in the previews of items, fetching their messages a
+// page at a time. Missing previews are only logged.
+func downloadThumbs(cl *client.Client, items []catalog.Item) error {
+	byChat := make(map[int64][]int)
+	wanted := make(map[int64]map[int]*catalog.Item)
+	for i := range items {
+		item := &items[i]
+		id := catalog.PreviewID(item.Entry)
+		if id == 0 {
+			continue
+		}
+		if wanted[item.ChatID] == nil {
+			wanted[item.ChatID] = make(map[int]*catalog.Item)
+		}
+		byChat[item.ChatID] = append(byChat[item.ChatID], id)
+		wanted[item.ChatID][id] = item
+	}
+
+	done := 0
+	for chatID, ids := range byChat {
+		for len(ids) > 0 {
+			page := ids[:min(len(ids), getMessagesLimit)]
+			ids = ids[len(page):]
+			msgs, err := cl.GetMessages(chatID, page)
+			if err != nil {
+				return err
+			}
+			for _, msg := range msgs {
+				item := wanted[chatID][msg.ID]
+				if item == nil {
+					continue
+				}
+				thumb, err := cl.DownloadThumbnail(msg)
+				if err != nil {
+					logger.Warn.Printf("No preview of media %d - %v", item.ID, err)
+					continue
+				}
+				item.Thumb = thumb
+				done++
+			}
+		}
+	}
+	logger.Info.Printf("Downloaded %d previews", done)
+	return nil
+}
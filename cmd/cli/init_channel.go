@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/messages"
+)
+
+// InitChannelCmd creates the storage channel and records it in the config
+type InitChannelCmd struct {
+	Title string `help:"Title of the new channel" required:"true"`
+	About string `help:"Channel description"`
+	Bot   string `help:"@username of a bot to add as admin"`
+	Force bool   `help:"Replace a storage_chat_id that is already set"`
+}
+
+// Run loads the config itself: storage_chat_id may not be set yet
+func (c *InitChannelCmd) Run(path, profile string) error {
+	cfg, err := config.LoadForSetup(path, profile)
+	if err != nil {
+		return err
+	}
+	if err := messages.SetLocale(cfg.Locale); err != nil {
+		return err
+	}
+	if id := cfg.Mtproto.StorageChatID; id != 0 && !c.Force {
+		return fmt.Errorf("storage_chat_id is already set to %d, pass --force to create a new channel anyway", id)
+	}
+	if c.Bot != "" && !strings.HasPrefix(c.Bot, "@") {
+		c.Bot = "@" + c.Bot
+	}
+
+	ctx := context.Background()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	var chatID int64
+	err = cl.Run(func(ctx context.Context) error {
+		id, err := cl.CreateChannel(c.Title, c.About)
+		if err != nil {
+			return err
+		}
+		chatID = id
+		logger.Info.Printf("Created channel %q (%d)", c.Title, chatID)
+		if c.Bot == "" {
+			return nil
+		}
+		bot, err := cl.ResolveUsername(c.Bot)
+		if err != nil {
+			return err
+		}
+		if err := cl.AddAdmin(chatID, bot, client.BotAdminRights, ""); err != nil {
+			return err
+		}
+		logger.Info.Printf("Added %s as admin", c.Bot)
+		return nil
+	})
+	if err != nil {
+		if chatID != 0 {
+			return fmt.Errorf("channel %d created, but: %w", chatID, err)
+		}
+		return fmt.Errorf("run failed: %w", err)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Println(messages.Text("cli.init_no_config", path, chatID))
+		return nil
+	}
+	old, err := config.SetStorageChatID(path, profile, chatID)
+	if err != nil {
+		return fmt.Errorf("channel %d created, but updating the config failed: %w", chatID, err)
+	}
+	if old != "" {
+		fmt.Println(messages.Text("cli.init_set_was", chatID, path, old))
+	} else {
+		fmt.Println(messages.Text("cli.init_set", chatID, path))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/notify"
+)
+
+// InviteBotCmd adds the bot of bot.token to the storage channel as an admin
+type InviteBotCmd struct {
+	Rank string `help:"Custom admin title shown in the channel"`
+}
+
+func (c *InviteBotCmd) Run(cfg *config.Config) error {
+	username, err := notify.BotUsername(&cfg.Bot)
+	if err != nil {
+		return fmt.Errorf("looking up the bot failed: %w", err)
+	}
+
+	ctx := context.Background()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	err = cl.Run(func(ctx context.Context) error {
+		bot, err := cl.ResolveUsername(username)
+		if err != nil {
+			return err
+		}
+		return cl.AddAdmin(cfg.Mtproto.StorageChatID, bot, client.BotAdminRights, c.Rank)
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	logger.Info.Printf("@%s is now an admin of the storage chat %d", username, cfg.Mtproto.StorageChatID)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/messages"
+	"time"
+)
+
+// JobsCmd manages the job queue of a running daemon through its control socket
+type JobsCmd struct {
+	List   JobsListCmd   `cmd:"" help:"List queued, running and finished jobs"`
+	Cancel JobsCancelCmd `cmd:"" help:"Cancel a queued or running job"`
+}
+
+type JobsListCmd struct{}
+
+type JobsCancelCmd struct {
+	ID int64 `arg:"" help:"Job ID"`
+}
+
+func (j *JobsListCmd) Run(cfg *config.Config) error {
+	var list []jobs.Job
+	if err := daemonRequest(cfg, http.MethodGet, "/jobs", &list); err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		fmt.Println(messages.Text("cli.jobs_empty"))
+		return nil
+	}
+	for _, job := range list {
+		line := fmt.Sprintf("#%-5d %-9s %-8s prio=%-3d attempts=%d/%d updated=%s",
+			job.ID, job.Type, job.State, job.Priority, job.Attempts, job.MaxAttempts,
+			job.UpdatedAt.Format(time.DateTime))
+		if job.Error != "" {
+			line += " error=" + job.Error
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func (j *JobsCancelCmd) Run(cfg *config.Config) error {
+	var job jobs.Job
+	if err := daemonRequest(cfg, http.MethodPost, fmt.Sprintf("/jobs/%d/cancel", j.ID), &job); err != nil {
+		return err
+	}
+	fmt.Println(messages.Text("cli.job_state", job.ID, job.State))
+	return nil
+}
+
+// daemonRequest calls the control socket of the running daemon and decodes
+// the JSON response
+func daemonRequest(cfg *config.Config, method, path string, out any) error {
+	socket := cfg.Daemon.Socket
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	// The host is ignored, every request goes to the socket
+	req, err := http.NewRequest(method, "http://daemon"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("daemon not reachable on %s, is `cli daemon` running? %w", socket, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("daemon returned %s: %s", resp.Status, apiErr.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
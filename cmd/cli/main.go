@@ -2,18 +2,53 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"tg-storage-assistant/internal/client"
 	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/ui"
 
 	"github.com/alecthomas/kong"
 )
 
 type CLI struct {
-	Config string `help:"Path to config file" short:"f" default:"config.yaml"`
+	Config   string `help:"Path to config file" short:"f" default:"config.yaml"`
+	Profile  string `help:"Named profile from the profiles section of the config" short:"p"`
+	LogLevel string `help:"Override logging.level (debug, info, warn, error)" name:"log-level"`
+	Progress string `help:"Progress output: auto, bars, plain or off (overrides logging.progress)"`
+	Quiet    bool   `help:"Disable progress output, same as --progress=off" short:"q"`
+	Wait     bool   `help:"Wait for another process using the session file to finish instead of failing"`
+	Preview  string `help:"Contact sheets of videos: full, only (without the video) or none (overrides mtproto.preview and the rules)" enum:",full,only,none" default:""`
 
-	History HistoryCmd `cmd:"" help:"Show history of chat"`
+	ProgressJSON string `help:"Write JSON progress events to - (stdout) or a unix socket path (overrides logging.progress_json)" name:"progress-json"`
+
+	History   HistoryCmd   `cmd:"" help:"Show history of chat"`
+	Daemon    DaemonCmd    `cmd:"" help:"Run the long-lived assistant (HTTP API, WebDAV and S3 gateways)"`
+	Jobs      JobsCmd      `cmd:"" help:"Manage the daemon job queue"`
+	Queue     QueueCmd     `cmd:"" help:"Show the upload order of jobs and local_dir, and mark files to upload first"`
+	Fetch     FetchCmd     `cmd:"" help:"Download a file from a URL and upload it"`
+	Upload    UploadCmd    `cmd:"" help:"Upload a file piped into standard input"`
+	Cat       CatCmd       `cmd:"" help:"Write the media of a message to standard output"`
+	Download  DownloadCmd  `cmd:"" help:"Download the media of a message, or a byte range of it"`
+	Save      SaveCmd      `cmd:"" help:"Save an online video with yt-dlp and upload it"`
+	Share     ShareCmd     `cmd:"" help:"Send archived media or a local photo or video to someone, optionally self-destructing"`
+	Import    ImportCmd    `cmd:"" help:"Copy media of another chat into the storage chat without downloading it"`
+	Restore   RestoreCmd   `cmd:"" help:"Download archived media back into a directory with their original names"`
+	Index     IndexCmd     `cmd:"" help:"Maintain the media index"`
+	Retention RetentionCmd `cmd:"" help:"Delete old media by the retention rules"`
+	Stats     StatsCmd     `cmd:"" help:"Show monthly upload statistics"`
+	Session   SessionCmd   `cmd:"" help:"List and restore backups of the session file"`
+	Sessions  SessionsCmd  `cmd:"" help:"List and terminate the sessions logged in to the account"`
+	NetTest   NetTestCmd   `cmd:"" name:"net-test" help:"Measure latency to the Telegram DCs and upload and download speed"`
+	Cfg       ConfigCmd    `cmd:"" name:"config" help:"Check the configuration"`
+
+	InitChannel InitChannelCmd `cmd:"" name:"init-channel" help:"Create a private storage channel and write its ID to the config"`
+	InviteBot   InviteBotCmd   `cmd:"" name:"invite-bot" help:"Add the bot of bot.token to the storage channel as an admin"`
 }
 
 type HistoryCmd struct {
@@ -22,29 +57,211 @@ type HistoryCmd struct {
 	Limit    int   `help:"Limit" short:"l" default:"20"`
 }
 
+// override applies the flags that take precedence over the config file,
+// after it is loaded and again after every reload of the daemon
+func (c *CLI) override(cfg *config.Config) error {
+	cfg.Mtproto.SessionWait = c.Wait
+	cfg.Mtproto.PreviewFlag = c.Preview
+	if c.LogLevel != "" {
+		level, err := logger.ParseLevel(c.LogLevel)
+		if err != nil {
+			return err
+		}
+		logger.SetLevel(level)
+	}
+	return nil
+}
+
 func main() {
 	var cli CLI
 	ctx := kong.Parse(&cli)
 
-	cfg, err := config.LoadConfig(cli.Config)
+	// The doctor reports config errors itself instead of failing on load
+	if ctx.Command() == "config doctor" {
+		if err := cli.Cfg.Doctor.Run(cli.Config, cli.Profile); err != nil {
+			exit(err)
+		}
+		return
+	}
+	// Secrets are stored before the config that refers to them can load
+	if ctx.Command() == "config secret <name>" {
+		if err := cli.Cfg.Secret.Run(); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	// The storage chat is created before the config can be complete
+	if ctx.Command() == "init-channel" {
+		if err := cli.InitChannel.Run(cli.Config, cli.Profile); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	cfg, err := config.LoadProfile(cli.Config, cli.Profile)
 	if err != nil {
-		log.Fatal(err)
+		exit(err)
+	}
+	if err := cli.override(cfg); err != nil {
+		exit(err)
+	}
+	if err := messages.SetLocale(cfg.Locale); err != nil {
+		exit(err)
+	}
+
+	progress := cfg.Logging.Progress
+	if cli.Progress != "" {
+		progress = cli.Progress
 	}
+	if cli.Quiet {
+		progress = string(ui.ProgressOff)
+	}
+	progressJSON := cfg.Logging.ProgressJSON
+	if cli.ProgressJSON != "" {
+		progressJSON = cli.ProgressJSON
+	}
+	if ctx.Command() == "cat" && progressJSON == "-" {
+		exit(errors.New("cat writes the media to stdout, progress events can't go there too"))
+	}
+	if err := ui.Setup(ui.ProgressMode(progress), progressJSON); err != nil {
+		exit(err)
+	}
+	defer ui.CloseEvents()
 
 	switch ctx.Command() {
 	case "history":
 		if err := cli.History.Run(&cfg.Mtproto); err != nil {
-			log.Fatal(err)
+			exit(err)
+		}
+	case "daemon run":
+		if err := cli.Daemon.Start.Run(cfg, cli.Config, cli.Profile, cli.override); err != nil {
+			exit(err)
+		}
+	case "session list":
+		if err := cli.Session.List.Run(&cfg.Mtproto); err != nil {
+			exit(err)
+		}
+	case "session restore", "session restore <n>":
+		if err := cli.Session.Restore.Run(&cfg.Mtproto); err != nil {
+			exit(err)
+		}
+	case "net-test":
+		if err := cli.NetTest.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "sessions list":
+		if err := cli.Sessions.List.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "sessions terminate", "sessions terminate <hashes>":
+		if err := cli.Sessions.Terminate.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "daemon status":
+		if err := cli.Daemon.Status.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "daemon scan":
+		if err := cli.Daemon.Scan.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "daemon reload":
+		if err := cli.Daemon.Reload.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "daemon pause":
+		if err := cli.Daemon.Pause.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "daemon resume":
+		if err := cli.Daemon.Resume.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "jobs list":
+		if err := cli.Jobs.List.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "jobs cancel <id>":
+		if err := cli.Jobs.Cancel.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "queue":
+		if err := cli.Queue.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "fetch":
+		if err := cli.Fetch.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "upload":
+		if err := cli.Upload.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "cat":
+		if err := cli.Cat.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "download":
+		if err := cli.Download.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "save <url>":
+		if err := cli.Save.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "share <source>":
+		if err := cli.Share.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "import":
+		if err := cli.Import.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "restore", "restore <ids>":
+		if err := cli.Restore.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "index rebuild":
+		if err := cli.Index.Rebuild.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "index usage":
+		if err := cli.Index.Usage.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "index export-html":
+		if err := cli.Index.ExportHTML.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "retention apply":
+		if err := cli.Retention.Apply.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "stats":
+		if err := cli.Stats.Run(cfg); err != nil {
+			exit(err)
+		}
+	case "invite-bot":
+		if err := cli.InviteBot.Run(cfg); err != nil {
+			exit(err)
 		}
 	}
 }
 
+// exit logs err and exits with its errs.ExitCode, so wrapper scripts can
+// tell login problems from transient failures
+func exit(err error) {
+	log.Print(err)
+	os.Exit(errs.ExitCode(err))
+}
+
 func (h *HistoryCmd) Run(cfg *config.MtprotoConfig) error {
 	ctx := context.Background()
 
 	cl, err := client.NewClient(ctx, cfg)
 	if err != nil {
-		log.Fatalf("new client failed: %v", err)
+		return fmt.Errorf("new client failed: %w", err)
 	}
 
 	err = cl.Run(func(ctx context.Context) error {
@@ -57,11 +274,11 @@ func (h *HistoryCmd) Run(cfg *config.MtprotoConfig) error {
 		}
 
 		if len(msgs) == 0 {
-			fmt.Println("no messages found")
+			fmt.Println(messages.Text("cli.history_empty"))
 			return nil
 		}
 
-		fmt.Printf("page has %d messages\n", len(msgs))
+		fmt.Println(messages.Text("cli.history_page", len(msgs)))
 		for _, m := range msgs {
 			// t := time.Unix(int64(m.Date), 0)
 			fmt.Println(m.Message)
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/util"
+	"time"
+
+	"github.com/gotd/td/telegram/dcs"
+	"golang.org/x/net/proxy"
+)
+
+// NetTestCmd measures how well Telegram can be reached, directly and through
+// the proxy, to help choose between proxies
+type NetTestCmd struct {
+	Tries    int    `help:"Connections per DC, the fastest counts" default:"3"`
+	Timeout  int    `help:"Seconds to wait for one connection" default:"5"`
+	Size     string `help:"Size of the test file sent to the storage chat and downloaded again" default:"4MB"`
+	NoUpload bool   `help:"Only measure connect latency" name:"no-upload"`
+}
+
+func (n *NetTestCmd) Run(cfg *config.Config) error {
+	size, err := util.ParseSize(n.Size)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("invalid --size %q", n.Size)
+	}
+	through, proxyURL, err := client.ProxyDialer(&cfg.Mtproto)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	columns := strings.Fields(messages.Text("cli.net_test_columns"))
+	header := fmt.Sprintf("%-4s %-16s %10s", columns[0], columns[1], columns[2])
+	if through != nil {
+		header += fmt.Sprintf("  %s", proxyURL)
+	}
+	fmt.Println(header)
+	for _, dc := range productionDCs() {
+		line := fmt.Sprintf("%-4d %-16s %10s", dc.ID, dc.IPAddress, n.latency(ctx, &net.Dialer{}, dc))
+		if through != nil {
+			line += fmt.Sprintf("  %s", n.latency(ctx, through, dc))
+		}
+		fmt.Println(line)
+	}
+	if n.NoUpload {
+		return nil
+	}
+
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+	err = cl.Run(func(ctx context.Context) error {
+		return transferTest(cl, cfg.Mtproto.StorageChatID, size)
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
+
+// productionDCs returns one IPv4 address of each production DC
+func productionDCs() []dcAddr {
+	var list []dcAddr
+	seen := make(map[int]bool)
+	for _, o := range dcs.Prod().Options {
+		if o.Ipv6 || o.MediaOnly || o.CDN || o.TCPObfuscatedOnly || seen[o.ID] {
+			continue
+		}
+		seen[o.ID] = true
+		list = append(list, dcAddr{ID: o.ID, IPAddress: o.IPAddress, Port: o.Port})
+	}
+	slices.SortFunc(list, func(a, b dcAddr) int { return a.ID - b.ID })
+	return list
+}
+
+type dcAddr struct {
+	ID        int
+	IPAddress string
+	Port      int
+}
+
+// latency is the fastest of the TCP connects to dc through d, or why they
+// all failed
+func (n *NetTestCmd) latency(ctx context.Context, d proxy.ContextDialer, dc dcAddr) string {
+	addr := net.JoinHostPort(dc.IPAddress, strconv.Itoa(dc.Port))
+	var best time.Duration
+	var lastErr error
+	for range max(n.Tries, 1) {
+		dialCtx, cancel := context.WithTimeout(ctx, time.Duration(n.Timeout)*time.Second)
+		start := time.Now()
+		conn, err := d.DialContext(dialCtx, "tcp", addr)
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn.Close()
+		if best == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	if best == 0 {
+		return messages.Text("cli.net_test_failed", lastErr)
+	}
+	return best.Round(time.Millisecond).String()
+}
+
+// transferTest sends size random bytes to the storage chat as a document,
+// downloads it again and deletes it, reporting the throughput both ways
+func transferTest(cl *client.Client, chatID, size int64) error {
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		return fmt.Errorf("resolve peer: %w", err)
+	}
+
+	start := time.Now()
+	file, _, err := cl.UploadStream(io.LimitReader(rand.Reader, size), "net-test.bin")
+	if err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+	up := time.Since(start)
+	msgID, err := cl.SendDocument(peer, file, "net-test.bin", "")
+	if err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	defer func() {
+		if err := cl.DeleteMessages(chatID, []int{msgID}); err != nil {
+			logger.Warn.Printf("Failed to delete the test message %d: %v", msgID, err)
+		}
+	}()
+
+	msgs, err := cl.GetMessages(chatID, []int{msgID})
+	if err != nil {
+		return fmt.Errorf("get the test message: %w", err)
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("the test message %d is gone", msgID)
+	}
+	start = time.Now()
+	if err := cl.StreamMessageMedia(msgs[0], io.Discard); err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	down := time.Since(start)
+
+	fmt.Printf("\n%s\n", messages.Text("cli.net_test_upload", util.FormatBytesToHumanReadable(size), up.Round(time.Millisecond), throughput(size, up)))
+	fmt.Println(messages.Text("cli.net_test_download", util.FormatBytesToHumanReadable(size), down.Round(time.Millisecond), throughput(size, down)))
+	return nil
+}
+
+func throughput(size int64, d time.Duration) string {
+	return util.FormatBytesToHumanReadable(int64(float64(size) / max(d.Seconds(), 0.001)))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/internal/priority"
+	"tg-storage-assistant/internal/util"
+)
+
+// QueueCmd shows what the daemon and the next upload run work on, in
+// order, and marks files of local_dir to upload first
+type QueueCmd struct {
+	Prioritize   []string `help:"Upload these files of local_dir before the others" short:"p"`
+	Unprioritize []string `help:"Remove the mark of --prioritize" short:"u"`
+}
+
+func (q *QueueCmd) Run(cfg *config.Config) error {
+	marks, err := priority.Open(cfg.Priority.Path)
+	if err != nil {
+		return err
+	}
+	for _, name := range q.Prioritize {
+		name = filepath.Base(name)
+		if _, err := os.Stat(filepath.Join(cfg.Mtproto.LocalDir, name)); err != nil {
+			return fmt.Errorf("%s is not in local_dir", name)
+		}
+		if err := marks.Mark(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range q.Unprioritize {
+		if err := marks.Unmark(filepath.Base(name)); err != nil {
+			return err
+		}
+	}
+
+	// Without a running daemon only local_dir is shown
+	var list []jobs.Job
+	if err := daemonRequest(cfg, http.MethodGet, "/jobs", &list); err == nil {
+		pending := jobs.RunOrder(list)
+		if len(pending) > 0 {
+			fmt.Println(messages.Text("cli.queue_jobs"))
+		}
+		for _, job := range pending {
+			fmt.Printf("  #%-5d %-12s %-8s prio=%d\n", job.ID, job.Type, job.State, job.Priority)
+		}
+	}
+
+	files, err := pipeline.LocalQueue(&cfg.Mtproto, marks)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println(messages.Text("cli.queue_empty"))
+		return nil
+	}
+	fmt.Println(messages.Text("cli.queue_files", len(files)))
+	for i, f := range files {
+		mark := " "
+		if f.Priority {
+			mark = "⚡"
+		}
+		fmt.Printf("  %4d %s %s (%s)\n", i+1, mark, f.Name, util.FormatBytesToHumanReadable(f.Size))
+	}
+	return nil
+}
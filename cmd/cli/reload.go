@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/logger"
+	"time"
+)
+
+// reloadPollInterval is how often the daemon checks the config file for changes
+const reloadPollInterval = 5 * time.Second
+
+// reloadable lists the config sections applied without a restart. Changes
+// to any other section are only logged.
+var reloadable = map[string]bool{
+	"logging": true,
+	"notify":  true,
+	"jobs":    true, // max_attempts only, see restartRequired
+}
+
+// reloader re-reads the config on SIGHUP (where supported), when the file
+// changes or when asked over the control socket, and hands the new config to
+// the apply hooks. The MTProto session and listeners are left untouched.
+type reloader struct {
+	mu       sync.Mutex
+	path     string
+	profile  string
+	override func(cfg *config.Config) error // command line flags, applied after each load
+	current  *config.Config
+	modTime  time.Time
+	apply    []func(cfg *config.Config)
+}
+
+func newReloader(path, profile string, cfg *config.Config, override func(cfg *config.Config) error) *reloader {
+	r := &reloader{path: path, profile: profile, override: override, current: cfg}
+	r.modTime, _ = r.stat()
+	return r
+}
+
+// OnReload registers fn to apply a reloaded config
+func (r *reloader) OnReload(fn func(cfg *config.Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apply = append(r.apply, fn)
+}
+
+func (r *reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	notifyReload(hup)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(reloadPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.Reload()
+		case <-ticker.C:
+			r.mu.Lock()
+			modTime, err := r.stat()
+			changed := err == nil && !modTime.Equal(r.modTime)
+			if changed {
+				r.modTime = modTime
+			}
+			r.mu.Unlock()
+			if changed {
+				r.Reload()
+			}
+		}
+	}
+}
+
+func (r *reloader) stat() (time.Time, error) {
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// Reload applies the config file now. A config that fails to load is
+// logged and returned, and the current one is kept.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.LoadProfile(r.path, r.profile)
+	if err != nil {
+		logger.Warn.Printf("Config reload failed, keeping the current config: %v", err)
+		return err
+	}
+	if err := r.override(cfg); err != nil {
+		return err
+	}
+
+	for _, section := range restartRequired(r.current, cfg) {
+		logger.Warn.Printf("Config reload: %s changed, restart the daemon to apply it", section)
+	}
+	for _, fn := range r.apply {
+		fn(cfg)
+	}
+	r.current = cfg
+	logger.Info.Printf("Config reloaded from %s", r.path)
+	return nil
+}
+
+// restartRequired returns the changed sections that can't be reloaded
+func restartRequired(old, cfg *config.Config) []string {
+	oldJobs, newJobs := old.Jobs, cfg.Jobs
+	oldJobs.MaxAttempts, newJobs.MaxAttempts = 0, 0
+
+	var changed []string
+	if oldJobs != newJobs {
+		changed = append(changed, "jobs.path")
+	}
+
+	ov, nv := reflect.ValueOf(*old), reflect.ValueOf(*cfg)
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		section := t.Field(i).Tag.Get("yaml")
+		if reloadable[section] {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, section)
+		}
+	}
+	return changed
+}
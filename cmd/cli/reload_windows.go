@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyReload is a no-op: Windows has no SIGHUP, the config file is polled
+func notifyReload(c chan<- os.Signal) {}
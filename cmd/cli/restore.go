@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// RestoreCmd downloads archived media back into a directory tree
+type RestoreCmd struct {
+	IDs       []int64 `arg:"" optional:"" name:"ids" help:"Media IDs from the index"`
+	All       bool    `help:"Restore every media in the index"`
+	Tag       string  `help:"Restore the media with this tag"`
+	Out       string  `help:"Directory to restore into" required:"true"`
+	Overwrite bool    `help:"Download files that already exist in --out again"`
+}
+
+func (r *RestoreCmd) Run(cfg *config.Config) error {
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+	entries, err := r.entries(store)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	var failures []error
+	err = cl.Run(func(ctx context.Context) error {
+		// Newest first: of several uploads under one name (S3 overwrites),
+		// the latest is restored
+		seen := make(map[string]bool)
+		restored, skipped := 0, 0
+		for i, entry := range entries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			rel, err := pipeline.RestorePath(entry)
+			if err != nil {
+				failures = append(failures, err)
+				continue
+			}
+			if seen[rel] {
+				continue
+			}
+			seen[rel] = true
+
+			path, err := pipeline.Restore(cl, entry, r.Out, r.Overwrite)
+			switch {
+			case errors.Is(err, pipeline.ErrRestored):
+				skipped++
+			case err != nil:
+				logger.Warn.Printf("Failed to restore media %d (%s) - %v", entry.ID, rel, err)
+				failures = append(failures, fmt.Errorf("media %d: %w", entry.ID, err))
+			default:
+				restored++
+				logger.Info.Printf("[%d/%d] Restored media %d to %s", i+1, len(entries), entry.ID, path)
+			}
+		}
+		logger.Info.Printf("Restored %d file(s), %d already there, %d failed", restored, skipped, len(failures))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d media failed to restore: %w", len(failures), errors.Join(failures...))
+	}
+	return nil
+}
+
+// entries selects the media to restore, newest first
+func (r *RestoreCmd) entries(store *index.Store) ([]*index.Entry, error) {
+	switch {
+	case r.All && (len(r.IDs) > 0 || r.Tag != ""):
+		return nil, fmt.Errorf("--all can't be combined with IDs or --tag")
+	case r.All || r.Tag != "":
+		entries, _ := store.Search(index.Query{Tag: r.Tag})
+		return entries, nil
+	case len(r.IDs) == 0:
+		return nil, fmt.Errorf("name media IDs, a --tag or --all")
+	}
+	var entries []*index.Entry
+	for _, id := range r.IDs {
+		entry, ok := store.Get(id)
+		if !ok {
+			return nil, fmt.Errorf("media %d not found", id)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
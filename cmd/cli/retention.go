@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/pipeline"
+	"time"
+)
+
+// RetentionCmd applies the retention rules of the config
+type RetentionCmd struct {
+	Apply RetentionApplyCmd `cmd:"" help:"Delete the media that retention rules expire"`
+}
+
+type RetentionApplyCmd struct {
+	DryRun bool `help:"Only list the media that would be deleted" name:"dry-run"`
+}
+
+func (r *RetentionApplyCmd) Run(cfg *config.Config) error {
+	if len(cfg.Retention.Rules) == 0 {
+		return fmt.Errorf("retention.rules is empty")
+	}
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+
+	cl, err := client.NewClient(context.Background(), &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+	var entries []*index.Entry
+	var applyErr error
+	err = cl.Run(func(ctx context.Context) error {
+		entries, applyErr = pipeline.ApplyRetention(cl, store, &cfg.Retention, r.DryRun)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+
+	verb, total := messages.Text("cli.retention_deleted"), "cli.retention_total"
+	if r.DryRun {
+		verb, total = messages.Text("cli.retention_dry_run"), "cli.retention_total_dry_run"
+	}
+	for _, e := range entries {
+		fmt.Printf("%s #%-5d %-8s %s #%s (%s)\n", verb, e.ID, e.MediaType, e.FileName, e.Tag, e.CreatedAt.Format(time.DateOnly))
+	}
+	fmt.Println(messages.Text(total, len(entries)))
+	return applyErr
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/messages"
+)
+
+// SecretCmd stores e.g. the api_hash so the config can say
+// api_hash: keyring:api_hash
+type SecretCmd struct {
+	Name string `arg:"" help:"Name of the secret, e.g. api_hash or bot_token"`
+}
+
+func (c *SecretCmd) Run() error {
+	fmt.Fprint(os.Stderr, messages.Text("cli.secret_prompt", c.Name))
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("failed to read secret: %w", err)
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return fmt.Errorf("empty secret")
+	}
+
+	if err := config.SetKeyringSecret(c.Name, secret); err != nil {
+		return fmt.Errorf("failed to store %s in the OS keyring: %w", c.Name, err)
+	}
+	fmt.Println(messages.Text("cli.secret_stored", c.Name, c.Name))
+	return nil
+}
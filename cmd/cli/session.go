@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/messages"
+	"time"
+)
+
+// SessionCmd manages the copies of the session file taken before each run
+type SessionCmd struct {
+	List    SessionListCmd    `cmd:"" help:"List the backups of the session file"`
+	Restore SessionRestoreCmd `cmd:"" help:"Replace the session file with a backup"`
+}
+
+type SessionListCmd struct{}
+
+func (s *SessionListCmd) Run(cfg *config.MtprotoConfig) error {
+	backups := client.SessionBackups(cfg)
+	if len(backups) == 0 {
+		fmt.Println(messages.Text("cli.session_no_backups", cfg.SessionFile))
+		return nil
+	}
+	for _, b := range backups {
+		fmt.Printf("%d  %s  %s\n", b.N, b.ModTime.Format(time.DateTime), b.Path)
+	}
+	return nil
+}
+
+type SessionRestoreCmd struct {
+	N int `arg:"" optional:"" default:"1" help:"Backup to restore, 1 is the newest"`
+}
+
+func (s *SessionRestoreCmd) Run(cfg *config.MtprotoConfig) error {
+	if err := client.RestoreSession(cfg, s.N); err != nil {
+		return err
+	}
+	fmt.Println(messages.Text("cli.session_restored", s.N, cfg.SessionFile, cfg.SessionFile+".broken"))
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/util"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// SessionsCmd lists the sessions logged in to the account, as Telegram's
+// Settings > Devices does, and terminates stale ones
+type SessionsCmd struct {
+	List      SessionsListCmd      `cmd:"" default:"1" help:"List the active sessions (the default)"`
+	Terminate SessionsTerminateCmd `cmd:"" help:"Log out sessions by hash or by inactivity"`
+}
+
+type SessionsListCmd struct{}
+
+func (s *SessionsListCmd) Run(cfg *config.Config) error {
+	return withAuthorizations(cfg, func(cl *client.Client, list []tg.Authorization) error {
+		for _, a := range list {
+			fmt.Println(formatAuthorization(a))
+		}
+		return nil
+	})
+}
+
+type SessionsTerminateCmd struct {
+	Hashes   []int64 `arg:"" optional:"" help:"Hashes of the sessions, as listed"`
+	Inactive string  `help:"Terminate every other session not active for this long, e.g. 90d"`
+}
+
+func (s *SessionsTerminateCmd) Run(cfg *config.Config) error {
+	if (len(s.Hashes) == 0) == (s.Inactive == "") {
+		return errors.New("give either session hashes or --inactive")
+	}
+	var cutoff time.Time
+	if s.Inactive != "" {
+		d, err := util.ParseDuration(s.Inactive)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid --inactive %q", s.Inactive)
+		}
+		cutoff = time.Now().Add(-d)
+	}
+
+	return withAuthorizations(cfg, func(cl *client.Client, list []tg.Authorization) error {
+		wanted := make(map[int64]bool, len(s.Hashes))
+		for _, h := range s.Hashes {
+			wanted[h] = true
+		}
+		var errs []error
+		for _, a := range list {
+			if a.Current {
+				if wanted[a.Hash] {
+					errs = append(errs, fmt.Errorf("session %d is this one", a.Hash))
+					delete(wanted, a.Hash)
+				}
+				continue
+			}
+			stale := !cutoff.IsZero() && time.Unix(int64(a.DateActive), 0).Before(cutoff)
+			if !wanted[a.Hash] && !stale {
+				continue
+			}
+			delete(wanted, a.Hash)
+			if err := cl.TerminateAuthorization(a.Hash); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Println(messages.Text("cli.session_terminated", formatAuthorization(a)))
+		}
+		for h := range wanted {
+			errs = append(errs, fmt.Errorf("no session %d", h))
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// withAuthorizations connects and calls fn with the sessions of the account
+func withAuthorizations(cfg *config.Config, fn func(cl *client.Client, list []tg.Authorization) error) error {
+	ctx := context.Background()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+	err = cl.Run(func(ctx context.Context) error {
+		list, err := cl.Authorizations()
+		if err != nil {
+			return err
+		}
+		return fn(cl, list)
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
+
+// formatAuthorization is one line of `cli sessions`, the current session
+// marked with *
+func formatAuthorization(a tg.Authorization) string {
+	current := " "
+	if a.Current {
+		current = "*"
+	}
+	return fmt.Sprintf("%s %-20d %s, %s %s, %s %s, %s %s, active %s",
+		current, a.Hash, a.DeviceModel, a.Platform, a.SystemVersion, a.AppName, a.AppVersion,
+		a.IP, a.Country, time.Unix(int64(a.DateActive), 0).Format(time.DateOnly))
+}
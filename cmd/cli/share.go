@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"tg-storage-assistant/internal/api"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"time"
+)
+
+// ShareCmd sends archived media or a local photo or video to someone,
+// optionally self-destructing
+type ShareCmd struct {
+	Source string        `arg:"" help:"Media ID from the index, or a local photo or video file"`
+	To     string        `help:"Recipient: @username or user ID" required:"true"`
+	TTL    time.Duration `help:"Self-destruct this long after being opened (1s-60s), private chats only" name:"ttl"`
+}
+
+func (s *ShareCmd) Run(cfg *config.Config) error {
+	ttl := int(s.TTL.Seconds())
+	if s.TTL < 0 || ttl > api.MaxShareTTL || s.TTL > 0 && ttl == 0 {
+		return fmt.Errorf("--ttl must be between 1s and %ds", api.MaxShareTTL)
+	}
+
+	var entry *index.Entry
+	var item client.MediaItem
+	if id, err := strconv.ParseInt(s.Source, 10, 64); err == nil {
+		store, err := index.Open(cfg.Index.Path)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if entry, ok = store.Get(id); !ok {
+			return fmt.Errorf("media %d not found", id)
+		}
+	} else if item, err = shareItem(s.Source, ttl); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	err = cl.Run(func(ctx context.Context) error {
+		peer, err := cl.ResolveRecipient(s.To)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			ids, err := cl.ShareMessages(entry.ChatID, entry.MessageIDs(), peer, ttl)
+			if err != nil {
+				return err
+			}
+			logger.Info.Printf("Shared media %d with %s (%d messages)", entry.ID, s.To, len(ids))
+			return nil
+		}
+		if _, err := cl.SendMedia(peer, item); err != nil {
+			return err
+		}
+		logger.Info.Printf("Shared %s with %s", filepath.Base(item.FilePath), s.To)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
+
+// shareItem sends path as a photo or a video
+func shareItem(path string, ttl int) (client.MediaItem, error) {
+	if _, err := os.Stat(path); err != nil {
+		return client.MediaItem{}, err
+	}
+	item := client.MediaItem{FilePath: path, TTL: ttl}
+	switch {
+	case fileprocessor.IsVideoFile(path):
+		item.MediaType = "video"
+		if w, h, err := ffmpeg.GetVideoResolution(path); err == nil {
+			item.W, item.H = w, h
+		}
+	case strings.HasPrefix(mime.TypeByExtension(filepath.Ext(path)), "image/"):
+		item.MediaType = "photo"
+	default:
+		return item, fmt.Errorf("%s is neither a photo nor a video", path)
+	}
+	return item, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+// StatsCmd shows the upload history recorded in the index
+type StatsCmd struct {
+	Months int `help:"Months to show, newest first" default:"12"`
+	Runs   int `help:"Also list the last N upload runs"`
+}
+
+func (s *StatsCmd) Run(cfg *config.Config) error {
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+	runs := store.Runs()
+	entries, total := store.Search(index.Query{})
+
+	c := strings.Fields(messages.Text("cli.stats_columns"))
+	fmt.Printf("%-8s %5s %9s %7s %11s %10s %7s %11s\n", c[0], c[1], c[2], c[3], c[4], c[5], c[6], c[7])
+	months := pipeline.Monthly(runs, entries)
+	for _, m := range months[:min(s.Months, len(months))] {
+		fmt.Printf("%-8s %5d %9d %7d %11s %10s %7d %11s\n", m.Month, m.Runs, m.Succeeded, m.Failed,
+			util.FormatBytesToHumanReadable(m.Bytes), m.Upload.Round(time.Second),
+			m.Media, util.FormatBytesToHumanReadable(m.Archived))
+	}
+
+	var archived int64
+	for _, e := range entries {
+		archived += e.Size
+	}
+	fmt.Printf("\n%s\n", messages.Text("cli.stats_total", total, util.FormatBytesToHumanReadable(archived), len(runs)))
+
+	if s.Runs > 0 {
+		fmt.Println()
+		for _, r := range runs[max(len(runs)-s.Runs, 0):] {
+			fmt.Println(messages.Text("cli.stats_run", r.Started.Local().Format(time.DateTime), r.Source,
+				r.Succeeded, r.Failed, r.Skipped, util.FormatBytesToHumanReadable(r.Bytes), r.Finished.Sub(r.Started).Round(time.Second)))
+		}
+	}
+	return nil
+}
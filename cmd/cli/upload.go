@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// UploadCmd streams standard input to the storage chat, e.g.
+// tar -c data | zstd | cli upload --stdin --name backup.tar.zst --tag backups
+type UploadCmd struct {
+	Stdin bool   `help:"Read the file from standard input" required:"true"`
+	Name  string `help:"File name of the upload" short:"n" required:"true"`
+	Tag   string `help:"Tag" short:"t" required:"true"`
+	Desc  string `help:"Description, the name without its extension by default" short:"d"`
+}
+
+func (u *UploadCmd) Run(cfg *config.Config) error {
+	if u.Name != filepath.Base(u.Name) || u.Name == "." {
+		return fmt.Errorf("--name must be a file name, not %q", u.Name)
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return errors.New("standard input is a terminal, pipe the file into it")
+	}
+	desc := u.Desc
+	if desc == "" {
+		desc = strings.TrimSuffix(u.Name, filepath.Ext(u.Name))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := index.Open(cfg.Index.Path)
+	if err != nil {
+		return err
+	}
+
+	cl, err := client.NewClient(ctx, &cfg.Mtproto)
+	if err != nil {
+		return fmt.Errorf("new client failed: %w", err)
+	}
+
+	err = cl.Run(func(ctx context.Context) error {
+		entry, err := pipeline.UploadStream(cl, store, &cfg.Mtproto, os.Stdin, u.Name, u.Tag, desc, "stdin")
+		if err != nil {
+			return err
+		}
+		logger.Info.Printf("Uploaded %s (%d parts) as index entry %d", entry.FileName, max(entry.Parts, 1), entry.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"tg-storage-assistant/internal/util"
+)
+
+// allowList is the set of users admins allowed to use /save, /find and
+// /jobs from any chat, persisted so /allow and /deny survive restarts
+type allowList struct {
+	mu    sync.Mutex
+	path  string
+	users map[int64]bool
+}
+
+// loadAllowList reads the list at path, empty if the file does not exist
+func loadAllowList(path string) (*allowList, error) {
+	l := &allowList{path: path, users: make(map[int64]bool)}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read allow-list failed: %w", err)
+	}
+	var ids []int64
+	if err := json.Unmarshal(raw, &ids); err != nil {
+		return nil, fmt.Errorf("parse allow-list %s failed: %w", path, err)
+	}
+	for _, id := range ids {
+		l.users[id] = true
+	}
+	return l, nil
+}
+
+func (l *allowList) Has(id int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.users[id]
+}
+
+// Set allows or denies a user and saves the list. It reports whether that
+// changed anything.
+func (l *allowList) Set(id int64, allowed bool) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.users[id] == allowed {
+		return false, nil
+	}
+	if allowed {
+		l.users[id] = true
+	} else {
+		delete(l.users, id)
+	}
+	return true, l.save()
+}
+
+// Users returns the allowed user IDs, sorted
+func (l *allowList) Users() []int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ids := make([]int64, 0, len(l.users))
+	for id := range l.users {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// save writes the list atomically (temp file + rename). Caller holds the lock.
+func (l *allowList) save() error {
+	ids := make([]int64, 0, len(l.users))
+	for id := range l.users {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	raw, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return util.ReplaceFile(tmp, l.path)
+}
+
+// parseUserID parses the user ID argument of /allow and /deny
+func parseUserID(payload string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimSpace(payload), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid user ID %q", payload)
+	}
+	return id, nil
+}
+
+// joinIDs formats user IDs for a reply, "none" when there are none
+func joinIDs(ids []int64) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"time"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// defaultArchiveTag tags media archived without a #tag
+const defaultArchiveTag = "inbox"
+
+// parseArchiveArgs reads "[message_id] [#tag] [description]"; msgID is 0
+// when the command replies to the media instead
+func parseArchiveArgs(payload string) (msgID int, tag, description string) {
+	fields := strings.Fields(payload)
+	if len(fields) > 0 {
+		if id, err := strconv.Atoi(fields[0]); err == nil && id > 0 {
+			msgID, fields = id, fields[1:]
+		}
+	}
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "#") {
+		tag, fields = fileprocessor.SanitizeTag(fields[0][1:], false), fields[1:]
+	}
+	if tag == "" {
+		tag = defaultArchiveTag
+	}
+	return msgID, tag, strings.Join(fields, " ")
+}
+
+// mediaRecord builds the record of a message the store doesn't know, e.g.
+// one sent before the bot started; nil when it holds no supported media
+func mediaRecord(msg *tele.Message) *MediaRecord {
+	rec := &MediaRecord{ChatID: msg.Chat.ID, MessageID: msg.ID, Caption: msg.Caption, UnixTime: msg.Unixtime}
+	switch {
+	case msg.Photo != nil:
+		rec.Type, rec.FileID, rec.FileUID, rec.FileSize = MediaPhoto, msg.Photo.FileID, msg.Photo.UniqueID, msg.Photo.FileSize
+	case msg.Document != nil:
+		d := msg.Document
+		rec.Type, rec.FileID, rec.FileUID, rec.FileSize = MediaDocument, d.FileID, d.UniqueID, d.FileSize
+		rec.FileName, rec.MimeType = d.FileName, d.MIME
+	case msg.Video != nil:
+		v := msg.Video
+		rec.Type, rec.FileID, rec.FileUID, rec.FileSize = MediaVideo, v.FileID, v.UniqueID, v.FileSize
+		rec.FileName, rec.MimeType = v.FileName, v.MIME
+	case msg.Voice != nil:
+		v := msg.Voice
+		rec.Type, rec.FileID, rec.FileUID, rec.FileSize = MediaVoice, v.FileID, v.UniqueID, v.FileSize
+		rec.MimeType, rec.Duration = v.MIME, v.Duration
+	case msg.VideoNote != nil:
+		v := msg.VideoNote
+		rec.Type, rec.FileID, rec.FileUID, rec.FileSize = MediaVideoNote, v.FileID, v.UniqueID, v.FileSize
+		rec.Duration, rec.Length = v.Duration, v.Length
+	default:
+		return nil
+	}
+	return rec
+}
+
+// archiveDescription is description, or else the first line of the
+// caption, the file name or the date the media was sent
+func archiveDescription(rec *MediaRecord, description string) string {
+	if description != "" {
+		return description
+	}
+	if line, _, _ := strings.Cut(strings.TrimSpace(rec.Caption), "\n"); line != "" {
+		return line
+	}
+	if rec.FileName != "" {
+		return strings.TrimSuffix(rec.FileName, filepath.Ext(rec.FileName))
+	}
+	return time.Unix(rec.UnixTime, 0).Format(time.DateOnly)
+}
+
+// archive posts the media of rec into the storage chat with the caption
+// "#tag description" and adds the copy to the index
+func archive(b *tele.Bot, media *index.Store, storageChatID int64, rec *MediaRecord, tag, description string) (*index.Entry, error) {
+	description = archiveDescription(rec, description)
+	sent, err := b.Send(tele.ChatID(storageChatID), sendable(rec, rec.FileID, "#"+tag+" "+description))
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *rec
+	copied.ChatID, copied.MessageID, copied.UnixTime = storageChatID, sent.ID, sent.Unixtime
+	entry := mediaEntry(&copied, tag, description)
+	if err := media.Add(entry); err != nil {
+		return nil, err
+	}
+	log.Info.Printf("Archived message %d of chat %d as media %d", rec.MessageID, rec.ChatID, entry.ID)
+	return entry, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/util"
+	"time"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// digestLargest is how many of the largest new files a digest lists
+const digestLargest = 3
+
+// digestSchedule posts a digest of newly indexed items every day or week
+type digestSchedule struct {
+	chatID int64
+	weekly bool // on Mondays
+	hour   int  // local time
+}
+
+// newDigestSchedule parses DIGEST_SCHEDULE: "daily" or "weekly", with an
+// optional hour such as "daily@9" (the default hour)
+func newDigestSchedule(chatID int64, v string) (*digestSchedule, error) {
+	d := &digestSchedule{chatID: chatID, hour: 9}
+	period, h, hasHour := strings.Cut(v, "@")
+	if hasHour {
+		hour, err := strconv.Atoi(h)
+		if err != nil || hour < 0 || hour > 23 {
+			return nil, fmt.Errorf("invalid hour %q", h)
+		}
+		d.hour = hour
+	}
+	switch period {
+	case "daily":
+	case "weekly":
+		d.weekly = true
+	default:
+		return nil, fmt.Errorf("unknown period %q (daily or weekly)", period)
+	}
+	return d, nil
+}
+
+// next returns the first digest time after now
+func (d *digestSchedule) next(now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), d.hour, 0, 0, 0, now.Location())
+	if d.weekly {
+		t = t.AddDate(0, 0, -int((t.Weekday()+6)%7)) // back to Monday
+	}
+	for !t.After(now) {
+		if d.weekly {
+			t = t.AddDate(0, 0, 7)
+		} else {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return t
+}
+
+// run posts digests until the process exits
+func (d *digestSchedule) run(b *tele.Bot, media *index.Store) {
+	title := messages.Text("bot.digest_daily")
+	if d.weekly {
+		title = messages.Text("bot.digest_weekly")
+	}
+	for {
+		at := d.next(time.Now())
+		time.Sleep(time.Until(at))
+
+		since := at.AddDate(0, 0, -1)
+		if d.weekly {
+			since = at.AddDate(0, 0, -7)
+		}
+		entries, _ := media.Search(index.Query{Since: since})
+		if len(entries) == 0 {
+			log.Info.Printf("%s: nothing new since %s", title, since.Format(time.DateTime))
+			continue
+		}
+		if _, err := b.Send(&tele.Chat{ID: d.chatID}, renderDigest(title, entries), tele.NoPreview); err != nil {
+			log.Warn.Printf("Failed to post the %s: %v", strings.ToLower(title), err)
+		}
+	}
+}
+
+// renderDigest summarizes entries: counts and sizes per tag, and the largest
+// files with links
+func renderDigest(title string, entries []*index.Entry) string {
+	type tagStats struct {
+		tag   string
+		count int
+		size  int64
+	}
+	byTag := make(map[string]*tagStats)
+	var total int64
+	for _, e := range entries {
+		st, ok := byTag[e.Tag]
+		if !ok {
+			st = &tagStats{tag: e.Tag}
+			byTag[e.Tag] = st
+		}
+		st.count++
+		st.size += e.Size
+		total += e.Size
+	}
+	tags := make([]*tagStats, 0, len(byTag))
+	for _, st := range byTag {
+		tags = append(tags, st)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].count != tags[j].count {
+			return tags[i].count > tags[j].count
+		}
+		return tags[i].tag < tags[j].tag
+	})
+
+	var b strings.Builder
+	b.WriteString(messages.Text("bot.digest_header", title, len(entries), util.FormatBytesToHumanReadable(total)))
+	for _, st := range tags {
+		tag := "#" + st.tag
+		if st.tag == "" {
+			tag = "untagged"
+		}
+		fmt.Fprintf(&b, "\n%s: %d (%s)", tag, st.count, util.FormatBytesToHumanReadable(st.size))
+	}
+
+	largest := append([]*index.Entry(nil), entries...)
+	sort.Slice(largest, func(i, j int) bool { return largest[i].Size > largest[j].Size })
+	if len(largest) > digestLargest {
+		largest = largest[:digestLargest]
+	}
+	b.WriteString("\n\nLargest:")
+	for _, e := range largest {
+		fmt.Fprintf(&b, "\n%s, %s", e.Caption, util.FormatBytesToHumanReadable(e.Size))
+		if link := e.Link(); link != "" {
+			fmt.Fprintf(&b, "\n%s", link)
+		}
+	}
+	return b.String()
+}
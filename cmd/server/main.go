@@ -1,25 +1,41 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"tg-storage-assistant/internal/dialer"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/messages"
+	"tg-storage-assistant/internal/util"
 	"time"
 
 	"github.com/joho/godotenv"
 	tele "gopkg.in/telebot.v4"
 )
 
+var log = logger.Named("bot")
+
 type MediaType string
 
 const (
-	MediaPhoto MediaType = "photo"
-	MediaVideo MediaType = "video"
+	MediaPhoto     MediaType = "photo"
+	MediaVideo     MediaType = "video"
+	MediaDocument  MediaType = "document" // images sent as files keep their original quality
+	MediaVoice     MediaType = "voice"
+	MediaVideoNote MediaType = "video_note" // round video message
 )
 
 type MediaRecord struct {
@@ -33,24 +49,37 @@ type MediaRecord struct {
 	FileName  string
 	MimeType  string
 	FileSize  int64
+	Duration  int         // seconds, for voice and video notes
+	Length    int         // diameter of video notes
+	Sizes     []PhotoSize // every size of a photo, smallest first
 }
 
 type MemStore struct {
-	mu   sync.RWMutex
-	data map[int64]map[int]*MediaRecord
+	mu    sync.RWMutex
+	data  map[int64]map[int]*MediaRecord
+	byUID map[string]*MediaRecord // first record of each file, by FileUID
 }
 
 func NewMemStore() *MemStore {
-	return &MemStore{data: make(map[int64]map[int]*MediaRecord)}
+	return &MemStore{data: make(map[int64]map[int]*MediaRecord), byUID: make(map[string]*MediaRecord)}
 }
 
-func (s *MemStore) Put(r *MediaRecord) {
+// Put stores r unless a file with the same FileUID was stored before, in
+// any chat; it then returns that earlier record instead
+func (s *MemStore) Put(r *MediaRecord) *MediaRecord {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if r.FileUID != "" {
+		if prev, ok := s.byUID[r.FileUID]; ok {
+			return prev
+		}
+		s.byUID[r.FileUID] = r
+	}
 	if _, ok := s.data[r.ChatID]; !ok {
 		s.data[r.ChatID] = make(map[int]*MediaRecord)
 	}
 	s.data[r.ChatID][r.MessageID] = r
+	return nil
 }
 
 func (s *MemStore) Get(chatID int64, msgID int) (*MediaRecord, bool) {
@@ -69,21 +98,153 @@ var store = NewMemStore()
 func main() {
 	_ = godotenv.Load()
 
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		level, err := logger.ParseLevel(v)
+		if err != nil {
+			log.Error.Fatal(err)
+		}
+		log.SetLevel(level)
+	}
+
+	// Language of the replies: en (default) or zh
+	if err := messages.SetLocale(os.Getenv("LOCALE")); err != nil {
+		log.Error.Fatalf("invalid LOCALE: %v", err)
+	}
+
 	token := os.Getenv("TOKEN")
 	if token == "" {
-		log.Fatal("TOKEN is empty; set TOKEN in .env")
+		log.Error.Fatal("TOKEN is empty; set TOKEN in .env")
+	}
+
+	// Address of the `cli daemon` HTTP API, used by /save
+	daemonURL := os.Getenv("DAEMON_URL")
+	if daemonURL == "" {
+		daemonURL = "http://127.0.0.1:8080"
+	}
+	daemonToken = os.Getenv("DAEMON_TOKEN")
+
+	// Media index shared with the uploader and the daemon, used by /find
+	indexPath := os.Getenv("INDEX_PATH")
+	if indexPath == "" {
+		indexPath = "./index.json"
+	}
+	mediaIndex, err := index.Open(indexPath)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+
+	// /save and /find expose the archive, so only this chat may use them
+	var allowedChatID int64
+	if v := os.Getenv("ALLOWED_CHAT_ID"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Error.Fatalf("invalid ALLOWED_CHAT_ID %q: %v", v, err)
+		}
+		allowedChatID = id
+	}
+
+	// /upload_now starts uploads on the daemon, so only these users may use it
+	adminIDs := make(map[int64]bool)
+	for _, v := range strings.FieldsFunc(os.Getenv("ADMIN_USER_IDS"), func(r rune) bool { return r == ',' || r == ' ' }) {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Error.Fatalf("invalid ADMIN_USER_IDS entry %q: %v", v, err)
+		}
+		adminIDs[id] = true
+	}
+	isAdmin := func(c tele.Context) bool {
+		return c.Sender() != nil && adminIDs[c.Sender().ID]
+	}
+
+	// Users admins allowed with /allow may use /save, /find and /jobs from
+	// any chat
+	allowedPath := os.Getenv("ALLOWED_USERS_PATH")
+	if allowedPath == "" {
+		allowedPath = "./allowed_users.json"
+	}
+	allowed, err := loadAllowList(allowedPath)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+	authorized := func(c tele.Context) bool {
+		if allowedChatID != 0 && c.Chat().ID == allowedChatID {
+			return true
+		}
+		return isAdmin(c) || c.Sender() != nil && allowed.Has(c.Sender().ID)
+	}
+
+	// Telegram recompresses photos, so optionally suggest sending them as files
+	var nudgeOriginals bool
+	if v := os.Getenv("NUDGE_ORIGINALS"); v != "" {
+		nudgeOriginals, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Error.Fatalf("invalid NUDGE_ORIGINALS %q: %v", v, err)
+		}
+	}
+
+	// Authorized users are asked for a tag after media is saved, which
+	// indexes it for /find
+	askTags := true
+	if v := os.Getenv("TAG_PROMPT"); v != "" {
+		askTags, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Error.Fatalf("invalid TAG_PROMPT %q: %v", v, err)
+		}
+	}
+
+	// /archive posts media into the storage channel, which the bot must be an
+	// admin of (`cli invite-bot`)
+	var storageChatID int64
+	if v := os.Getenv("STORAGE_CHAT_ID"); v != "" {
+		storageChatID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Error.Fatalf("invalid STORAGE_CHAT_ID %q: %v", v, err)
+		}
+	}
+
+	// Optional digest of newly indexed items, posted to DIGEST_CHAT_ID
+	var digest *digestSchedule
+	if v := os.Getenv("DIGEST_CHAT_ID"); v != "" {
+		chatID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Error.Fatalf("invalid DIGEST_CHAT_ID %q: %v", v, err)
+		}
+		schedule := os.Getenv("DIGEST_SCHEDULE")
+		if schedule == "" {
+			schedule = "daily"
+		}
+		if digest, err = newDigestSchedule(chatID, schedule); err != nil {
+			log.Error.Fatalf("invalid DIGEST_SCHEDULE %q: %v", schedule, err)
+		}
 	}
 
 	b, err := tele.NewBot(tele.Settings{
 		Token:  token,
-		Poller: &tele.LongPoller{Timeout: 10 * time.Second},
+		Poller: &photoPoller{Timeout: 10 * time.Second},
+		// HTTPS_PROXY, or else ALL_PROXY, minus NO_PROXY
+		Client: &http.Client{
+			Timeout:   time.Minute,
+			Transport: &http.Transport{Proxy: dialer.ProxyFromEnvironment},
+		},
 	})
 	if err != nil {
-		log.Fatal(err)
+		log.Error.Fatal(err)
+	}
+
+	tags := newTagger(b, mediaIndex)
+	pages := newPager(b)
+	pages.add("find", func(arg string, n int) (*page, error) { return findPage(mediaIndex, arg, n) })
+	pages.add("list", func(tag string, n int) (*page, error) { return listPage(mediaIndex, tag, n) })
+	pages.add("jobs", func(_ string, n int) (*page, error) { return jobsPage(daemonURL, n) })
+	replySaved := func(c tele.Context, rec *MediaRecord, text string) error {
+		if askTags && authorized(c) {
+			return tags.ask(c, rec, text)
+		}
+		return c.Reply(text)
 	}
 
 	b.Handle("/hello", func(c tele.Context) error {
-		return c.Send(fmt.Sprintf("Hello! The ChatID is %d", c.Chat().ID))
+		return c.Send(messages.Text("bot.hello", c.Chat().ID))
 	})
 
 	// Handle incoming photos (v4: msg.Photo is *tele.Photo)
@@ -102,9 +263,44 @@ func main() {
 			Caption:   msg.Caption,
 			UnixTime:  int64(msg.Unixtime),
 			FileSize:  int64(p.FileSize),
+			Sizes:     pendingSizes.take(c.Chat().ID, msg.ID),
+		}
+		if prev := store.Put(rec); prev != nil {
+			return replyDuplicate(c, prev)
 		}
-		store.Put(rec) // ✅ Fixed here
-		return c.Reply(fmt.Sprintf("✅ Photo saved. message_id=%d", msg.ID))
+		reply := messages.Text("bot.photo_saved", msg.ID)
+		if len(rec.Sizes) > 1 {
+			reply += "\n" + messages.Text("bot.photo_sizes", describeSizes(rec.Sizes))
+		}
+		if nudgeOriginals {
+			reply += "\n" + messages.Text("bot.photo_nudge")
+		}
+		return replySaved(c, rec, reply)
+	})
+
+	// Handle incoming files; images sent this way are not recompressed
+	b.Handle(tele.OnDocument, func(c tele.Context) error {
+		msg := c.Message()
+		d := msg.Document
+		if d == nil {
+			return nil
+		}
+		rec := &MediaRecord{
+			ChatID:    c.Chat().ID,
+			MessageID: msg.ID,
+			Type:      MediaDocument,
+			FileID:    d.FileID,
+			FileUID:   d.UniqueID,
+			Caption:   msg.Caption,
+			UnixTime:  int64(msg.Unixtime),
+			FileName:  d.FileName,
+			MimeType:  d.MIME,
+			FileSize:  d.FileSize,
+		}
+		if prev := store.Put(rec); prev != nil {
+			return replyDuplicate(c, prev)
+		}
+		return replySaved(c, rec, messages.Text("bot.file_saved", msg.ID))
 	})
 
 	// Handle incoming videos
@@ -126,68 +322,452 @@ func main() {
 			MimeType:  v.MIME,
 			FileSize:  v.FileSize, // int64
 		}
-		store.Put(rec)
-		return c.Reply(fmt.Sprintf("✅ Video saved. message_id=%d", msg.ID))
+		if prev := store.Put(rec); prev != nil {
+			return replyDuplicate(c, prev)
+		}
+		return replySaved(c, rec, messages.Text("bot.video_saved", msg.ID))
 	})
 
-	// Resend media as-is: /get <message_id>
+	// Handle incoming voice messages
+	b.Handle(tele.OnVoice, func(c tele.Context) error {
+		msg := c.Message()
+		v := msg.Voice
+		if v == nil {
+			return nil
+		}
+		rec := &MediaRecord{
+			ChatID:    c.Chat().ID,
+			MessageID: msg.ID,
+			Type:      MediaVoice,
+			FileID:    v.FileID,
+			FileUID:   v.UniqueID,
+			Caption:   msg.Caption,
+			UnixTime:  int64(msg.Unixtime),
+			MimeType:  v.MIME,
+			FileSize:  v.FileSize,
+			Duration:  v.Duration,
+		}
+		if prev := store.Put(rec); prev != nil {
+			return replyDuplicate(c, prev)
+		}
+		return replySaved(c, rec, messages.Text("bot.voice_saved", msg.ID))
+	})
+
+	// Handle incoming round video messages
+	b.Handle(tele.OnVideoNote, func(c tele.Context) error {
+		msg := c.Message()
+		v := msg.VideoNote
+		if v == nil {
+			return nil
+		}
+		rec := &MediaRecord{
+			ChatID:    c.Chat().ID,
+			MessageID: msg.ID,
+			Type:      MediaVideoNote,
+			FileID:    v.FileID,
+			FileUID:   v.UniqueID,
+			UnixTime:  int64(msg.Unixtime),
+			FileSize:  v.FileSize,
+			Duration:  v.Duration,
+			Length:    v.Length,
+		}
+		if prev := store.Put(rec); prev != nil {
+			return replyDuplicate(c, prev)
+		}
+		return replySaved(c, rec, messages.Text("bot.video_note_saved", msg.ID))
+	})
+
+	// Answers to the tag question: a suggested tag, Skip, or a reply with
+	// any other tag
+	b.Handle(tagBtn, func(c tele.Context) error {
+		if !authorized(c) {
+			return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.tag_not_allowed")})
+		}
+		return tags.choose(c)
+	})
+	b.Handle(skipBtn, func(c tele.Context) error {
+		if !authorized(c) {
+			return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.tag_not_allowed")})
+		}
+		return tags.skip(c)
+	})
+	b.Handle(tele.OnText, func(c tele.Context) error {
+		if !authorized(c) {
+			return nil
+		}
+		return tags.reply(c)
+	})
+
+	// Resend media as-is: /get <message_id> [size]
 	b.Handle("/get", func(c tele.Context) error {
-		msgID, err := parseMsgIDArg(c)
+		msgID, sizeArg, err := parseMsgIDArg(c)
 		if err != nil {
-			return c.Reply("Usage: /get <message_id>")
+			return c.Reply(messages.Text("bot.get_usage"))
 		}
 		rec, ok := store.Get(c.Chat().ID, msgID)
 		if !ok {
-			return c.Reply("Message ID not found (currently in-memory only, please send a media first)")
+			return c.Reply(messages.Text("bot.not_found"))
 		}
-		switch rec.Type {
-		case MediaPhoto:
-			return c.Send(&tele.Photo{File: tele.File{FileID: rec.FileID}, Caption: rec.Caption})
-		case MediaVideo:
-			return c.Send(&tele.Video{File: tele.File{FileID: rec.FileID}, Caption: rec.Caption, MIME: rec.MimeType})
-		default:
-			return c.Reply("Unsupported media type")
+		fileID, err := recordFileID(rec, sizeArg)
+		if err != nil {
+			return c.Reply(err.Error())
+		}
+		item := sendable(rec, fileID, rec.Caption)
+		if item == nil {
+			return c.Reply(messages.Text("bot.unsupported_media"))
 		}
+		return c.Send(item)
 	})
 
-	// Download to local: /dl <message_id>
+	// Download to local: /dl <message_id> [size]
 	b.Handle("/dl", func(c tele.Context) error {
-		msgID, err := parseMsgIDArg(c)
+		msgID, sizeArg, err := parseMsgIDArg(c)
 		if err != nil {
-			return c.Reply("Usage: /dl <message_id>")
+			return c.Reply(messages.Text("bot.dl_usage"))
 		}
 		rec, ok := store.Get(c.Chat().ID, msgID)
 		if !ok {
-			return c.Reply("Message ID not found (currently in-memory only, please send a media first)")
+			return c.Reply(messages.Text("bot.not_found"))
+		}
+		fileID, err := recordFileID(rec, sizeArg)
+		if err != nil {
+			return c.Reply(err.Error())
+		}
+		path, err := downloadByRecord(b, rec, fileID)
+		if err != nil {
+			return c.Reply(messages.Text("bot.download_failed", err))
+		}
+		return c.Reply(messages.Text("bot.downloaded", path))
+	})
+
+	// Copy media of this chat into the storage channel and index it:
+	// /archive [message_id] [#tag] [description], or as a reply to the media
+	b.Handle("/archive", func(c tele.Context) error {
+		if !authorized(c) {
+			return c.Reply(messages.Text("bot.not_enabled", "/archive"))
+		}
+		if storageChatID == 0 {
+			return c.Reply(messages.Text("bot.archive_disabled"))
+		}
+		msgID, tag, description := parseArchiveArgs(c.Message().Payload)
+		var rec *MediaRecord
+		switch to := c.Message().ReplyTo; {
+		case msgID != 0:
+			rec, _ = store.Get(c.Chat().ID, msgID)
+		case to != nil:
+			if rec, _ = store.Get(c.Chat().ID, to.ID); rec == nil {
+				rec = mediaRecord(to)
+			}
+		default:
+			return c.Reply(messages.Text("bot.archive_usage"))
 		}
-		path, err := downloadByRecord(b, rec)
+		if rec == nil {
+			return c.Reply(messages.Text("bot.not_found"))
+		}
+		if sendable(rec, rec.FileID, "") == nil {
+			return c.Reply(messages.Text("bot.unsupported_media"))
+		}
+
+		entry, err := archive(b, mediaIndex, storageChatID, rec, tag, description)
 		if err != nil {
-			return c.Reply("Download failed: " + err.Error())
+			return c.Reply(messages.Text("bot.archive_failed", err))
+		}
+		text := messages.Text("bot.archived", entry.ID, entry.Caption)
+		if link := entry.Link(); link != "" {
+			text += "\n" + link
+		}
+		return c.Reply(text, tele.NoPreview)
+	})
+
+	// Archive an online video: /save <url>
+	b.Handle("/save", func(c tele.Context) error {
+		if !authorized(c) {
+			return c.Reply(messages.Text("bot.not_enabled", "/save"))
+		}
+		arg := strings.TrimSpace(c.Message().Payload)
+		if u, err := url.Parse(arg); arg == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return c.Reply(messages.Text("bot.save_usage"))
+		}
+		jobID, err := submitSave(daemonURL, arg)
+		if err != nil {
+			return c.Reply(messages.Text("bot.save_failed", err))
+		}
+		return c.Reply(messages.Text("bot.save_queued", jobID))
+	})
+
+	// Send archived media that self-destructs after being opened, admins
+	// only: /share <media id> <@user or user id> [seconds]
+	b.Handle("/share", func(c tele.Context) error {
+		if !isAdmin(c) {
+			return c.Reply(messages.Text("bot.admins_only", "/share"))
+		}
+		entryID, to, ttl, err := parseShareArgs(c.Args())
+		if err != nil {
+			return c.Reply(err.Error())
+		}
+		job, err := postJob(daemonURL, fmt.Sprintf("/api/media/%d/share", entryID), map[string]any{"to": to, "ttl_seconds": ttl})
+		if err != nil {
+			return c.Reply(messages.Text("bot.share_failed", err))
+		}
+		status, err := b.Send(c.Chat(), messages.Text("bot.share_queued", entryID, to, ttl, job.ID))
+		if err != nil {
+			return err
+		}
+		go watchJob(b, status, daemonURL, job.ID)
+		return nil
+	})
+
+	// Look up archived files in the shared media index: /find <#tag or keyword>
+	// Search with /find or /search; both page through the results
+	find := func(command string) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			if !authorized(c) {
+				return c.Reply(messages.Text("bot.not_enabled", command))
+			}
+			arg := strings.TrimSpace(c.Message().Payload)
+			if arg == "" {
+				return c.Reply(messages.Text("bot.find_usage", command))
+			}
+			return pages.send(c, "find", arg)
+		}
+	}
+	b.Handle("/find", find("/find"))
+	b.Handle("/search", find("/search"))
+
+	// The newest archived media, optionally of one tag: /list [#tag]
+	b.Handle("/list", func(c tele.Context) error {
+		if !authorized(c) {
+			return c.Reply(messages.Text("bot.not_enabled", "/list"))
+		}
+		return pages.send(c, "list", strings.TrimPrefix(strings.TrimSpace(c.Message().Payload), "#"))
+	})
+
+	// Active and queued daemon jobs with Cancel buttons: /jobs
+	b.Handle("/jobs", func(c tele.Context) error {
+		if !authorized(c) {
+			return c.Reply(messages.Text("bot.not_enabled", "/jobs"))
+		}
+		return pages.send(c, "jobs", "")
+	})
+
+	// Page buttons of /find, /search, /list and /jobs
+	b.Handle(pageBtn, func(c tele.Context) error {
+		if !authorized(c) {
+			return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.page_not_allowed")})
+		}
+		return pages.turn(c)
+	})
+
+	// Cancel buttons of /jobs, admins only
+	b.Handle(cancelBtn, func(c tele.Context) error {
+		if !isAdmin(c) {
+			return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.cancel_admins_only")})
+		}
+		id, err := strconv.ParseInt(c.Callback().Data, 10, 64)
+		if err != nil {
+			return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.cancel_invalid")})
+		}
+		if err := cancelJob(daemonURL, id); err != nil {
+			return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.cancel_failed", err), ShowAlert: true})
+		}
+		return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.cancel_done", id)})
+	})
+
+	// Upload everything in local_dir now: /upload_now
+	b.Handle("/upload_now", func(c tele.Context) error {
+		if !isAdmin(c) {
+			return c.Reply(messages.Text("bot.admins_only", "/upload_now"))
+		}
+		job, err := postJob(daemonURL, "/api/upload", struct{}{})
+		if err != nil {
+			return c.Reply(messages.Text("bot.upload_failed", err))
+		}
+		status, err := b.Send(c.Chat(), messages.Text("bot.upload_queued", job.ID))
+		if err != nil {
+			return err
+		}
+		go watchJob(b, status, daemonURL, job.ID)
+		return nil
+	})
+
+	// Upload a file of local_dir before the others, admins only:
+	// /priority <file name>
+	b.Handle("/priority", func(c tele.Context) error {
+		if !isAdmin(c) {
+			return c.Reply(messages.Text("bot.admins_only", "/priority"))
+		}
+		name := strings.TrimSpace(c.Message().Payload)
+		if name == "" {
+			return c.Reply(messages.Text("bot.priority_usage"))
 		}
-		return c.Reply("Downloaded to local: " + path)
+		if err := prioritize(daemonURL, name); err != nil {
+			return c.Reply(messages.Text("bot.priority_failed", err))
+		}
+		return c.Reply(messages.Text("bot.prioritized", name))
 	})
 
-	log.Println("Bot started...")
+	// Hold daemon jobs back while running ones finish, admins only: /pause,
+	// /resume
+	setPaused := func(command string, pause bool) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			if !isAdmin(c) {
+				return c.Reply(messages.Text("bot.admins_only", command))
+			}
+			changed, err := pauseDaemon(daemonURL, pause)
+			switch {
+			case err != nil:
+				return c.Reply(messages.Text("bot.pause_failed", err))
+			case pause && changed:
+				log.Info.Printf("Daemon paused by %d", c.Sender().ID)
+				return c.Reply(messages.Text("bot.paused"))
+			case pause:
+				return c.Reply(messages.Text("bot.already_paused"))
+			case changed:
+				log.Info.Printf("Daemon resumed by %d", c.Sender().ID)
+				return c.Reply(messages.Text("bot.resumed"))
+			default:
+				return c.Reply(messages.Text("bot.not_paused"))
+			}
+		}
+	}
+	b.Handle("/pause", setPaused("/pause", true))
+	b.Handle("/resume", setPaused("/resume", false))
+
+	// Manage the allow-list, admins only: /allow <user id>, /deny <user id>
+	setAllowed := func(command string, allow bool) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			if !isAdmin(c) {
+				return c.Reply(messages.Text("bot.allow_admins_only"))
+			}
+			id, err := parseUserID(c.Message().Payload)
+			if err != nil {
+				return c.Reply(messages.Text("bot.allow_usage", command))
+			}
+			changed, err := allowed.Set(id, allow)
+			switch {
+			case err != nil:
+				return c.Reply(messages.Text("bot.allow_save_failed", err))
+			case !changed && allow:
+				return c.Reply(messages.Text("bot.allow_already", id))
+			case !changed:
+				return c.Reply(messages.Text("bot.deny_absent", id))
+			case allow:
+				log.Info.Printf("User %d allowed by %d", id, c.Sender().ID)
+				return c.Reply(messages.Text("bot.allowed", id))
+			default:
+				log.Info.Printf("User %d denied by %d", id, c.Sender().ID)
+				return c.Reply(messages.Text("bot.denied", id))
+			}
+		}
+	}
+	b.Handle("/allow", setAllowed("/allow", true))
+	b.Handle("/deny", setAllowed("/deny", false))
+
+	// Who may use the bot: /admins
+	b.Handle("/admins", func(c tele.Context) error {
+		if !isAdmin(c) {
+			return c.Reply(messages.Text("bot.admins_only", "/admins"))
+		}
+		admins := make([]int64, 0, len(adminIDs))
+		for id := range adminIDs {
+			admins = append(admins, id)
+		}
+		slices.Sort(admins)
+		text := messages.Text("bot.admins_list", joinIDs(admins), joinIDs(allowed.Users()))
+		if allowedChatID != 0 {
+			text += "\n" + messages.Text("bot.admins_chat", allowedChatID)
+		}
+		return c.Reply(text)
+	})
+
+	if digest != nil {
+		go digest.run(b, mediaIndex)
+	}
+
+	log.Info.Println("Bot started...")
 	b.Start()
 }
 
-func parseMsgIDArg(c tele.Context) (int, error) {
-	arg := strings.TrimSpace(c.Message().Payload) // /get 123 -> "123"
-	if arg == "" {
-		return 0, errors.New("missing")
+// replyDuplicate points to the earlier record of a file received again
+func replyDuplicate(c tele.Context, prev *MediaRecord) error {
+	text := messages.Text("bot.duplicate", prev.MessageID)
+	if prev.ChatID == c.Chat().ID {
+		// Replying to the original shows it without a link
+		return c.Send(text, &tele.SendOptions{ReplyTo: &tele.Message{ID: prev.MessageID, Chat: c.Chat()}})
+	}
+	if link := messageLink(prev.ChatID, prev.MessageID); link != "" {
+		text += "\n" + link
+	} else {
+		text += messages.Text("bot.duplicate_chat", prev.ChatID)
+	}
+	return c.Reply(text, tele.NoPreview)
+}
+
+// messageLink links to a message of a supergroup or channel; private chats
+// and basic groups have no message links
+func messageLink(chatID int64, msgID int) string {
+	channelID := -chatID - 1000000000000
+	if channelID <= 0 {
+		return ""
 	}
-	id, err := strconv.Atoi(arg)
+	return fmt.Sprintf("https://t.me/c/%d/%d", channelID, msgID)
+}
+
+// parseMsgIDArg parses "<message_id> [size]" from the command payload
+func parseMsgIDArg(c tele.Context) (int, string, error) {
+	fields := strings.Fields(c.Message().Payload) // /get 123 small -> ["123", "small"]
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, "", errors.New("missing")
+	}
+	id, err := strconv.Atoi(fields[0])
 	if err != nil || id <= 0 {
-		return 0, errors.New("bad")
+		return 0, "", errors.New("bad")
+	}
+	if len(fields) == 2 {
+		return id, fields[1], nil
+	}
+	return id, "", nil
+}
+
+// recordFileID returns the file to send or download; only photos have
+// several sizes
+func recordFileID(rec *MediaRecord, sizeArg string) (string, error) {
+	if rec.Type != MediaPhoto || len(rec.Sizes) == 0 {
+		if sizeArg != "" {
+			return "", errors.New(messages.Text("bot.single_size"))
+		}
+		return rec.FileID, nil
+	}
+	size, err := pickSize(rec.Sizes, sizeArg)
+	if err != nil {
+		return "", err
+	}
+	return size.FileID, nil
+}
+
+// sendable resends the file fileID of rec with caption, nil for media types
+// the bot doesn't store. Video notes can't have a caption.
+func sendable(rec *MediaRecord, fileID, caption string) tele.Sendable {
+	switch rec.Type {
+	case MediaPhoto:
+		return &tele.Photo{File: tele.File{FileID: fileID}, Caption: caption}
+	case MediaDocument:
+		return &tele.Document{File: tele.File{FileID: fileID}, Caption: caption, FileName: rec.FileName, MIME: rec.MimeType}
+	case MediaVideo:
+		return &tele.Video{File: tele.File{FileID: fileID}, Caption: caption, MIME: rec.MimeType}
+	case MediaVoice:
+		return &tele.Voice{File: tele.File{FileID: fileID}, Caption: caption, Duration: rec.Duration}
+	case MediaVideoNote:
+		return &tele.VideoNote{File: tele.File{FileID: fileID}, Duration: rec.Duration, Length: rec.Length}
 	}
-	return id, nil
+	return nil
 }
 
-func downloadByRecord(b *tele.Bot, rec *MediaRecord) (string, error) {
+func downloadByRecord(b *tele.Bot, rec *MediaRecord, fileID string) (string, error) {
 	if err := os.MkdirAll("downloads", 0o755); err != nil {
 		return "", err
 	}
-	file := tele.File{FileID: rec.FileID}
+	file := tele.File{FileID: fileID}
 
 	ext := ".bin"
 	switch rec.Type {
@@ -195,10 +775,21 @@ func downloadByRecord(b *tele.Bot, rec *MediaRecord) (string, error) {
 		ext = ".jpg"
 	case MediaVideo:
 		ext = ".mp4"
+	case MediaVoice:
+		// Suffixes that make an upload of the file restore the note
+		ext = ".voice.ogg"
+	case MediaVideoNote:
+		ext = ".round.mp4"
 	}
 	name := rec.FileName
 	if name == "" {
 		name = fmt.Sprintf("%d_%d%s", rec.ChatID, rec.MessageID, ext)
+		// Keep a smaller size from overwriting the original
+		for i, s := range rec.Sizes {
+			if s.FileID == fileID && i < len(rec.Sizes)-1 {
+				name = fmt.Sprintf("%d_%d_%d%s", rec.ChatID, rec.MessageID, i+1, ext)
+			}
+		}
 	} else if filepath.Ext(name) == "" {
 		name += ext
 	}
@@ -210,3 +801,399 @@ func downloadByRecord(b *tele.Bot, rec *MediaRecord) (string, error) {
 	}
 	return dst, nil
 }
+
+// findPage searches the index for an exact #tag or a keyword and renders
+// the matches with links to their messages, newest first
+func findPage(media *index.Store, arg string, n int) (*page, error) {
+	q := index.Query{Text: arg, Offset: n * pageSize, Limit: pageSize}
+	if tag, ok := strings.CutPrefix(arg, "#"); ok {
+		q = index.Query{Tag: tag, Offset: n * pageSize, Limit: pageSize}
+	}
+	entries, total := media.Search(q)
+	if total == 0 {
+		return &page{text: messages.Text("bot.find_none", arg), pages: 1}, nil
+	}
+	return &page{text: messages.Text("bot.find_results", total, arg) + renderEntries(entries), pages: pageCount(total)}, nil
+}
+
+// listPage renders the newest entries of the index, of one tag unless tag
+// is empty
+func listPage(media *index.Store, tag string, n int) (*page, error) {
+	entries, total := media.Search(index.Query{Tag: tag, Offset: n * pageSize, Limit: pageSize})
+	switch {
+	case total == 0:
+		return &page{text: messages.Text("bot.list_none"), pages: 1}, nil
+	case tag != "":
+		return &page{text: messages.Text("bot.list_tag", total, tag) + renderEntries(entries), pages: pageCount(total)}, nil
+	}
+	return &page{text: messages.Text("bot.list_all", total) + renderEntries(entries), pages: pageCount(total)}, nil
+}
+
+// renderEntries lists entries by caption, size and link
+func renderEntries(entries []*index.Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\n\n%s", e.Caption)
+		if e.Parts > 1 {
+			b.WriteString(messages.Text("bot.find_parts", e.Parts))
+		}
+		fmt.Fprintf(&b, ", %s", util.FormatBytesToHumanReadable(e.Size))
+		if link := e.Link(); link != "" {
+			fmt.Fprintf(&b, "\n%s", link)
+		}
+	}
+	return b.String()
+}
+
+// cancelBtn cancels the daemon job of its data
+var cancelBtn = &tele.Btn{Unique: "cancel_job"}
+
+// nextFiles is how many files of local_dir the first page of /jobs shows
+const nextFiles = 5
+
+// jobsPage renders the active and queued daemon jobs in run order with
+// Cancel buttons, and on the first page the files the next upload run takes
+func jobsPage(daemonURL string, n int) (*page, error) {
+	list, err := listJobs(daemonURL)
+	if err != nil {
+		return nil, errors.New(messages.Text("bot.jobs_failed", err))
+	}
+
+	var text strings.Builder
+	if len(list) == 0 {
+		text.WriteString(messages.Text("bot.jobs_none") + "\n")
+	}
+	var rows []tele.Row
+	for _, job := range list[min(n*pageSize, len(list)):min((n+1)*pageSize, len(list))] {
+		if job.Priority > 0 {
+			text.WriteString("⚡")
+		}
+		fmt.Fprintf(&text, "#%d %s, %s", job.ID, job.Type, job.State)
+		if t := job.target(); t != "" {
+			fmt.Fprintf(&text, ": %s", t)
+		}
+		if job.Percent > 0 {
+			fmt.Fprintf(&text, " (%.0f%%", job.Percent)
+			if eta := job.eta(); eta > 0 {
+				text.WriteString(messages.Text("bot.jobs_eta", eta))
+			}
+			text.WriteString(")")
+		}
+		text.WriteString("\n")
+		rows = append(rows, tele.Row{{Unique: cancelBtn.Unique, Text: messages.Text("bot.jobs_cancel", job.ID), Data: strconv.FormatInt(job.ID, 10)}})
+	}
+	if n == 0 {
+		if files, err := localQueue(daemonURL); err == nil && len(files) > 0 {
+			text.WriteString("\n" + messages.Text("bot.jobs_files", len(files)) + "\n")
+			for _, f := range files[:min(len(files), nextFiles)] {
+				if f.Priority {
+					text.WriteString("⚡")
+				}
+				text.WriteString(f.Name + "\n")
+			}
+		}
+	}
+	return &page{text: text.String(), pages: pageCount(len(list)), rows: rows}, nil
+}
+
+// defaultShareTTL is how long /share media lives once opened, in seconds
+const defaultShareTTL = 30
+
+// parseShareArgs reads "/share <media id> <@user or user id> [seconds]"
+func parseShareArgs(args []string) (entryID int64, to string, ttl int, err error) {
+	usage := errors.New(messages.Text("bot.share_usage", defaultShareTTL))
+	if len(args) < 2 || len(args) > 3 {
+		return 0, "", 0, usage
+	}
+	if entryID, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+		return 0, "", 0, usage
+	}
+	ttl = defaultShareTTL
+	if len(args) == 3 {
+		if ttl, err = strconv.Atoi(args[2]); err != nil || ttl < 1 || ttl > 60 {
+			return 0, "", 0, usage
+		}
+	}
+	return entryID, args[1], ttl, nil
+}
+
+// submitSave queues a yt-dlp save job on the daemon and returns the job ID
+func submitSave(daemonURL, videoURL string) (int64, error) {
+	job, err := postJob(daemonURL, "/api/save", map[string]string{"url": videoURL})
+	if err != nil {
+		return 0, err
+	}
+	return job.ID, nil
+}
+
+// daemonJob is the part of a daemon job the bot reports
+type daemonJob struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	State     string          `json:"state"`
+	Priority  int             `json:"priority"`
+	Progress  string          `json:"progress"`
+	Percent   float64         `json:"percent"`
+	StartedAt time.Time       `json:"started_at"`
+	Result    []string        `json:"result"`
+	Error     string          `json:"error"`
+	Category  string          `json:"category"`
+}
+
+// target describes what the job works on, from its payload
+func (j *daemonJob) target() string {
+	var p struct {
+		EntryID int64  `json:"entry_id"`
+		URL     string `json:"url"`
+		To      string `json:"to"`
+	}
+	json.Unmarshal(j.Payload, &p)
+	switch {
+	case j.Progress != "":
+		return j.Progress
+	case p.URL != "":
+		return p.URL
+	case p.EntryID != 0 && p.To != "":
+		return fmt.Sprintf("media %d to %s", p.EntryID, p.To)
+	case p.EntryID != 0:
+		return fmt.Sprintf("media %d", p.EntryID)
+	default:
+		return ""
+	}
+}
+
+// eta estimates the time left of a running job from its percentage
+func (j *daemonJob) eta() time.Duration {
+	if j.State != "running" || j.Percent <= 0 || j.StartedAt.IsZero() {
+		return 0
+	}
+	elapsed := time.Since(j.StartedAt)
+	return time.Duration(float64(elapsed) * (100 - j.Percent) / j.Percent).Round(time.Second)
+}
+
+// daemonToken is http.token of the daemon, sent with every API call
+var daemonToken string
+
+// daemonCall sends a request with a JSON body (or none) to the daemon API
+func daemonCall(method, target string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if daemonToken != "" {
+		req.Header.Set("Authorization", "Bearer "+daemonToken)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// postJob submits a job to the daemon API
+func postJob(daemonURL, path string, payload any) (*daemonJob, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := daemonCall(http.MethodPost, daemonURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var job daemonJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("invalid daemon response: %w", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("%s: %s", resp.Status, job.Error)
+	}
+	return &job, nil
+}
+
+// jobPollInterval is how often watchJob refreshes a status message
+const jobPollInterval = 5 * time.Second
+
+// watchJob edits status with the progress of a daemon job until it ends
+func watchJob(b *tele.Bot, status *tele.Message, daemonURL string, id int64) {
+	last, failures := "", 0
+	for {
+		time.Sleep(jobPollInterval)
+		job, err := getJob(daemonURL, id)
+		if err != nil {
+			// Give up after a minute without an answer
+			if failures++; failures >= 12 {
+				log.Warn.Printf("Stopped polling job %d: %v", id, err)
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		text := messages.Text("bot.job_running", id, job.State)
+		done := true
+		switch job.State {
+		case "done":
+			text = messages.Text("bot.job_done", id, strings.Join(job.Result, "\n"))
+		case "failed":
+			text = messages.Text("bot.job_failed", id, cmp.Or(job.Category, "other"), job.Error)
+		case "canceled":
+			text = messages.Text("bot.job_canceled", id)
+		default:
+			done = false
+			if job.Progress != "" {
+				text += ": " + job.Progress
+			}
+		}
+
+		if text != last {
+			if _, err := b.Edit(status, text); err != nil {
+				log.Warn.Printf("Failed to update the status of job %d: %v", id, err)
+			}
+			last = text
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// listJobs fetches the queued and running daemon jobs in the order the
+// daemon runs them
+func listJobs(daemonURL string) ([]daemonJob, error) {
+	resp, err := daemonCall(http.MethodGet, daemonURL+"/api/jobs", nil)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("daemon returned %s", resp.Status)
+	}
+
+	var all []daemonJob
+	if err := json.NewDecoder(resp.Body).Decode(&all); err != nil {
+		return nil, fmt.Errorf("invalid daemon response: %w", err)
+	}
+	var active []daemonJob
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].State == "queued" || all[i].State == "running" {
+			active = append(active, all[i])
+		}
+	}
+	// Like jobs.RunOrder, keeping oldest first within a priority
+	slices.SortStableFunc(active, func(a, b daemonJob) int {
+		if (a.State == "running") != (b.State == "running") {
+			if a.State == "running" {
+				return -1
+			}
+			return 1
+		}
+		return b.Priority - a.Priority
+	})
+	return active, nil
+}
+
+// queuedFile is a file of local_dir in the upload order of the daemon
+type queuedFile struct {
+	Name     string `json:"name"`
+	Priority bool   `json:"priority"`
+}
+
+// localQueue fetches the files of local_dir in upload order
+func localQueue(daemonURL string) ([]queuedFile, error) {
+	resp, err := daemonCall(http.MethodGet, daemonURL+"/api/queue", nil)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("daemon returned %s", resp.Status)
+	}
+
+	var files []queuedFile
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return nil, fmt.Errorf("invalid daemon response: %w", err)
+	}
+	return files, nil
+}
+
+// prioritize marks a file of local_dir to upload first
+func prioritize(daemonURL, name string) error {
+	body, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return err
+	}
+	resp, err := daemonCall(http.MethodPost, daemonURL+"/api/queue/priority", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var out struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return fmt.Errorf("%s: %s", resp.Status, out.Error)
+	}
+	return nil
+}
+
+// cancelJob cancels a daemon job
+func cancelJob(daemonURL string, id int64) error {
+	resp, err := daemonCall(http.MethodPost, fmt.Sprintf("%s/api/jobs/%d/cancel", daemonURL, id), nil)
+	if err != nil {
+		return fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var job daemonJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return fmt.Errorf("invalid daemon response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(job.Error)
+	}
+	return nil
+}
+
+// pauseDaemon pauses or resumes the daemon job queue and reports whether
+// that changed anything
+func pauseDaemon(daemonURL string, pause bool) (bool, error) {
+	path := "/api/resume"
+	if pause {
+		path = "/api/pause"
+	}
+	resp, err := daemonCall(http.MethodPost, daemonURL+path, nil)
+	if err != nil {
+		return false, fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("daemon returned %s", resp.Status)
+	}
+
+	var state struct {
+		Changed bool `json:"changed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return false, fmt.Errorf("invalid daemon response: %w", err)
+	}
+	return state.Changed, nil
+}
+
+// getJob fetches a daemon job
+func getJob(daemonURL string, id int64) (*daemonJob, error) {
+	resp, err := daemonCall(http.MethodGet, fmt.Sprintf("%s/api/jobs/%d", daemonURL, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var job daemonJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("invalid daemon response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, job.Error)
+	}
+	return &job, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"tg-storage-assistant/internal/messages"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// pageSize is how many items a page of a bot list shows
+const pageSize = 10
+
+var pageBtn = &tele.Btn{Unique: "page"}
+
+// page is one page of a bot list
+type page struct {
+	text  string
+	pages int        // in the whole list, at least 1
+	rows  []tele.Row // buttons of the items, above the navigation
+}
+
+// pageSource renders page n (from 0) of a list for the command argument.
+// Its errors are shown to the user as they are.
+type pageSource func(arg string, n int) (*page, error)
+
+// pager sends lists a page at a time with buttons that turn the page by
+// editing the message. The list, page and argument are kept in the
+// callback data; arguments too long for it are kept in memory instead.
+type pager struct {
+	bot   *tele.Bot
+	lists map[string]pageSource
+
+	mu   sync.Mutex
+	args []string // long arguments, referred to as ~<index>
+}
+
+func newPager(b *tele.Bot) *pager {
+	return &pager{bot: b, lists: make(map[string]pageSource)}
+}
+
+// add registers a list under a short name
+func (p *pager) add(name string, src pageSource) {
+	p.lists[name] = src
+}
+
+// send replies with the first page of the named list
+func (p *pager) send(c tele.Context, name, arg string) error {
+	pg, err := p.lists[name](arg, 0)
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+	return c.Reply(pg.text, p.markup(name, arg, 0, pg), tele.NoPreview)
+}
+
+// turn handles the navigation buttons
+func (p *pager) turn(c tele.Context) error {
+	name, arg, n, err := p.parse(c.Callback().Data)
+	src, ok := p.lists[name]
+	if err != nil || !ok {
+		return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.page_invalid")})
+	}
+	pg, err := src(arg, n)
+	if err == nil && n >= pg.pages {
+		// The list shrank since the page was sent
+		n = pg.pages - 1
+		pg, err = src(arg, n)
+	}
+	if err != nil {
+		return c.Respond(&tele.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+
+	err = c.Edit(pg.text, p.markup(name, arg, n, pg), tele.NoPreview)
+	if err != nil && !errors.Is(err, tele.ErrSameMessageContent) && !errors.Is(err, tele.ErrMessageNotModified) {
+		return c.Respond(&tele.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+	return c.Respond()
+}
+
+// markup is the item buttons of pg followed by the navigation: previous,
+// the page number, which reloads the page, and next
+func (p *pager) markup(name, arg string, n int, pg *page) *tele.ReplyMarkup {
+	markup := p.bot.NewMarkup()
+	rows := pg.rows
+	if pg.pages > 1 {
+		var nav tele.Row
+		if n > 0 {
+			nav = append(nav, markup.Data("◀️", pageBtn.Unique, p.data(name, arg, n-1)))
+		}
+		nav = append(nav, markup.Data(fmt.Sprintf("%d/%d", n+1, pg.pages), pageBtn.Unique, p.data(name, arg, n)))
+		if n < pg.pages-1 {
+			nav = append(nav, markup.Data("▶️", pageBtn.Unique, p.data(name, arg, n+1)))
+		}
+		rows = append(rows, nav)
+	}
+	markup.Inline(rows...)
+	return markup
+}
+
+// data encodes a page as "<list>|<page>|<arg>"
+func (p *pager) data(name, arg string, n int) string {
+	data := name + "|" + strconv.Itoa(n) + "|" + arg
+	if len("\f"+pageBtn.Unique+"|"+data) <= maxCallbackData && !strings.HasPrefix(arg, "~") {
+		return data
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := len(p.args)
+	for j, a := range p.args {
+		if a == arg {
+			i = j
+			break
+		}
+	}
+	if i == len(p.args) {
+		p.args = append(p.args, arg)
+	}
+	return name + "|" + strconv.Itoa(n) + "|~" + strconv.Itoa(i)
+}
+
+// parse decodes what data encoded
+func (p *pager) parse(data string) (name, arg string, n int, err error) {
+	name, rest, _ := strings.Cut(data, "|")
+	num, arg, _ := strings.Cut(rest, "|")
+	if n, err = strconv.Atoi(num); err != nil || n < 0 {
+		return "", "", 0, fmt.Errorf("invalid page %q", num)
+	}
+	if ref, ok := strings.CutPrefix(arg, "~"); ok {
+		i, err := strconv.Atoi(ref)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if err != nil || i < 0 || i >= len(p.args) {
+			return "", "", 0, fmt.Errorf("unknown argument %q", arg)
+		}
+		arg = p.args[i]
+	}
+	return name, arg, n, nil
+}
+
+// pageCount is the number of pages of total items, at least 1
+func pageCount(total int) int {
+	return max((total+pageSize-1)/pageSize, 1)
+}
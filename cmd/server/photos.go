@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"tg-storage-assistant/internal/messages"
+	"time"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// PhotoSize is one of the resolutions Telegram keeps of a photo
+type PhotoSize struct {
+	FileID   string
+	FileUID  string
+	Width    int
+	Height   int
+	FileSize int64
+}
+
+// photoSizes holds the sizes of photos read by photoPoller until the photo
+// handler picks them up
+type photoSizes struct {
+	mu    sync.Mutex
+	sizes map[[2]int64][]PhotoSize
+}
+
+func (s *photoSizes) put(chatID int64, msgID int, sizes []PhotoSize) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sizes == nil {
+		s.sizes = make(map[[2]int64][]PhotoSize)
+	}
+	s.sizes[[2]int64{chatID, int64(msgID)}] = sizes
+}
+
+func (s *photoSizes) take(chatID int64, msgID int) []PhotoSize {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]int64{chatID, int64(msgID)}
+	sizes := s.sizes[key]
+	delete(s.sizes, key)
+	return sizes
+}
+
+var pendingSizes photoSizes
+
+// photoPoller is tele.LongPoller that also keeps every size of incoming
+// photos, which telebot reduces to the largest one
+type photoPoller struct {
+	Timeout      time.Duration
+	LastUpdateID int
+}
+
+// Poll does long polling like tele.LongPoller
+func (p *photoPoller) Poll(b *tele.Bot, dest chan tele.Update, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		data, err := b.Raw("getUpdates", map[string]string{
+			"offset":  strconv.Itoa(p.LastUpdateID + 1),
+			"timeout": strconv.Itoa(int(p.Timeout / time.Second)),
+		})
+		if err != nil {
+			log.Debug.Printf("getUpdates failed: %v", err)
+			continue
+		}
+		var resp struct {
+			Result []json.RawMessage
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			log.Warn.Printf("Invalid getUpdates response: %v", err)
+			continue
+		}
+
+		for _, raw := range resp.Result {
+			var update tele.Update
+			if err := json.Unmarshal(raw, &update); err != nil {
+				log.Warn.Printf("Invalid update: %v", err)
+				continue
+			}
+			keepPhotoSizes(raw)
+			p.LastUpdateID = update.ID
+			dest <- update
+		}
+	}
+}
+
+// keepPhotoSizes records the sizes of a photo message in pendingSizes
+func keepPhotoSizes(raw json.RawMessage) {
+	var update struct {
+		Message *struct {
+			ID   int `json:"message_id"`
+			Chat struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+			Photo []struct {
+				FileID   string `json:"file_id"`
+				UniqueID string `json:"file_unique_id"`
+				Width    int    `json:"width"`
+				Height   int    `json:"height"`
+				FileSize int64  `json:"file_size"`
+			} `json:"photo"`
+		} `json:"message"`
+	}
+	if json.Unmarshal(raw, &update) != nil || update.Message == nil || len(update.Message.Photo) == 0 {
+		return
+	}
+	m := update.Message
+	sizes := make([]PhotoSize, len(m.Photo))
+	for i, p := range m.Photo {
+		sizes[i] = PhotoSize{FileID: p.FileID, FileUID: p.UniqueID, Width: p.Width, Height: p.Height, FileSize: p.FileSize}
+	}
+	pendingSizes.put(m.Chat.ID, m.ID, sizes)
+}
+
+// pickSize selects a photo size by name (small, medium, large), by index as
+// listed in the save reply or by the largest side not above a pixel count
+func pickSize(sizes []PhotoSize, arg string) (PhotoSize, error) {
+	if len(sizes) == 0 {
+		return PhotoSize{}, errors.New(messages.Text("bot.no_sizes"))
+	}
+	switch strings.ToLower(arg) {
+	case "", "large", "l":
+		return sizes[len(sizes)-1], nil
+	case "medium", "m":
+		return sizes[len(sizes)/2], nil
+	case "small", "s":
+		return sizes[0], nil
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n <= 0 {
+		return PhotoSize{}, errors.New(messages.Text("bot.unknown_size", arg))
+	}
+	if n <= len(sizes) {
+		return sizes[n-1], nil
+	}
+	// Sizes are ordered from the smallest, so keep the last one that fits
+	best := sizes[0]
+	for _, s := range sizes {
+		if max(s.Width, s.Height) <= n {
+			best = s
+		}
+	}
+	return best, nil
+}
+
+// describeSizes lists the sizes of a photo for the save reply
+func describeSizes(sizes []PhotoSize) string {
+	parts := make([]string, len(sizes))
+	for i, s := range sizes {
+		parts[i] = fmt.Sprintf("%d: %dx%d", i+1, s.Width, s.Height)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/messages"
+	"time"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// tagSuggestions caps the tags offered as buttons after media is saved
+const tagSuggestions = 6
+
+// maxCallbackData is Telegram's limit for the data of an inline button
+const maxCallbackData = 64
+
+var (
+	tagBtn  = &tele.Btn{Unique: "tag"}
+	skipBtn = &tele.Btn{Unique: "tag_skip"}
+)
+
+// tagPrompt is a save reply asking for the tag of rec
+type tagPrompt struct {
+	rec  *MediaRecord
+	text string // the reply without the question
+}
+
+// tagger asks for a tag after media is saved and records the answer in the
+// media index, so media sent from a phone is categorized like uploads
+type tagger struct {
+	bot   *tele.Bot
+	media *index.Store
+
+	mu      sync.Mutex
+	prompts map[[2]int64]*tagPrompt // by chat and prompt message
+}
+
+func newTagger(b *tele.Bot, media *index.Store) *tagger {
+	return &tagger{bot: b, media: media, prompts: make(map[[2]int64]*tagPrompt)}
+}
+
+// ask replies text to the saved media and adds the question with the most
+// used tags as buttons
+func (t *tagger) ask(c tele.Context, rec *MediaRecord, text string) error {
+	markup := t.bot.NewMarkup()
+	var row tele.Row
+	for _, tag := range suggestTags(t.media, tagSuggestions) {
+		if len("\f"+tagBtn.Unique+"|"+tag) > maxCallbackData {
+			continue
+		}
+		row = append(row, markup.Data("#"+tag, tagBtn.Unique, tag))
+	}
+	rows := []tele.Row{markup.Row(markup.Data(messages.Text("bot.tag_skip"), skipBtn.Unique))}
+	if len(row) > 0 {
+		rows = append(markup.Split(3, row), rows...)
+	}
+	markup.Inline(rows...)
+
+	prompt, err := t.bot.Reply(c.Message(), text+"\n"+messages.Text("bot.tag_prompt"), markup)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.prompts[[2]int64{prompt.Chat.ID, int64(prompt.ID)}] = &tagPrompt{rec: rec, text: text}
+	t.mu.Unlock()
+	return nil
+}
+
+// take removes and returns the prompt of msg, nil when it was answered
+func (t *tagger) take(msg *tele.Message) *tagPrompt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := [2]int64{msg.Chat.ID, int64(msg.ID)}
+	p := t.prompts[key]
+	delete(t.prompts, key)
+	return p
+}
+
+// choose handles a suggested tag button
+func (t *tagger) choose(c tele.Context) error {
+	p := t.take(c.Callback().Message)
+	if p == nil {
+		return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.tag_answered")})
+	}
+	if err := t.apply(c.Callback().Message, p, c.Callback().Data); err != nil {
+		return c.Respond(&tele.CallbackResponse{Text: messages.Text("bot.tag_failed", err), ShowAlert: true})
+	}
+	return c.Respond()
+}
+
+// skip handles the Skip button
+func (t *tagger) skip(c tele.Context) error {
+	if p := t.take(c.Callback().Message); p != nil {
+		if _, err := t.bot.Edit(c.Callback().Message, p.text); err != nil {
+			log.Warn.Printf("Failed to update the tag prompt: %v", err)
+		}
+	}
+	return c.Respond()
+}
+
+// reply handles a text message, which answers a prompt when it replies to it
+func (t *tagger) reply(c tele.Context) error {
+	to := c.Message().ReplyTo
+	if to == nil {
+		return nil
+	}
+	p := t.take(to)
+	if p == nil {
+		return nil
+	}
+	tag := fileprocessor.SanitizeTag(strings.TrimPrefix(strings.TrimSpace(c.Text()), "#"), false)
+	if tag == "" {
+		t.mu.Lock()
+		t.prompts[[2]int64{to.Chat.ID, int64(to.ID)}] = p
+		t.mu.Unlock()
+		return c.Reply(messages.Text("bot.tag_invalid"))
+	}
+	if err := t.apply(to, p, tag); err != nil {
+		return c.Reply(messages.Text("bot.tag_failed", err))
+	}
+	return nil
+}
+
+// apply indexes the media of p under tag and updates the prompt
+func (t *tagger) apply(prompt *tele.Message, p *tagPrompt, tag string) error {
+	description, _, _ := strings.Cut(strings.TrimSpace(p.rec.Caption), "\n")
+	if err := t.media.Add(mediaEntry(p.rec, tag, description)); err != nil {
+		return err
+	}
+	log.Info.Printf("Tagged message %d in chat %d as #%s", p.rec.MessageID, p.rec.ChatID, tag)
+	if _, err := t.bot.Edit(prompt, p.text+"\n"+messages.Text("bot.tagged", tag)); err != nil {
+		log.Warn.Printf("Failed to update the tag prompt: %v", err)
+	}
+	return nil
+}
+
+// mediaEntry is the index entry of media received by the bot. Its caption
+// is what the uploader would write: "#tag description".
+func mediaEntry(rec *MediaRecord, tag, description string) *index.Entry {
+	return &index.Entry{
+		ChatID:      rec.ChatID,
+		Files:       []index.File{{MessageID: rec.MessageID, Name: rec.FileName, Size: rec.FileSize}},
+		Tag:         tag,
+		Description: description,
+		Caption:     strings.TrimSpace("#" + tag + " " + description),
+		FileName:    rec.FileName,
+		MediaType:   string(rec.Type),
+		Source:      "bot",
+		Size:        rec.FileSize,
+		CreatedAt:   time.Unix(rec.UnixTime, 0),
+	}
+}
+
+// suggestTags returns the n most used tags of the index
+func suggestTags(media *index.Store, n int) []string {
+	entries, _ := media.Search(index.Query{})
+	counts := make(map[string]int)
+	for _, e := range entries {
+		if e.Tag != "" {
+			counts[e.Tag]++
+		}
+	}
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	return tags[:min(n, len(tags))]
+}
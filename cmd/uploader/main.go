@@ -2,109 +2,399 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"os/signal"
+	"syscall"
 	"tg-storage-assistant/internal/client"
 	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/ffmpeg"
 	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
 	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/notify"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/internal/priority"
+	"tg-storage-assistant/internal/retry"
+	"tg-storage-assistant/internal/ui"
 	"tg-storage-assistant/internal/video"
+	"time"
+
+	"github.com/gotd/td/tg"
 )
 
+var log = logger.Named("uploader")
+
 func main() {
 	ctx := context.Background()
 
 	// Parse configuration from command-line arguments
 	allConfig, err := config.ParseConfig()
 	if err != nil {
-		logger.Error.Fatal(err)
+		log.Error.Fatal(err)
 	}
 	cfg := allConfig.Mtproto
+	if err := ui.Setup(ui.ProgressMode(allConfig.Logging.Progress), allConfig.Logging.ProgressJSON); err != nil {
+		log.Error.Fatal(err)
+	}
+	defer ui.CloseEvents()
+
+	// Failures before the client runs can only be reported through the bot
+	notifier := notify.New(&allConfig.Notify, &allConfig.Bot, nil)
+	fatal := func(err error) {
+		notify.Send(notifier, fmt.Sprintf("❌ Upload run failed: %v", err))
+		exit(err)
+	}
+
+	// Without ffmpeg and ffprobe videos stay in local_dir, anything else is
+	// still uploaded
+	videos := true
+	if err := ffmpeg.Available(); err != nil {
+		log.Warn.Printf("%v, only images and documents will be uploaded", err)
+		videos = false
+	}
+
+	// Open media index
+	store, err := index.Open(allConfig.Index.Path)
+	if err != nil {
+		fatal(err)
+	}
 
-	// Check if ffmpeg and ffprobe are available (required for video processing)
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		logger.Error.Fatal("ffmpeg not found in PATH. Video processing will fail")
+	// Failed uploads are recorded for `cli daemon` to retry
+	retries, err := retry.Open(allConfig.Retry.Path, allConfig.Retry.MaxAttempts, allConfig.Retry.DelayDuration)
+	if err != nil {
+		fatal(err)
 	}
-	if _, err := exec.LookPath("ffprobe"); err != nil {
-		logger.Error.Fatal("ffprobe not found in PATH. Video processing will fail")
+	marks, err := priority.Open(allConfig.Priority.Path)
+	if err != nil {
+		fatal(err)
 	}
 
 	// Create client
 	client, err := client.NewClient(ctx, &cfg)
 	if err != nil {
-		logger.Error.Fatal(err)
+		fatal(err)
 	}
 
 	// Run client
+	notified := false
 	if err := client.Run(func(ctx context.Context) error {
+		notifier = notify.New(&allConfig.Notify, &allConfig.Bot, client)
+		fail := func(err error) error {
+			notify.Send(notifier, fmt.Sprintf("❌ Upload run failed: %v", err))
+			notified = true
+			return err
+		}
+
 		// Scan for files
 		processor := fileprocessor.NewProcessor(cfg.LocalDir, cfg.DoneDir)
 		files, err := processor.ScanFiles()
 		if err != nil {
-			return fmt.Errorf("failed to scan files: %w", err)
+			return fail(fmt.Errorf("failed to scan files: %w", err))
+		}
+		files, busy, err := processor.StableFiles(ctx, files, cfg.StableForDuration)
+		if err != nil {
+			return fail(err)
+		}
+		for _, name := range busy {
+			log.Info.Printf("%s is still being written, leaving it for the next run", name)
+		}
+		processor.SortFiles(files, cfg.ScanOrderBy, cfg.ScanOrderDesc)
+		if !videos {
+			var skipped int
+			if files, skipped = fileprocessor.WithoutVideos(files); skipped > 0 {
+				log.Warn.Printf("Leaving %d video(s) in local_dir until ffmpeg is installed", skipped)
+			}
+		}
+		files, _ = pipeline.Prioritize(&cfg, marks, files)
+		files, budget := pipeline.WithinBudget(store, &cfg, processor, files, time.Now())
+		if budget != "" {
+			log.Warn.Print(budget)
 		}
 
 		if len(files) == 0 {
+			// Nothing to do is not worth a message
+			notified = true
 			return fmt.Errorf("no files to process")
 		}
 
 		peer, err := client.ResolvePeer(cfg.StorageChatID)
 		if err != nil {
-			return fmt.Errorf("resolve peer: %w", err)
+			return fail(fmt.Errorf("resolve peer: %w", err))
 		}
 
-		logger.Info.Printf("Found %d files to process", len(files))
+		log.Info.Printf("Found %d files to process", len(files))
+		quota := pipeline.QuotaWarning(store, &cfg, processor.TotalSize(files))
+		for _, w := range quota {
+			log.Warn.Print(w)
+			notify.Send(notifier, "⚠️ "+w)
+		}
 
-		// Process each file
-		stats := fileprocessor.Stats{}
-		for _, filename := range files {
-			stats.Processed++
+		// Ctrl+C aborts the current upload but keeps the connection for the
+		// summary; a second Ctrl+C quits immediately
+		uploadCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigs)
+		go func() {
+			select {
+			case <-sigs:
+				log.Warn.Println("Interrupted, aborting the current upload (press Ctrl+C again to quit now)")
+				signal.Stop(sigs)
+				cancel()
+			case <-uploadCtx.Done():
+			}
+		}()
 
-			// Parse filename
-			tag, description, err := fileprocessor.ParseFilename(filename)
-			if err != nil {
-				logger.Warn.Printf("Skipping file %s - %v", filename, err)
-				stats.Failed++
-				continue
+		if at := allConfig.Schedule.At; !at.IsZero() {
+			log.Info.Printf("Scheduling uploads from %s, every %s", at.Format(time.DateTime), allConfig.Schedule.Every)
+		}
+		started := time.Now()
+		stats := uploadFiles(client.WithContext(uploadCtx), peer, processor, store, retries, marks, &cfg, allConfig.Schedule, files)
+		stats.Warnings = quota
+		if budget != "" {
+			stats.Warnings = append(stats.Warnings, budget)
+		}
+		pipeline.RecordRun(store, "uploader", started, stats)
+		log.Info.Println(stats.Summary())
+		ui.EmitRunFinished(stats)
+		if stats.Succeeded > 0 {
+			if err := client.MarkRead(cfg.StorageChatID, 0); err != nil {
+				log.Warn.Printf("Failed to mark the storage chat read: %v", err)
 			}
+		}
 
-			// Get full file path
-			filePath := processor.GetFilePath(filename)
+		status := "✅ Upload run finished"
+		switch {
+		case uploadCtx.Err() != nil:
+			status = "⏹ Upload run interrupted"
+		case stats.Failed > 0:
+			status = "⚠️ Upload run finished with failures"
+		}
+		notify.Send(notifier, status+"\n"+stats.Summary())
+		notified = true
+		return failuresError(stats)
+	}); err != nil {
+		if notified {
+			exit(err)
+		}
+		// Connection or login failures: the client is not usable for a DM
+		notifier = notify.New(&allConfig.Notify, &allConfig.Bot, nil)
+		fatal(err)
+	}
+}
 
-			// Get file info for logging
-			fileInfo, err := os.Stat(filePath)
+// exit logs err and exits with its errs.ExitCode, so wrapper scripts can
+// tell login problems from transient failures
+func exit(err error) {
+	log.Error.Print(err)
+	os.Exit(errs.ExitCode(err))
+}
+
+// failuresError joins the reasons of the failed files, nil if all succeeded
+func failuresError(stats *fileprocessor.Stats) error {
+	if stats.Failed == 0 {
+		return nil
+	}
+	reasons := make([]error, len(stats.Failures))
+	for i, f := range stats.Failures {
+		reasons[i] = client.Classify(f.Err)
+	}
+	return fmt.Errorf("%d file(s) failed: %w", stats.Failed, errors.Join(reasons...))
+}
+
+// uploadFiles processes each file in order and returns the run statistics
+func uploadFiles(
+	client *client.Client,
+	peer tg.InputPeerClass,
+	processor *fileprocessor.Processor,
+	store *index.Store,
+	retries *retry.Queue,
+	marks *priority.Marks,
+	cfg *config.MtprotoConfig,
+	schedule config.Schedule,
+	files []string,
+) *fileprocessor.Stats {
+	stats := &fileprocessor.Stats{}
+	ctx := client.Context()
+	scheduled := 0
+	for _, filename := range files {
+		if ctx.Err() != nil {
+			log.Info.Printf("Interrupted, %d file(s) left in local_dir", len(files)-stats.Processed)
+			break
+		}
+		stats.Processed++
+
+		// Get full file path
+		filePath := processor.GetFilePath(filename)
+
+		// Parse filename
+		tag, description, err := pipeline.ParseName(cfg, filePath)
+		if err != nil {
+			log.Warn.Printf("Skipping file %s - %v", filename, err)
+			stats.Fail(filename, err)
+			continue
+		}
+
+		// Get file info for logging
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			log.Warn.Printf("Failed to get file info for %s - %v", filename, err)
+			stats.Fail(filename, err)
+			continue
+		}
+
+		// Look for an earlier upload the index doesn't know about
+		caption := pipeline.Caption(cfg, filePath, tag, description)
+		proc := cfg.Processing(tag)
+		isPhoto := pipeline.IsPhoto(cfg, proc, filename)
+		asDocument := proc.AsDocument || (!isPhoto && !fileprocessor.IsVideoFile(filename))
+		if err := pipeline.CheckInput(filePath, !asDocument && !isPhoto); err != nil {
+			// Retrying can't fix it
+			pipeline.Quarantine(cfg, filename, err)
+			stats.Fail(filename, err)
+			pipeline.Forget(retries, marks, filename)
+			continue
+		}
+		sum, err := pipeline.ContentHash(cfg, filePath)
+		if err != nil {
+			log.Warn.Printf("Failed to hash %s - %v", filename, err)
+			stats.Fail(filename, err)
+			continue
+		}
+		previous := pipeline.CurrentVersion(store, cfg, tag, filename)
+		if previous != nil && pipeline.Unchanged(previous, sum, fileInfo.Size()) {
+			log.Info.Printf("%s is unchanged since media %d", filename, previous.ID)
+			if err := video.MoveVideoFiles(cfg, filename, sum); err != nil {
+				log.Warn.Printf("Skipped %s but failed to move file - %v", filename, err)
+			}
+			stats.Skipped++
+			continue
+		}
+		// The caption of a known file would find the version it replaces
+		existing := pipeline.FindHashed(store, cfg, sum)
+		if existing == nil && previous == nil {
+			existing, err = pipeline.FindUploaded(client, cfg, tag, description, caption, fileInfo.Size(), asDocument)
 			if err != nil {
-				logger.Warn.Printf("Failed to get file info for %s - %v", filename, err)
-				stats.Failed++
-				continue
+				log.Warn.Printf("%v", err)
 			}
-
-			if !fileprocessor.IsVideoFile(filename) {
-				logger.Warn.Printf("Skipping non-video file: %s", filename)
-				stats.Failed++
+		}
+		if existing != nil {
+			log.Warn.Printf("%s looks already uploaded (message %d)", filename, existing.MessageID())
+			if cfg.DuplicateCheck == "skip" {
+				// Entries found by hash are in the index already
+				if existing.ID == 0 {
+					existing.FileName = filename
+					existing.SHA256 = sum
+					if err := store.Add(existing); err != nil {
+						log.Warn.Printf("Failed to record %s in the index - %v", filename, err)
+					}
+				}
+				if err := video.MoveVideoFiles(cfg, filename, sum); err != nil {
+					log.Warn.Printf("Skipped %s but failed to move file - %v", filename, err)
+				}
+				stats.Skipped++
 				continue
 			}
+		}
 
-			// Process video
-			logger.Info.Printf("Processing video: %s", filename)
-			err = video.ProcessVideo(client, peer, filePath, tag, description, cfg.MaxSizeBytes, cfg.TempDir, cfg.CleanupTempDir)
-			if err != nil {
-				video.LogFileInfo(filename, fileInfo.Size(), false, err)
-				stats.Failed++
-				continue
+		// Process video, or send it whole when a rule says so or it is not a
+		// video. With -schedule it is queued to be posted later.
+		log.Info.Printf("Processing: %s", filename)
+		started, ffmpegBefore := time.Now(), ffmpeg.Elapsed()
+		at := schedule.Time(scheduled)
+		sender := client.WithSchedule(at)
+		mediaType := "video"
+		var files, scrub []index.File
+		var parts int
+		switch {
+		case isPhoto:
+			files, mediaType, err = pipeline.SendPhoto(sender, cfg, peer, filePath, caption, proc.MaxSizeBytes)
+		case pipeline.IsAudio(proc, filename):
+			mediaType = "audio"
+			files, err = pipeline.SendAudio(sender, cfg, peer, filePath, caption, proc.MaxSizeBytes)
+		case asDocument:
+			mediaType = "document"
+			files, err = pipeline.SendDocument(sender, cfg, peer, filePath, caption, proc.MaxSizeBytes)
+		default:
+			var sent video.Sent
+			sent, err = video.ProcessVideo(sender, peer, filePath, sum, tag, description, proc, pipeline.KnownFile(store), cfg.TempDir, cfg.CleanupTempDir)
+			files, parts, scrub = sent.Files, sent.Parts, sent.Scrub
+			if err == nil && parts == 0 {
+				// Only the contact sheet was sent
+				mediaType = "photo"
+			}
+		}
+		if err != nil && ctx.Err() != nil {
+			// The file stays pending in local_dir and is sent again whole on
+			// the next run. Messages already posted for it, such as an
+			// earlier album, are left in the chat. An upload that finished
+			// before the interruption is recorded and moved below, and the
+			// loop stops before the next file.
+			log.Warn.Printf("Upload of %s interrupted, it will be retried on the next run", filename)
+			stats.Fail(filename, fmt.Errorf("interrupted, left in local_dir"))
+			break
+		}
+		if err != nil {
+			video.LogFileInfo(filename, fileInfo.Size(), false, err)
+			stats.Fail(filename, err)
+			if entry, err := retries.Fail(filename, err); err != nil {
+				log.Warn.Printf("Failed to queue %s for retry - %v", filename, err)
+			} else if !retries.GaveUp(entry) {
+				log.Info.Printf("Queued %s for retry at %s (attempt %d)", filename, entry.NextRetryAt.Format(time.DateTime), entry.Attempts)
 			}
+			continue
+		}
+		pipeline.Forget(retries, marks, filename)
+		stats.Uploaded(filename, fileInfo.Size(), time.Since(started), ffmpeg.Elapsed()-ffmpegBefore)
 
-			// Move video file to done directory
-			if err := video.MoveVideoFiles(&cfg, filename); err != nil {
-				logger.Warn.Printf("Uploaded %s but failed to move file - %v", filename, err)
-				stats.Failed++
-				continue
+		if !at.IsZero() {
+			// Scheduled messages get new IDs once posted, so there is nothing
+			// to check, mirror or index yet
+			log.Info.Printf("Scheduled %s for %s", filename, at.Format(time.DateTime))
+			scheduled++
+		} else {
+			// Check the upload, copy it to the mirror channels and record it
+			// in the media index, even when interrupted meanwhile
+			cl := client.WithContext(context.WithoutCancel(ctx))
+			entry := &index.Entry{
+				ChatID:      cfg.StorageChatID,
+				Files:       files,
+				Tag:         tag,
+				Description: description,
+				Caption:     caption,
+				FileName:    filename,
+				MediaType:   mediaType,
+				Source:      "uploader",
+				Size:        fileInfo.Size(),
+				ModTime:     fileInfo.ModTime(),
+				SHA256:      sum,
+			}
+			if mediaType == "video" {
+				entry.Parts = parts
+				entry.Scrub = scrub
+			}
+			pipeline.NextVersion(entry, previous)
+			pipeline.MarkStatus(cl, cfg, entry)
+			pipeline.Mirror(cl, cfg, entry)
+			if err := store.Add(entry); err != nil {
+				log.Warn.Printf("Uploaded %s but failed to update index - %v", filename, err)
+			} else {
+				pipeline.Supersede(cl, store, previous, entry)
 			}
 		}
 
-		return nil
-	}); err != nil {
-		logger.Error.Fatal(err)
+		// Move video file to done directory
+		if err := video.MoveVideoFiles(cfg, filename, sum); err != nil {
+			log.Warn.Printf("Uploaded %s but failed to move file - %v", filename, err)
+			stats.Fail(filename, fmt.Errorf("uploaded but not moved: %w", err))
+			continue
+		}
+
+		stats.Succeeded++
 	}
+	return stats
 }
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireJSON(t *testing.T) {
+	h := requireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	for _, tc := range []struct {
+		method, path, contentType string
+		want                      int
+	}{
+		{"POST", "/api/media/1/share", "application/json", http.StatusAccepted},
+		{"POST", "/api/save", "application/json; charset=utf-8", http.StatusAccepted},
+		{"POST", "/api/media/1/share", "text/plain", http.StatusUnsupportedMediaType},
+		{"POST", "/api/upload", "", http.StatusUnsupportedMediaType},
+		{"POST", "/api/upload", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"GET", "/api/media", "", http.StatusAccepted},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"to":"@someone"}`))
+		if tc.contentType != "" {
+			r.Header.Set("Content-Type", tc.contentType)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s %s as %q = %d, want %d", tc.method, tc.path, tc.contentType, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/logger"
+	"time"
+)
+
+// DaemonStatus is what GET /status of the control socket returns
+type DaemonStatus struct {
+	PID        int        `json:"pid"`
+	StartedAt  time.Time  `json:"started_at"`
+	Connected  bool       `json:"connected"`
+	Error      string     `json:"error,omitempty"` // why the MTProto connection is down
+	QueueDepth int        `json:"queue_depth"`
+	Paused     bool       `json:"paused"`
+	Running    []jobs.Job `json:"running"`
+}
+
+// ControlServer lets the CLI drive the running daemon over a unix socket,
+// so commands like `cli daemon status` need neither the HTTP API nor a
+// second MTProto session. Only the owner of the socket can connect.
+type ControlServer struct {
+	path    string
+	client  *client.Client
+	jobs    *jobs.Queue
+	reload  func() error
+	started time.Time
+	srv     *http.Server
+	lis     net.Listener
+}
+
+// NewControlServer listens on the socket at path. reload re-reads the
+// daemon config. A socket left behind by a crashed daemon is replaced,
+// one another daemon still serves is an error.
+func NewControlServer(path string, cl *client.Client, queue *jobs.Queue, reload func() error) (*ControlServer, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another daemon is listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("chmod %s: %w", path, err)
+	}
+
+	s := &ControlServer{
+		path:    path,
+		client:  cl,
+		jobs:    queue,
+		reload:  reload,
+		started: time.Now(),
+		lis:     lis,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /jobs", s.handleListJobs)
+	mux.HandleFunc("POST /jobs/{id}/cancel", s.handleCancelJob)
+	mux.HandleFunc("POST /scan", s.handleScan)
+	mux.HandleFunc("POST /reload", s.handleReload)
+	mux.HandleFunc("POST /pause", handlePause(queue, true))
+	mux.HandleFunc("POST /resume", handlePause(queue, false))
+	s.srv = &http.Server{Handler: mux}
+	return s, nil
+}
+
+// Start begins serving in the background
+func (s *ControlServer) Start() {
+	go func() {
+		logger.Info.Printf("Control socket listening on %s", s.path)
+		if err := s.srv.Serve(s.lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error.Printf("Control socket stopped: %v", err)
+		}
+	}()
+}
+
+// Shutdown stops accepting requests and removes the socket
+func (s *ControlServer) Shutdown(ctx context.Context) error {
+	// The unix listener unlinks the socket file when it is closed
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *ControlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st := DaemonStatus{
+		PID:        os.Getpid(),
+		StartedAt:  s.started,
+		QueueDepth: s.jobs.Depth(),
+		Paused:     s.jobs.Paused(),
+		Running:    []jobs.Job{},
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if err := s.client.Ping(ctx); err != nil {
+		st.Error = err.Error()
+	} else {
+		st.Connected = true
+	}
+	for _, job := range s.jobs.List() {
+		if job.State == jobs.StateRunning {
+			st.Running = append(st.Running, job)
+		}
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *ControlServer) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.jobs.List())
+}
+
+func (s *ControlServer) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	if err := s.jobs.Cancel(id); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, jobs.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	job, _ := s.jobs.Get(id)
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleScan queues an upload of local_dir, like POST /api/upload
+func (s *ControlServer) handleScan(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Submit("upload_local", struct{}{}, jobs.PriorityHigh)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *ControlServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := s.reload(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+}
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/pkg/assistantpb"
+
+	"github.com/gotd/td/tg"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcChunkSize caps the data of one Download message, well below gRPC's
+// default 4MB message limit
+const grpcChunkSize = 1 << 20
+
+// GRPCServer serves the Assistant service of pkg/assistantpb, so other
+// programs can upload, search and download without scraping the HTTP API
+type GRPCServer struct {
+	assistantpb.UnimplementedAssistantServer
+
+	cfg    *config.Config
+	store  *index.Store
+	client *client.Client
+	jobs   *jobs.Queue
+	srv    *grpc.Server
+}
+
+func NewGRPCServer(cfg *config.Config, store *index.Store, cl *client.Client, queue *jobs.Queue) *GRPCServer {
+	s := &GRPCServer{
+		cfg:    cfg,
+		store:  store,
+		client: cl,
+		jobs:   queue,
+	}
+
+	var opts []grpc.ServerOption
+	if cfg.GRPC.Token != "" {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := s.authorize(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := s.authorize(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+	s.srv = grpc.NewServer(opts...)
+	assistantpb.RegisterAssistantServer(s.srv, s)
+	return s
+}
+
+// Start begins serving in the background
+func (s *GRPCServer) Start() {
+	go func() {
+		lis, err := net.Listen("tcp", s.cfg.GRPC.Listen)
+		if err != nil {
+			logger.Error.Printf("gRPC API stopped: %v", err)
+			return
+		}
+		logger.Info.Printf("gRPC API listening on %s", s.cfg.GRPC.Listen)
+		if err := s.srv.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			logger.Error.Printf("gRPC API stopped: %v", err)
+		}
+	}()
+}
+
+// Shutdown waits for running calls to finish, and cancels them when ctx
+// ends first
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// authorize checks the "authorization: Bearer <token>" metadata of a call
+func (s *GRPCServer) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.GRPC.Token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing token")
+}
+
+func (s *GRPCServer) UploadFile(stream grpc.ClientStreamingServer[assistantpb.UploadFileRequest, assistantpb.Media]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return status.Error(codes.InvalidArgument, "the first message must carry the file info")
+	}
+	if info.Name == "" || info.Name != filepath.Base(info.Name) || info.Name == "." {
+		return status.Errorf(codes.InvalidArgument, "name must be a file name, not %q", info.Name)
+	}
+	if info.Tag == "" {
+		return status.Error(codes.InvalidArgument, "tag is required")
+	}
+	desc := info.Description
+	if desc == "" {
+		desc = strings.TrimSuffix(info.Name, filepath.Ext(info.Name))
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := pw.Write(req.GetData()); err != nil {
+				// The upload failed and closed the reader
+				return
+			}
+		}
+	}()
+
+	entry, err := pipeline.UploadStream(s.client, s.store, &s.cfg.Mtproto, pr, info.Name, info.Tag, desc, "grpc")
+	pr.CloseWithError(errors.New("upload ended"))
+	if err != nil {
+		if stream.Context().Err() != nil {
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	logger.Info.Printf("Uploaded %s over gRPC as index entry %d", entry.FileName, entry.ID)
+	return stream.SendAndClose(mediaProto(entry))
+}
+
+func (s *GRPCServer) GetStatus(_ context.Context, req *assistantpb.GetStatusRequest) (*assistantpb.Status, error) {
+	st := &assistantpb.Status{QueueDepth: int32(s.jobs.Depth())}
+	if req.JobId != 0 {
+		job, ok := s.jobs.Get(req.JobId)
+		if !ok {
+			return nil, status.Error(codes.NotFound, "job not found")
+		}
+		st.Job = &assistantpb.Job{
+			Id:        job.ID,
+			Type:      job.Type,
+			State:     string(job.State),
+			Attempts:  int32(job.Attempts),
+			Error:     job.Error,
+			Progress:  job.Progress,
+			Percent:   job.Percent,
+			Result:    job.Result,
+			CreatedAt: timestamppb.New(job.CreatedAt),
+			UpdatedAt: timestamppb.New(job.UpdatedAt),
+		}
+	}
+	return st, nil
+}
+
+func (s *GRPCServer) Search(_ context.Context, req *assistantpb.SearchRequest) (*assistantpb.SearchResponse, error) {
+	limit := int(req.Limit)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	entries, total := s.store.Search(index.Query{
+		Text:   req.Query,
+		Tag:    req.Tag,
+		Offset: max(int(req.Offset), 0),
+		Limit:  limit,
+	})
+	resp := &assistantpb.SearchResponse{Total: int32(total)}
+	for _, e := range entries {
+		resp.Items = append(resp.Items, mediaProto(e))
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) Download(req *assistantpb.DownloadRequest, stream grpc.ServerStreamingServer[assistantpb.DownloadResponse]) error {
+	entry, ok := s.store.Get(req.MediaId)
+	if !ok {
+		return status.Error(codes.NotFound, "media not found")
+	}
+	files := pipeline.OriginalFiles(entry)
+	if len(files) == 0 {
+		return status.Error(codes.NotFound, "media has no files")
+	}
+	if req.Offset < 0 || req.Length < 0 {
+		return status.Error(codes.InvalidArgument, "offset and length can't be negative")
+	}
+	ranged := req.Offset > 0 || req.Length > 0
+	if ranged && len(files) > 1 {
+		return status.Errorf(codes.FailedPrecondition, "media %d is stored in %d parts, download it whole", entry.ID, len(files))
+	}
+
+	w := &grpcWriter{stream: stream}
+	var err error
+	if ranged {
+		var msgs []*tg.Message
+		if msgs, err = s.client.GetMessages(entry.ChatID, []int{files[0].MessageID}); err == nil {
+			if len(msgs) == 0 {
+				return status.Error(codes.NotFound, "media is gone from the chat")
+			}
+			length := req.Length
+			if length == 0 {
+				// To the end, see assistant.proto
+				length = -1
+			}
+			err = s.client.DownloadRange(msgs[0], req.Offset, length, w)
+		}
+	} else {
+		err = pipeline.Cat(s.client, s.store, entry.ChatID, files[0].MessageID, w)
+	}
+	if err != nil {
+		if stream.Context().Err() != nil {
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// grpcWriter sends what is written to it as DownloadResponse messages
+type grpcWriter struct {
+	stream grpc.ServerStreamingServer[assistantpb.DownloadResponse]
+}
+
+func (w *grpcWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), grpcChunkSize)]
+		if err := w.stream.Send(&assistantpb.DownloadResponse{Data: chunk}); err != nil {
+			return n, fmt.Errorf("send: %w", err)
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// mediaProto converts an index entry to its message
+func mediaProto(e *index.Entry) *assistantpb.Media {
+	m := &assistantpb.Media{
+		Id:          e.ID,
+		ChatId:      e.ChatID,
+		Tag:         e.Tag,
+		Description: e.Description,
+		FileName:    e.FileName,
+		MediaType:   e.MediaType,
+		Source:      e.Source,
+		Size:        e.Size,
+		Sha256:      e.SHA256,
+		Parts:       int32(e.Parts),
+		Version:     int32(e.Version),
+		CreatedAt:   timestamppb.New(e.CreatedAt),
+		Link:        e.Link(),
+	}
+	for _, f := range e.Files {
+		m.Files = append(m.Files, &assistantpb.File{MessageId: int32(f.MessageID), Name: f.Name, Size: f.Size})
+	}
+	return m
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/pkg/assistantpb"
+
+	"google.golang.org/grpc"
+)
+
+// downloadStream collects what GRPCServer.Download sends
+type downloadStream struct {
+	grpc.ServerStream
+	data bytes.Buffer
+}
+
+func (s *downloadStream) Send(resp *assistantpb.DownloadResponse) error {
+	s.data.Write(resp.Data)
+	return nil
+}
+
+func (s *downloadStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestGRPCDownload(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	cl := client.NewWithAPI(context.Background(), &config.MtprotoConfig{}, fake)
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := make([]byte, client.DownloadChunkSize+1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	msgID, err := cl.SendMedia(peer, client.MediaItem{FilePath: path, MediaType: "document"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := index.Open(filepath.Join(t.TempDir(), "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &index.Entry{
+		ChatID:    chatID,
+		Files:     []index.File{{MessageID: msgID, Name: "data.bin", Size: int64(len(content))}},
+		FileName:  "data.bin",
+		MediaType: "document",
+		Size:      int64(len(content)),
+	}
+	if err := store.Add(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &GRPCServer{cfg: &config.Config{}, store: store, client: cl}
+	end := int64(len(content))
+	for _, tc := range []struct {
+		offset, length int64
+		want           []byte
+	}{
+		{0, 0, content},
+		{client.DownloadChunkSize - 10, 0, content[client.DownloadChunkSize-10:]}, // length 0 reads to the end
+		{100, 50, content[100:150]},
+		{end - 5, 100, content[end-5:]},
+	} {
+		stream := &downloadStream{}
+		req := &assistantpb.DownloadRequest{MediaId: entry.ID, Offset: tc.offset, Length: tc.length}
+		if err := s.Download(req, stream); err != nil {
+			t.Fatalf("offset %d, length %d: %v", tc.offset, tc.length, err)
+		}
+		if !bytes.Equal(stream.data.Bytes(), tc.want) {
+			t.Errorf("offset %d, length %d: got %d bytes, want %d", tc.offset, tc.length, stream.data.Len(), len(tc.want))
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/metrics"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+type check struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// health serves the liveness and readiness checks of the daemon
+type health struct {
+	cfg    *config.Config
+	client *client.Client
+	jobs   *jobs.Queue
+}
+
+func (h *health) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", h.handleHealthz)
+	mux.HandleFunc("GET /readyz", h.handleReadyz)
+	mux.HandleFunc("GET /metrics", handleMetrics)
+}
+
+// HealthServer serves only /healthz, /readyz and /metrics on http.listen,
+// so the daemon can be probed when the HTTP API is disabled
+type HealthServer struct {
+	listen string
+	srv    *http.Server
+}
+
+func NewHealthServer(cfg *config.Config, cl *client.Client, queue *jobs.Queue) *HealthServer {
+	mux := http.NewServeMux()
+	(&health{cfg: cfg, client: cl, jobs: queue}).register(mux)
+	return &HealthServer{
+		listen: cfg.HTTP.Listen,
+		srv:    &http.Server{Addr: cfg.HTTP.Listen, Handler: mux},
+	}
+}
+
+// Start begins serving in the background
+func (s *HealthServer) Start() {
+	go func() {
+		logger.Info.Printf("Health checks listening on http://%s", s.listen)
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error.Printf("Health server stopped: %v", err)
+		}
+	}()
+}
+
+// Shutdown stops accepting requests
+func (s *HealthServer) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// handleHealthz reports liveness: a wedged MTProto connection fails it so
+// the orchestrator restarts the container
+func (h *health) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]check{
+		"mtproto": h.checkConnection(r.Context()),
+	}
+	writeChecks(w, checks, map[string]any{})
+}
+
+// handleReadyz reports whether the daemon can do useful work, including free
+// space in every directory it writes to
+func (h *health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg
+	checks := map[string]check{
+		"mtproto":     h.checkConnection(r.Context()),
+		"session":     h.checkSession(r.Context()),
+		"temp_dir":    h.checkDisk(cfg.Mtproto.TempDir),
+		"local_dir":   h.checkDisk(cfg.Mtproto.LocalDir),
+		"staging_dir": h.checkDisk(cfg.Mtproto.StagingDir),
+	}
+	if cfg.HTTP.Enabled {
+		checks["download_dir"] = h.checkDisk(cfg.HTTP.DownloadDir)
+	}
+	if cfg.WebDAV.Enabled {
+		checks["webdav_cache_dir"] = h.checkDisk(cfg.WebDAV.CacheDir)
+	}
+	if cfg.S3.Enabled {
+		checks["s3_cache_dir"] = h.checkDisk(cfg.S3.CacheDir)
+	}
+	writeChecks(w, checks, map[string]any{
+		"queue_depth": h.jobs.Depth(),
+	})
+}
+
+// handleMetrics serves the failure counters for Prometheus
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metrics.WriteText(w); err != nil {
+		logger.Warn.Printf("Failed to write metrics - %v", err)
+	}
+}
+
+func (h *health) checkConnection(ctx context.Context) check {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := h.client.Ping(ctx); err != nil {
+		return check{Detail: err.Error()}
+	}
+	return check{OK: true}
+}
+
+func (h *health) checkSession(ctx context.Context) check {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	authorized, err := h.client.Authorized(ctx)
+	if err != nil {
+		return check{Detail: err.Error()}
+	}
+	if !authorized {
+		return check{Detail: "session is not authorized"}
+	}
+	return check{OK: true}
+}
+
+// checkDisk reports the free space for dir. Directories created on demand
+// are checked through their nearest existing parent.
+func (h *health) checkDisk(dir string) check {
+	dir = existingDir(dir)
+	free, err := util.FreeSpace(dir)
+	if err != nil {
+		return check{Detail: err.Error()}
+	}
+
+	detail := fmt.Sprintf("%s free", util.FormatBytesToHumanReadable(int64(free)))
+	if int64(free) < h.cfg.HTTP.MinFreeSpaceBytes {
+		return check{Detail: detail + ", below " + h.cfg.HTTP.MinFreeSpace}
+	}
+	return check{OK: true, Detail: detail}
+}
+
+func existingDir(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+func writeChecks(w http.ResponseWriter, checks map[string]check, extra map[string]any) {
+	status := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	extra["status"] = http.StatusText(status)
+	extra["checks"] = checks
+	writeJSON(w, status, extra)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/internal/priority"
+	"tg-storage-assistant/internal/retry"
+	"tg-storage-assistant/internal/video"
+)
+
+// entryPayload is the payload of download and reupload jobs
+type entryPayload struct {
+	EntryID int64 `json:"entry_id"`
+}
+
+// savePayload is the payload of save_url jobs
+type savePayload struct {
+	URL string `json:"url"`
+}
+
+// jobRunner executes the jobs submitted through the API. Every client call
+// uses the job context, so canceling a job stops its transfers.
+type jobRunner struct {
+	cfg     *config.Config
+	store   *index.Store
+	client  *client.Client
+	queue   *jobs.Queue
+	retries *retry.Queue
+	marks   *priority.Marks
+}
+
+// RegisterJobHandlers registers the download, reupload, save_url,
+// upload_local and share handlers. The daemon calls it whether or not the
+// HTTP API is enabled, so persisted jobs keep running.
+func RegisterJobHandlers(queue *jobs.Queue, cfg *config.Config, store *index.Store, cl *client.Client, retries *retry.Queue, marks *priority.Marks) {
+	r := &jobRunner{cfg: cfg, store: store, client: cl, queue: queue, retries: retries, marks: marks}
+	queue.Register("download", r.runEntryJob(r.download))
+	queue.Register("reupload", r.runEntryJob(r.reupload))
+	queue.Register("save_url", r.runSave)
+	queue.Register("upload_local", r.runUploadLocal)
+	queue.Register("share", r.runShare)
+}
+
+// runEntryJob adapts an entry operation to a job handler
+func (r *jobRunner) runEntryJob(run func(context.Context, *jobs.Job, *index.Entry) ([]string, error)) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) ([]string, error) {
+		var payload entryPayload
+		if err := job.Decode(&payload); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		entry, ok := r.store.Get(payload.EntryID)
+		if !ok {
+			return nil, fmt.Errorf("media %d not found", payload.EntryID)
+		}
+		result, err := run(ctx, job, entry)
+		return result, canceledErr(ctx, err)
+	}
+}
+
+// canceledErr reports a failure after the job was canceled as the cancel
+// itself, so the queue does not retry it
+func canceledErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+	return err
+}
+
+// download fetches every message of the entry into <download_dir>/<entry id>
+func (r *jobRunner) download(ctx context.Context, job *jobs.Job, entry *index.Entry) ([]string, error) {
+	cl := r.client.WithContext(ctx)
+	msgs, err := cl.GetMessages(entry.ChatID, entry.MessageIDs())
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(r.cfg.HTTP.DownloadDir, strconv.FormatInt(entry.ID, 10))
+	var paths []string
+	for i, msg := range msgs {
+		r.queue.SetProgress(job.ID, fmt.Sprintf("%d/%d files of media %d", i+1, len(msgs), entry.ID), float64(i)*100/float64(len(msgs)))
+		path, err := cl.DownloadMessageMedia(msg, dir)
+		if err != nil {
+			return paths, err
+		}
+		pipeline.SetModTime(path, entry.ModTime)
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// reupload runs the original file from done_dir through the video pipeline again
+func (r *jobRunner) reupload(ctx context.Context, _ *jobs.Job, entry *index.Entry) ([]string, error) {
+	if entry.MediaType != "video" {
+		return nil, fmt.Errorf("only videos can be re-uploaded, media %d is a %s", entry.ID, entry.MediaType)
+	}
+	// Only uploader entries are plain names in done_dir, S3 keys may contain paths
+	if entry.FileName == "" || filepath.Base(entry.FileName) != entry.FileName {
+		return nil, fmt.Errorf("invalid file name for re-upload: %q", entry.FileName)
+	}
+
+	cfg := &r.cfg.Mtproto
+	cl := r.client.WithContext(ctx)
+	filePath := filepath.Join(cfg.DoneDir, video.DoneName(cfg, entry.FileName, entry.SHA256))
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("original file not available: %w", err)
+	}
+
+	peer, err := cl.ResolvePeer(cfg.StorageChatID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve peer: %w", err)
+	}
+
+	proc := cfg.Processing(entry.Tag)
+	if proc.Preview == "only" {
+		// A re-upload is for the video itself
+		proc.Preview = "full"
+	}
+	// Parts are uploaded again, not referred to
+	sent, err := video.ProcessVideo(cl, peer, filePath, entry.SHA256, entry.Tag, entry.Description, proc, nil, cfg.TempDir, cfg.CleanupTempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	newEntry := &index.Entry{
+		ChatID:      cfg.StorageChatID,
+		Files:       sent.Files,
+		Tag:         entry.Tag,
+		Description: entry.Description,
+		Caption:     fileprocessor.BuildCaption(entry.Tag, entry.Description),
+		FileName:    entry.FileName,
+		MediaType:   entry.MediaType,
+		Source:      "uploader",
+		Size:        fileInfo.Size(),
+		ModTime:     entry.ModTime,
+		SHA256:      entry.SHA256,
+		Parts:       sent.Parts,
+		Scrub:       sent.Scrub,
+	}
+	pipeline.MarkStatus(cl, cfg, newEntry)
+	pipeline.Mirror(cl, cfg, newEntry)
+	if err := r.store.Add(newEntry); err != nil {
+		return nil, err
+	}
+	return []string{fmt.Sprintf("entry %d", newEntry.ID)}, nil
+}
+
+// runSave downloads the job URL with yt-dlp and uploads the result
+func (r *jobRunner) runSave(ctx context.Context, job *jobs.Job) ([]string, error) {
+	var payload savePayload
+	if err := job.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	p := pipeline.New(r.client.WithContext(ctx), &r.cfg.Mtproto, r.store)
+	entry, err := p.SaveURL(ctx, &r.cfg.YtDlp, payload.URL)
+	if err != nil {
+		return nil, canceledErr(ctx, err)
+	}
+	return []string{fmt.Sprintf("entry %d", entry.ID)}, nil
+}
+
+// runUploadLocal uploads everything in local_dir like an uploader run,
+// reporting the current file as the job progress
+func (r *jobRunner) runUploadLocal(ctx context.Context, job *jobs.Job) ([]string, error) {
+	p := pipeline.New(r.client.WithContext(ctx), &r.cfg.Mtproto, r.store)
+	stats, err := p.UploadLocalDir(ctx, r.retries, r.marks, func(done, total int, name string) {
+		r.queue.SetProgress(job.ID, fmt.Sprintf("%d/%d uploading %s", done+1, total, name), float64(done)*100/float64(total))
+	})
+	if err != nil {
+		return nil, canceledErr(ctx, err)
+	}
+	if stats.Processed == 0 {
+		return []string{"no files in local_dir"}, nil
+	}
+	// Failed files are in the retry queue, so the job itself is not retried
+	return strings.Split(stats.Summary(), "\n"), nil
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"tg-storage-assistant/internal/jobs"
+)
+
+// PauseState is what the pause and resume endpoints return
+type PauseState struct {
+	Paused  bool `json:"paused"`
+	Changed bool `json:"changed"` // false when it already was
+}
+
+// handlePause pauses (pause) or resumes the job queue of the daemon.
+// Running jobs finish, so nothing is cut off halfway.
+func handlePause(queue *jobs.Queue, pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var changed bool
+		if pause {
+			changed = queue.Pause()
+		} else {
+			changed = queue.Resume()
+		}
+		writeJSON(w, http.StatusOK, PauseState{Paused: queue.Paused(), Changed: changed})
+	}
+}
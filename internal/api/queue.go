@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// handleQueue lists the files of local_dir in upload order
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	queued, err := pipeline.LocalQueue(&s.cfg.Mtproto, s.marks)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, queued)
+}
+
+// handlePrioritize marks a file of local_dir to upload before the others,
+// also in an upload run already going on
+func (s *Server) handlePrioritize(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	name := filepath.Base(payload.Name)
+	if _, err := os.Stat(filepath.Join(s.cfg.Mtproto.LocalDir, name)); err != nil {
+		writeError(w, http.StatusNotFound, name+" is not in local_dir")
+		return
+	}
+	if err := s.marks.Mark(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.handleQueue(w, r)
+}
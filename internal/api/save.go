@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"tg-storage-assistant/internal/jobs"
+)
+
+func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
+	var payload savePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if u, err := url.Parse(payload.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		writeError(w, http.StatusBadRequest, "url must be an http(s) URL")
+		return
+	}
+
+	job, err := s.jobs.Submit("save_url", payload, jobs.PriorityNormal)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// handleUpload starts an upload run over local_dir
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Submit("upload_local", struct{}{}, jobs.PriorityHigh)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/priority"
+)
+
+// Server exposes the media index and upload/download jobs over HTTP
+type Server struct {
+	cfg    *config.Config
+	store  *index.Store
+	client *client.Client
+	jobs   *jobs.Queue
+	marks  *priority.Marks
+	srv    *http.Server
+}
+
+func NewServer(cfg *config.Config, store *index.Store, cl *client.Client, queue *jobs.Queue, marks *priority.Marks) *Server {
+	s := &Server{
+		cfg:    cfg,
+		store:  store,
+		client: cl,
+		jobs:   queue,
+		marks:  marks,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/media", s.handleListMedia)
+	mux.HandleFunc("GET /api/media/{id}", s.handleGetMedia)
+	mux.HandleFunc("POST /api/media/{id}/download", s.handleDownload)
+	mux.HandleFunc("POST /api/media/{id}/reupload", s.handleReupload)
+	mux.HandleFunc("POST /api/media/{id}/share", s.handleShare)
+	mux.HandleFunc("POST /api/save", s.handleSave)
+	mux.HandleFunc("POST /api/upload", s.handleUpload)
+	mux.HandleFunc("GET /api/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("POST /api/jobs/{id}/cancel", s.handleCancelJob)
+	mux.HandleFunc("POST /api/pause", handlePause(queue, true))
+	mux.HandleFunc("POST /api/resume", handlePause(queue, false))
+	mux.HandleFunc("GET /api/queue", s.handleQueue)
+	mux.HandleFunc("POST /api/queue/priority", s.handlePrioritize)
+	mux.HandleFunc("GET /api/media/{id}/preview", s.handlePreview)
+	mux.HandleFunc("GET /stream/{id}", s.handleStream)
+	mux.HandleFunc("GET /stream/{id}/{name}", s.handleScrub)
+	mux.HandleFunc("GET /thumb/{id}", s.handleThumb)
+	(&health{cfg: cfg, client: cl, jobs: queue}).register(mux)
+	mux.Handle("GET /", webHandler())
+
+	s.srv = &http.Server{
+		Addr:    cfg.HTTP.Listen,
+		Handler: requireToken(cfg.HTTP.Token, requireJSON(mux)),
+	}
+	return s
+}
+
+// Start begins serving in the background
+func (s *Server) Start() {
+	go func() {
+		logger.Info.Printf("HTTP API listening on http://%s", s.cfg.HTTP.Listen)
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error.Printf("HTTP API stopped: %v", err)
+		}
+	}()
+}
+
+// Shutdown stops accepting requests
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *Server) handleListMedia(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	entries, total := s.store.Search(index.Query{
+		Text:   q.Get("q"),
+		Tag:    q.Get("tag"),
+		Offset: offset,
+		Limit:  limit,
+	})
+	if entries == nil {
+		entries = []*index.Entry{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+		"items":  entries,
+	})
+}
+
+func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+
+	s.submit(w, "download", entry)
+}
+
+func (s *Server) handleReupload(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+
+	s.submit(w, "reupload", entry)
+}
+
+func (s *Server) submit(w http.ResponseWriter, typ string, entry *index.Entry) {
+	job, err := s.jobs.Submit(typ, entryPayload{EntryID: entry.ID}, jobs.PriorityNormal)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.jobs.List())
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	job, ok := s.jobs.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	if err := s.jobs.Cancel(id); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, jobs.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	job, _ := s.jobs.Get(id)
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) lookupEntry(w http.ResponseWriter, r *http.Request) (*index.Entry, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid media id")
+		return nil, false
+	}
+	entry, ok := s.store.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "media not found")
+		return nil, false
+	}
+	return entry, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
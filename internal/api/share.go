@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"tg-storage-assistant/internal/jobs"
+)
+
+// MaxShareTTL is the longest self-destruct timer Telegram accepts, in seconds
+const MaxShareTTL = 60
+
+// sharePayload is the payload of share jobs
+type sharePayload struct {
+	EntryID int64  `json:"entry_id"`
+	To      string `json:"to"`          // @username or chat ID
+	TTL     int    `json:"ttl_seconds"` // 0 sends normally
+}
+
+// handleShare sends an entry to someone, optionally as self-destructing media
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	var payload sharePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if payload.To == "" {
+		writeError(w, http.StatusBadRequest, "to is required")
+		return
+	}
+	if payload.TTL < 0 || payload.TTL > MaxShareTTL {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("ttl_seconds must be 0-%d", MaxShareTTL))
+		return
+	}
+	payload.EntryID = entry.ID
+
+	job, err := s.jobs.Submit("share", payload, jobs.PriorityHigh)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// runShare resends the messages of an entry to the recipient
+func (r *jobRunner) runShare(ctx context.Context, job *jobs.Job) ([]string, error) {
+	var payload sharePayload
+	if err := job.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	entry, ok := r.store.Get(payload.EntryID)
+	if !ok {
+		return nil, fmt.Errorf("media %d not found", payload.EntryID)
+	}
+
+	cl := r.client.WithContext(ctx)
+	peer, err := cl.ResolveRecipient(payload.To)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := cl.ShareMessages(entry.ChatID, entry.MessageIDs(), peer, payload.TTL)
+	if err != nil {
+		return nil, canceledErr(ctx, err)
+	}
+	return []string{fmt.Sprintf("%d message(s) to %s", len(ids), payload.To)}, nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+)
+
+// handleStream plays a video entry in the browser without downloading it
+// first: its parts are fetched from Telegram one after the other and
+// remuxed by ffmpeg into one fragmented MP4 as they arrive. ?transcode=1
+// re-encodes it to H.264 and AAC for codecs the browser can't play, such as
+// HEVC. The stream can't be seeked.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	if entry.MediaType != "video" {
+		writeError(w, http.StatusNotFound, "not a video")
+		return
+	}
+	if err := ffmpeg.Available(); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	files := pipeline.OriginalFiles(entry)
+	ids := make([]int, len(files))
+	for i, f := range files {
+		ids[i] = f.MessageID
+	}
+	msgs, err := s.client.GetMessages(entry.ChatID, ids)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if len(msgs) != len(ids) {
+		writeError(w, http.StatusNotFound, "video parts are gone from the chat")
+		return
+	}
+
+	parts := make([]ffmpeg.StreamPart, len(msgs))
+	var start float64
+	for i, msg := range msgs {
+		parts[i] = ffmpeg.StreamPart{
+			Start: start,
+			Write: func(w io.Writer) error { return s.client.StreamMessageMedia(msg, w) },
+		}
+		duration := client.MediaDuration(msg)
+		if duration == 0 && i < len(msgs)-1 {
+			logger.Warn.Printf("Part %d of media %d has no duration, its timestamps may overlap the next part", i+1, entry.ID)
+		}
+		start += duration
+	}
+
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Cache-Control", "no-store")
+	transcode := r.URL.Query().Get("transcode") == "1"
+	if err := ffmpeg.StreamMP4(r.Context(), parts, w, transcode); err != nil && r.Context().Err() == nil {
+		// The response has started, the player just sees it end
+		logger.Warn.Printf("Streaming media %d failed: %v", entry.ID, err)
+	}
+}
+
+// handleScrub serves the sprite sheets and WebVTT sent with a video for
+// scrubbing, by name. The WebVTT refers to the sheets relative to itself,
+// so players given /stream/{id}/<name>_thumbnails.vtt find them.
+func (s *Server) handleScrub(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	msgID := 0
+	for _, f := range entry.Scrub {
+		if f.Name == name {
+			msgID = f.MessageID
+		}
+	}
+	if msgID == 0 {
+		writeError(w, http.StatusNotFound, "no such scrub thumbnail")
+		return
+	}
+	msgs, err := s.client.GetMessages(entry.ChatID, []int{msgID})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if len(msgs) == 0 {
+		writeError(w, http.StatusNotFound, "scrub thumbnail is gone from the chat")
+		return
+	}
+
+	if filepath.Ext(name) == ".vtt" {
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "image/jpeg")
+	}
+	w.Header().Set("Cache-Control", "max-age=86400")
+	if token := r.URL.Query().Get("token"); token != "" && filepath.Ext(name) == ".vtt" {
+		// The player fetches the sheets by the relative links of the cues,
+		// which need the token too
+		var vtt bytes.Buffer
+		if err := s.client.StreamMessageMedia(msgs[0], &vtt); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.Write(bytes.ReplaceAll(vtt.Bytes(), []byte("#xywh="), []byte("?token="+url.QueryEscape(token)+"#xywh=")))
+		return
+	}
+	if err := s.client.StreamMessageMedia(msgs[0], w); err != nil && r.Context().Err() == nil {
+		logger.Warn.Printf("Serving %s of media %d failed: %v", name, entry.ID, err)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+)
+
+// thumbLocks serializes concurrent fetches of the same thumbnail
+var thumbLocks sync.Map
+
+// handleThumb serves a small JPEG of an entry for grids and media
+// browsers: the contact sheet of videos, or with ?part=n the thumbnail
+// Telegram made of part n (from 1); the photo itself in a small size; the
+// thumbnail of documents and the cover of music. Thumbnails are kept under
+// download_dir after the first request.
+func (s *Server) handleThumb(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	part := 0
+	if v := r.URL.Query().Get("part"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || entry.MediaType != "video" || n >= len(entry.Files) {
+			writeError(w, http.StatusNotFound, "no such part")
+			return
+		}
+		part = n
+	}
+
+	name := strconv.FormatInt(entry.ID, 10)
+	if part > 0 {
+		name += "-" + strconv.Itoa(part)
+	}
+	path := filepath.Join(s.cfg.HTTP.DownloadDir, ".thumbs", name+".jpg")
+
+	mu, _ := thumbLocks.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		err = s.fetchThumb(entry, part, path)
+	}
+	if err != nil {
+		logger.Warn.Printf("Failed to fetch thumbnail for entry %d: %v", entry.ID, err)
+		writeError(w, http.StatusBadGateway, "thumbnail not available")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "max-age=86400")
+	http.ServeFile(w, r, path)
+}
+
+// fetchThumb writes the thumbnail of entry, or of its video part, to path
+func (s *Server) fetchThumb(entry *index.Entry, part int, path string) error {
+	// The contact sheet is a photo of its own, downloaded whole
+	if entry.MediaType == "video" && part == 0 {
+		return s.fetchPreview(entry.ChatID, entry.MessageID(), path)
+	}
+
+	msgID := entry.MessageID()
+	if part > 0 {
+		msgID = entry.Files[part].MessageID
+	}
+	msgs, err := s.client.GetMessages(entry.ChatID, []int{msgID})
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("message %d is gone: %w", msgID, os.ErrNotExist)
+	}
+	data, err := s.client.DownloadThumbnail(msgs[0])
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return util.ReplaceFile(tmp, path)
+}
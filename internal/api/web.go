@@ -0,0 +1,83 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// webHandler serves the single-page UI bundled into the binary
+func webHandler() http.Handler {
+	root, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(root))
+}
+
+// previewLocks serializes concurrent fetches of the same preview
+var previewLocks sync.Map
+
+// handlePreview serves the contact sheet (first album message) of a video
+// entry, fetching it from Telegram on the first request. Other entries have
+// no preview: their first message is the file itself.
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	if entry.MediaType != "video" {
+		writeError(w, http.StatusNotFound, "preview not available")
+		return
+	}
+
+	path := filepath.Join(s.cfg.HTTP.DownloadDir, ".previews", strconv.FormatInt(entry.ID, 10)+".jpg")
+
+	mu, _ := previewLocks.LoadOrStore(entry.ID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		err = s.fetchPreview(entry.ChatID, entry.MessageID(), path)
+	}
+	if err != nil {
+		logger.Warn.Printf("Failed to fetch preview for entry %d: %v", entry.ID, err)
+		writeError(w, http.StatusBadGateway, "preview not available")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "max-age=86400")
+	http.ServeFile(w, r, path)
+}
+
+// fetchPreview downloads the preview through a .part file so a failed
+// download never leaves a truncated image behind
+func (s *Server) fetchPreview(chatID int64, msgID int, path string) error {
+	msgs, err := s.client.GetMessages(chatID, []int{msgID})
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return os.ErrNotExist
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	if err := s.client.DownloadMessageMediaTo(msgs[0], tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return util.ReplaceFile(tmp, path)
+}
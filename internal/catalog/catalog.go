@@ -0,0 +1,72 @@
+// Package catalog renders the media index as a single HTML page that needs
+// neither the daemon nor Telegram to browse.
+package catalog
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+//go:embed catalog.html
+var page string
+
+var tmpl = template.Must(template.New("catalog").Funcs(template.FuncMap{
+	"size": util.FormatBytesToHumanReadable,
+	"thumb": func(jpeg []byte) template.URL {
+		return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(jpeg))
+	},
+	"search": func(e *index.Entry) string {
+		return strings.ToLower(strings.Join([]string{e.Tag, e.Description, e.Caption, e.FileName}, " "))
+	},
+}).Parse(page))
+
+// Item is an entry of the catalog with its preview, a JPEG or nil
+type Item struct {
+	*index.Entry
+	Thumb []byte
+}
+
+// Write renders items, in the given order, as a self-contained HTML page:
+// previews are embedded and the search runs in the browser
+func Write(w io.Writer, title string, items []Item) error {
+	data := struct {
+		Title    string
+		Items    []Item
+		Tags     []string
+		Size     int64
+		Exported time.Time
+	}{Title: title, Items: items, Exported: time.Now()}
+
+	seen := make(map[string]bool)
+	for _, item := range items {
+		data.Size += item.Size
+		if item.Tag != "" && !seen[item.Tag] {
+			seen[item.Tag] = true
+			data.Tags = append(data.Tags, item.Tag)
+		}
+	}
+	sort.Strings(data.Tags)
+	return tmpl.Execute(w, data)
+}
+
+// PreviewID is the message of entry whose picture represents it: the
+// contact sheet of a video, the photo itself, the first page sent before a
+// document or the cover of music. It returns 0 for other entries.
+func PreviewID(entry *index.Entry) int {
+	switch {
+	case len(entry.Files) == 0:
+		return 0
+	case entry.MediaType == "video" && len(entry.Files) > 1, entry.MediaType == "photo", entry.MediaType == "audio":
+		return entry.Files[0].MessageID
+	case entry.MediaType == "document" && len(entry.Files) > 1:
+		return entry.Files[1].MessageID
+	}
+	return 0
+}
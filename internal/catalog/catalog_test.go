@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/index"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	items := []Item{
+		{
+			Entry: &index.Entry{
+				ID: 2, ChatID: -1001234567890, Tag: "trip", Description: "beach <day>",
+				FileName: "trip_beach.mp4", MediaType: "video", Parts: 2, Size: 1500000,
+				Files:     []index.File{{MessageID: 7}, {MessageID: 8}, {MessageID: 9}},
+				CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			},
+			Thumb: []byte{0xff, 0xd8, 0xff},
+		},
+		{Entry: &index.Entry{ID: 1, Tag: "tax", FileName: "tax_2024.pdf", MediaType: "document", Size: 500000}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "My storage", items); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		"<title>My storage</title>",
+		`src="data:image/jpeg;base64,/9j/"`,
+		`href="https://t.me/c/1234567890/7"`,
+		"beach &lt;day&gt;",
+		"video · 2 parts · 1.50 MB · 2024-05-01",
+		"</span> of 2 · 2.00 MB",
+		`<a data-tag="tax">#tax</a><a data-tag="trip">#trip</a>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+	if strings.Count(html, "Open in Telegram") != 1 {
+		t.Errorf("want a link only for the channel entry")
+	}
+}
+
+func TestPreviewID(t *testing.T) {
+	files := []index.File{{MessageID: 5}, {MessageID: 4}}
+	tests := []struct {
+		entry index.Entry
+		want  int
+	}{
+		{index.Entry{MediaType: "video", Files: files}, 5},
+		{index.Entry{MediaType: "photo", Files: files[:1]}, 5},
+		{index.Entry{MediaType: "document", Files: files}, 4},
+		{index.Entry{MediaType: "document", Files: files[:1]}, 0},
+		{index.Entry{MediaType: "voice", Files: files[:1]}, 0},
+		{index.Entry{MediaType: "video"}, 0},
+	}
+	for _, tt := range tests {
+		if got := PreviewID(&tt.entry); got != tt.want {
+			t.Errorf("PreviewID(%s with %d files) = %d, want %d", tt.entry.MediaType, len(tt.entry.Files), got, tt.want)
+		}
+	}
+}
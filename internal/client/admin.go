@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/gotd/td/tg"
+)
+
+// BotAdminRights are the rights the bot needs in the storage channel to
+// post, edit and clean up messages
+var BotAdminRights = tg.ChatAdminRights{
+	ChangeInfo:     true,
+	PostMessages:   true,
+	EditMessages:   true,
+	DeleteMessages: true,
+	InviteUsers:    true,
+	PinMessages:    true,
+}
+
+// CreateChannel creates a private broadcast channel and returns its Bot API
+// chat ID (-100xxxxxxxxxx)
+func (c *Client) CreateChannel(title, about string) (int64, error) {
+	updates, err := c.api.ChannelsCreateChannel(c.ctx, &tg.ChannelsCreateChannelRequest{
+		Broadcast: true,
+		Title:     title,
+		About:     about,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create channel failed: %w", err)
+	}
+
+	var chats []tg.ChatClass
+	switch u := updates.(type) {
+	case *tg.Updates:
+		chats = u.Chats
+	case *tg.UpdatesCombined:
+		chats = u.Chats
+	}
+	for _, chat := range chats {
+		if ch, ok := chat.(*tg.Channel); ok {
+			return -1000000000000 - ch.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no channel in the create channel result %T", updates)
+}
+
+// AddAdmin makes user an admin of the channel chatID with rights, adding it
+// to the channel first if needed, which is how bots join channels
+func (c *Client) AddAdmin(chatID int64, user tg.InputPeerClass, rights tg.ChatAdminRights, rank string) error {
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+	channel, ok := peer.(*tg.InputPeerChannel)
+	if !ok {
+		return fmt.Errorf("chat %d is not a channel or supergroup", chatID)
+	}
+	u, ok := user.(*tg.InputPeerUser)
+	if !ok {
+		return fmt.Errorf("only users and bots can be admins, got %T", user)
+	}
+
+	_, err = c.api.ChannelsEditAdmin(c.ctx, &tg.ChannelsEditAdminRequest{
+		Channel:     &tg.InputChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+		UserID:      &tg.InputUser{UserID: u.UserID, AccessHash: u.AccessHash},
+		AdminRights: rights,
+		Rank:        rank,
+	})
+	if err != nil {
+		return fmt.Errorf("promote user %d failed: %w", u.UserID, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/gotd/td/tg"
+)
+
+// albumPageSize is how many messages GetAlbums requests at a time
+const albumPageSize = 100
+
+// Album is one logical item of a chat: a single message, or every message
+// of an album such as a split video's preview and parts
+type Album struct {
+	GroupedID int64         // 0 for a single message
+	Messages  []*tg.Message // oldest first
+}
+
+// ID returns the ID of the first message
+func (a *Album) ID() int {
+	return a.Messages[0].ID
+}
+
+// Caption returns the album's caption, which Telegram shows from whichever
+// message carries one
+func (a *Album) Caption() string {
+	for _, m := range a.Messages {
+		if m.Message != "" {
+			return m.Message
+		}
+	}
+	return ""
+}
+
+// GetAlbums is GetHistory grouped into logical items, newest first. Limit
+// counts items rather than messages, and an album is never cut off by the
+// end of a page.
+func (c *Client) GetAlbums(chatID int64, opts HistoryOptions) ([]*Album, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return nil, fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+
+	var albums []*Album
+	opts.Limit = albumPageSize
+	for {
+		msgs, err := c.history(peer, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) == 0 {
+			return albums, nil
+		}
+		for _, m := range msgs {
+			if n := len(albums); n > 0 && m.GroupedID != 0 && m.GroupedID == albums[n-1].GroupedID {
+				last := albums[n-1]
+				last.Messages = append([]*tg.Message{m}, last.Messages...)
+				continue
+			}
+			// The next item starts, so the last one is complete
+			if len(albums) == limit {
+				return albums, nil
+			}
+			albums = append(albums, &Album{GroupedID: m.GroupedID, Messages: []*tg.Message{m}})
+		}
+		opts.OffsetID = msgs[len(msgs)-1].ID
+	}
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// Authorizations lists the sessions logged in to the account: this one
+// first, then the most recently active
+func (c *Client) Authorizations() ([]tg.Authorization, error) {
+	res, err := c.api.AccountGetAuthorizations(c.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get authorizations failed: %w", err)
+	}
+	list := res.Authorizations
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Current != list[j].Current {
+			return list[i].Current
+		}
+		return list[i].DateActive > list[j].DateActive
+	})
+	return list, nil
+}
+
+// TerminateAuthorization logs out the session with hash. The current
+// session can't be terminated this way.
+func (c *Client) TerminateAuthorization(hash int64) error {
+	if _, err := c.api.AccountResetAuthorization(c.ctx, hash); err != nil {
+		if tgerr.Is(err, tg.ErrFreshResetAuthorisationForbidden) {
+			return fmt.Errorf("this session is less than a day old, Telegram only lets older sessions terminate others: %w", err)
+		}
+		return fmt.Errorf("terminate session %d failed: %w", hash, err)
+	}
+	return nil
+}
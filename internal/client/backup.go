@@ -0,0 +1,110 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"tg-storage-assistant/internal/config"
+	"time"
+
+	"github.com/gotd/td/tgerr"
+)
+
+// SessionBackup is a copy of the session file saved before a run
+type SessionBackup struct {
+	N       int // 1 is the newest
+	Path    string
+	ModTime time.Time
+}
+
+// backupPath is the path of backup n of the session file
+func backupPath(sessionFile string, n int) string {
+	return fmt.Sprintf("%s.%d", sessionFile, n)
+}
+
+// backupSession copies the session file to <session_file>.1, shifting the
+// older copies up to session_backups. Nothing is rotated when the file
+// equals the newest copy, so a run that breaks the session doesn't push the
+// good copies out.
+func backupSession(cfg *config.MtprotoConfig) error {
+	if cfg.SessionBackups <= 0 {
+		return nil
+	}
+	data, err := os.ReadFile(cfg.SessionFile)
+	if errors.Is(err, os.ErrNotExist) || len(data) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if newest, err := os.ReadFile(backupPath(cfg.SessionFile, 1)); err == nil && bytes.Equal(newest, data) {
+		return nil
+	}
+
+	for n := cfg.SessionBackups; n > 1; n-- {
+		err := os.Rename(backupPath(cfg.SessionFile, n-1), backupPath(cfg.SessionFile, n))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.WriteFile(backupPath(cfg.SessionFile, 1), data, 0o600)
+}
+
+// SessionBackups lists the backups of the session file, newest first
+func SessionBackups(cfg *config.MtprotoConfig) []SessionBackup {
+	var list []SessionBackup
+	for n := 1; n <= cfg.SessionBackups; n++ {
+		path := backupPath(cfg.SessionFile, n)
+		if fi, err := os.Stat(path); err == nil {
+			list = append(list, SessionBackup{N: n, Path: path, ModTime: fi.ModTime()})
+		}
+	}
+	return list
+}
+
+// RestoreSession replaces the session file with backup n. The replaced
+// file is kept as <session_file>.broken. It fails while another process
+// uses the session.
+func RestoreSession(cfg *config.MtprotoConfig, n int) error {
+	data, err := os.ReadFile(backupPath(cfg.SessionFile, n))
+	if err != nil {
+		return fmt.Errorf("read backup %d: %w", n, err)
+	}
+	unlock, err := lockSession(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Rename(cfg.SessionFile, cfg.SessionFile+".broken"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.WriteFile(cfg.SessionFile, data, 0o600)
+}
+
+// recoveryHint tells how to get a session Telegram rejected working again,
+// "" when err is not such a rejection
+func recoveryHint(cfg *config.MtprotoConfig, err error) string {
+	code := ""
+	for _, c := range []string{"AUTH_KEY_UNREGISTERED", "SESSION_REVOKED", "SESSION_EXPIRED", "AUTH_KEY_INVALID"} {
+		if tgerr.Is(err, c) {
+			code = c
+			break
+		}
+	}
+	if code == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Telegram rejected session %s (%s). ", cfg.SessionFile, code)
+	if backups := SessionBackups(cfg); len(backups) > 0 {
+		fmt.Fprintf(&b, "If the file was overwritten or damaged, `cli session restore` puts back the copy of %s (`cli session list` shows all %d). ",
+			backups[0].ModTime.Format(time.DateTime), len(backups))
+	}
+	b.WriteString("If it was logged out from another device, move the file away and log in again with `cli history -c <chat id>`.")
+	return b.String()
+}
@@ -5,25 +5,34 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"tg-storage-assistant/internal/config"
 	"tg-storage-assistant/internal/dialer"
+	"tg-storage-assistant/internal/errs"
 	"tg-storage-assistant/internal/logger"
 	"tg-storage-assistant/internal/ui"
+	"time"
 
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/auth"
 	"github.com/gotd/td/telegram/dcs"
 	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
+	"golang.org/x/net/proxy"
 )
 
+var log = logger.Named("client")
+
 type Client struct {
 	ctx            context.Context
 	cfg            *config.MtprotoConfig
-	client         *telegram.Client
+	client         *telegram.Client // nil for clients made by NewWithAPI
+	api            API
 	flow           auth.Flow
 	uploader       *uploader.Uploader
 	uploadProgress *ui.UploadProgress
+	uploadMu       *sync.Mutex // one upload batch at a time, shared by WithContext copies
+	scheduleDate   int         // unix time sends are scheduled for, 0 to post now
 }
 
 func NewClient(ctx context.Context, cfg *config.MtprotoConfig) (*Client, error) {
@@ -34,17 +43,40 @@ func NewClient(ctx context.Context, cfg *config.MtprotoConfig) (*Client, error)
 	options.SessionStorage = &telegram.FileSessionStorage{
 		Path: cfg.SessionFile,
 	}
+	if cfg.SessionKey != "" {
+		storage, err := newEncryptedSession(options.SessionStorage, cfg.SessionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up session encryption: %w", err)
+		}
+		options.SessionStorage = storage
+	}
 
 	// Network settings
-	if cfg.Proxy != "" {
-		dial, err := dialer.CreateProxyDialerFromURL(cfg.Proxy)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create proxy dialer: %w", err)
+	dial, proxyURL, err := ProxyDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var dialFunc dcs.DialFunc
+	if dial != nil {
+		if cfg.Proxy == "" {
+			log.Info.Printf("Connecting through %s from the environment", proxyURL)
 		}
+		dialFunc = dial.DialContext
+	}
+	options.Resolver = newFallbackResolver(dialFunc, transportModes[cfg.Transport])
 
-		options.Resolver = dcs.Plain(dcs.PlainOptions{
-			Dial: dial.DialContext,
-		})
+	options.Device = telegram.DeviceConfig{
+		DeviceModel:   cfg.DeviceModel,
+		SystemVersion: cfg.SystemVersion,
+		AppVersion:    cfg.AppVersion,
+	}
+
+	// gotd's own log (RPC retries, reconnects), off unless the mtproto
+	// logging module is enabled
+	options.Logger = logger.Named("mtproto").Zap()
+
+	if cfg.TestDC != 0 {
+		return newTestClient(ctx, cfg, options), nil
 	}
 
 	// Client
@@ -56,17 +88,96 @@ func NewClient(ctx context.Context, cfg *config.MtprotoConfig) (*Client, error)
 	)
 
 	return &Client{
-		ctx:    ctx,
-		cfg:    cfg,
-		client: client,
-		flow:   flow,
+		ctx:      ctx,
+		cfg:      cfg,
+		client:   client,
+		api:      client.API(),
+		flow:     flow,
+		uploadMu: &sync.Mutex{},
 	}, nil
 }
 
+// ProxyDialer returns the dialer of the configured proxy, or else of the
+// environment unless proxy is "direct", and its URL. It is nil for direct
+// connections.
+func ProxyDialer(cfg *config.MtprotoConfig) (proxy.ContextDialer, string, error) {
+	resolver, err := Resolver(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	switch cfg.Proxy {
+	case "direct":
+		return nil, "", nil
+	case "":
+		d, err := dialer.FromEnvironment(resolver)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to use the proxy of the environment: %w", err)
+		}
+		if d == nil {
+			return nil, "", nil
+		}
+		return d, dialer.EnvironmentProxy(), nil
+	}
+	d, err := dialer.CreateProxyDialerFromURL(cfg.Proxy, resolver)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create proxy dialer: %w", err)
+	}
+	return d, cfg.Proxy, nil
+}
+
+// Resolver returns the DNS-over-HTTPS resolver of cfg.DoH, nil for the
+// system resolver
+func Resolver(cfg *config.MtprotoConfig) (*dialer.Resolver, error) {
+	if cfg.DoH == "" {
+		return nil, nil
+	}
+	return dialer.NewResolver(cfg.DoH)
+}
+
+// NewWithAPI returns a client that calls api instead of connecting to
+// Telegram, for tests with FakeAPI. Run never logs in.
+func NewWithAPI(ctx context.Context, cfg *config.MtprotoConfig, api API) *Client {
+	return &Client{
+		ctx:      ctx,
+		cfg:      cfg,
+		api:      api,
+		uploadMu: &sync.Mutex{},
+	}
+}
+
+// WithContext returns a client sharing the same connection whose API calls
+// use ctx, so long operations can be canceled
+func (c *Client) WithContext(ctx context.Context) *Client {
+	c2 := *c
+	c2.ctx = ctx
+	c2.uploader = nil
+	c2.uploadProgress = nil
+	return &c2
+}
+
+// WithSchedule returns a client sharing the same connection whose
+// SendMessage, SendMedia and SendMultiMedia queue scheduled messages posted
+// at at, or post right away when at is zero. The IDs they return are those
+// of the scheduled messages, which change once they are posted.
+func (c *Client) WithSchedule(at time.Time) *Client {
+	c2 := *c
+	c2.scheduleDate = 0
+	if !at.IsZero() {
+		c2.scheduleDate = int(at.Unix())
+	}
+	return &c2
+}
+
+// Context returns the context API calls of c use
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
 func (c *Client) InitUploader() {
 	c.uploadProgress = ui.NewUploadProgress()
-	c.uploader = uploader.NewUploader(c.client.API()).
-		WithPartSize(512 * 1024).
+	c.uploader = uploader.NewUploader(c.api).
+		WithPartSize(c.partSize()).
+		WithThreads(c.cfg.UploadThreads).
 		WithProgress(c.uploadProgress)
 }
 
@@ -77,7 +188,7 @@ func (c *Client) CloseUploader() {
 
 func (c *Client) ResolvePeer(chatID int64) (tg.InputPeerClass, error) {
 	// Get dialogs to find the peer with access hash
-	dialogs, err := c.client.API().MessagesGetDialogs(c.ctx, &tg.MessagesGetDialogsRequest{
+	dialogs, err := c.api.MessagesGetDialogs(c.ctx, &tg.MessagesGetDialogsRequest{
 		OffsetPeer: &tg.InputPeerEmpty{},
 		Limit:      100,
 	})
@@ -86,11 +197,19 @@ func (c *Client) ResolvePeer(chatID int64) (tg.InputPeerClass, error) {
 	}
 
 	var chats []tg.ChatClass
+	var users []tg.UserClass
 	switch d := dialogs.(type) {
 	case *tg.MessagesDialogs:
-		chats = d.Chats
+		chats, users = d.Chats, d.Users
 	case *tg.MessagesDialogsSlice:
-		chats = d.Chats
+		chats, users = d.Chats, d.Users
+	}
+
+	// Users have positive IDs in Bot API format
+	for _, u := range users {
+		if user, ok := u.(*tg.User); ok && user.ID == chatID {
+			return user.AsInputPeer(), nil
+		}
 	}
 
 	// Find the chat
@@ -117,27 +236,95 @@ func (c *Client) ResolvePeer(chatID int64) (tg.InputPeerClass, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("chat ID %d not found in dialogs (make sure the user account is a member of this chat)", chatID)
+	return nil, fmt.Errorf("%w: chat ID %d is not in the dialogs (make sure the user account is a member of this chat)", errs.ErrPeerNotFound, chatID)
 }
 
 func (c *Client) Run(f func(ctx context.Context) error) error {
-	return c.client.Run(c.ctx, func(ctx context.Context) error {
+	if c.client == nil {
+		return Classify(f(c.ctx))
+	}
+	unlock, err := c.beginSession()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.endSession(c.client.Run(c.ctx, func(ctx context.Context) error {
 		if err := c.LoginIfNecessary(); err != nil {
 			return fmt.Errorf("login failed: %w", err)
 		}
 
 		return f(c.ctx)
-	})
+	}))
+}
+
+// RunWithoutLogin connects like Run but never starts the interactive login,
+// for checks that must not block on a code prompt
+func (c *Client) RunWithoutLogin(f func(ctx context.Context) error) error {
+	if c.client == nil {
+		return Classify(f(c.ctx))
+	}
+	unlock, err := c.beginSession()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.endSession(c.client.Run(c.ctx, func(ctx context.Context) error {
+		return f(c.ctx)
+	}))
+}
+
+// beginSession locks the session file and backs it up before connecting
+func (c *Client) beginSession() (unlock func(), err error) {
+	unlock, err = lockSession(c.ctx, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := backupSession(c.cfg); err != nil {
+		log.Warn.Printf("Failed to back up session %s: %v", c.cfg.SessionFile, err)
+	}
+	return unlock, nil
+}
+
+// endSession classifies the error of a run and explains how to recover a
+// session Telegram rejected
+func (c *Client) endSession(err error) error {
+	if hint := recoveryHint(c.cfg, err); hint != "" {
+		log.Error.Println(hint)
+	}
+	return Classify(err)
 }
 
 func (c *Client) LoginIfNecessary() error {
+	if c.client == nil {
+		return nil
+	}
 	// Login if necessary
 	if err := c.client.Auth().IfNecessary(c.ctx, c.flow); err != nil {
-		return fmt.Errorf("auth failed: %w", err)
+		return fmt.Errorf("%w: %w", errs.ErrAuthRequired, err)
 	}
 	return nil
 }
 
+// Ping checks that the MTProto connection is alive
+func (c *Client) Ping(ctx context.Context) error {
+	if c.client == nil {
+		return nil
+	}
+	return c.client.Ping(ctx)
+}
+
+// Authorized reports whether the session is logged in
+func (c *Client) Authorized(ctx context.Context) (bool, error) {
+	if c.client == nil {
+		return true, nil
+	}
+	status, err := c.client.Auth().Status(ctx)
+	if err != nil {
+		return false, err
+	}
+	return status.Authorized, nil
+}
+
 type codeOnlyAuth struct{}
 
 func (a *codeOnlyAuth) Code(_ context.Context, _ *tg.AuthSentCode) (string, error) {
@@ -165,8 +352,12 @@ func (c *Client) GetHistory(chatID int64, opts HistoryOptions) ([]*tg.Message, e
 	if err != nil {
 		return nil, fmt.Errorf("ResolvePeer failed: %w", err)
 	}
+	return c.history(peer, opts)
+}
 
-	resp, err := c.client.API().MessagesGetHistory(c.ctx, &tg.MessagesGetHistoryRequest{
+// history fetches one page of messages of peer
+func (c *Client) history(peer tg.InputPeerClass, opts HistoryOptions) ([]*tg.Message, error) {
+	resp, err := c.api.MessagesGetHistory(c.ctx, &tg.MessagesGetHistoryRequest{
 		Peer:       peer,
 		OffsetID:   opts.OffsetID,
 		AddOffset:  0,
@@ -179,6 +370,11 @@ func (c *Client) GetHistory(chatID int64, opts HistoryOptions) ([]*tg.Message, e
 		return nil, fmt.Errorf("MessagesGetHistory failed: %w", err)
 	}
 
+	return collectMessages(resp)
+}
+
+// collectMessages extracts the plain messages from a messages.Messages response
+func collectMessages(resp tg.MessagesMessagesClass) ([]*tg.Message, error) {
 	var msgs []*tg.Message
 
 	switch v := resp.(type) {
@@ -207,6 +403,73 @@ func (c *Client) GetHistory(chatID int64, opts HistoryOptions) ([]*tg.Message, e
 	return msgs, nil
 }
 
+// DeleteMessages deletes messages for everyone in the given chat
+func (c *Client) DeleteMessages(chatID int64, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+
+	switch p := peer.(type) {
+	case *tg.InputPeerChannel:
+		_, err = c.api.ChannelsDeleteMessages(c.ctx, &tg.ChannelsDeleteMessagesRequest{
+			Channel: &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash},
+			ID:      ids,
+		})
+	default:
+		_, err = c.api.MessagesDeleteMessages(c.ctx, &tg.MessagesDeleteMessagesRequest{
+			Revoke: true,
+			ID:     ids,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("delete messages failed: %w", err)
+	}
+	return nil
+}
+
+// MarkRead marks the messages of chatID up to maxID as read, or all of them
+// when maxID is 0, so bulk uploads don't pile up unread messages in the
+// official apps
+func (c *Client) MarkRead(chatID int64, maxID int) error {
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+
+	if maxID <= 0 {
+		latest, err := c.history(peer, HistoryOptions{Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(latest) == 0 {
+			return nil
+		}
+		maxID = latest[0].ID
+	}
+
+	switch p := peer.(type) {
+	case *tg.InputPeerChannel:
+		_, err = c.api.ChannelsReadHistory(c.ctx, &tg.ChannelsReadHistoryRequest{
+			Channel: &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash},
+			MaxID:   maxID,
+		})
+	default:
+		_, err = c.api.MessagesReadHistory(c.ctx, &tg.MessagesReadHistoryRequest{
+			Peer:  peer,
+			MaxID: maxID,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("read history failed: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) ForwardMessages(fromChatID, toChatID int64, msgs []*tg.Message) error {
 	if len(msgs) == 0 {
 		return nil
@@ -235,7 +498,7 @@ func (c *Client) ForwardMessages(fromChatID, toChatID int64, msgs []*tg.Message)
 		randomIDs[i] = randID()
 	}
 
-	_, err = c.client.API().MessagesForwardMessages(c.ctx, &tg.MessagesForwardMessagesRequest{
+	_, err = c.api.MessagesForwardMessages(c.ctx, &tg.MessagesForwardMessagesRequest{
 		FromPeer: fromPeer,
 		ID:       ids,
 		RandomID: randomIDs,
@@ -248,6 +511,43 @@ func (c *Client) ForwardMessages(fromChatID, toChatID int64, msgs []*tg.Message)
 	return nil
 }
 
+// CopyMessages copies messages ids of fromChatID to toChatID without the
+// "forwarded from" header, keeping albums together, and returns the IDs of
+// the copies in order
+func (c *Client) CopyMessages(fromChatID, toChatID int64, ids []int) ([]int, error) {
+	fromPeer, err := c.ResolvePeer(fromChatID)
+	if err != nil {
+		return nil, fmt.Errorf("ResolvePeer(from) failed: %w", err)
+	}
+	toPeer, err := c.ResolvePeer(toChatID)
+	if err != nil {
+		return nil, fmt.Errorf("ResolvePeer(to) failed: %w", err)
+	}
+
+	randomIDs := make([]int64, len(ids))
+	for i := range ids {
+		randomIDs[i] = randID()
+	}
+	updates, err := c.api.MessagesForwardMessages(c.ctx, &tg.MessagesForwardMessagesRequest{
+		FromPeer:   fromPeer,
+		ID:         ids,
+		RandomID:   randomIDs,
+		ToPeer:     toPeer,
+		DropAuthor: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("MessagesForwardMessages failed: %w", err)
+	}
+
+	sent := extractSentMedias(updates)
+	copied := make([]int, 0, len(sent))
+	for _, m := range sent {
+		copied = append(copied, m.MsgID)
+	}
+	sort.Ints(copied)
+	return copied, nil
+}
+
 func (c *Client) SendMessagesAsNew(fromChatID, toChatID int64, msgs []*tg.Message) error {
 	if len(msgs) == 0 {
 		return nil
@@ -263,7 +563,7 @@ func (c *Client) SendMessagesAsNew(fromChatID, toChatID int64, msgs []*tg.Messag
 		return msgs[i].ID < msgs[j].ID
 	})
 
-	api := c.client.API()
+	api := c.api
 
 	// 1. Split into singles and albums
 	singles := make([]*tg.Message, 0, len(msgs))
@@ -340,7 +640,7 @@ func (c *Client) SendMessagesAsNew(fromChatID, toChatID int64, msgs []*tg.Messag
 			}
 		default:
 			// Ignore other types
-			logger.Debug.Printf("unknown media type: %T\n", m.Media)
+			log.Debug.Printf("unknown media type: %T\n", m.Media)
 			continue
 		}
 	}
@@ -356,7 +656,7 @@ func (c *Client) SendMessagesAsNew(fromChatID, toChatID int64, msgs []*tg.Messag
 		for i, m := range group {
 			if m.Media == nil {
 				// Plain text in albums is usually not present, ignore
-				logger.Debug.Printf("plain text in album id=%d\n", m.ID)
+				log.Debug.Printf("plain text in album id=%d\n", m.ID)
 				continue
 			}
 
@@ -391,7 +691,7 @@ func (c *Client) SendMessagesAsNew(fromChatID, toChatID int64, msgs []*tg.Messag
 
 			default:
 				// Unsupported media types are skipped
-				logger.Debug.Printf("unsupported media type: %T\n", m.Media)
+				log.Debug.Printf("unsupported media type: %T\n", m.Media)
 				continue
 			}
 
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+)
+
+// GetMessages fetches messages by ID from the given chat
+func (c *Client) GetMessages(chatID int64, ids []int) ([]*tg.Message, error) {
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return nil, fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+
+	inputIDs := make([]tg.InputMessageClass, len(ids))
+	for i, id := range ids {
+		inputIDs[i] = &tg.InputMessageID{ID: id}
+	}
+
+	var resp tg.MessagesMessagesClass
+	switch p := peer.(type) {
+	case *tg.InputPeerChannel:
+		resp, err = c.api.ChannelsGetMessages(c.ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash},
+			ID:      inputIDs,
+		})
+	default:
+		resp, err = c.api.MessagesGetMessages(c.ctx, inputIDs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get messages failed: %w", err)
+	}
+
+	return collectMessages(resp)
+}
+
+// DownloadMessageMedia downloads the photo or document of msg into dir and
+// returns the path of the written file
+func (c *Client) DownloadMessageMedia(msg *tg.Message, dir string) (string, error) {
+	loc, name, err := mediaLocation(msg)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create download dir: %w", err)
+	}
+	dst := filepath.Join(dir, name)
+
+	if err := c.download(msg.ID, loc, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// DownloadMessageMediaTo downloads the photo or document of msg to dst
+func (c *Client) DownloadMessageMediaTo(msg *tg.Message, dst string) error {
+	loc, _, err := mediaLocation(msg)
+	if err != nil {
+		return err
+	}
+	return c.download(msg.ID, loc, dst)
+}
+
+// StreamMessageMedia writes the photo or document of msg to w as it is
+// downloaded
+func (c *Client) StreamMessageMedia(msg *tg.Message, w io.Writer) error {
+	loc, _, err := mediaLocation(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := downloader.NewDownloader().Download(c.api, loc).Stream(c.ctx, w); err != nil {
+		return fmt.Errorf("download message %d failed: %w", msg.ID, err)
+	}
+	return nil
+}
+
+func (c *Client) download(msgID int, loc tg.InputFileLocationClass, dst string) error {
+	_, err := downloader.NewDownloader().Download(c.api, loc).ToPath(c.ctx, dst)
+	if err != nil {
+		return fmt.Errorf("download message %d failed: %w", msgID, err)
+	}
+	return nil
+}
+
+// thumbSize is the photo size DownloadThumbnail prefers, 320px on the longer side
+const thumbSize = "m"
+
+// DownloadThumbnail returns a small JPEG of the photo of msg, or the
+// thumbnail of its document such as a music cover
+func (c *Client) DownloadThumbnail(msg *tg.Message) ([]byte, error) {
+	var loc tg.InputFileLocationClass
+	switch media := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		if photo, ok := media.Photo.(*tg.Photo); ok {
+			loc = &tg.InputPhotoFileLocation{
+				ID:            photo.ID,
+				AccessHash:    photo.AccessHash,
+				FileReference: photo.FileReference,
+				ThumbSize:     thumbType(photo.Sizes),
+			}
+		}
+	case *tg.MessageMediaDocument:
+		if doc, ok := media.Document.(*tg.Document); ok && thumbType(doc.Thumbs) != "" {
+			loc = &tg.InputDocumentFileLocation{
+				ID:            doc.ID,
+				AccessHash:    doc.AccessHash,
+				FileReference: doc.FileReference,
+				ThumbSize:     thumbType(doc.Thumbs),
+			}
+		}
+	}
+	if loc == nil {
+		return nil, fmt.Errorf("message %d has no thumbnail", msg.ID)
+	}
+
+	var buf bytes.Buffer
+	if _, err := downloader.NewDownloader().Download(c.api, loc).Stream(c.ctx, &buf); err != nil {
+		return nil, fmt.Errorf("download thumbnail of message %d failed: %w", msg.ID, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbType picks thumbSize among sizes, or else the biggest one that can
+// be downloaded
+func thumbType(sizes []tg.PhotoSizeClass) string {
+	best, bestArea := "", 0
+	for _, size := range sizes {
+		s, ok := size.(*tg.PhotoSize)
+		if !ok {
+			continue
+		}
+		if s.Type == thumbSize {
+			return s.Type
+		}
+		if s.W*s.H > bestArea {
+			best, bestArea = s.Type, s.W*s.H
+		}
+	}
+	return best
+}
+
+// MediaName is the file name DownloadMessageMedia gives the media of msg,
+// "" when it has none
+func MediaName(msg *tg.Message) string {
+	_, name, err := mediaLocation(msg)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// MediaDuration returns the length in seconds Telegram records for the
+// video or audio of msg, 0 when unknown
+func MediaDuration(msg *tg.Message) float64 {
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return 0
+	}
+	doc, ok := media.Document.(*tg.Document)
+	if !ok {
+		return 0
+	}
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeVideo:
+			return a.Duration
+		case *tg.DocumentAttributeAudio:
+			return float64(a.Duration)
+		}
+	}
+	return 0
+}
+
+// mediaLocation returns the file location and a file name for the media of msg
+func mediaLocation(msg *tg.Message) (tg.InputFileLocationClass, string, error) {
+	switch media := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		photo, ok := media.Photo.(*tg.Photo)
+		if !ok {
+			return nil, "", fmt.Errorf("message %d has an empty photo", msg.ID)
+		}
+		return &tg.InputPhotoFileLocation{
+			ID:            photo.ID,
+			AccessHash:    photo.AccessHash,
+			FileReference: photo.FileReference,
+			ThumbSize:     largestPhotoSize(photo),
+		}, fmt.Sprintf("%d.jpg", msg.ID), nil
+
+	case *tg.MessageMediaDocument:
+		doc, ok := media.Document.(*tg.Document)
+		if !ok {
+			return nil, "", fmt.Errorf("message %d has an empty document", msg.ID)
+		}
+		// Voice and video notes have no file name; their suffix lets an
+		// upload of the file restore them as notes (see fileprocessor.NoteType)
+		name := fmt.Sprintf("%d.bin", msg.ID)
+		for _, attr := range doc.Attributes {
+			switch a := attr.(type) {
+			case *tg.DocumentAttributeFilename:
+				if a.FileName != "" {
+					name = filepath.Base(a.FileName)
+				}
+			case *tg.DocumentAttributeAudio:
+				if a.Voice {
+					name = fmt.Sprintf("%d.voice.ogg", msg.ID)
+				}
+			case *tg.DocumentAttributeVideo:
+				if a.RoundMessage {
+					name = fmt.Sprintf("%d.round.mp4", msg.ID)
+				}
+			}
+		}
+		return &tg.InputDocumentFileLocation{
+			ID:            doc.ID,
+			AccessHash:    doc.AccessHash,
+			FileReference: doc.FileReference,
+		}, name, nil
+	}
+
+	return nil, "", fmt.Errorf("message %d has no downloadable media", msg.ID)
+}
+
+// largestPhotoSize returns the type of the biggest available photo size
+func largestPhotoSize(photo *tg.Photo) string {
+	best, bestArea := "", 0
+	for _, size := range photo.Sizes {
+		switch s := size.(type) {
+		case *tg.PhotoSize:
+			if s.W*s.H > bestArea {
+				best, bestArea = s.Type, s.W*s.H
+			}
+		case *tg.PhotoSizeProgressive:
+			if s.W*s.H > bestArea {
+				best, bestArea = s.Type, s.W*s.H
+			}
+		}
+	}
+	return best
+}
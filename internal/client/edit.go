@@ -0,0 +1,52 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/gotd/td/tg"
+)
+
+// EditCaption replaces the caption (or text) of a message. entities style
+// the new caption and may be nil; an empty caption removes it.
+func (c *Client) EditCaption(chatID int64, msgID int, caption string, entities []tg.MessageEntityClass) error {
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+
+	req := &tg.MessagesEditMessageRequest{Peer: peer, ID: msgID}
+	req.SetMessage(caption)
+	if entities != nil {
+		req.SetEntities(entities)
+	}
+	if _, err := c.api.MessagesEditMessage(c.ctx, req); err != nil {
+		return fmt.Errorf("edit caption of message %d failed: %w", msgID, err)
+	}
+	return nil
+}
+
+// EditMedia uploads item and puts it in place of the media of a message,
+// e.g. to replace a corrupted part of an album. The caption is replaced by
+// item.Caption and entities when it is set, and kept otherwise.
+func (c *Client) EditMedia(chatID int64, msgID int, item MediaItem, entities []tg.MessageEntityClass) error {
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+	media, err := c.uploadSingle(item)
+	if err != nil {
+		return err
+	}
+
+	req := &tg.MessagesEditMessageRequest{Peer: peer, ID: msgID, Media: media.Media}
+	if item.Caption != "" {
+		req.SetMessage(item.Caption)
+		if entities != nil {
+			req.SetEntities(entities)
+		}
+	}
+	if _, err := c.api.MessagesEditMessage(c.ctx, req); err != nil {
+		return fmt.Errorf("edit media of message %d failed: %w", msgID, err)
+	}
+	return nil
+}
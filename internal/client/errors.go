@@ -0,0 +1,33 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"tg-storage-assistant/internal/errs"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tgerr"
+)
+
+// Classify wraps Telegram RPC errors that callers react to differently in
+// the matching errs sentinel; other errors are returned unchanged
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, sentinel := range []error{errs.ErrAuthRequired, errs.ErrFloodWait, errs.ErrPeerNotFound} {
+		if errors.Is(err, sentinel) {
+			return err
+		}
+	}
+	switch {
+	case auth.IsUnauthorized(err):
+		return fmt.Errorf("%w: %w", errs.ErrAuthRequired, err)
+	case tgerr.Is(err, "PEER_ID_INVALID", "CHANNEL_INVALID", "CHANNEL_PRIVATE", "CHAT_ID_INVALID"):
+		return fmt.Errorf("%w: %w", errs.ErrPeerNotFound, err)
+	}
+	if d, ok := tgerr.AsFloodWait(err); ok {
+		return fmt.Errorf("%w of %s: %w", errs.ErrFloodWait, d, err)
+	}
+	return err
+}
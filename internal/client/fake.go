@@ -0,0 +1,640 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// FakeAPI is an in-memory Telegram for tests. Channels added with AddChannel
+// show up in the dialogs; uploaded, sent and forwarded media are kept per
+// channel and served back by history and search. Invalid requests fail with
+// the RPC errors Telegram returns; calling a method the fake doesn't
+// implement panics.
+type FakeAPI struct {
+	API // not implemented
+
+	mu       sync.Mutex
+	channels map[int64]*fakeChannel         // by channel ID, not the -100 chat ID
+	users    map[string]*tg.User            // by username
+	media    map[int64]tg.MessageMediaClass // uploaded photos and documents by ID
+	sizes    map[int64]int64                // bytes of uploaded files by file ID
+	parts    map[int64]map[int][]byte       // parts of uploaded files by file ID
+	files    map[int64][]byte               // content of documents by ID
+	auths    []tg.Authorization             // sessions of the account
+	nextID   int64
+
+	bigParts     int // big file parts received
+	bigPartLimit int // fail big file parts after this many, 0 for no limit
+}
+
+type fakeChannel struct {
+	channel  *tg.Channel
+	messages []*tg.Message // oldest first
+	lastID   int
+	readID   int // newest message marked read
+
+	scheduled       []*tg.Message // not posted yet, kept out of history
+	lastScheduledID int
+
+	admins map[int64]tg.ChatAdminRights // by user ID
+}
+
+// NewFakeAPI returns a fake without channels
+func NewFakeAPI() *FakeAPI {
+	return &FakeAPI{
+		channels: make(map[int64]*fakeChannel),
+		users:    make(map[string]*tg.User),
+		media:    make(map[int64]tg.MessageMediaClass),
+		sizes:    make(map[int64]int64),
+		parts:    make(map[int64]map[int][]byte),
+		files:    make(map[int64][]byte),
+	}
+}
+
+// AddChannel creates a channel with the Bot API chat ID chatID
+// (-100xxxxxxxxxx) for ResolvePeer to find
+func (f *FakeAPI) AddChannel(chatID int64, title string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := -chatID - 1000000000000
+	f.channels[id] = &fakeChannel{channel: &tg.Channel{ID: id, AccessHash: id * 31, Title: title}}
+}
+
+// AddUser creates a user (or bot) that ResolveUsername finds by username
+func (f *FakeAPI) AddUser(userID int64, username string, bot bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[username] = &tg.User{ID: userID, AccessHash: userID * 31, Username: username, Bot: bot}
+}
+
+// Admins returns the admins of chatID added with ChannelsEditAdmin
+func (f *FakeAPI) Admins(chatID int64) map[int64]tg.ChatAdminRights {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, ok := f.channels[-chatID-1000000000000]
+	if !ok {
+		return nil
+	}
+	return ch.admins
+}
+
+// Messages returns the messages of chatID, oldest first
+func (f *FakeAPI) Messages(chatID int64) []*tg.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, ok := f.channels[-chatID-1000000000000]
+	if !ok {
+		return nil
+	}
+	return append([]*tg.Message(nil), ch.messages...)
+}
+
+// Scheduled returns the scheduled messages of chatID in the order they were
+// queued
+func (f *FakeAPI) Scheduled(chatID int64) []*tg.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, ok := f.channels[-chatID-1000000000000]
+	if !ok {
+		return nil
+	}
+	return append([]*tg.Message(nil), ch.scheduled...)
+}
+
+// ReadMaxID returns the newest message of chatID marked read
+func (f *FakeAPI) ReadMaxID(chatID int64) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, ok := f.channels[-chatID-1000000000000]
+	if !ok {
+		return 0
+	}
+	return ch.readID
+}
+
+func (f *FakeAPI) newID() int64 {
+	f.nextID++
+	return f.nextID
+}
+
+func (f *FakeAPI) channel(peer tg.InputPeerClass) (*fakeChannel, error) {
+	p, ok := peer.(*tg.InputPeerChannel)
+	if !ok {
+		return nil, fmt.Errorf("fake: unsupported peer %T", peer)
+	}
+	ch, ok := f.channels[p.ChannelID]
+	if !ok || ch.channel.AccessHash != p.AccessHash {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+	return ch, nil
+}
+
+func (f *FakeAPI) UploadSaveFilePart(_ context.Context, req *tg.UploadSaveFilePartRequest) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.savePart(req.FileID, req.FilePart, req.Bytes)
+	return true, nil
+}
+
+func (f *FakeAPI) UploadSaveBigFilePart(_ context.Context, req *tg.UploadSaveBigFilePartRequest) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.bigPartLimit > 0 && f.bigParts >= f.bigPartLimit {
+		return false, tgerr.New(500, "RPC_CALL_FAIL")
+	}
+	f.bigParts++
+	f.savePart(req.FileID, req.FilePart, req.Bytes)
+	return true, nil
+}
+
+func (f *FakeAPI) savePart(fileID int64, part int, data []byte) {
+	if f.parts[fileID] == nil {
+		f.parts[fileID] = make(map[int][]byte)
+	}
+	f.parts[fileID][part] = append([]byte(nil), data...)
+	f.sizes[fileID] += int64(len(data))
+}
+
+// content joins the parts of an uploaded file
+func (f *FakeAPI) content(fileID int64) []byte {
+	var data []byte
+	for p := 0; p < len(f.parts[fileID]); p++ {
+		data = append(data, f.parts[fileID][p]...)
+	}
+	return data
+}
+
+// UploadGetFile serves the content of documents with the limits Telegram
+// puts on offset and limit
+func (f *FakeAPI) UploadGetFile(_ context.Context, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	loc, ok := req.Location.(*tg.InputDocumentFileLocation)
+	if !ok {
+		return nil, fmt.Errorf("fake: unsupported location %T", req.Location)
+	}
+	data, ok := f.files[loc.ID]
+	if !ok {
+		return nil, tgerr.New(400, "FILE_REFERENCE_EXPIRED")
+	}
+	const mb = 1 << 20
+	if req.Limit <= 0 || req.Limit%4096 != 0 || mb%req.Limit != 0 {
+		return nil, tgerr.New(400, "LIMIT_INVALID")
+	}
+	if req.Offset%4096 != 0 || req.Offset/mb != (req.Offset+int64(req.Limit)-1)/mb {
+		return nil, tgerr.New(400, "OFFSET_INVALID")
+	}
+	start := min(req.Offset, int64(len(data)))
+	end := min(start+int64(req.Limit), int64(len(data)))
+	return &tg.UploadFile{Type: &tg.StorageFilePartial{}, Bytes: data[start:end]}, nil
+}
+
+// LimitBigParts makes big file parts fail once n were received in total,
+// as if the connection dropped; 0 lifts the limit. It returns the number
+// received so far.
+func (f *FakeAPI) LimitBigParts(n int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bigPartLimit = n
+	return f.bigParts
+}
+
+func (f *FakeAPI) MessagesUploadMedia(_ context.Context, req *tg.MessagesUploadMediaRequest) (tg.MessageMediaClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resolveMedia(req.Media)
+}
+
+// resolveMedia stores newly uploaded media and looks up media sent again
+func (f *FakeAPI) resolveMedia(in tg.InputMediaClass) (tg.MessageMediaClass, error) {
+	switch m := in.(type) {
+	case *tg.InputMediaUploadedPhoto:
+		id := f.newID()
+		media := &tg.MessageMediaPhoto{Photo: &tg.Photo{ID: id, AccessHash: id, FileReference: []byte{1}}}
+		f.media[id] = media
+		return media, nil
+	case *tg.InputMediaUploadedDocument:
+		id := f.newID()
+		media := &tg.MessageMediaDocument{Document: &tg.Document{
+			ID:            id,
+			AccessHash:    id,
+			FileReference: []byte{1},
+			MimeType:      m.MimeType,
+			Size:          f.sizes[inputFileID(m.File)],
+			Attributes:    m.Attributes,
+		}}
+		f.media[id] = media
+		f.files[id] = f.content(inputFileID(m.File))
+		return media, nil
+	case *tg.InputMediaPhoto:
+		if p, ok := m.ID.(*tg.InputPhoto); ok && f.media[p.ID] != nil {
+			media := *f.media[p.ID].(*tg.MessageMediaPhoto)
+			if ttl, ok := m.GetTTLSeconds(); ok {
+				media.SetTTLSeconds(ttl)
+			}
+			return &media, nil
+		}
+	case *tg.InputMediaDocument:
+		if d, ok := m.ID.(*tg.InputDocument); ok && f.media[d.ID] != nil {
+			media := *f.media[d.ID].(*tg.MessageMediaDocument)
+			if ttl, ok := m.GetTTLSeconds(); ok {
+				media.SetTTLSeconds(ttl)
+			}
+			return &media, nil
+		}
+	}
+	return nil, tgerr.New(400, "MEDIA_INVALID")
+}
+
+func inputFileID(file tg.InputFileClass) int64 {
+	switch v := file.(type) {
+	case *tg.InputFile:
+		return v.ID
+	case *tg.InputFileBig:
+		return v.ID
+	}
+	return 0
+}
+
+// post appends a message to ch
+func (f *FakeAPI) post(ch *fakeChannel, text string, media tg.MessageMediaClass, groupedID int64) *tg.Message {
+	return f.send(ch, text, media, groupedID, 0)
+}
+
+// send posts a message to ch, or queues it when scheduleDate is set
+func (f *FakeAPI) send(ch *fakeChannel, text string, media tg.MessageMediaClass, groupedID int64, scheduleDate int) *tg.Message {
+	msg := &tg.Message{
+		PeerID:    &tg.PeerChannel{ChannelID: ch.channel.ID},
+		Date:      scheduleDate,
+		Message:   text,
+		GroupedID: groupedID,
+	}
+	if media != nil {
+		msg.Media = media
+	}
+	if scheduleDate == 0 {
+		ch.lastID++
+		msg.ID = ch.lastID
+		msg.Date = int(time.Now().Unix())
+		ch.messages = append(ch.messages, msg)
+	} else {
+		ch.lastScheduledID++
+		msg.ID = ch.lastScheduledID
+		ch.scheduled = append(ch.scheduled, msg)
+	}
+	return msg
+}
+
+// updates reports sent messages the way Telegram does for channels
+func updates(msgs []*tg.Message, randomIDs []int64, scheduled bool) *tg.Updates {
+	u := &tg.Updates{}
+	for i, msg := range msgs {
+		if i < len(randomIDs) {
+			u.Updates = append(u.Updates, &tg.UpdateMessageID{ID: msg.ID, RandomID: randomIDs[i]})
+		}
+		if scheduled {
+			u.Updates = append(u.Updates, &tg.UpdateNewScheduledMessage{Message: msg})
+		} else {
+			u.Updates = append(u.Updates, &tg.UpdateNewChannelMessage{Message: msg})
+		}
+	}
+	return u
+}
+
+func (f *FakeAPI) MessagesSendMessage(_ context.Context, req *tg.MessagesSendMessageRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, err := f.channel(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	msg := f.send(ch, req.Message, nil, 0, req.ScheduleDate)
+	return updates([]*tg.Message{msg}, []int64{req.RandomID}, req.ScheduleDate != 0), nil
+}
+
+func (f *FakeAPI) MessagesSendMedia(_ context.Context, req *tg.MessagesSendMediaRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, err := f.channel(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	media, err := f.resolveMedia(req.Media)
+	if err != nil {
+		return nil, err
+	}
+	msg := f.send(ch, req.Message, media, 0, req.ScheduleDate)
+	return updates([]*tg.Message{msg}, []int64{req.RandomID}, req.ScheduleDate != 0), nil
+}
+
+func (f *FakeAPI) MessagesSendMultiMedia(_ context.Context, req *tg.MessagesSendMultiMediaRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, err := f.channel(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.MultiMedia) < 2 || len(req.MultiMedia) > 10 {
+		return nil, tgerr.New(400, "MEDIA_INVALID")
+	}
+
+	groupedID := f.newID()
+	msgs := make([]*tg.Message, len(req.MultiMedia))
+	randomIDs := make([]int64, len(req.MultiMedia))
+	for i, item := range req.MultiMedia {
+		media, err := f.resolveMedia(item.Media)
+		if err != nil {
+			return nil, err
+		}
+		msgs[i] = f.send(ch, item.Message, media, groupedID, req.ScheduleDate)
+		randomIDs[i] = item.RandomID
+	}
+	return updates(msgs, randomIDs, req.ScheduleDate != 0), nil
+}
+
+func (f *FakeAPI) MessagesForwardMessages(_ context.Context, req *tg.MessagesForwardMessagesRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	from, err := f.channel(req.FromPeer)
+	if err != nil {
+		return nil, err
+	}
+	to, err := f.channel(req.ToPeer)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[int64]int64) // source album -> copy
+	var msgs []*tg.Message
+	for _, id := range req.ID {
+		src := from.find(id)
+		if src == nil {
+			return nil, tgerr.New(400, "MESSAGE_ID_INVALID")
+		}
+		groupedID := src.GroupedID
+		if groupedID != 0 {
+			if _, ok := groups[groupedID]; !ok {
+				groups[groupedID] = f.newID()
+			}
+			groupedID = groups[groupedID]
+		}
+		msgs = append(msgs, f.post(to, src.Message, src.Media, groupedID))
+	}
+	return updates(msgs, req.RandomID, false), nil
+}
+
+func (f *FakeAPI) MessagesEditMessage(_ context.Context, req *tg.MessagesEditMessageRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, err := f.channel(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	msg := ch.find(req.ID)
+	if msg == nil {
+		return nil, tgerr.New(400, "MESSAGE_ID_INVALID")
+	}
+
+	if req.Media != nil {
+		media, err := f.resolveMedia(req.Media)
+		if err != nil {
+			return nil, err
+		}
+		msg.Media = media
+	}
+	if text, ok := req.GetMessage(); ok {
+		msg.Message = text
+		msg.Entities = req.Entities
+	}
+	return &tg.Updates{Updates: []tg.UpdateClass{&tg.UpdateEditChannelMessage{Message: msg}}}, nil
+}
+
+func (f *FakeAPI) MessagesSendReaction(_ context.Context, req *tg.MessagesSendReactionRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, err := f.channel(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	msg := ch.find(req.MsgID)
+	if msg == nil {
+		return nil, tgerr.New(400, "MESSAGE_ID_INVALID")
+	}
+
+	// Only the account's own reactions are kept
+	var results []tg.ReactionCount
+	for i, r := range req.Reaction {
+		results = append(results, tg.ReactionCount{Reaction: r, Count: 1, ChosenOrder: i + 1})
+	}
+	msg.SetReactions(tg.MessageReactions{Results: results})
+	return &tg.Updates{Updates: []tg.UpdateClass{&tg.UpdateEditChannelMessage{Message: msg}}}, nil
+}
+
+func (ch *fakeChannel) find(id int) *tg.Message {
+	for _, m := range ch.messages {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (f *FakeAPI) ChannelsGetMessages(_ context.Context, req *tg.ChannelsGetMessagesRequest) (tg.MessagesMessagesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in, ok := req.Channel.(*tg.InputChannel)
+	if !ok {
+		return nil, fmt.Errorf("fake: unsupported channel %T", req.Channel)
+	}
+	ch, err := f.channel(&tg.InputPeerChannel{ChannelID: in.ChannelID, AccessHash: in.AccessHash})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &tg.MessagesChannelMessages{}
+	for _, input := range req.ID {
+		id, ok := input.(*tg.InputMessageID)
+		if !ok {
+			return nil, fmt.Errorf("fake: unsupported message %T", input)
+		}
+		if msg := ch.find(id.ID); msg != nil {
+			resp.Messages = append(resp.Messages, msg)
+		} else {
+			resp.Messages = append(resp.Messages, &tg.MessageEmpty{ID: id.ID})
+		}
+	}
+	resp.Count = len(resp.Messages)
+	return resp, nil
+}
+
+func (f *FakeAPI) MessagesGetDialogs(context.Context, *tg.MessagesGetDialogsRequest) (tg.MessagesDialogsClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]int64, 0, len(f.channels))
+	for id := range f.channels {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	dialogs := &tg.MessagesDialogs{}
+	for _, id := range ids {
+		dialogs.Chats = append(dialogs.Chats, f.channels[id].channel)
+	}
+	return dialogs, nil
+}
+
+func (f *FakeAPI) MessagesGetHistory(_ context.Context, req *tg.MessagesGetHistoryRequest) (tg.MessagesMessagesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, err := f.channel(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	return ch.page(req.OffsetID, req.MinID, req.MaxID, req.Limit, ""), nil
+}
+
+func (f *FakeAPI) MessagesSearch(_ context.Context, req *tg.MessagesSearchRequest) (tg.MessagesMessagesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, err := f.channel(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	return ch.page(req.OffsetID, req.MinID, req.MaxID, req.Limit, req.Q), nil
+}
+
+// page returns messages newest first, like history and search
+func (ch *fakeChannel) page(offsetID, minID, maxID, limit int, query string) *tg.MessagesChannelMessages {
+	resp := &tg.MessagesChannelMessages{Chats: []tg.ChatClass{ch.channel}}
+	for i := len(ch.messages) - 1; i >= 0 && (limit <= 0 || len(resp.Messages) < limit); i-- {
+		m := ch.messages[i]
+		switch {
+		case offsetID > 0 && m.ID >= offsetID,
+			maxID > 0 && m.ID >= maxID,
+			m.ID <= minID,
+			query != "" && !strings.Contains(strings.ToLower(m.Message), strings.ToLower(query)):
+			continue
+		}
+		resp.Messages = append(resp.Messages, m)
+	}
+	resp.Count = len(resp.Messages)
+	return resp
+}
+
+func (f *FakeAPI) ChannelsReadHistory(_ context.Context, req *tg.ChannelsReadHistoryRequest) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in, ok := req.Channel.(*tg.InputChannel)
+	if !ok {
+		return false, fmt.Errorf("fake: unsupported channel %T", req.Channel)
+	}
+	ch, err := f.channel(&tg.InputPeerChannel{ChannelID: in.ChannelID, AccessHash: in.AccessHash})
+	if err != nil {
+		return false, err
+	}
+	ch.readID = max(ch.readID, min(req.MaxID, ch.lastID))
+	return true, nil
+}
+
+func (f *FakeAPI) ContactsResolveUsername(_ context.Context, req *tg.ContactsResolveUsernameRequest) (*tg.ContactsResolvedPeer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[req.Username]
+	if !ok {
+		return nil, tgerr.New(400, "USERNAME_NOT_OCCUPIED")
+	}
+	return &tg.ContactsResolvedPeer{Peer: &tg.PeerUser{UserID: user.ID}, Users: []tg.UserClass{user}}, nil
+}
+
+func (f *FakeAPI) ChannelsCreateChannel(_ context.Context, req *tg.ChannelsCreateChannelRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if req.Title == "" {
+		return nil, tgerr.New(400, "CHAT_TITLE_EMPTY")
+	}
+	id := 1000000 + f.newID()
+	channel := &tg.Channel{ID: id, AccessHash: id * 31, Title: req.Title, Broadcast: req.Broadcast, Creator: true}
+	f.channels[id] = &fakeChannel{channel: channel}
+	return &tg.Updates{Chats: []tg.ChatClass{channel}}, nil
+}
+
+func (f *FakeAPI) ChannelsEditAdmin(_ context.Context, req *tg.ChannelsEditAdminRequest) (tg.UpdatesClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in, ok := req.Channel.(*tg.InputChannel)
+	if !ok {
+		return nil, fmt.Errorf("fake: unsupported channel %T", req.Channel)
+	}
+	ch, err := f.channel(&tg.InputPeerChannel{ChannelID: in.ChannelID, AccessHash: in.AccessHash})
+	if err != nil {
+		return nil, err
+	}
+	user, ok := req.UserID.(*tg.InputUser)
+	if !ok {
+		return nil, tgerr.New(400, "USER_ID_INVALID")
+	}
+	if ch.admins == nil {
+		ch.admins = make(map[int64]tg.ChatAdminRights)
+	}
+	ch.admins[user.UserID] = req.AdminRights
+	return &tg.Updates{}, nil
+}
+
+func (f *FakeAPI) ChannelsDeleteMessages(_ context.Context, req *tg.ChannelsDeleteMessagesRequest) (*tg.MessagesAffectedMessages, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in, ok := req.Channel.(*tg.InputChannel)
+	if !ok {
+		return nil, fmt.Errorf("fake: unsupported channel %T", req.Channel)
+	}
+	ch, err := f.channel(&tg.InputPeerChannel{ChannelID: in.ChannelID, AccessHash: in.AccessHash})
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[int]bool, len(req.ID))
+	for _, id := range req.ID {
+		deleted[id] = true
+	}
+	kept := ch.messages[:0]
+	for _, m := range ch.messages {
+		if !deleted[m.ID] {
+			kept = append(kept, m)
+		}
+	}
+	ch.messages = kept
+	return &tg.MessagesAffectedMessages{}, nil
+}
+
+// AddAuthorization adds a session of the account, listed by
+// AccountGetAuthorizations
+func (f *FakeAPI) AddAuthorization(a tg.Authorization) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auths = append(f.auths, a)
+}
+
+func (f *FakeAPI) AccountGetAuthorizations(context.Context) (*tg.AccountAuthorizations, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &tg.AccountAuthorizations{Authorizations: append([]tg.Authorization(nil), f.auths...)}, nil
+}
+
+func (f *FakeAPI) AccountResetAuthorization(_ context.Context, hash int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, a := range f.auths {
+		if a.Hash == hash && !a.Current {
+			f.auths = append(f.auths[:i], f.auths[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, tgerr.New(400, "HASH_INVALID")
+}
@@ -0,0 +1,401 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	storageChat = int64(-1001234567890)
+	mirrorChat  = int64(-1009876543210)
+)
+
+func newFakeClient(t *testing.T) (*Client, *FakeAPI) {
+	t.Helper()
+	fake := NewFakeAPI()
+	fake.AddChannel(storageChat, "storage")
+	fake.AddChannel(mirrorChat, "mirror")
+	return NewWithAPI(context.Background(), &config.MtprotoConfig{}, fake), fake
+}
+
+func writeFile(t *testing.T, name string, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSendAlbumAndHistory(t *testing.T) {
+	c, fake := newFakeClient(t)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatalf("ResolvePeer: %v", err)
+	}
+
+	ids, err := c.SendMultiMedia(peer, []MediaItem{
+		{FilePath: writeFile(t, "part1.mp4", 1000), MediaType: "video", W: 640, H: 360},
+		{FilePath: writeFile(t, "part2.mp4", 2000), MediaType: "video", W: 640, H: 360, Caption: "#tag video"},
+	})
+	if err != nil {
+		t.Fatalf("SendMultiMedia: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("ids = %v, want [1 2]", ids)
+	}
+
+	msgs, err := c.GetHistory(storageChat, HistoryOptions{})
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].ID != 2 || msgs[0].GroupedID == 0 || msgs[0].GroupedID != msgs[1].GroupedID {
+		t.Fatalf("history is not the album, newest first: %+v", msgs)
+	}
+	if size := DocumentSize(msgs[0]); size != 2000 {
+		t.Fatalf("DocumentSize = %d, want 2000", size)
+	}
+
+	found, err := c.FindCaption(storageChat, "#tag video", 100)
+	if err != nil || len(found) != 1 || found[0].ID != 2 {
+		t.Fatalf("FindCaption = %v, %v", found, err)
+	}
+
+	copied, err := c.CopyMessages(storageChat, mirrorChat, ids)
+	if err != nil {
+		t.Fatalf("CopyMessages: %v", err)
+	}
+	mirrored := fake.Messages(mirrorChat)
+	if len(copied) != 2 || len(mirrored) != 2 || mirrored[1].Message != "#tag video" {
+		t.Fatalf("copies = %v, mirror = %+v", copied, mirrored)
+	}
+}
+
+func TestResolvePeerNotFound(t *testing.T) {
+	c, _ := newFakeClient(t)
+	if _, err := c.ResolvePeer(-1000000000001); !errors.Is(err, errs.ErrPeerNotFound) {
+		t.Fatalf("err = %v, want ErrPeerNotFound", err)
+	}
+}
+
+func TestGetAlbums(t *testing.T) {
+	c, _ := newFakeClient(t)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := func(name, caption string) MediaItem {
+		return MediaItem{FilePath: writeFile(t, name, 10), MediaType: "document", Caption: caption}
+	}
+	if _, err := c.SendMedia(peer, doc("a.txt", "#a first")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendMultiMedia(peer, []MediaItem{doc("p.jpg", ""), doc("1.mp4", ""), doc("2.mp4", "#b album")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendMedia(peer, doc("c.txt", "#c last")); err != nil {
+		t.Fatal(err)
+	}
+
+	albums, err := c.GetAlbums(storageChat, HistoryOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetAlbums: %v", err)
+	}
+	if len(albums) != 2 || albums[0].Caption() != "#c last" || albums[1].Caption() != "#b album" {
+		t.Fatalf("got %d albums: %+v", len(albums), albums)
+	}
+	if album := albums[1]; len(album.Messages) != 3 || album.ID() != 2 || album.GroupedID == 0 {
+		t.Fatalf("album = %+v, want messages 2-4", album)
+	}
+
+	rest, err := c.GetAlbums(storageChat, HistoryOptions{OffsetID: albums[1].ID()})
+	if err != nil || len(rest) != 1 || rest[0].Caption() != "#a first" {
+		t.Fatalf("next page = %+v, %v", rest, err)
+	}
+}
+
+func TestEditCaptionAndMedia(t *testing.T) {
+	c, fake := newFakeClient(t)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.SendMedia(peer, MediaItem{FilePath: writeFile(t, "a.bin", 10), MediaType: "document", Caption: "#old caption"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bold := []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 4}}
+	if err := c.EditCaption(storageChat, id, "#new caption", bold); err != nil {
+		t.Fatalf("EditCaption: %v", err)
+	}
+	if err := c.EditMedia(storageChat, id, MediaItem{FilePath: writeFile(t, "b.bin", 20), MediaType: "document"}, nil); err != nil {
+		t.Fatalf("EditMedia: %v", err)
+	}
+
+	msg := fake.Messages(storageChat)[0]
+	if msg.Message != "#new caption" || len(msg.Entities) != 1 {
+		t.Fatalf("caption = %q %v, want the edited one kept by EditMedia", msg.Message, msg.Entities)
+	}
+	if size := DocumentSize(msg); size != 20 {
+		t.Fatalf("DocumentSize = %d, want the replaced file", size)
+	}
+}
+
+func TestSendExistingByReference(t *testing.T) {
+	c, fake := newFakeClient(t)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, "part.mp4", 10)
+	if _, err := c.SendMedia(peer, MediaItem{FilePath: path, MediaType: "document"}); err != nil {
+		t.Fatal(err)
+	}
+	first := fake.Messages(storageChat)[0]
+
+	// An upload would get a document of its own
+	items := []MediaItem{
+		{FilePath: path, MediaType: "video", Existing: first},
+		{FilePath: writeFile(t, "new.mp4", 10), MediaType: "video"},
+	}
+	if _, err := c.SendMultiMedia(peer, items); err != nil {
+		t.Fatal(err)
+	}
+	msgs := fake.Messages(storageChat)
+	if len(msgs) != 3 {
+		t.Fatalf("%d messages, want 3", len(msgs))
+	}
+	doc := func(m *tg.Message) int64 { return m.Media.(*tg.MessageMediaDocument).Document.GetID() }
+	if doc(msgs[1]) != doc(first) || doc(msgs[2]) == doc(first) {
+		t.Errorf("documents %d and %d, want %d referred to and a new upload", doc(msgs[1]), doc(msgs[2]), doc(first))
+	}
+}
+
+func TestMarkRead(t *testing.T) {
+	c, fake := newFakeClient(t)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := c.SendMessage(peer, "#note"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.MarkRead(storageChat, 2); err != nil || fake.ReadMaxID(storageChat) != 2 {
+		t.Fatalf("MarkRead(2) = %v, read up to %d", err, fake.ReadMaxID(storageChat))
+	}
+	if err := c.MarkRead(storageChat, 0); err != nil || fake.ReadMaxID(storageChat) != 3 {
+		t.Fatalf("MarkRead(0) = %v, read up to %d, want the latest", err, fake.ReadMaxID(storageChat))
+	}
+}
+
+func TestSetReaction(t *testing.T) {
+	c, fake := newFakeClient(t)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.SendMessage(peer, "#note")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetReaction(storageChat, id, ReactionVerified); err != nil {
+		t.Fatalf("SetReaction: %v", err)
+	}
+	results := fake.Messages(storageChat)[0].Reactions.Results
+	if len(results) != 1 || results[0].Reaction.(*tg.ReactionEmoji).Emoticon != ReactionVerified {
+		t.Fatalf("reactions = %+v", results)
+	}
+	if err := c.SetReaction(storageChat, id, ""); err != nil || len(fake.Messages(storageChat)[0].Reactions.Results) != 0 {
+		t.Fatalf("removing the reaction: %v", err)
+	}
+}
+
+func TestWithSchedule(t *testing.T) {
+	c, fake := newFakeClient(t)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	ids, err := c.WithSchedule(at).SendMultiMedia(peer, []MediaItem{
+		{FilePath: writeFile(t, "1.bin", 10), MediaType: "document"},
+		{FilePath: writeFile(t, "2.bin", 10), MediaType: "document", Caption: "#later"},
+	})
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("scheduled SendMultiMedia = %v, %v", ids, err)
+	}
+	if _, err := c.SendMessage(peer, "#now"); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduled := fake.Scheduled(storageChat)
+	if len(scheduled) != 2 || scheduled[0].Date != int(at.Unix()) {
+		t.Fatalf("scheduled = %+v", scheduled)
+	}
+	if posted := fake.Messages(storageChat); len(posted) != 1 || posted[0].Message != "#now" {
+		t.Fatalf("posted = %+v, want only the unscheduled message", posted)
+	}
+}
+
+func TestShareMessagesWithTTL(t *testing.T) {
+	c, fake := newFakeClient(t)
+	storage, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	videoID, err := c.SendMedia(storage, MediaItem{FilePath: writeFile(t, "clip.mp4", 10), MediaType: "video", Caption: "#clip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docID, err := c.SendMedia(storage, MediaItem{FilePath: writeFile(t, "notes.txt", 10), MediaType: "document"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := c.ResolveRecipient(strconv.FormatInt(mirrorChat, 10))
+	if err != nil {
+		t.Fatalf("ResolveRecipient: %v", err)
+	}
+	if ids, err := c.ShareMessages(storageChat, []int{videoID}, to, 10); err != nil || len(ids) != 1 {
+		t.Fatalf("ShareMessages = %v, %v", ids, err)
+	}
+	shared := fake.Messages(mirrorChat)[0]
+	if ttl, _ := shared.Media.(*tg.MessageMediaDocument).GetTTLSeconds(); ttl != 10 || shared.Message != "" {
+		t.Fatalf("shared ttl = %d, caption %q", ttl, shared.Message)
+	}
+	if _, err := c.ShareMessages(storageChat, []int{docID}, to, 10); err == nil {
+		t.Fatal("a self-destructing document was sent")
+	}
+	if _, err := c.SendMedia(to, MediaItem{FilePath: writeFile(t, "a.txt", 1), MediaType: "document", TTL: 10}); err == nil {
+		t.Fatal("a self-destructing document was uploaded")
+	}
+}
+
+func TestCreateChannelWithBotAdmin(t *testing.T) {
+	c, fake := newFakeClient(t)
+	fake.AddUser(777, "storage_bot", true)
+
+	chatID, err := c.CreateChannel("My Storage", "")
+	if err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+	if _, err := c.ResolvePeer(chatID); err != nil {
+		t.Fatalf("new channel %d not found: %v", chatID, err)
+	}
+
+	bot, err := c.ResolveUsername("@storage_bot")
+	if err != nil {
+		t.Fatalf("ResolveUsername: %v", err)
+	}
+	if err := c.AddAdmin(chatID, bot, BotAdminRights, ""); err != nil {
+		t.Fatalf("AddAdmin: %v", err)
+	}
+	if rights, ok := fake.Admins(chatID)[777]; !ok || !rights.PostMessages {
+		t.Fatalf("admins = %+v", fake.Admins(chatID))
+	}
+	if _, err := c.ResolveUsername("@nobody"); !errors.Is(err, errs.ErrPeerNotFound) {
+		t.Fatalf("unknown username: %v", err)
+	}
+}
+
+func TestResumeBigUpload(t *testing.T) {
+	fake := NewFakeAPI()
+	fake.AddChannel(storageChat, "storage")
+	stateDir := t.TempDir()
+	c := NewWithAPI(context.Background(), &config.MtprotoConfig{UploadStateDir: stateDir}, fake)
+	peer, err := c.ResolvePeer(storageChat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = resumeMinSize + 3*config.MaxUploadPartSize/2 // 22 parts
+	item := MediaItem{FilePath: writeFile(t, "big.bin", size), MediaType: "document"}
+
+	fake.LimitBigParts(15)
+	if _, err := c.SendMedia(peer, item); err == nil {
+		t.Fatal("upload succeeded past the dropped connection")
+	}
+	if states, _ := filepath.Glob(filepath.Join(stateDir, "*.json")); len(states) != 1 {
+		t.Fatalf("upload states = %v", states)
+	}
+
+	fake.LimitBigParts(0)
+	id, err := c.SendMedia(peer, item)
+	if err != nil {
+		t.Fatalf("resumed SendMedia: %v", err)
+	}
+	if sent := fake.LimitBigParts(0); sent != 22 {
+		t.Fatalf("%d parts sent in total, want 22 with none sent twice", sent)
+	}
+	if msg := fake.Messages(storageChat)[0]; msg.ID != id || DocumentSize(msg) != size {
+		t.Fatalf("document size = %d, want %d", DocumentSize(msg), size)
+	}
+	if states, _ := filepath.Glob(filepath.Join(stateDir, "*.json")); len(states) != 0 {
+		t.Fatalf("upload state kept after success: %v", states)
+	}
+}
+
+// unsavedParts answers every big file part with false and no error
+type unsavedParts struct {
+	*FakeAPI
+	calls int
+}
+
+func (u *unsavedParts) UploadSaveBigFilePart(context.Context, *tg.UploadSaveBigFilePartRequest) (bool, error) {
+	u.calls++
+	return false, nil
+}
+
+func TestSaveBigPartGivesUp(t *testing.T) {
+	api := &unsavedParts{FakeAPI: NewFakeAPI()}
+	c := NewWithAPI(context.Background(), &config.MtprotoConfig{}, api)
+	if err := c.saveBigPart(context.Background(), 1, 0, 2, []byte("data")); err == nil {
+		t.Fatal("unsaved part reported as sent")
+	}
+	if api.calls != maxPartAttempts {
+		t.Fatalf("%d attempts, want %d", api.calls, maxPartAttempts)
+	}
+}
+
+func TestAuthorizations(t *testing.T) {
+	c, fake := newFakeClient(t)
+	fake.AddAuthorization(tg.Authorization{Hash: 1, DeviceModel: "phone", DateActive: 100})
+	fake.AddAuthorization(tg.Authorization{Hash: 2, DeviceModel: "nas", DateActive: 50, Current: true})
+	fake.AddAuthorization(tg.Authorization{Hash: 3, DeviceModel: "laptop", DateActive: 200})
+
+	list, err := c.Authorizations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []int64
+	for _, a := range list {
+		hashes = append(hashes, a.Hash)
+	}
+	if len(hashes) != 3 || hashes[0] != 2 || hashes[1] != 3 || hashes[2] != 1 {
+		t.Errorf("order = %v, want the current session, then the most recently active", hashes)
+	}
+
+	if err := c.TerminateAuthorization(2); err == nil {
+		t.Error("terminating the current session should fail")
+	}
+	if err := c.TerminateAuthorization(1); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := c.Authorizations(); len(list) != 2 {
+		t.Errorf("%d sessions left, want 2", len(list))
+	}
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/crypto"
+	"github.com/gotd/td/mtproxy"
+	"github.com/gotd/td/mtproxy/obfuscator"
+	"github.com/gotd/td/proto/codec"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/transport"
+)
+
+// connModeTimeout bounds one mode's TCP connects, so the next mode is
+// tried before gotd gives up on the dial
+const connModeTimeout = 10 * time.Second
+
+// connMode is one way of reaching a DC
+type connMode struct {
+	port       int // 0 keeps the port of the DC option
+	obfuscated bool
+}
+
+func (m connMode) String() string {
+	s := "the plain transport"
+	if m.obfuscated {
+		s = "the obfuscated transport"
+	}
+	if m.port != 0 {
+		s += fmt.Sprintf(" on port %d", m.port)
+	}
+	return s
+}
+
+// transportModes are the modes of each mtproto.transport setting, tried in
+// order. The obfuscated transport looks like random bytes to firewalls
+// that spot MTProto, and DCs also listen on ports 80 and 5222.
+var transportModes = map[string][]connMode{
+	"auto":       {{}, {obfuscated: true}, {port: 80, obfuscated: true}, {port: 5222, obfuscated: true}, {port: 80}, {port: 5222}},
+	"plain":      {{}},
+	"obfuscated": {{obfuscated: true}, {port: 80, obfuscated: true}, {port: 5222, obfuscated: true}},
+}
+
+// fallbackResolver connects to DCs in the current mode and moves on to the
+// next one when a connection fails before Telegram answered on it. With an
+// existing auth key gotd only opens the TCP connection while dialing, so a
+// firewall dropping MTProto shows up as a connection closed unanswered.
+type fallbackResolver struct {
+	dial  dcs.DialFunc
+	modes []connMode
+
+	mu      sync.Mutex
+	current int  // index in modes
+	noted   bool // the current mode was logged as working
+}
+
+func newFallbackResolver(dial dcs.DialFunc, modes []connMode) *fallbackResolver {
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	return &fallbackResolver{dial: dial, modes: modes}
+}
+
+func (r *fallbackResolver) Primary(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	return r.connect(ctx, dc, list.Test, dcs.FindPrimaryDCs(list.Options, dc, false))
+}
+
+func (r *fallbackResolver) MediaOnly(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	var media []tg.DCOption
+	for _, o := range dcs.FindDCs(list.Options, dc, false) {
+		if o.MediaOnly {
+			media = append(media, o)
+		}
+	}
+	// Media DCs are announced with a negative ID in the obfuscated header
+	return r.connect(ctx, -dc, list.Test, media)
+}
+
+func (r *fallbackResolver) CDN(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	return nil, fmt.Errorf("can't resolve %d: CDN is unsupported", dc)
+}
+
+// connect tries each mode once, starting with the current one
+func (r *fallbackResolver) connect(ctx context.Context, dc int, test bool, options []tg.DCOption) (transport.Conn, error) {
+	var candidates []tg.DCOption
+	for _, o := range options {
+		// Options needing a secret are skipped, as in the plain mode
+		if !o.TCPObfuscatedOnly {
+			candidates = append(candidates, o)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no addresses for DC %d", dc)
+	}
+
+	var lastErr error
+	for range r.modes {
+		i := r.mode()
+		conn, err := r.dialMode(ctx, r.modes[i], dc, test, candidates)
+		if err == nil {
+			return &fallbackConn{Conn: conn, resolver: r, mode: i}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+		r.failed(i, err)
+	}
+	return nil, lastErr
+}
+
+// dialMode connects to the first candidate reachable in mode m
+func (r *fallbackResolver) dialMode(ctx context.Context, m connMode, dc int, test bool, candidates []tg.DCOption) (transport.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, connModeTimeout)
+	defer cancel()
+
+	var lastErr error
+	for _, o := range candidates {
+		port := o.Port
+		if m.port != 0 {
+			port = m.port
+		}
+		conn, err := r.dial(ctx, "tcp", net.JoinHostPort(o.IPAddress, strconv.Itoa(port)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !m.obfuscated {
+			tc, err := transport.Intermediate.Handshake(conn)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tc, nil
+		}
+
+		// Test DCs are told apart by 10000 added to the ID
+		id := dc
+		if test {
+			if id < 0 {
+				id -= 10000
+			} else {
+				id += 10000
+			}
+		}
+		obfs := obfuscator.Obfuscated2(crypto.DefaultRand(), conn)
+		if err := obfs.Handshake(codec.IntermediateClientStart, id, mtproxy.Secret{}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		proto := transport.NewProtocol(func() transport.Codec {
+			return codec.NoHeader{Codec: codec.Intermediate{}}
+		})
+		tc, err := proto.Handshake(obfs)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+	return nil, lastErr
+}
+
+func (r *fallbackResolver) mode() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// failed moves on from mode i, unless another connection already did
+func (r *fallbackResolver) failed(i int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != i || len(r.modes) == 1 {
+		return
+	}
+	r.current = (i + 1) % len(r.modes)
+	r.noted = false
+	log.Warn.Printf("Telegram didn't answer over %s (%v), trying %s", r.modes[i], err, r.modes[r.current])
+}
+
+// answered notes that mode i works
+func (r *fallbackResolver) answered(i int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == i && !r.noted {
+		r.noted = true
+		if i != 0 {
+			log.Info.Printf("Connected to Telegram over %s", r.modes[i])
+		}
+	}
+}
+
+// fallbackConn reports to its resolver whether Telegram ever answered on it
+type fallbackConn struct {
+	transport.Conn
+	resolver *fallbackResolver
+	mode     int
+	answered atomic.Bool
+	closed   sync.Once
+}
+
+func (c *fallbackConn) Recv(ctx context.Context, b *bin.Buffer) error {
+	err := c.Conn.Recv(ctx, b)
+	if err == nil && !c.answered.Swap(true) {
+		c.resolver.answered(c.mode)
+	}
+	return err
+}
+
+func (c *fallbackConn) Close() error {
+	c.closed.Do(func() {
+		if !c.answered.Load() {
+			c.resolver.failed(c.mode, fmt.Errorf("connection closed without an answer"))
+		}
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/telegram/dcs"
+)
+
+func TestFallbackResolver(t *testing.T) {
+	var dialed []string
+	headers := make(chan int, 1)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if strings.HasSuffix(addr, ":443") {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		go func() {
+			n, _ := io.ReadFull(server, make([]byte, 64))
+			headers <- n
+			server.Close()
+		}()
+		return client, nil
+	}
+
+	r := newFallbackResolver(dial, transportModes["auto"])
+	conn, err := r.Primary(context.Background(), 2, dcs.Prod())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.mode() != 2 || !strings.HasSuffix(dialed[len(dialed)-1], ":80") {
+		t.Fatalf("connected over %s to %v, want the obfuscated transport on port 80", r.modes[r.mode()], dialed)
+	}
+	if n := <-headers; n != 64 {
+		t.Errorf("sent a %d byte header, want the 64 byte obfuscated one", n)
+	}
+
+	// A connection closed before Telegram answered moves on to the next mode
+	conn.Close()
+	if r.mode() != 3 {
+		t.Errorf("after an unanswered connection the mode is %s, want port 5222", r.modes[r.mode()])
+	}
+
+	plain := newFallbackResolver(dial, transportModes["plain"])
+	if _, err := plain.Primary(context.Background(), 2, dcs.Prod()); err == nil {
+		t.Error("transport plain fell back to another port")
+	}
+}
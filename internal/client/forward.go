@@ -15,8 +15,8 @@ func (c *Client) ForwardMedia(updates tg.UpdatesClass) error {
 	// }
 	// for _, media := range sentMedias {
 	// 	if media.Photo != nil {
-	// 		logger.Debug.Println("forwarding photo: ", media.Photo)
-	// 		_, err = c.client.API().MessagesSendMedia(c.ctx, &tg.MessagesSendMediaRequest{
+	// 		log.Debug.Println("forwarding photo: ", media.Photo)
+	// 		_, err = c.api.MessagesSendMedia(c.ctx, &tg.MessagesSendMediaRequest{
 	// 			Peer:     targetPeer,
 	// 			RandomID: randID(),
 	// 			Media: &tg.InputMediaPhoto{
@@ -31,9 +31,9 @@ func (c *Client) ForwardMedia(updates tg.UpdatesClass) error {
 	// 			return err
 	// 		}
 	// 	} else if media.Document != nil {
-	// 		logger.Debug.Println("forwarding document: ", media.Document)
+	// 		log.Debug.Println("forwarding document: ", media.Document)
 
-	// 		_, err = c.client.API().MessagesSendMedia(c.ctx, &tg.MessagesSendMediaRequest{
+	// 		_, err = c.api.MessagesSendMedia(c.ctx, &tg.MessagesSendMediaRequest{
 	// 			Peer:     targetPeer,
 	// 			RandomID: randID(),
 	// 			Media: &tg.InputMediaDocument{
@@ -48,7 +48,7 @@ func (c *Client) ForwardMedia(updates tg.UpdatesClass) error {
 	// 			return err
 	// 		}
 	// 	} else {
-	// 		logger.Debug.Println("unknown media type: ", media)
+	// 		log.Debug.Println("unknown media type: ", media)
 	// 	}
 	// }
 
@@ -101,6 +101,10 @@ func extractSentMedias(updates tg.UpdatesClass) []MediaHandle {
 				if msg, ok := x.Message.(*tg.Message); ok {
 					handleMsg(msg)
 				}
+			case *tg.UpdateNewScheduledMessage:
+				if msg, ok := x.Message.(*tg.Message); ok {
+					handleMsg(msg)
+				}
 			}
 		}
 
@@ -115,6 +119,10 @@ func extractSentMedias(updates tg.UpdatesClass) []MediaHandle {
 				if msg, ok := x.Message.(*tg.Message); ok {
 					handleMsg(msg)
 				}
+			case *tg.UpdateNewScheduledMessage:
+				if msg, ok := x.Message.(*tg.Message); ok {
+					handleMsg(msg)
+				}
 			}
 		}
 	}
@@ -3,12 +3,13 @@ package client
 import (
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"mime"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
-	"tg-storage-assistant/internal/logger"
 	"tg-storage-assistant/internal/util"
 
 	"github.com/gotd/td/tg"
@@ -16,29 +17,42 @@ import (
 
 type MediaItem struct {
 	FilePath  string
-	MediaType string // "photo" or "video"
+	MediaType string // "photo", "video", "document", "audio", "voice" or "video_note"
 	Caption   string
 	W         int
 	H         int
+	Duration  float64 // seconds, for audio, voice and video notes
+	TTL       int     // seconds a photo or video lives once opened, private chats only
+	Title     string  // shown by Telegram's player for audio
+	Performer string
+	Thumb     string // JPEG of at most 320x320 shown for audio
+	// A message holding the same file as FilePath, whose photo or document
+	// is sent again by reference instead of uploading FilePath
+	Existing *tg.Message
 }
 
-func (c *Client) SendMultiMedia(peer tg.InputPeerClass, items []MediaItem) error {
+// SendMultiMedia uploads the items as a single album and returns the IDs of
+// the sent messages in album order
+func (c *Client) SendMultiMedia(peer tg.InputPeerClass, items []MediaItem) ([]int, error) {
 	for i, item := range items {
 		fileInfo, err := os.Stat(item.FilePath)
 		if err != nil {
-			return fmt.Errorf("failed to get file info: %w", err)
+			return nil, fmt.Errorf("failed to get file info: %w", err)
 		}
-		logger.Debug.Printf("┃ #%d (%s - %-9s)[%s] %s\n",
+		log.Debug.Printf("┃ #%d (%s - %-9s)[%s] %s\n",
 			i+1,
 			item.MediaType, util.FormatBytesToHumanReadable(fileInfo.Size()),
 			util.SafeBase(item.FilePath), item.Caption)
 	}
 
+	c.uploadMu.Lock()
+	defer c.uploadMu.Unlock()
+
 	c.InitUploader()
 	album := make([]tg.InputSingleMedia, len(items))
 
 	wg := sync.WaitGroup{}
-	errs := make(chan error, len(items))
+	failures := make(chan error, len(items))
 
 	for i, item := range items {
 		wg.Add(1)
@@ -46,7 +60,7 @@ func (c *Client) SendMultiMedia(peer tg.InputPeerClass, items []MediaItem) error
 			defer wg.Done()
 			media, err := c.uploadMedia(item)
 			if err != nil {
-				errs <- err
+				failures <- err
 				return
 			}
 			album[i] = *media
@@ -55,70 +69,183 @@ func (c *Client) SendMultiMedia(peer tg.InputPeerClass, items []MediaItem) error
 
 	wg.Wait()
 	c.CloseUploader()
-	close(errs)
-	if len(errs) > 0 {
-		return fmt.Errorf("failed to upload media: %v", errs)
+	close(failures)
+	var uploadErrs []error
+	for err := range failures {
+		uploadErrs = append(uploadErrs, err)
+	}
+	if err := errors.Join(uploadErrs...); err != nil {
+		return nil, fmt.Errorf("failed to upload media: %w", Classify(err))
+	}
+	log.Debug.Println("All media uploaded successfully")
+
+	updates, err := c.api.MessagesSendMultiMedia(c.ctx, &tg.MessagesSendMultiMediaRequest{
+		Peer:         peer,
+		MultiMedia:   album,
+		ScheduleDate: c.scheduleDate,
+	})
+	if err != nil {
+		return nil, Classify(err)
+	}
+
+	sent := extractSentMedias(updates)
+	ids := make([]int, 0, len(sent))
+	for _, m := range sent {
+		ids = append(ids, m.MsgID)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// SendMedia uploads a single item as its own message and returns its ID
+func (c *Client) SendMedia(peer tg.InputPeerClass, item MediaItem) (int, error) {
+	media, err := c.uploadSingle(item)
+	if err != nil {
+		return 0, Classify(err)
 	}
-	logger.Debug.Println("All media uploaded successfully")
 
-	_, err := c.client.API().MessagesSendMultiMedia(c.ctx, &tg.MessagesSendMultiMediaRequest{
-		Peer:       peer,
-		MultiMedia: album,
+	return c.sendSingle(peer, media, util.SafeBase(item.FilePath))
+}
+
+// sendSingle sends uploaded media as its own message and returns its ID
+func (c *Client) sendSingle(peer tg.InputPeerClass, media *tg.InputSingleMedia, name string) (int, error) {
+	updates, err := c.api.MessagesSendMedia(c.ctx, &tg.MessagesSendMediaRequest{
+		Peer:         peer,
+		Media:        media.Media,
+		Message:      media.Message,
+		RandomID:     randID(),
+		ScheduleDate: c.scheduleDate,
+	})
+	if err != nil {
+		return 0, Classify(err)
+	}
+
+	sent := extractSentMedias(updates)
+	if len(sent) == 0 {
+		return 0, fmt.Errorf("no message returned for %s", name)
+	}
+	return sent[0].MsgID, nil
+}
+
+// uploadSingle uploads one item while holding the upload lock
+func (c *Client) uploadSingle(item MediaItem) (*tg.InputSingleMedia, error) {
+	c.uploadMu.Lock()
+	defer c.uploadMu.Unlock()
+
+	c.InitUploader()
+	defer c.CloseUploader()
+	return c.uploadMedia(item)
+}
+
+// SendMessage sends a plain text message and returns its ID
+func (c *Client) SendMessage(peer tg.InputPeerClass, text string) (int, error) {
+	updates, err := c.api.MessagesSendMessage(c.ctx, &tg.MessagesSendMessageRequest{
+		Peer:         peer,
+		RandomID:     randID(),
+		Message:      text,
+		ScheduleDate: c.scheduleDate,
 	})
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("send message failed: %w", err)
 	}
-	return nil
+
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return u.ID, nil
+	case *tg.Updates:
+		for _, upd := range u.Updates {
+			if id, ok := upd.(*tg.UpdateMessageID); ok {
+				return id.ID, nil
+			}
+		}
+	}
+	return 0, nil
 }
 
 func (c *Client) uploadMedia(media MediaItem) (*tg.InputSingleMedia, error) {
-	inputFile, err := c.uploader.FromPath(c.ctx, media.FilePath)
+	if media.TTL > 0 && media.MediaType != "photo" && media.MediaType != "video" {
+		return nil, fmt.Errorf("only photos and videos can self-destruct, not %s", media.MediaType)
+	}
+	single, err := c.buildMedia(media)
+	if err != nil || media.TTL <= 0 {
+		return single, err
+	}
+	switch m := single.Media.(type) {
+	case *tg.InputMediaPhoto:
+		m.SetTTLSeconds(media.TTL)
+	case *tg.InputMediaDocument:
+		m.SetTTLSeconds(media.TTL)
+	}
+	return single, nil
+}
+
+// buildMedia uploads the file of media and refers to it for sending
+func (c *Client) buildMedia(media MediaItem) (*tg.InputSingleMedia, error) {
+	if media.Existing != nil {
+		ref, err := shareMedia(media.Existing, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &tg.InputSingleMedia{Media: ref, RandomID: randID(), Message: media.Caption}, nil
+	}
+	inputFile, resume, err := c.uploadFile(media.FilePath)
 	if err != nil {
 		return nil, fmt.Errorf("upload %q: %w", media.FilePath, err)
 	}
+	single, err := c.uploadedMedia(inputFile, media)
+	resume.finish(err)
+	return single, err
+}
 
+// uploadedMedia turns an uploaded file into media of the item's type
+func (c *Client) uploadedMedia(inputFile tg.InputFileClass, media MediaItem) (*tg.InputSingleMedia, error) {
 	switch media.MediaType {
 	case "photo":
-		photo := c.buildPhotoMedia(inputFile, media.Caption)
-		return &photo, nil
+		return c.buildPhotoMedia(inputFile, media.Caption)
 	case "video":
-		video := c.buildVideoMedia(inputFile, media.W, media.H, media.Caption)
-		return &video, nil
+		return c.buildVideoMedia(inputFile, media.W, media.H, media.Caption)
+	case "document":
+		return c.buildDocumentMedia(inputFile, media.Caption)
+	case "audio":
+		return c.buildAudioMedia(inputFile, media)
+	case "voice":
+		return c.buildVoiceMedia(inputFile, media.Duration, media.Caption)
+	case "video_note":
+		return c.buildVideoNoteMedia(inputFile, media.W, media.Duration, media.Caption)
 	}
 
 	return nil, fmt.Errorf("invalid media type: %s", media.MediaType)
 }
 
-func (c *Client) buildPhotoMedia(input tg.InputFileClass, caption string) tg.InputSingleMedia {
-	media, err := c.client.API().MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
+func (c *Client) buildPhotoMedia(input tg.InputFileClass, caption string) (*tg.InputSingleMedia, error) {
+	media, err := c.api.MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
 		Peer:  &tg.InputPeerSelf{},
 		Media: &tg.InputMediaUploadedPhoto{File: input},
 	})
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("upload photo failed: %w", err)
+	}
+	mediaPhoto, ok := media.(*tg.MessageMediaPhoto)
+	if !ok {
+		return nil, fmt.Errorf("unexpected upload result: %T", media)
 	}
-	return tg.InputSingleMedia{
+	photo, ok := mediaPhoto.Photo.(*tg.Photo)
+	if !ok {
+		return nil, fmt.Errorf("unexpected photo: %T", mediaPhoto.Photo)
+	}
+	return &tg.InputSingleMedia{
 		Media: &tg.InputMediaPhoto{ID: &tg.InputPhoto{
-			ID:            media.(*tg.MessageMediaPhoto).Photo.(*tg.Photo).GetID(),
-			AccessHash:    media.(*tg.MessageMediaPhoto).Photo.(*tg.Photo).GetAccessHash(),
-			FileReference: media.(*tg.MessageMediaPhoto).Photo.(*tg.Photo).GetFileReference(),
+			ID:            photo.GetID(),
+			AccessHash:    photo.GetAccessHash(),
+			FileReference: photo.GetFileReference(),
 		}},
 		RandomID: randID(),
 		Message:  caption,
-	}
+	}, nil
 }
 
-func (c *Client) buildVideoMedia(inputFile tg.InputFileClass, width, height int, caption string) tg.InputSingleMedia {
-	fileName := func() string {
-		switch v := inputFile.(type) {
-		case *tg.InputFile:
-			return filepath.Base(v.Name)
-		case *tg.InputFileBig:
-			return filepath.Base(v.Name)
-		default:
-			return "Unknown"
-		}
-	}()
+func (c *Client) buildVideoMedia(inputFile tg.InputFileClass, width, height int, caption string) (*tg.InputSingleMedia, error) {
+	fileName := inputFileName(inputFile)
 
 	attrs := []tg.DocumentAttributeClass{
 		&tg.DocumentAttributeVideo{
@@ -128,7 +255,7 @@ func (c *Client) buildVideoMedia(inputFile tg.InputFileClass, width, height int,
 		},
 		&tg.DocumentAttributeFilename{FileName: fileName},
 	}
-	media, err := c.client.API().MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
+	media, err := c.api.MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
 		Peer: &tg.InputPeerSelf{},
 		Media: &tg.InputMediaUploadedDocument{
 			File:       inputFile,
@@ -137,18 +264,124 @@ func (c *Client) buildVideoMedia(inputFile tg.InputFileClass, width, height int,
 		},
 	})
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("upload video failed: %w", err)
 	}
-	return tg.InputSingleMedia{
+	return inputDocumentMedia(media, caption)
+}
+
+func (c *Client) buildDocumentMedia(inputFile tg.InputFileClass, caption string) (*tg.InputSingleMedia, error) {
+	fileName := inputFileName(inputFile)
+	media, err := c.api.MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
+		Peer: &tg.InputPeerSelf{},
+		Media: &tg.InputMediaUploadedDocument{
+			File:       inputFile,
+			ForceFile:  true,
+			MimeType:   guessMIME(fileName),
+			Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: fileName}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload document failed: %w", err)
+	}
+	return inputDocumentMedia(media, caption)
+}
+
+// buildAudioMedia sends a music file for Telegram's player, with its title,
+// performer and cover
+func (c *Client) buildAudioMedia(inputFile tg.InputFileClass, media MediaItem) (*tg.InputSingleMedia, error) {
+	fileName := inputFileName(inputFile)
+	doc := &tg.InputMediaUploadedDocument{
+		File:     inputFile,
+		MimeType: guessMIME(fileName),
+		Attributes: []tg.DocumentAttributeClass{
+			&tg.DocumentAttributeAudio{Duration: int(media.Duration), Title: media.Title, Performer: media.Performer},
+			&tg.DocumentAttributeFilename{FileName: fileName},
+		},
+	}
+	if media.Thumb != "" {
+		thumb, err := c.uploader.FromPath(c.ctx, media.Thumb)
+		if err != nil {
+			return nil, fmt.Errorf("upload thumbnail failed: %w", err)
+		}
+		doc.SetThumb(thumb)
+	}
+	uploaded, err := c.api.MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
+		Peer:  &tg.InputPeerSelf{},
+		Media: doc,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload audio failed: %w", err)
+	}
+	return inputDocumentMedia(uploaded, media.Caption)
+}
+
+// buildVoiceMedia sends an OGG/Opus file as a voice message
+func (c *Client) buildVoiceMedia(inputFile tg.InputFileClass, duration float64, caption string) (*tg.InputSingleMedia, error) {
+	media, err := c.api.MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
+		Peer: &tg.InputPeerSelf{},
+		Media: &tg.InputMediaUploadedDocument{
+			File:     inputFile,
+			MimeType: "audio/ogg",
+			Attributes: []tg.DocumentAttributeClass{
+				&tg.DocumentAttributeAudio{Voice: true, Duration: int(duration)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload voice failed: %w", err)
+	}
+	return inputDocumentMedia(media, caption)
+}
+
+// buildVideoNoteMedia sends a square MP4 as a round video message
+func (c *Client) buildVideoNoteMedia(inputFile tg.InputFileClass, size int, duration float64, caption string) (*tg.InputSingleMedia, error) {
+	media, err := c.api.MessagesUploadMedia(c.ctx, &tg.MessagesUploadMediaRequest{
+		Peer: &tg.InputPeerSelf{},
+		Media: &tg.InputMediaUploadedDocument{
+			File:     inputFile,
+			MimeType: "video/mp4",
+			Attributes: []tg.DocumentAttributeClass{
+				&tg.DocumentAttributeVideo{RoundMessage: true, W: size, H: size, Duration: duration},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload video note failed: %w", err)
+	}
+	return inputDocumentMedia(media, caption)
+}
+
+// inputDocumentMedia turns an uploaded document into an album item
+func inputDocumentMedia(media tg.MessageMediaClass, caption string) (*tg.InputSingleMedia, error) {
+	mediaDoc, ok := media.(*tg.MessageMediaDocument)
+	if !ok {
+		return nil, fmt.Errorf("unexpected upload result: %T", media)
+	}
+	doc, ok := mediaDoc.Document.(*tg.Document)
+	if !ok {
+		return nil, fmt.Errorf("unexpected document: %T", mediaDoc.Document)
+	}
+	return &tg.InputSingleMedia{
 		Media: &tg.InputMediaDocument{
 			ID: &tg.InputDocument{
-				ID:            media.(*tg.MessageMediaDocument).Document.(*tg.Document).GetID(),
-				AccessHash:    media.(*tg.MessageMediaDocument).Document.(*tg.Document).GetAccessHash(),
-				FileReference: media.(*tg.MessageMediaDocument).Document.(*tg.Document).GetFileReference(),
+				ID:            doc.GetID(),
+				AccessHash:    doc.GetAccessHash(),
+				FileReference: doc.GetFileReference(),
 			},
 		},
 		RandomID: randID(),
 		Message:  caption,
+	}, nil
+}
+
+func inputFileName(inputFile tg.InputFileClass) string {
+	switch v := inputFile.(type) {
+	case *tg.InputFile:
+		return filepath.Base(v.Name)
+	case *tg.InputFileBig:
+		return filepath.Base(v.Name)
+	default:
+		return "Unknown"
 	}
 }
 
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// DownloadChunkSize is the size of the pieces DownloadChunk fetches, the
+// most upload.getFile returns at once
+const DownloadChunkSize = 1 << 20
+
+// MediaSize returns the size in bytes of the document of msg, 0 for photos
+// and messages without media
+func MediaSize(msg *tg.Message) int64 {
+	if media, ok := msg.Media.(*tg.MessageMediaDocument); ok {
+		if doc, ok := media.Document.(*tg.Document); ok {
+			return doc.Size
+		}
+	}
+	return 0
+}
+
+// DownloadChunk returns chunk n of the media of msg: DownloadChunkSize
+// bytes from n*DownloadChunkSize, fewer at the end of the file
+func (c *Client) DownloadChunk(msg *tg.Message, n int64) ([]byte, error) {
+	loc, _, err := mediaLocation(msg)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		resp, err := c.api.UploadGetFile(c.ctx, &tg.UploadGetFileRequest{
+			Location: loc,
+			Offset:   n * DownloadChunkSize,
+			Limit:    DownloadChunkSize,
+		})
+		if flood, err := tgerr.FloodWait(c.ctx, err); err != nil {
+			if flood {
+				continue
+			}
+			return nil, fmt.Errorf("download chunk %d of message %d failed: %w", n, msg.ID, err)
+		}
+		switch f := resp.(type) {
+		case *tg.UploadFile:
+			return f.Bytes, nil
+		default:
+			return nil, fmt.Errorf("message %d is served by a CDN, which ranged downloads don't support", msg.ID)
+		}
+	}
+}
+
+// DownloadRange writes length bytes of the media of msg from offset to w,
+// fetching only the chunks holding them. A negative length reads to the
+// end of the file.
+func (c *Client) DownloadRange(msg *tg.Message, offset, length int64, w io.Writer) error {
+	for length != 0 {
+		n, skip := offset/DownloadChunkSize, offset%DownloadChunkSize
+		chunk, err := c.DownloadChunk(msg, n)
+		if err != nil {
+			return err
+		}
+		if int64(len(chunk)) <= skip {
+			break
+		}
+		data := chunk[skip:]
+		if length > 0 && int64(len(data)) > length {
+			data = data[:length]
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		offset += int64(len(data))
+		if length > 0 {
+			length -= int64(len(data))
+		}
+		if len(chunk) < DownloadChunkSize {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/gotd/td/tg"
+)
+
+// Status reactions put on uploads, see pipeline.MarkStatus
+const (
+	ReactionVerified  = "✅"
+	ReactionCorrupted = "⚠️"
+)
+
+// SetReaction replaces the account's reaction to a message with emoji, or
+// removes it when emoji is empty. The chat must allow the emoji.
+func (c *Client) SetReaction(chatID int64, msgID int, emoji string) error {
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+
+	req := &tg.MessagesSendReactionRequest{Peer: peer, MsgID: msgID}
+	if emoji != "" {
+		req.SetReaction([]tg.ReactionClass{&tg.ReactionEmoji{Emoticon: emoji}})
+	}
+	if _, err := c.api.MessagesSendReaction(c.ctx, req); err != nil {
+		return fmt.Errorf("set reaction on message %d failed: %w", msgID, err)
+	}
+	return nil
+}
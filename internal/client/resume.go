@@ -0,0 +1,313 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/util"
+	"time"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// resumeMinSize is the size from which files are uploaded as big files.
+// Telegram keeps their parts under the file ID, so an interrupted upload can
+// send only the missing ones.
+const resumeMinSize = 10 * 1024 * 1024
+
+// resumeMaxAge is how long sent parts are trusted to still be on the server
+const resumeMaxAge = 24 * time.Hour
+
+// resumeSaveInterval throttles writing the state while parts are confirmed
+const resumeSaveInterval = time.Second
+
+// fingerprintSample is read from both ends of a file to recognize it again,
+// whatever directory a new run splits it into
+const fingerprintSample = 1 << 20
+
+// uploadState is what is persisted about one big upload
+type uploadState struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	FileID   int64     `json:"file_id"`
+	PartSize int       `json:"part_size"`
+	Parts    []int     `json:"parts"` // confirmed by the server
+	Started  time.Time `json:"started"`
+}
+
+// resumable is a big upload whose progress is saved in upload_state_dir
+type resumable struct {
+	path      string // the file being uploaded
+	statePath string
+	total     int // parts
+
+	mu       sync.Mutex
+	state    uploadState
+	done     map[int]bool
+	uploaded int64
+	saved    time.Time
+}
+
+// partSize is the configured upload part size
+func (c *Client) partSize() int {
+	if c.cfg.UploadPartSizeBytes == 0 {
+		return config.MaxUploadPartSize
+	}
+	return c.cfg.UploadPartSizeBytes
+}
+
+// uploadFile uploads path. Big files are resumable when upload_state_dir is
+// set: parts sent by an earlier, interrupted run are not sent again. The
+// returned resumable is nil otherwise.
+func (c *Client) uploadFile(path string) (tg.InputFileClass, *resumable, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.cfg.UploadStateDir == "" || info.Size() < resumeMinSize {
+		file, err := c.uploader.FromPath(c.ctx, path)
+		return file, nil, err
+	}
+
+	r, err := openResumable(c.cfg.UploadStateDir, path, info.Size(), c.partSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := c.uploadResumable(r)
+	return file, r, err
+}
+
+// openResumable loads the saved state of path, or starts a new one
+func openResumable(dir, path string, size int64, partSize int) (*resumable, error) {
+	key, err := fingerprint(path, size)
+	if err != nil {
+		return nil, err
+	}
+	r := &resumable{
+		path:      path,
+		statePath: filepath.Join(dir, key+".json"),
+		total:     int((size + int64(partSize) - 1) / int64(partSize)),
+		done:      make(map[int]bool),
+	}
+
+	raw, err := os.ReadFile(r.statePath)
+	if err == nil && json.Unmarshal(raw, &r.state) == nil &&
+		r.state.PartSize == partSize && r.state.Size == size && time.Since(r.state.Started) < resumeMaxAge {
+		for _, p := range r.state.Parts {
+			r.done[p] = true
+			r.uploaded += partBytes(p, partSize, size)
+		}
+		return r, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read upload state failed: %w", err)
+	}
+
+	r.state = uploadState{
+		Name:     filepath.Base(path),
+		Size:     size,
+		FileID:   randID(),
+		PartSize: partSize,
+		Started:  time.Now(),
+	}
+	return r, nil
+}
+
+// fingerprint identifies the content of a file by its size and both ends
+func fingerprint(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", size)
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, fingerprintSample)); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(f, max(size-fingerprintSample, 0), fingerprintSample)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
+
+// partBytes is the length of part p of a file of size bytes
+func partBytes(p, partSize int, size int64) int64 {
+	return min(int64(partSize), size-int64(p)*int64(partSize))
+}
+
+// uploadResumable sends the parts of r that the server does not have yet
+func (c *Client) uploadResumable(r *resumable) (tg.InputFileClass, error) {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if n := len(r.done); n > 0 {
+		log.Info.Printf("Resuming upload of %s: %d of %d parts already sent", r.state.Name, n, r.total)
+	}
+
+	var missing []int
+	for p := range r.total {
+		if !r.done[p] {
+			missing = append(missing, p)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	todo := make(chan int)
+	go func() {
+		defer close(todo)
+		for _, p := range missing {
+			select {
+			case todo <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	threads := max(c.cfg.UploadThreads, 1)
+	failures := make(chan error, threads)
+	var wg sync.WaitGroup
+	for range threads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, r.state.PartSize)
+			for p := range todo {
+				if err := c.sendPart(ctx, f, r, p, buf); err != nil {
+					failures <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(failures)
+
+	saveErr := r.save()
+	if err := <-failures; err != nil {
+		return nil, fmt.Errorf("upload %q: %w", r.path, err)
+	}
+	if saveErr != nil {
+		log.Warn.Printf("Failed to save the upload state of %s: %v", r.state.Name, saveErr)
+	}
+	return &tg.InputFileBig{ID: r.state.FileID, Parts: r.total, Name: r.state.Name}, nil
+}
+
+// sendPart reads part p of f into buf and sends it, retrying flood waits
+func (c *Client) sendPart(ctx context.Context, f *os.File, r *resumable, p int, buf []byte) error {
+	n, err := f.ReadAt(buf, int64(p)*int64(r.state.PartSize))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read part %d: %w", p, err)
+	}
+	if err := c.saveBigPart(ctx, r.state.FileID, p, r.total, buf[:n]); err != nil {
+		return err
+	}
+
+	uploaded := r.confirm(p, n)
+	if c.uploadProgress != nil {
+		return c.uploadProgress.Chunk(ctx, uploader.ProgressState{
+			ID:       r.state.FileID,
+			Name:     r.state.Name,
+			Part:     p,
+			PartSize: r.state.PartSize,
+			Uploaded: uploaded,
+			Total:    r.state.Size,
+		})
+	}
+	return nil
+}
+
+// maxPartAttempts bounds the tries of a part Telegram didn't save without
+// saying why
+const maxPartAttempts = 5
+
+// saveBigPart sends part p of a big file of total parts, retrying flood
+// waits and parts that weren't saved
+func (c *Client) saveBigPart(ctx context.Context, fileID int64, p, total int, data []byte) error {
+	for attempt := 1; ; attempt++ {
+		ok, err := c.api.UploadSaveBigFilePart(ctx, &tg.UploadSaveBigFilePartRequest{
+			FileID:         fileID,
+			FilePart:       p,
+			FileTotalParts: total,
+			Bytes:          data,
+		})
+		if flood, err := tgerr.FloodWait(ctx, err); err != nil {
+			if flood {
+				continue
+			}
+			return fmt.Errorf("send part %d: %w", p, err)
+		}
+		if ok {
+			return nil
+		}
+		if attempt >= maxPartAttempts {
+			return fmt.Errorf("send part %d: not saved after %d attempts", p, attempt)
+		}
+	}
+}
+
+// confirm records a sent part, saving the state now and then, and returns
+// the bytes uploaded so far
+func (r *resumable) confirm(p, n int) int64 {
+	r.mu.Lock()
+	r.done[p] = true
+	r.state.Parts = append(r.state.Parts, p)
+	r.uploaded += int64(n)
+	uploaded, due := r.uploaded, time.Since(r.saved) >= resumeSaveInterval
+	r.mu.Unlock()
+
+	if due {
+		if err := r.save(); err != nil {
+			log.Warn.Printf("Failed to save the upload state of %s: %v", r.state.Name, err)
+		}
+	}
+	return uploaded
+}
+
+// save writes the state atomically (temp file + rename)
+func (r *resumable) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = time.Now()
+
+	raw, err := json.Marshal(r.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.statePath), 0o755); err != nil {
+		return err
+	}
+	tmp := r.statePath + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return util.ReplaceFile(tmp, r.statePath)
+}
+
+// finish forgets the state once the upload was used, or once the server
+// lost the parts (err is FILE_PART_X_MISSING) so the next run starts over
+func (r *resumable) finish(err error) {
+	if r == nil || (err != nil && !tgerr.Is(err, "FILE_PART_MISSING", "FILE_PARTS_INVALID")) {
+		return
+	}
+	if err := os.Remove(r.statePath); err != nil && !os.IsNotExist(err) {
+		log.Warn.Printf("Failed to remove the upload state of %s: %v", r.state.Name, err)
+	}
+}
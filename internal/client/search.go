@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// searchPageSize is the most messages.search returns per call
+const searchPageSize = 100
+
+// FindCaption returns the messages in chatID whose caption is exactly
+// caption, newest first. Telegram is searched for the caption's first word
+// (the #tag hashtag), looking at no more than limit results.
+func (c *Client) FindCaption(chatID int64, caption string, limit int) ([]*tg.Message, error) {
+	peer, err := c.ResolvePeer(chatID)
+	if err != nil {
+		return nil, fmt.Errorf("ResolvePeer failed: %w", err)
+	}
+	query, _, _ := strings.Cut(caption, " ")
+
+	var found []*tg.Message
+	offsetID := 0
+	for scanned := 0; scanned < limit; {
+		resp, err := c.api.MessagesSearch(c.ctx, &tg.MessagesSearchRequest{
+			Peer:     peer,
+			Q:        query,
+			Filter:   &tg.InputMessagesFilterEmpty{},
+			OffsetID: offsetID,
+			Limit:    min(searchPageSize, limit-scanned),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MessagesSearch failed: %w", err)
+		}
+		msgs, err := collectMessages(resp)
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+
+		for _, msg := range msgs {
+			if msg.Message == caption {
+				found = append(found, msg)
+			}
+		}
+		scanned += len(msgs)
+		offsetID = msgs[len(msgs)-1].ID
+	}
+	return found, nil
+}
+
+// DocumentSize returns the size of the document attached to msg, or -1
+func DocumentSize(msg *tg.Message) int64 {
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return -1
+	}
+	doc, ok := media.Document.(*tg.Document)
+	if !ok {
+		return -1
+	}
+	return doc.Size
+}
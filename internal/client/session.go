@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/util"
+	"time"
+
+	"github.com/gotd/td/session"
+)
+
+// sessionMagic starts an encrypted session file, so plain files written
+// before session_key was set can still be read (and are encrypted on the
+// next save)
+var sessionMagic = []byte("TGAENC1\n")
+
+// encryptedSession stores the session with AES-256-GCM, keyed by the
+// SHA-256 of session_key
+type encryptedSession struct {
+	storage session.Storage
+	aead    cipher.AEAD
+}
+
+func newEncryptedSession(storage session.Storage, key string) (*encryptedSession, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedSession{storage: storage, aead: aead}, nil
+}
+
+func (s *encryptedSession) LoadSession(ctx context.Context) ([]byte, error) {
+	data, err := s.storage.LoadSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, sessionMagic) {
+		log.Warn.Println("Session file is not encrypted yet, it will be encrypted on the next save")
+		return data, nil
+	}
+
+	data = data[len(sessionMagic):]
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("encrypted session is truncated")
+	}
+	plain, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session (wrong session_key?): %w", err)
+	}
+	return plain, nil
+}
+
+func (s *encryptedSession) StoreSession(ctx context.Context, data []byte) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	out := append(append([]byte{}, sessionMagic...), nonce...)
+	out = s.aead.Seal(out, nonce, data, nil)
+	return s.storage.StoreSession(ctx, out)
+}
+
+// sessionLockPoll is how often a --wait run checks whether the session is free
+const sessionLockPoll = time.Second
+
+// lockSession keeps other processes from using the session file while this
+// one runs: two connections with one auth key race on its updates and may
+// corrupt the file. With session wait it waits for the other process to
+// finish, otherwise it fails with errs.ErrSessionInUse.
+func lockSession(ctx context.Context, cfg *config.MtprotoConfig) (unlock func(), err error) {
+	path := cfg.SessionFile + ".lock"
+	logged := false
+	for {
+		unlock, err := util.TryLockFile(path)
+		if !errors.Is(err, util.ErrLocked) {
+			return unlock, err
+		}
+		holder := "another process"
+		if pid := util.LockHolder(path); pid != 0 {
+			holder = fmt.Sprintf("PID %d", pid)
+		}
+		if !cfg.SessionWait {
+			return nil, fmt.Errorf("%w by %s (%s), pass --wait to queue behind it", errs.ErrSessionInUse, holder, cfg.SessionFile)
+		}
+		if !logged {
+			log.Info.Printf("Session %s is in use by %s, waiting for it", cfg.SessionFile, holder)
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sessionLockPoll):
+		}
+	}
+}
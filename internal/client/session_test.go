@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+)
+
+func TestLockSession(t *testing.T) {
+	cfg := &config.MtprotoConfig{SessionFile: filepath.Join(t.TempDir(), "session.json")}
+
+	unlock, err := lockSession(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lockSession(context.Background(), cfg)
+	if !errors.Is(err, errs.ErrSessionInUse) {
+		t.Fatalf("second lock = %v, want ErrSessionInUse", err)
+	}
+	if want := fmt.Sprintf("PID %d", os.Getpid()); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q doesn't name %s", err, want)
+	}
+
+	cfg.SessionWait = true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := lockSession(ctx, cfg); !errors.Is(err, context.Canceled) {
+		t.Errorf("waiting lock = %v, want it to end with its context", err)
+	}
+
+	unlock()
+	unlock, err = lockSession(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestBackupSession(t *testing.T) {
+	cfg := &config.MtprotoConfig{SessionFile: filepath.Join(t.TempDir(), "session.json"), SessionBackups: 2}
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(cfg.SessionFile, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backup := func(n int) string {
+		t.Helper()
+		data, _ := os.ReadFile(backupPath(cfg.SessionFile, n))
+		return string(data)
+	}
+
+	if err := backupSession(cfg); err != nil {
+		t.Fatalf("backup without a session: %v", err)
+	}
+	for _, data := range []string{"a", "b", "b", "c"} {
+		write(data)
+		if err := backupSession(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The unchanged "b" didn't rotate, and "a" fell out
+	if backup(1) != "c" || backup(2) != "b" || backup(3) != "" {
+		t.Errorf("backups = %q, %q, %q, want c, b and none", backup(1), backup(2), backup(3))
+	}
+	if got := SessionBackups(cfg); len(got) != 2 || got[0].N != 1 {
+		t.Errorf("SessionBackups = %+v", got)
+	}
+
+	write("broken")
+	if err := RestoreSession(cfg, 2); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(cfg.SessionFile); string(data) != "b" {
+		t.Errorf("restored session = %q, want b", data)
+	}
+	if data, _ := os.ReadFile(cfg.SessionFile + ".broken"); string(data) != "broken" {
+		t.Errorf("replaced session = %q, want it kept", data)
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/errs"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// ResolveUsername looks up a user, group or channel by its @username
+func (c *Client) ResolveUsername(username string) (tg.InputPeerClass, error) {
+	username = strings.TrimPrefix(username, "@")
+	resolved, err := c.api.ContactsResolveUsername(c.ctx, &tg.ContactsResolveUsernameRequest{Username: username})
+	if tgerr.Is(err, "USERNAME_NOT_OCCUPIED", "USERNAME_INVALID") {
+		return nil, fmt.Errorf("%w: @%s", errs.ErrPeerNotFound, username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve @%s failed: %w", username, err)
+	}
+
+	for _, u := range resolved.Users {
+		if user, ok := u.(*tg.User); ok {
+			if p, ok := resolved.Peer.(*tg.PeerUser); ok && p.UserID == user.ID {
+				return user.AsInputPeer(), nil
+			}
+		}
+	}
+	for _, chat := range resolved.Chats {
+		switch ch := chat.(type) {
+		case *tg.Channel:
+			if p, ok := resolved.Peer.(*tg.PeerChannel); ok && p.ChannelID == ch.ID {
+				return ch.AsInputPeer(), nil
+			}
+		case *tg.Chat:
+			if p, ok := resolved.Peer.(*tg.PeerChat); ok && p.ChatID == ch.ID {
+				return ch.AsInputPeer(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: @%s", errs.ErrPeerNotFound, username)
+}
+
+// ResolveRecipient resolves "@username" or a Bot API chat ID
+func (c *Client) ResolveRecipient(who string) (tg.InputPeerClass, error) {
+	if strings.HasPrefix(who, "@") {
+		return c.ResolveUsername(who)
+	}
+	chatID, err := strconv.ParseInt(who, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("recipient must be @username or a chat ID, got %q", who)
+	}
+	return c.ResolvePeer(chatID)
+}
+
+// ShareMessages sends the media of messages ids of fromChatID to peer again,
+// one message each and without the caption. With ttl (seconds) the photos
+// and videos self-destruct that long after being opened, which Telegram only
+// allows in private chats.
+func (c *Client) ShareMessages(fromChatID int64, ids []int, peer tg.InputPeerClass, ttl int) ([]int, error) {
+	msgs, err := c.GetMessages(fromChatID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var sent []int
+	for _, msg := range msgs {
+		media, err := shareMedia(msg, ttl)
+		if err != nil {
+			return sent, err
+		}
+		updates, err := c.api.MessagesSendMedia(c.ctx, &tg.MessagesSendMediaRequest{
+			Peer:     peer,
+			Media:    media,
+			RandomID: randID(),
+		})
+		if err != nil {
+			return sent, fmt.Errorf("share message %d failed: %w", msg.ID, err)
+		}
+		for _, m := range extractSentMedias(updates) {
+			sent = append(sent, m.MsgID)
+		}
+	}
+	return sent, nil
+}
+
+// shareMedia refers to the photo or document of msg, with ttl if set
+func shareMedia(msg *tg.Message, ttl int) (tg.InputMediaClass, error) {
+	switch m := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			media := &tg.InputMediaPhoto{ID: photo.AsInput()}
+			if ttl > 0 {
+				media.SetTTLSeconds(ttl)
+			}
+			return media, nil
+		}
+	case *tg.MessageMediaDocument:
+		if doc, ok := m.Document.(*tg.Document); ok {
+			if ttl > 0 && !strings.HasPrefix(doc.MimeType, "video/") {
+				return nil, fmt.Errorf("message %d is a %s file, only photos and videos can self-destruct", msg.ID, doc.MimeType)
+			}
+			media := &tg.InputMediaDocument{ID: doc.AsInput()}
+			if ttl > 0 {
+				media.SetTTLSeconds(ttl)
+			}
+			return media, nil
+		}
+	}
+	return nil, fmt.Errorf("message %d has no photo or document", msg.ID)
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"io"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+// UploadStream uploads everything read from r, whose size is unknown up
+// front, as a big file named name and returns it with its size. Every part
+// but the last gives -1 as the total, see
+// https://core.telegram.org/api/files#streamed-uploads. One part is read
+// ahead to know which part is the last.
+func (c *Client) UploadStream(r io.Reader, name string) (tg.InputFileClass, int64, error) {
+	c.uploadMu.Lock()
+	defer c.uploadMu.Unlock()
+	c.InitUploader()
+	defer c.CloseUploader()
+
+	partSize := c.partSize()
+	buf, ahead := make([]byte, partSize), make([]byte, partSize)
+	n, err := readPart(r, buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	if n == 0 {
+		return nil, 0, errors.New("nothing to upload")
+	}
+
+	fileID := randID()
+	var size int64
+	for p := 0; ; p++ {
+		next := 0
+		if n == partSize {
+			if next, err = readPart(r, ahead); err != nil {
+				return nil, size, err
+			}
+		}
+		total := -1
+		if next == 0 {
+			total = p + 1
+		}
+		if err := c.saveBigPart(c.ctx, fileID, p, total, buf[:n]); err != nil {
+			return nil, size, err
+		}
+		size += int64(n)
+
+		// The progress line ends once the total is known
+		progressTotal := int64(-1)
+		if next == 0 {
+			progressTotal = size
+		}
+		if err := c.uploadProgress.Chunk(c.ctx, uploader.ProgressState{
+			ID: fileID, Name: name, Part: p, PartSize: partSize, Uploaded: size, Total: progressTotal,
+		}); err != nil {
+			return nil, size, err
+		}
+
+		if next == 0 {
+			return &tg.InputFileBig{ID: fileID, Parts: p + 1, Name: name}, size, nil
+		}
+		buf, ahead, n = ahead, buf, next
+	}
+}
+
+// readPart fills buf from r like io.ReadFull, but running out of data is
+// not an error: the part is then shorter or empty
+func readPart(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, nil
+	}
+	return n, err
+}
+
+// SendDocument sends a file uploaded by UploadStream as the document name
+// and returns the message ID
+func (c *Client) SendDocument(peer tg.InputPeerClass, file tg.InputFileClass, name, caption string) (int, error) {
+	if big, ok := file.(*tg.InputFileBig); ok {
+		big.Name = name
+	}
+	media, err := c.buildDocumentMedia(file, caption)
+	if err != nil {
+		return 0, err
+	}
+	return c.sendSingle(peer, media, name)
+}
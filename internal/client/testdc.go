@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"tg-storage-assistant/internal/config"
+
+	"github.com/gotd/td/crypto"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/dcs"
+)
+
+// newTestClient connects to Telegram's test DCs, where test numbers log in
+// with a code derived from the DC and no real account is at risk
+func newTestClient(ctx context.Context, cfg *config.MtprotoConfig, options telegram.Options) *Client {
+	options.DC = cfg.TestDC
+	options.DCList = dcs.Test()
+
+	appID, appHash := cfg.APIID, cfg.APIHash
+	if appID == 0 || appHash == "" {
+		appID, appHash = telegram.TestAppID, telegram.TestAppHash
+	}
+	authenticator := auth.Test(crypto.DefaultRand(), cfg.TestDC)
+	if cfg.Phone != "" {
+		authenticator = auth.TestUser(cfg.Phone, cfg.TestDC)
+	}
+
+	client := telegram.NewClient(appID, appHash, options)
+	return &Client{
+		ctx:      ctx,
+		cfg:      cfg,
+		client:   client,
+		api:      client.API(),
+		flow:     auth.NewFlow(authenticator, auth.SendCodeOptions{}),
+		uploadMu: &sync.Mutex{},
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"tg-storage-assistant/internal/config"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// TestTestDCFlows runs upload, album and history against Telegram's test
+// servers. It is skipped unless TELEGRAM_TEST_DC names a test DC (1-3).
+func TestTestDCFlows(t *testing.T) {
+	dc, _ := strconv.Atoi(os.Getenv("TELEGRAM_TEST_DC"))
+	if dc == 0 {
+		t.Skip("set TELEGRAM_TEST_DC=2 to run against the Telegram test servers")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cfg := &config.MtprotoConfig{
+		TestDC:      dc,
+		SessionFile: filepath.Join(t.TempDir(), "session.json"),
+	}
+	c, err := NewClient(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	single, part1, part2 := writeFile(t, "single.bin", 4096), writeFile(t, "part1.bin", 2048), writeFile(t, "part2.bin", 2048)
+
+	// Run calls back on another goroutine, so failures are returned
+	err = c.Run(func(ctx context.Context) error {
+		// A fresh channel keeps runs apart; test accounts start without one
+		created, err := c.client.API().ChannelsCreateChannel(ctx, &tg.ChannelsCreateChannelRequest{
+			Broadcast: true,
+			Title:     "tg-assistant e2e",
+		})
+		if err != nil {
+			return err
+		}
+		var channel *tg.Channel
+		if u, ok := created.(*tg.Updates); ok {
+			for _, chat := range u.Chats {
+				if ch, ok := chat.(*tg.Channel); ok {
+					channel = ch
+				}
+			}
+		}
+		if channel == nil {
+			return fmt.Errorf("no channel in %T", created)
+		}
+		defer c.client.API().ChannelsDeleteChannel(ctx, &tg.InputChannel{ChannelID: channel.ID, AccessHash: channel.AccessHash})
+		chatID := -1000000000000 - channel.ID
+
+		peer, err := c.ResolvePeer(chatID)
+		if err != nil {
+			return err
+		}
+		singleID, err := c.SendMedia(peer, MediaItem{FilePath: single, MediaType: "document", Caption: "#e2e single"})
+		if err != nil {
+			return err
+		}
+		album, err := c.SendMultiMedia(peer, []MediaItem{
+			{FilePath: part1, MediaType: "document"},
+			{FilePath: part2, MediaType: "document", Caption: "#e2e album"},
+		})
+		if err != nil {
+			return err
+		}
+		if len(album) != 2 || album[0] <= singleID {
+			return fmt.Errorf("album ids %v after single %d", album, singleID)
+		}
+
+		msgs, err := c.GetHistory(chatID, HistoryOptions{Limit: 10})
+		if err != nil {
+			return err
+		}
+		var captions []string
+		for _, m := range msgs {
+			if m.Media != nil {
+				captions = append(captions, m.Message)
+			}
+		}
+		if len(captions) != 3 || captions[0] != "#e2e album" || captions[2] != "#e2e single" {
+			return fmt.Errorf("history captions = %q", captions)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,68 +1,647 @@
 package config
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/messages"
 	"tg-storage-assistant/internal/util"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.yaml.in/yaml/v3"
 )
 
 type Config struct {
-	Mtproto MtprotoConfig `yaml:"mtproto"`
-	Bot     BotConfig     `yaml:"bot"`
+	Mtproto   MtprotoConfig   `yaml:"mtproto"`
+	Bot       BotConfig       `yaml:"bot"`
+	Index     IndexConfig     `yaml:"index"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Daemon    DaemonConfig    `yaml:"daemon"`
+	Retry     RetryConfig     `yaml:"retry"`
+	Priority  PriorityConfig  `yaml:"priority"`
+	Notify    NotifyConfig    `yaml:"notify"`
+	YtDlp     YtDlpConfig     `yaml:"ytdlp"`
+	Feeds     FeedsConfig     `yaml:"feeds"`
+	Retention RetentionConfig `yaml:"retention"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	WebDAV    WebDAVConfig    `yaml:"webdav"`
+	S3        S3Config        `yaml:"s3"`
+	GRPC      GRPCConfig      `yaml:"grpc"`
+	Logging   LoggingConfig   `yaml:"logging"`
+
+	// Language of CLI output: en (default) or zh, see internal/messages
+	Locale string `yaml:"locale"`
+
+	Schedule Schedule `yaml:"-"` // from the uploader's -schedule flags
 }
 
 type MtprotoConfig struct {
 	// MTProto credentials
-	SessionFile   string `yaml:"session_file"`
-	APIID         int    `yaml:"api_id"`
-	APIHash       string `yaml:"api_hash"`
-	Phone         string `yaml:"phone"`
-	StorageChatID int64  `yaml:"storage_chat_id"`
+	SessionFile    string  `yaml:"session_file"`
+	SessionKey     string  `yaml:"session_key"` // encrypts the session file when set
+	SessionKeyFile string  `yaml:"session_key_file"`
+	SessionBackups int     `yaml:"session_backups"` // copies kept as <session_file>.N, default is 3, -1 for none
+	APIID          int     `yaml:"api_id"`
+	APIHash        string  `yaml:"api_hash"` // inline or keyring:<name>
+	APIHashFile    string  `yaml:"api_hash_file"`
+	Phone          string  `yaml:"phone"`
+	StorageChatID  int64   `yaml:"storage_chat_id"`
+	Mirrors        []int64 `yaml:"mirrors"` // chats every upload is copied to
+
+	// How the session shows in Telegram's Settings > Devices and `cli
+	// sessions`. Empty system_version and app_version are the OS and the
+	// MTProto library version.
+	DeviceModel   string `yaml:"device_model"` // default is tg-storage-assistant
+	SystemVersion string `yaml:"system_version"`
+	AppVersion    string `yaml:"app_version"`
+
+	// Wait for another process using the session file to finish instead of
+	// failing, from the --wait flags
+	SessionWait bool `yaml:"-"`
+
+	// Soft limit of bytes stored per chat, e.g. 500GB: a batch that would
+	// pass it is uploaded with a warning. Empty for none.
+	Quota      string `yaml:"quota"`
+	QuotaBytes int64  `yaml:"-"` // parsed from Quota
+
+	// Bytes uploaded per day at most, e.g. 50GB: an upload run takes the
+	// files of local_dir in order while they fit and leaves the rest for
+	// the next day. Empty for none.
+	DailyBudget      string `yaml:"daily_budget"`
+	DailyBudgetBytes int64  `yaml:"-"` // parsed from DailyBudget
 
 	// Proxy settings
 	Proxy string `yaml:"proxy"`
+	// DNS-over-HTTPS server looking up the proxy host, e.g.
+	// https://1.1.1.1/dns-query, for networks where plain DNS is forged.
+	// Empty uses the system resolver.
+	DoH string `yaml:"doh"`
+	// How to reach the DCs: auto (the plain transport, then the obfuscated
+	// one and ports 80 and 5222 while connections fail), plain or
+	// obfuscated. Default is auto.
+	Transport string `yaml:"transport"`
+
+	// Connect to Telegram's test servers instead of production: the ID of
+	// the test DC (1-3), 0 for production. api_id/api_hash default to the
+	// public test app and phone to a random test number (99966<dc>XXXX).
+	TestDC int `yaml:"test_dc"`
 
 	// File paths
 	LocalDir       string `yaml:"local_dir"`
 	TempDir        string `yaml:"temp_dir"`
 	DoneDir        string `yaml:"done_dir"`
+	StagingDir     string `yaml:"staging_dir"`      // remote downloads before upload, default is ./staging
+	QuarantineDir  string `yaml:"quarantine_dir"`   // broken files of local_dir, which stay there when empty
 	MaxSize        string `yaml:"max_size"`         // e.g. "20MB"
 	MaxSizeBytes   int64  `yaml:"-"`                // parsed from MaxSize
 	CleanupTempDir bool   `yaml:"cleanup_temp_dir"` // default is true
+
+	// Files in local_dir whose size or modification time changes within
+	// this long (e.g. 10s) are still being copied and wait for the next run.
+	// Empty or 0 processes files right away.
+	StableFor         string        `yaml:"stable_for"`
+	StableForDuration time.Duration `yaml:"-"` // parsed from StableFor
+
+	// Order files in local_dir are uploaded in: name (default), mtime or
+	// size, optionally followed by asc (default) or desc
+	ScanOrder     string `yaml:"scan_order"`
+	ScanOrderBy   string `yaml:"-"` // name, mtime or size, parsed from ScanOrder
+	ScanOrderDesc bool   `yaml:"-"`
+
+	Rules []RuleConfig `yaml:"rules"` // per-tag processing overrides, first match wins
+
+	// File names that aren't TAG_DESCRIPTION.ext: templates are tried in
+	// order, then filename_fallback dir tags files with their directory
+	FilenameTemplates []FilenameTemplate `yaml:"filename_templates"`
+	FilenameFallback  string             `yaml:"filename_fallback"` // none (default) or dir
+
+	// Tags from file names are made valid hashtags; ascii also
+	// transliterates accented, Cyrillic and Greek letters
+	TagTransliteration string `yaml:"tag_transliteration"` // none (default) or ascii
+
+	// Upload tuning: the part size must divide 512KB, and each file sends
+	// upload_threads parts at once
+	UploadPartSize      string `yaml:"upload_part_size"` // default is 512KB
+	UploadPartSizeBytes int    `yaml:"-"`                // parsed from UploadPartSize
+	UploadThreads       int    `yaml:"upload_threads"`   // default is 1
+
+	// Where the progress of big uploads is kept, so an interrupted upload
+	// continues from its last sent part. Default is ./upload_state, "off"
+	// disables resuming.
+	UploadStateDir string `yaml:"upload_state_dir"`
+
+	// Images are sent as photos. Those Telegram would reject are scaled down
+	// to photo_max_side and re-encoded as JPEG at photo_quality;
+	// photo_originals also sends the original file as a document right
+	// after the photo.
+	PhotoMaxSide   int  `yaml:"photo_max_side"` // pixels, default is 2560
+	PhotoQuality   int  `yaml:"photo_quality"`  // 1-100, default is 87
+	PhotoOriginals bool `yaml:"photo_originals"`
+
+	// HEIC/HEIF images are converted to JPEG to be sent as photos; with
+	// photo_convert_raw camera RAW files are too, otherwise they are sent
+	// as documents
+	PhotoConvertRaw bool `yaml:"photo_convert_raw"`
+
+	// Send a picture of the first page of PDFs and office documents right
+	// before them, like the preview of videos
+	DocumentPreviews bool `yaml:"document_previews"`
+
+	// The contact sheet of videos: full (before the parts, default), only
+	// (without the video, for cataloging) or none. Videos shorter than
+	// preview_min_duration get none. Rules override both.
+	Preview                    string        `yaml:"preview"`
+	PreviewMinDuration         string        `yaml:"preview_min_duration"` // e.g. 1m
+	PreviewMinDurationDuration time.Duration `yaml:"-"`                    // parsed from PreviewMinDuration
+	// From the -preview and --preview flags, overriding preview and the rules
+	PreviewFlag string `yaml:"-"`
+	// Bounds of the frames in a contact sheet, which grow with the
+	// duration of the video
+	PreviewMinFrames int `yaml:"preview_min_frames"` // default is 4
+	PreviewMaxFrames int `yaml:"preview_max_frames"` // default is 64
+
+	// Convert HDR (PQ and HLG) and 10-bit videos to 8-bit SDR H.264 in
+	// BT.709, together with any transcode, since many Telegram clients show
+	// HDR washed out. HDR needs ffmpeg built with zscale (libzimg).
+	ToneMap bool `yaml:"tone_map"`
+
+	// Send sprite sheets of a frame every scrub_interval and a WebVTT
+	// file mapping times to them after each video, for players of the
+	// streaming gateway to show when hovering the seek bar
+	ScrubThumbnails       bool          `yaml:"scrub_thumbnails"`
+	ScrubInterval         string        `yaml:"scrub_interval"` // default is 10s
+	ScrubIntervalDuration time.Duration `yaml:"-"`              // parsed from ScrubInterval
+
+	// EXIF of images: photo_exif lists what is added to their captions
+	// (date, camera, gps), photo_date_tag adds a #YYYY_MM tag of the date
+	// they were taken
+	PhotoExif    []string `yaml:"photo_exif"`
+	PhotoDateTag bool     `yaml:"photo_date_tag"`
+
+	// Add a line with the modification time of the original file to
+	// captions, so index rebuild and cli download can restore it too
+	CaptionMTime bool `yaml:"caption_mtime"`
+
+	// Set by LoadForSetup: the storage chat may not exist yet
+	setup bool
+
+	// Looking for earlier uploads of the same file in the storage chat
+	DuplicateCheck string `yaml:"duplicate_check"` // off (default), warn or skip
+	DuplicateScan  int    `yaml:"duplicate_scan"`  // search results to look at, default is 200
+
+	// Check new uploads against the storage chat and react with ✅ or ⚠️
+	StatusReactions bool `yaml:"status_reactions"`
+
+	// original (default) keeps file names in done_dir, hash prefixes them
+	// with their SHA-256 and records it in the index for duplicate lookups
+	DoneNaming string `yaml:"done_naming"`
+
+	// A file uploaded again under its name and tag is skipped when unchanged,
+	// otherwise it becomes the next version and the caption of the previous
+	// one points to it
+	Versioning bool `yaml:"versioning"`
+}
+
+// parseScanOrder splits scan_order into the key and direction
+func (c *MtprotoConfig) parseScanOrder() error {
+	fields := strings.Fields(strings.ToLower(c.ScanOrder))
+	c.ScanOrderBy, c.ScanOrderDesc = "name", false
+	if len(fields) > 2 {
+		return fmt.Errorf("scan_order must be name, mtime or size with asc or desc, got %q", c.ScanOrder)
+	}
+	if len(fields) > 0 {
+		c.ScanOrderBy = fields[0]
+	}
+	if len(fields) > 1 {
+		switch fields[1] {
+		case "asc":
+		case "desc":
+			c.ScanOrderDesc = true
+		default:
+			return fmt.Errorf("scan_order direction must be asc or desc, got %q", fields[1])
+		}
+	}
+	switch c.ScanOrderBy {
+	case "name", "mtime", "size":
+	default:
+		return fmt.Errorf("scan_order must be name, mtime or size, got %q", fields[0])
+	}
+	return nil
+}
+
+// MaxUploadPartSize is the largest part Telegram accepts
+const MaxUploadPartSize = 512 * 1024
+
+// validateUpload parses upload_part_size and defaults the upload tuning
+func (c *MtprotoConfig) validateUpload() error {
+	if c.UploadPartSize == "" {
+		c.UploadPartSizeBytes = MaxUploadPartSize
+	} else {
+		size, err := util.ParseSize(c.UploadPartSize)
+		if err != nil {
+			return fmt.Errorf("invalid mtproto.upload_part_size: %w", err)
+		}
+		if size < 1024 || size%1024 != 0 || MaxUploadPartSize%size != 0 {
+			return fmt.Errorf("upload_part_size must be 1KB-512KB and divide 512KB, got %s", c.UploadPartSize)
+		}
+		c.UploadPartSizeBytes = int(size)
+	}
+	if c.UploadThreads < 0 || c.UploadThreads > 16 {
+		return fmt.Errorf("upload_threads must be 1-16, got %d", c.UploadThreads)
+	}
+	if c.UploadThreads == 0 {
+		c.UploadThreads = 1
+	}
+	switch c.UploadStateDir {
+	case "":
+		c.UploadStateDir = "./upload_state"
+	case "off":
+		c.UploadStateDir = ""
+	}
+	return nil
+}
+
+// FilenameTemplate parses file names (without extension) with a regexp.
+// Its named groups are tag, description, date, series and episode.
+type FilenameTemplate struct {
+	Name    string         `yaml:"name"`
+	Pattern string         `yaml:"pattern"`
+	Regexp  *regexp.Regexp `yaml:"-"` // compiled from Pattern
+}
+
+// filenameGroups are the group names a template may capture
+var filenameGroups = []string{"tag", "description", "date", "series", "episode"}
+
+func (t *FilenameTemplate) Validate() error {
+	re, err := regexp.Compile(t.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	named := 0
+	for _, group := range re.SubexpNames()[1:] {
+		if group == "" {
+			continue
+		}
+		if !slices.Contains(filenameGroups, group) {
+			return fmt.Errorf("unknown group %q, use %s", group, strings.Join(filenameGroups, ", "))
+		}
+		named++
+	}
+	if named == 0 {
+		return fmt.Errorf("pattern %q has no named groups", t.Pattern)
+	}
+	t.Regexp = re
+	return nil
+}
+
+// RuleConfig changes how uploads with a given tag are processed
+type RuleConfig struct {
+	Tag             string `yaml:"tag"`
+	MaxSize         string `yaml:"max_size"`  // overrides mtproto.max_size
+	MaxSizeBytes    int64  `yaml:"-"`         // parsed from MaxSize
+	SendAs          string `yaml:"send_as"`   // video (split and previewed, default) or document (sent whole)
+	Transcode       string `yaml:"transcode"` // e.g. 720p: scale videos down to this height first
+	TranscodeHeight int    `yaml:"-"`         // parsed from Transcode
+	// Override preview and preview_min_duration
+	Preview                    string        `yaml:"preview"`
+	PreviewMinDuration         string        `yaml:"preview_min_duration"`
+	PreviewMinDurationDuration time.Duration `yaml:"-"`
+	// Upload files with this tag before the rest of local_dir
+	Priority bool `yaml:"priority"`
+}
+
+// Processing is the effective handling of one upload
+type Processing struct {
+	MaxSizeBytes       int64
+	AsDocument         bool
+	TranscodeHeight    int           // 0 keeps the resolution
+	Preview            string        // full, only or none
+	PreviewMinDuration time.Duration // shorter videos get no preview
+	PreviewMinFrames   int
+	PreviewMaxFrames   int
+	ToneMap            bool          // convert HDR and 10-bit videos to 8-bit SDR
+	CaptionMTime       bool          // add the modification time to captions
+	ScrubInterval      time.Duration // 0 sends no scrub thumbnails
+	Priority           bool          // uploaded before the rest of local_dir
+}
+
+// Processing returns the settings for uploads tagged tag
+func (c *MtprotoConfig) Processing(tag string) Processing {
+	p := Processing{
+		MaxSizeBytes:       c.MaxSizeBytes,
+		Preview:            c.Preview,
+		PreviewMinDuration: c.PreviewMinDurationDuration,
+		PreviewMinFrames:   c.PreviewMinFrames,
+		PreviewMaxFrames:   c.PreviewMaxFrames,
+		ToneMap:            c.ToneMap,
+		CaptionMTime:       c.CaptionMTime,
+	}
+	if c.ScrubThumbnails {
+		p.ScrubInterval = c.ScrubIntervalDuration
+	}
+	for _, rule := range c.Rules {
+		if rule.Tag != tag {
+			continue
+		}
+		if rule.MaxSizeBytes > 0 {
+			p.MaxSizeBytes = rule.MaxSizeBytes
+		}
+		p.AsDocument = rule.SendAs == "document"
+		p.TranscodeHeight = rule.TranscodeHeight
+		if rule.Preview != "" {
+			p.Preview = rule.Preview
+		}
+		if rule.PreviewMinDuration != "" {
+			p.PreviewMinDuration = rule.PreviewMinDurationDuration
+		}
+		p.Priority = rule.Priority
+		break
+	}
+	if c.PreviewFlag != "" {
+		p.Preview = c.PreviewFlag
+	}
+	if p.Preview == "" {
+		p.Preview = "full"
+	}
+	return p
+}
+
+// validatePreview checks a preview setting
+func validatePreview(preview string) error {
+	if !slices.Contains([]string{"full", "only", "none"}, preview) {
+		return fmt.Errorf("preview must be full, only or none, got %q", preview)
+	}
+	return nil
+}
+
+func (r *RuleConfig) Validate() error {
+	if r.Tag == "" {
+		return fmt.Errorf("tag is required")
+	}
+	if r.MaxSize != "" {
+		size, err := util.ParseSize(r.MaxSize)
+		if err != nil {
+			return fmt.Errorf("invalid max_size: %w", err)
+		}
+		r.MaxSizeBytes = size
+	}
+
+	switch r.SendAs {
+	case "":
+		r.SendAs = "video"
+	case "video", "document":
+	default:
+		return fmt.Errorf("send_as must be video or document, got %q", r.SendAs)
+	}
+
+	if r.Transcode != "" {
+		h, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(r.Transcode), "p"))
+		if err != nil || h <= 0 {
+			return fmt.Errorf("invalid transcode %q, expected a height like 720p", r.Transcode)
+		}
+		if r.SendAs == "document" {
+			return fmt.Errorf("transcode has no effect with send_as: document")
+		}
+		r.TranscodeHeight = h
+	}
+	if r.Preview != "" {
+		if err := validatePreview(r.Preview); err != nil {
+			return err
+		}
+	}
+	if r.PreviewMinDuration != "" {
+		d, err := time.ParseDuration(r.PreviewMinDuration)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid preview_min_duration: %q", r.PreviewMinDuration)
+		}
+		r.PreviewMinDurationDuration = d
+	}
+	return nil
 }
 
 type BotConfig struct {
-	Token string `yaml:"token"`
-	Proxy string `yaml:"proxy"`
+	Token     string `yaml:"token"` // inline or keyring:<name>
+	TokenFile string `yaml:"token_file"`
+	Proxy     string `yaml:"proxy"`
+}
+
+type IndexConfig struct {
+	Path string `yaml:"path"` // default is ./index.json
+}
+
+type JobsConfig struct {
+	Path        string `yaml:"path"`         // default is ./jobs.json
+	MaxAttempts int    `yaml:"max_attempts"` // default is 3
+}
+
+// DaemonConfig is how the CLI reaches a running `cli daemon`
+type DaemonConfig struct {
+	Socket string `yaml:"socket"` // control socket, default is ./daemon.sock
+}
+
+// RetryConfig controls the queue of failed uploads from local_dir
+type RetryConfig struct {
+	Path          string        `yaml:"path"`         // default is ./retry.json
+	MaxAttempts   int           `yaml:"max_attempts"` // default is 5
+	Delay         string        `yaml:"delay"`        // first retry, doubled after each failure, default is 1m
+	DelayDuration time.Duration `yaml:"-"`            // parsed from Delay
+}
+
+// PriorityConfig locates the files of local_dir marked to upload first
+type PriorityConfig struct {
+	Path string `yaml:"path"` // default is ./priority.json
+}
+
+type NotifyConfig struct {
+	Via    string `yaml:"via"`     // "bot", "saved_messages" or empty to disable
+	ChatID int64  `yaml:"chat_id"` // recipient when via is "bot"
+}
+
+type YtDlpConfig struct {
+	Binary string `yaml:"binary"` // yt-dlp executable, looked up in PATH
+	Tag    string `yaml:"tag"`    // tag for saved videos
+}
+
+type FeedsConfig struct {
+	StatePath string       `yaml:"state_path"` // default is ./feeds.json
+	Watch     []FeedConfig `yaml:"watch"`
+}
+
+type FeedConfig struct {
+	URL              string        `yaml:"url"`
+	Interval         string        `yaml:"interval"` // poll interval, default is 1h
+	IntervalDuration time.Duration `yaml:"-"`        // parsed from Interval
+	Tag              string        `yaml:"tag"`      // default is the feed title
+	Backfill         int           `yaml:"backfill"` // items queued on the first poll, default is 0 (only new items)
+}
+
+// RetentionConfig deletes old media from the storage chat and the index
+type RetentionConfig struct {
+	Interval         string          `yaml:"interval"` // how often the daemon applies the rules, empty for only cli retention apply
+	IntervalDuration time.Duration   `yaml:"-"`        // parsed from Interval
+	Rules            []RetentionRule `yaml:"rules"`
+}
+
+// RetentionRule selects media to delete. Media matching any rule is deleted.
+type RetentionRule struct {
+	Tag            string        `yaml:"tag"`           // media with this tag, empty for all
+	KeepVersions   int           `yaml:"keep_versions"` // newest uploads of each file name to keep, 0 keeps all
+	MaxAge         string        `yaml:"max_age"`       // delete media older than this, e.g. 30d or 12h
+	MaxAgeDuration time.Duration `yaml:"-"`             // parsed from MaxAge
+}
+
+type LoggingConfig struct {
+	Level        string       `yaml:"level"`         // debug, info, warn or error, default is info
+	LevelValue   logger.Level `yaml:"-"`             // parsed from Level
+	Format       string       `yaml:"format"`        // text or json, default is text
+	File         string       `yaml:"file"`          // default is stdout/stderr
+	MaxSize      string       `yaml:"max_size"`      // rotate file at this size, default is 100MB
+	MaxSizeBytes int64        `yaml:"-"`             // parsed from MaxSize
+	MaxBackups   int          `yaml:"max_backups"`   // rotated files to keep, default is 3
+	Progress     string       `yaml:"progress"`      // auto, bars, plain or off, default is auto
+	ProgressJSON string       `yaml:"progress_json"` // JSON event stream: "-" for stdout or a unix socket path
+
+	// Per-module levels (client, ffmpeg, uploader, bot, mtproto). mtproto is
+	// gotd's own log (RPC retries, reconnects) and is off unless set here.
+	Modules      map[string]string       `yaml:"modules"`
+	ModuleLevels map[string]logger.Level `yaml:"-"` // parsed from Modules
+}
+
+type HTTPConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	Listen            string `yaml:"listen"`         // default is 127.0.0.1:8080
+	DownloadDir       string `yaml:"download_dir"`   // default is ./downloads
+	MinFreeSpace      string `yaml:"min_free_space"` // readiness threshold, default is 1GB
+	MinFreeSpaceBytes int64  `yaml:"-"`              // parsed from MinFreeSpace
+	Token             string `yaml:"token"`          // bearer token of /api and /stream, required unless listening on loopback
+}
+
+type WebDAVConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Listen         string `yaml:"listen"`     // default is 127.0.0.1:8081
+	CacheDir       string `yaml:"cache_dir"`  // default is ./cache/webdav
+	CacheSize      string `yaml:"cache_size"` // evict least recently used files above this, default is 10GB
+	CacheSizeBytes int64  `yaml:"-"`          // parsed from CacheSize
+
+	// Chunks of files read in ranges, e.g. by video players seeking
+	ChunkCacheDir       string `yaml:"chunk_cache_dir"`  // default is <cache_dir>/chunks
+	ChunkCacheSize      string `yaml:"chunk_cache_size"` // evict least recently used chunks above this, default is 2GB
+	ChunkCacheSizeBytes int64  `yaml:"-"`                // parsed from ChunkCacheSize
+}
+
+type S3Config struct {
+	Enabled        bool   `yaml:"enabled"`
+	Listen         string `yaml:"listen"`     // default is 127.0.0.1:9000
+	Bucket         string `yaml:"bucket"`     // default is telegram
+	AccessKey      string `yaml:"access_key"` // required unless listening on loopback
+	SecretKey      string `yaml:"secret_key"` // used to verify SigV4 signatures
+	CacheDir       string `yaml:"cache_dir"`  // default is ./cache/s3
+	CacheSize      string `yaml:"cache_size"` // evict least recently used files above this, default is 10GB
+	CacheSizeBytes int64  `yaml:"-"`          // parsed from CacheSize
+
+	// Chunks of files read in ranges, e.g. by video players seeking
+	ChunkCacheDir       string `yaml:"chunk_cache_dir"`  // default is <cache_dir>/chunks
+	ChunkCacheSize      string `yaml:"chunk_cache_size"` // evict least recently used chunks above this, default is 2GB
+	ChunkCacheSizeBytes int64  `yaml:"-"`                // parsed from ChunkCacheSize
+}
+
+// GRPCConfig is the control API of pkg/assistantpb served by the daemon
+type GRPCConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // default is 127.0.0.1:9090
+	Token   string `yaml:"token"`  // bearer token of every call, required unless listening on loopback
 }
 
 func ParseConfig() (*Config, error) {
 	cfg := &Config{}
 
-	var configFile string
+	var configFile, profile, progress, progressJSON, schedule, preview string
+	var quiet, wait bool
+	var scheduleEvery time.Duration
 	flag.StringVar(&configFile, "config", "config.yaml", "Path to config file")
+	flag.StringVar(&profile, "profile", "", "Named profile from the profiles section of the config")
+	flag.StringVar(&progress, "progress", "", "Progress output: auto, bars, plain or off (overrides logging.progress)")
+	flag.BoolVar(&quiet, "quiet", false, "Disable progress output, same as -progress=off")
+	flag.BoolVar(&wait, "wait", false, "Wait for another process using the session file to finish instead of failing")
+	flag.StringVar(&progressJSON, "progress-json", "", `Write JSON progress events to "-" (stdout) or a unix socket path`)
+	flag.StringVar(&schedule, "schedule", "", `Queue uploads as scheduled messages posted at "2006-01-02 15:04" or after a delay like 90m`)
+	flag.DurationVar(&scheduleEvery, "schedule-every", 0, "With -schedule, post each upload this long after the previous one")
+	flag.StringVar(&preview, "preview", "", "Contact sheets of videos: full, only (without the video) or none (overrides preview and the rules)")
 	flag.Parse()
 
-	cfg, err := LoadConfig(configFile)
+	cfg, err := LoadProfile(configFile, profile)
 	if err != nil {
 		return nil, fmt.Errorf("load config failed: %w", err)
 	}
+	if quiet {
+		progress = "off"
+	}
+	cfg.Mtproto.SessionWait = wait
+	if preview != "" {
+		if err := validatePreview(preview); err != nil {
+			return nil, fmt.Errorf("invalid -preview: %w", err)
+		}
+		cfg.Mtproto.PreviewFlag = preview
+	}
+	if progressJSON != "" {
+		cfg.Logging.ProgressJSON = progressJSON
+	}
+	if progress != "" {
+		cfg.Logging.Progress = progress
+		if err := cfg.Logging.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid -progress: %w", err)
+		}
+	}
+	if schedule != "" {
+		if cfg.Schedule.At, err = ParseScheduleTime(schedule, time.Now()); err != nil {
+			return nil, err
+		}
+		cfg.Schedule.Every = scheduleEvery
+	} else if scheduleEvery != 0 {
+		return nil, fmt.Errorf("-schedule-every needs -schedule")
+	}
 	return cfg, nil
 }
 
 func LoadConfig(path string) (*Config, error) {
+	return LoadProfile(path, "")
+}
+
+// LoadProfile loads path with the named entry of its profiles section
+// merged over the top-level settings. An empty profile uses the top-level
+// settings only.
+func LoadProfile(path, profile string) (*Config, error) {
+	return load(path, profile, false)
+}
+
+// LoadForSetup is LoadProfile for commands that create the storage chat:
+// storage_chat_id may be missing
+func LoadForSetup(path, profile string) (*Config, error) {
+	return load(path, profile, true)
+}
+
+func load(path, profile string, setup bool) (*Config, error) {
 	// load environment variables from .env file
 	if err := godotenv.Load(); err == nil {
 		logger.Info.Println("loaded environment variables from .env file")
 	}
 
-	// 1. read file
+	// 1. read file; it may be left out when everything comes from TG_ variables
 	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) && hasEnvOverrides() {
+		logger.Info.Printf("config file %s not found, using environment variables only", path)
+		raw, err = nil, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("read config failed: %w", err)
 	}
@@ -70,27 +649,110 @@ func LoadConfig(path string) (*Config, error) {
 	// 2. expand environment variables
 	expanded := os.ExpandEnv(string(raw))
 
-	// 3. parse yaml
+	// 3. parse yaml and apply the profile
+	merged, err := selectProfile([]byte(expanded), profile)
+	if err != nil {
+		return nil, err
+	}
 	var cfg Config
-	if err := yaml.Unmarshal([]byte(expanded), &cfg); err != nil {
+	if err := yaml.Unmarshal(merged, &cfg); err != nil {
 		return nil, fmt.Errorf("parse yaml failed: %w", err)
 	}
 
-	// 4. validate
+	// 4. apply TG_<SECTION>_<KEY> overrides
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	// 5. validate
+	cfg.Mtproto.setup = setup
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
+	// 6. apply logging settings
+	if err := logger.Configure(cfg.Logging.Options()); err != nil {
+		return nil, fmt.Errorf("logging setup failed: %w", err)
+	}
+
 	return &cfg, nil
 }
 
+// CheckKeys reports keys in the config file that don't match any field,
+// which LoadProfile silently ignores (usually typos)
+func CheckKeys(path, profile string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config failed: %w", err)
+	}
+	merged, err := selectProfile([]byte(os.ExpandEnv(string(raw))), profile)
+	if err != nil {
+		return err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(merged))
+	dec.KnownFields(true)
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
 func (c *Config) Validate() error {
+	if err := c.Logging.Validate(); err != nil {
+		return fmt.Errorf("logging config invalid: %w", err)
+	}
 	if err := c.Mtproto.Validate(); err != nil {
 		return fmt.Errorf("mtproto config invalid: %w", err)
 	}
 	if err := c.Bot.Validate(); err != nil {
 		return fmt.Errorf("bot config invalid: %w", err)
 	}
+	if err := c.Index.Validate(); err != nil {
+		return fmt.Errorf("index config invalid: %w", err)
+	}
+	if err := c.Jobs.Validate(); err != nil {
+		return fmt.Errorf("jobs config invalid: %w", err)
+	}
+	if err := c.Daemon.Validate(); err != nil {
+		return fmt.Errorf("daemon config invalid: %w", err)
+	}
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry config invalid: %w", err)
+	}
+	if err := c.Priority.Validate(); err != nil {
+		return fmt.Errorf("priority config invalid: %w", err)
+	}
+	if err := c.Notify.Validate(); err != nil {
+		return fmt.Errorf("notify config invalid: %w", err)
+	}
+	if err := c.YtDlp.Validate(); err != nil {
+		return fmt.Errorf("ytdlp config invalid: %w", err)
+	}
+	if err := c.Feeds.Validate(); err != nil {
+		return fmt.Errorf("feeds config invalid: %w", err)
+	}
+	if err := c.Retention.Validate(); err != nil {
+		return fmt.Errorf("retention config invalid: %w", err)
+	}
+	if err := c.HTTP.Validate(); err != nil {
+		return fmt.Errorf("http config invalid: %w", err)
+	}
+	if err := c.WebDAV.Validate(); err != nil {
+		return fmt.Errorf("webdav config invalid: %w", err)
+	}
+	if err := c.S3.Validate(); err != nil {
+		return fmt.Errorf("s3 config invalid: %w", err)
+	}
+	if err := c.GRPC.Validate(); err != nil {
+		return fmt.Errorf("grpc config invalid: %w", err)
+	}
+	locale, err := messages.Normalize(c.Locale)
+	if err != nil {
+		return fmt.Errorf("invalid locale: %w", err)
+	}
+	c.Locale = locale
 	return nil
 }
 
@@ -104,15 +766,61 @@ func (c *MtprotoConfig) Validate() error {
 		c.MaxSizeBytes = size
 	}
 
-	if c.APIID == 0 {
+	// resolve secrets
+	var err error
+	if c.APIHash, err = resolveSecret("api_hash", c.APIHash, c.APIHashFile); err != nil {
+		return err
+	}
+	if c.SessionKey, err = resolveSecret("session_key", c.SessionKey, c.SessionKeyFile); err != nil {
+		return err
+	}
+
+	if c.DeviceModel == "" {
+		c.DeviceModel = "tg-storage-assistant"
+	}
+	if c.SessionBackups == 0 {
+		c.SessionBackups = 3
+	}
+	if c.TestDC < 0 || c.TestDC > 3 {
+		return fmt.Errorf("test_dc must be 1, 2 or 3 (0 for production), got %d", c.TestDC)
+	}
+	if c.APIID == 0 && c.TestDC == 0 {
 		return fmt.Errorf("api_id is required (get from https://my.telegram.org/apps)")
 	}
-	if c.APIHash == "" {
+	if c.APIHash == "" && c.TestDC == 0 {
 		return fmt.Errorf("api_hash is required (get from https://my.telegram.org/apps)")
 	}
-	if c.StorageChatID == 0 {
+	if c.StorageChatID == 0 && !c.setup {
 		return fmt.Errorf("storage_chat_id is required")
 	}
+	for i, id := range c.Mirrors {
+		if id == 0 || id == c.StorageChatID {
+			return fmt.Errorf("mirrors[%d] must be a chat ID other than storage_chat_id", i)
+		}
+	}
+	if c.Quota != "" {
+		if c.QuotaBytes, err = util.ParseSize(c.Quota); err != nil {
+			return fmt.Errorf("invalid quota: %w", err)
+		}
+	}
+	if c.DailyBudget != "" {
+		if c.DailyBudgetBytes, err = util.ParseSize(c.DailyBudget); err != nil {
+			return fmt.Errorf("invalid daily_budget: %w", err)
+		}
+		if c.DailyBudgetBytes <= 0 {
+			return fmt.Errorf("daily_budget must be positive, got %s", c.DailyBudget)
+		}
+	}
+	switch c.Transport {
+	case "":
+		c.Transport = "auto"
+	case "auto", "plain", "obfuscated":
+	default:
+		return fmt.Errorf("transport must be auto, plain or obfuscated, got %q", c.Transport)
+	}
+	if c.DoH != "" && !strings.HasPrefix(c.DoH, "https://") {
+		return fmt.Errorf("doh must be an https:// URL, got %q", c.DoH)
+	}
 	if c.LocalDir == "" {
 		return fmt.Errorf("local_dir is required")
 	}
@@ -122,6 +830,110 @@ func (c *MtprotoConfig) Validate() error {
 	if c.DoneDir == "" {
 		return fmt.Errorf("done_dir is required")
 	}
+	if c.StagingDir == "" {
+		c.StagingDir = "./staging"
+	}
+	for i := range c.Rules {
+		if err := c.Rules[i].Validate(); err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+	}
+	for i := range c.FilenameTemplates {
+		if err := c.FilenameTemplates[i].Validate(); err != nil {
+			return fmt.Errorf("filename_templates[%d]: %w", i, err)
+		}
+	}
+	switch c.FilenameFallback {
+	case "":
+		c.FilenameFallback = "none"
+	case "none", "dir":
+	default:
+		return fmt.Errorf("filename_fallback must be none or dir, got %q", c.FilenameFallback)
+	}
+	switch c.TagTransliteration {
+	case "":
+		c.TagTransliteration = "none"
+	case "none", "ascii":
+	default:
+		return fmt.Errorf("tag_transliteration must be none or ascii, got %q", c.TagTransliteration)
+	}
+	if err := c.validateUpload(); err != nil {
+		return err
+	}
+	if err := c.parseScanOrder(); err != nil {
+		return err
+	}
+	if c.PhotoMaxSide == 0 {
+		c.PhotoMaxSide = 2560
+	}
+	if c.PhotoMaxSide < 320 || c.PhotoMaxSide > 5000 {
+		return fmt.Errorf("photo_max_side must be 320-5000, got %d", c.PhotoMaxSide)
+	}
+	if c.PhotoQuality == 0 {
+		c.PhotoQuality = 87
+	}
+	if c.PhotoQuality < 1 || c.PhotoQuality > 100 {
+		return fmt.Errorf("photo_quality must be 1-100, got %d", c.PhotoQuality)
+	}
+	for _, field := range c.PhotoExif {
+		if !slices.Contains([]string{"date", "camera", "gps"}, field) {
+			return fmt.Errorf("photo_exif must list date, camera or gps, got %q", field)
+		}
+	}
+	if c.Preview == "" {
+		c.Preview = "full"
+	}
+	if err := validatePreview(c.Preview); err != nil {
+		return err
+	}
+	if c.PreviewMinDuration != "" {
+		d, err := time.ParseDuration(c.PreviewMinDuration)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid mtproto.preview_min_duration: %q", c.PreviewMinDuration)
+		}
+		c.PreviewMinDurationDuration = d
+	}
+	if c.PreviewMinFrames == 0 {
+		c.PreviewMinFrames = 4
+	}
+	if c.PreviewMaxFrames == 0 {
+		c.PreviewMaxFrames = 64
+	}
+	if c.PreviewMinFrames < 1 || c.PreviewMaxFrames < c.PreviewMinFrames || c.PreviewMaxFrames > 100 {
+		return fmt.Errorf("preview_min_frames and preview_max_frames must be 1-100 with min <= max, got %d and %d", c.PreviewMinFrames, c.PreviewMaxFrames)
+	}
+	if c.ScrubInterval == "" {
+		c.ScrubInterval = "10s"
+	}
+	d, err := time.ParseDuration(c.ScrubInterval)
+	if err != nil || d < time.Second {
+		return fmt.Errorf("invalid mtproto.scrub_interval: %q, must be at least 1s", c.ScrubInterval)
+	}
+	c.ScrubIntervalDuration = d
+	if c.StableFor != "" {
+		d, err := time.ParseDuration(c.StableFor)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid mtproto.stable_for: %q", c.StableFor)
+		}
+		c.StableForDuration = d
+	}
+	switch c.DuplicateCheck {
+	case "":
+		c.DuplicateCheck = "off"
+	case "off", "warn", "skip":
+	default:
+		return fmt.Errorf("duplicate_check must be off, warn or skip, got %q", c.DuplicateCheck)
+	}
+	if c.DuplicateScan <= 0 {
+		c.DuplicateScan = 200
+	}
+	switch c.DoneNaming {
+	case "":
+		c.DoneNaming = "original"
+	case "original", "hash":
+	default:
+		return fmt.Errorf("done_naming must be original or hash, got %q", c.DoneNaming)
+	}
 
 	// phone is optional: if session file does not exist, it must be provided
 	if c.Phone == "" {
@@ -147,13 +959,367 @@ func (c *MtprotoConfig) Validate() error {
 		}
 	}
 
+	if c.QuarantineDir != "" {
+		if err := os.MkdirAll(c.QuarantineDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create quarantine_dir: %w", err)
+		}
+	}
+
 	return nil
 }
 
 func (c *BotConfig) Validate() error {
+	var err error
+	if c.Token, err = resolveSecret("token", c.Token, c.TokenFile); err != nil {
+		return err
+	}
 	if c.Token == "" {
 		return fmt.Errorf("bot.token is required (get from @BotFather)")
 	}
 
 	return nil
 }
+
+func (c *IndexConfig) Validate() error {
+	if c.Path == "" {
+		c.Path = "./index.json"
+	}
+
+	return nil
+}
+
+func (c *JobsConfig) Validate() error {
+	if c.Path == "" {
+		c.Path = "./jobs.json"
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+
+	return nil
+}
+
+func (c *DaemonConfig) Validate() error {
+	if c.Socket == "" {
+		c.Socket = "./daemon.sock"
+	}
+
+	return nil
+}
+
+func (c *RetryConfig) Validate() error {
+	if c.Path == "" {
+		c.Path = "./retry.json"
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.Delay == "" {
+		c.Delay = "1m"
+	}
+	d, err := time.ParseDuration(c.Delay)
+	if err != nil {
+		return fmt.Errorf("invalid retry.delay: %w", err)
+	}
+	c.DelayDuration = d
+
+	return nil
+}
+
+func (c *PriorityConfig) Validate() error {
+	if c.Path == "" {
+		c.Path = "./priority.json"
+	}
+	return nil
+}
+
+func (c *NotifyConfig) Validate() error {
+	switch c.Via {
+	case "", "saved_messages":
+	case "bot":
+		if c.ChatID == 0 {
+			return fmt.Errorf("notify.chat_id is required when notify.via is bot")
+		}
+	default:
+		return fmt.Errorf("unknown notify.via: %s (use bot or saved_messages)", c.Via)
+	}
+
+	return nil
+}
+
+func (c *YtDlpConfig) Validate() error {
+	if c.Binary == "" {
+		c.Binary = "yt-dlp"
+	}
+	if c.Tag == "" {
+		c.Tag = "ytdlp"
+	}
+
+	return nil
+}
+
+func (c *FeedsConfig) Validate() error {
+	if c.StatePath == "" {
+		c.StatePath = "./feeds.json"
+	}
+
+	for i := range c.Watch {
+		feed := &c.Watch[i]
+		if feed.URL == "" {
+			return fmt.Errorf("feeds.watch[%d].url is required", i)
+		}
+		if feed.Interval == "" {
+			feed.Interval = "1h"
+		}
+		d, err := time.ParseDuration(feed.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid feeds.watch[%d].interval: %w", i, err)
+		}
+		if d < time.Minute {
+			return fmt.Errorf("feeds.watch[%d].interval must be at least 1m", i)
+		}
+		feed.IntervalDuration = d
+		if feed.Backfill < 0 {
+			return fmt.Errorf("feeds.watch[%d].backfill must not be negative", i)
+		}
+	}
+
+	return nil
+}
+
+func (c *RetentionConfig) Validate() error {
+	if c.Interval != "" {
+		d, err := util.ParseDuration(c.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval: %w", err)
+		}
+		if d < time.Minute {
+			return fmt.Errorf("interval must be at least 1m")
+		}
+		c.IntervalDuration = d
+	}
+
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		rule.Tag = strings.TrimPrefix(rule.Tag, "#")
+		if rule.KeepVersions < 0 {
+			return fmt.Errorf("rules[%d].keep_versions must not be negative", i)
+		}
+		if rule.MaxAge != "" {
+			d, err := util.ParseDuration(rule.MaxAge)
+			if err != nil {
+				return fmt.Errorf("invalid rules[%d].max_age: %w", i, err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("rules[%d].max_age must be positive", i)
+			}
+			rule.MaxAgeDuration = d
+		}
+		if rule.KeepVersions == 0 && rule.MaxAge == "" {
+			return fmt.Errorf("rules[%d] needs keep_versions or max_age", i)
+		}
+	}
+
+	return nil
+}
+
+func (c *LoggingConfig) Validate() error {
+	if c.Level == "" {
+		c.Level = "info"
+	}
+	level, err := logger.ParseLevel(c.Level)
+	if err != nil {
+		return err
+	}
+	c.LevelValue = level
+
+	switch c.Format {
+	case "":
+		c.Format = "text"
+	case "text", "json":
+	default:
+		return fmt.Errorf("format must be text or json, got %q", c.Format)
+	}
+
+	if c.MaxSize == "" {
+		c.MaxSize = "100MB"
+	}
+	size, err := util.ParseSize(c.MaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid max_size: %w", err)
+	}
+	c.MaxSizeBytes = size
+
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("max_backups must not be negative")
+	}
+	if c.MaxBackups == 0 {
+		c.MaxBackups = 3
+	}
+
+	switch c.Progress {
+	case "":
+		c.Progress = "auto"
+	case "auto", "bars", "plain", "off":
+	default:
+		return fmt.Errorf("progress must be auto, bars, plain or off, got %q", c.Progress)
+	}
+
+	c.ModuleLevels = map[string]logger.Level{"mtproto": logger.LevelOff}
+	for name, value := range c.Modules {
+		level, err := logger.ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("modules.%s: %w", name, err)
+		}
+		c.ModuleLevels[name] = level
+	}
+	return nil
+}
+
+// Options converts the config for logger.Configure
+func (c *LoggingConfig) Options() logger.Options {
+	return logger.Options{
+		Level:      c.LevelValue,
+		JSON:       c.Format == "json",
+		File:       c.File,
+		MaxSize:    c.MaxSizeBytes,
+		MaxBackups: c.MaxBackups,
+		Modules:    c.ModuleLevels,
+	}
+}
+
+// Validate always applies the defaults: the daemon serves health checks on
+// listen even when the API is disabled
+func (c *HTTPConfig) Validate() error {
+	if c.Listen == "" {
+		c.Listen = "127.0.0.1:8080"
+	}
+	if c.DownloadDir == "" {
+		c.DownloadDir = "./downloads"
+	}
+	if c.MinFreeSpace == "" {
+		c.MinFreeSpace = "1GB"
+	}
+	size, err := util.ParseSize(c.MinFreeSpace)
+	if err != nil {
+		return fmt.Errorf("invalid http.min_free_space: %w", err)
+	}
+	c.MinFreeSpaceBytes = size
+	// Anyone reaching the listener could download, share and upload
+	if c.Enabled && c.Token == "" && !isLoopback(c.Listen) {
+		return fmt.Errorf("token is required when listen is not a loopback address")
+	}
+
+	return nil
+}
+
+func (c *WebDAVConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Listen == "" {
+		c.Listen = "127.0.0.1:8081"
+	}
+	if c.CacheDir == "" {
+		c.CacheDir = "./cache/webdav"
+	}
+	if c.CacheSize == "" {
+		c.CacheSize = "10GB"
+	}
+	size, err := util.ParseSize(c.CacheSize)
+	if err != nil {
+		return fmt.Errorf("invalid cache_size: %w", err)
+	}
+	c.CacheSizeBytes = size
+	if c.ChunkCacheDir, c.ChunkCacheSizeBytes, err = chunkCache(c.CacheDir, c.ChunkCacheDir, c.ChunkCacheSize); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *S3Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Listen == "" {
+		c.Listen = "127.0.0.1:9000"
+	}
+	if c.Bucket == "" {
+		c.Bucket = "telegram"
+	}
+	if strings.ContainsAny(c.Bucket, "/ ") {
+		return fmt.Errorf("invalid bucket name: %q", c.Bucket)
+	}
+	if c.AccessKey == "" {
+		// Anyone reaching the listener could delete storage messages
+		if !isLoopback(c.Listen) {
+			return fmt.Errorf("access_key and secret_key are required when listen is not a loopback address")
+		}
+	} else if c.SecretKey == "" {
+		return fmt.Errorf("secret_key is required when access_key is set")
+	}
+	if c.CacheDir == "" {
+		c.CacheDir = "./cache/s3"
+	}
+	if c.CacheSize == "" {
+		c.CacheSize = "10GB"
+	}
+	size, err := util.ParseSize(c.CacheSize)
+	if err != nil {
+		return fmt.Errorf("invalid cache_size: %w", err)
+	}
+	c.CacheSizeBytes = size
+	if c.ChunkCacheDir, c.ChunkCacheSizeBytes, err = chunkCache(c.CacheDir, c.ChunkCacheDir, c.ChunkCacheSize); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *GRPCConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Listen == "" {
+		c.Listen = "127.0.0.1:9090"
+	}
+	// Anyone reaching the listener could upload and download
+	if c.Token == "" && !isLoopback(c.Listen) {
+		return fmt.Errorf("token is required when listen is not a loopback address")
+	}
+
+	return nil
+}
+
+// chunkCache applies the defaults of a gateway's chunk cache and parses
+// its size
+func chunkCache(cacheDir, dir, size string) (string, int64, error) {
+	if dir == "" {
+		dir = filepath.Join(cacheDir, "chunks")
+	}
+	if size == "" {
+		size = "2GB"
+	}
+	n, err := util.ParseSize(size)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid chunk_cache_size: %w", err)
+	}
+	return dir, n, nil
+}
+
+// isLoopback reports whether a listen address only accepts local connections
+func isLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcessingRules(t *testing.T) {
+	rules := []RuleConfig{
+		{Tag: "raw", SendAs: "document", MaxSize: "2GB"},
+		{Tag: "mobile", Transcode: "720p"},
+		{Tag: "catalog", Preview: "only"},
+		{Tag: "clips", PreviewMinDuration: "1m"},
+	}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			t.Fatalf("rules[%d]: %v", i, err)
+		}
+	}
+	cfg := MtprotoConfig{MaxSizeBytes: 20 << 20, Rules: rules}
+
+	if p := cfg.Processing("raw"); !p.AsDocument || p.MaxSizeBytes != 2<<30 {
+		t.Fatalf("raw: %+v", p)
+	}
+	if p := cfg.Processing("mobile"); p.AsDocument || p.TranscodeHeight != 720 || p.MaxSizeBytes != 20<<20 {
+		t.Fatalf("mobile: %+v", p)
+	}
+	if p := cfg.Processing("other"); p != (Processing{MaxSizeBytes: 20 << 20, Preview: "full"}) {
+		t.Fatalf("other: %+v", p)
+	}
+	if p := cfg.Processing("catalog"); p.Preview != "only" {
+		t.Fatalf("catalog: %+v", p)
+	}
+	if p := cfg.Processing("clips"); p.Preview != "full" || p.PreviewMinDuration != time.Minute {
+		t.Fatalf("clips: %+v", p)
+	}
+	cfg.ScrubThumbnails, cfg.ScrubIntervalDuration = true, 5*time.Second
+	if p := cfg.Processing("raw"); p.ScrubInterval != 5*time.Second {
+		t.Fatalf("raw with scrub_thumbnails: %+v", p)
+	}
+	cfg.PreviewFlag = "none"
+	if p := cfg.Processing("catalog"); p.Preview != "none" {
+		t.Fatalf("catalog with --preview none: %+v", p)
+	}
+
+	bad := RuleConfig{Tag: "x", Transcode: "hd"}
+	if err := bad.Validate(); err == nil {
+		t.Fatal("invalid transcode accepted")
+	}
+	bad = RuleConfig{Tag: "x", Preview: "some"}
+	if err := bad.Validate(); err == nil {
+		t.Fatal("invalid preview accepted")
+	}
+}
+
+func TestUploadTuning(t *testing.T) {
+	cfg := MtprotoConfig{}
+	if err := cfg.validateUpload(); err != nil || cfg.UploadPartSizeBytes != 512<<10 || cfg.UploadThreads != 1 {
+		t.Fatalf("defaults = %d bytes, %d threads, %v", cfg.UploadPartSizeBytes, cfg.UploadThreads, err)
+	}
+	cfg = MtprotoConfig{UploadPartSize: "128KB", UploadThreads: 8}
+	if err := cfg.validateUpload(); err != nil || cfg.UploadPartSizeBytes != 128<<10 {
+		t.Fatalf("128KB = %d, %v", cfg.UploadPartSizeBytes, err)
+	}
+	for _, size := range []string{"1MB", "384KB", "1000B"} {
+		cfg = MtprotoConfig{UploadPartSize: size}
+		if err := cfg.validateUpload(); err == nil {
+			t.Fatalf("part size %s accepted", size)
+		}
+	}
+}
+
+func TestScanOrder(t *testing.T) {
+	cfg := MtprotoConfig{ScanOrder: "Size desc"}
+	if err := cfg.parseScanOrder(); err != nil || cfg.ScanOrderBy != "size" || !cfg.ScanOrderDesc {
+		t.Fatalf("size desc = %q %v, %v", cfg.ScanOrderBy, cfg.ScanOrderDesc, err)
+	}
+	for _, order := range []string{"date", "mtime down", "mtime asc x"} {
+		cfg = MtprotoConfig{ScanOrder: order}
+		if err := cfg.parseScanOrder(); err == nil {
+			t.Errorf("scan_order %q accepted", order)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	cfg := RetentionConfig{Interval: "1d", Rules: []RetentionRule{{Tag: "#tmp", MaxAge: "30d"}, {KeepVersions: 3}}}
+	if err := cfg.Validate(); err != nil || cfg.IntervalDuration != 24*time.Hour || cfg.Rules[0].MaxAgeDuration != 720*time.Hour || cfg.Rules[0].Tag != "tmp" {
+		t.Fatalf("retention = %+v, %v", cfg, err)
+	}
+	for _, rule := range []RetentionRule{{Tag: "tmp"}, {MaxAge: "soon"}, {KeepVersions: -1}} {
+		cfg = RetentionConfig{Rules: []RetentionRule{rule}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("rule %+v accepted", rule)
+		}
+	}
+}
+
+func TestHTTPToken(t *testing.T) {
+	for _, tc := range []struct {
+		cfg HTTPConfig
+		ok  bool
+	}{
+		{HTTPConfig{Enabled: true}, true},
+		{HTTPConfig{Enabled: true, Listen: "localhost:8080"}, true},
+		{HTTPConfig{Enabled: true, Listen: "0.0.0.0:8080"}, false},
+		{HTTPConfig{Enabled: true, Listen: "0.0.0.0:8080", Token: "secret"}, true},
+		{HTTPConfig{Listen: "0.0.0.0:8080"}, true}, // only health checks
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%+v: err = %v", tc.cfg, err)
+		}
+	}
+}
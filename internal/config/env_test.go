@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("TG_MTPROTO_API_ID", "12345")
+	t.Setenv("TG_BOT_TOKEN", "bot-token")
+	t.Setenv("TG_HTTP_ENABLED", "true")
+	t.Setenv("TG_LOGGING_MAX_BACKUPS", "7")
+
+	cfg := Config{Bot: BotConfig{Token: "from-yaml"}}
+	if err := applyEnv(&cfg); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if cfg.Mtproto.APIID != 12345 || cfg.Bot.Token != "bot-token" || !cfg.HTTP.Enabled || cfg.Logging.MaxBackups != 7 {
+		t.Fatalf("overrides not applied: %+v", cfg)
+	}
+
+	t.Setenv("TG_MTPROTO_API_ID", "abc")
+	if err := applyEnv(&cfg); err == nil {
+		t.Fatal("invalid number accepted")
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// selectProfile removes the profiles section from raw and, if profile is
+// set, deep-merges that profile over the remaining settings. Mappings are
+// merged key by key; any other value in the profile replaces the base one.
+func selectProfile(raw []byte, profile string) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse yaml failed: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+
+	profiles, _ := doc["profiles"].(map[string]any)
+	delete(doc, "profiles")
+
+	if profile != "" {
+		p, ok := profiles[profile]
+		if !ok {
+			names := slices.Sorted(maps.Keys(profiles))
+			if len(names) == 0 {
+				return nil, fmt.Errorf("profile %q not found: config has no profiles section", profile)
+			}
+			return nil, fmt.Errorf("profile %q not found (available: %s)", profile, strings.Join(names, ", "))
+		}
+		overrides, ok := p.(map[string]any)
+		if !ok && p != nil {
+			return nil, fmt.Errorf("profile %q must be a mapping", profile)
+		}
+		mergeMaps(doc, overrides)
+	}
+
+	return yaml.Marshal(doc)
+}
+
+func mergeMaps(dst, src map[string]any) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]any)
+		dstMap, dstIsMap := dst[k].(map[string]any)
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
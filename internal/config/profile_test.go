@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func TestSelectProfile(t *testing.T) {
+	raw := []byte(`
+mtproto:
+  session_file: ./session.json
+  max_size: 20MB
+bot:
+  token: base
+profiles:
+  work:
+    mtproto:
+      session_file: ./work.json
+`)
+
+	out, err := selectProfile(raw, "work")
+	if err != nil {
+		t.Fatalf("selectProfile: %v", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(out, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mtproto.SessionFile != "./work.json" || cfg.Mtproto.MaxSize != "20MB" || cfg.Bot.Token != "base" {
+		t.Fatalf("profile not merged: %+v", cfg)
+	}
+
+	if _, err := selectProfile(raw, "missing"); err == nil {
+		t.Fatal("unknown profile accepted")
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Schedule queues uploads as scheduled messages instead of posting them
+// right away. It is set by the uploader's -schedule flags, not the config
+// file.
+type Schedule struct {
+	At    time.Time     // time of the first upload, zero to post immediately
+	Every time.Duration // gap between uploads, 0 posts them all at At
+}
+
+// Time returns when the i-th upload (from 0) of a run is posted
+func (s Schedule) Time(i int) time.Time {
+	if s.At.IsZero() {
+		return time.Time{}
+	}
+	return s.At.Add(time.Duration(i) * s.Every)
+}
+
+// ParseScheduleTime parses an absolute local time ("2006-01-02 15:04") or a
+// delay from now ("90m")
+func ParseScheduleTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("schedule delay must be positive, got %s", s)
+		}
+		return now.Add(d), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid schedule %q, want \"2006-01-02 15:04\" or a delay like 90m", s)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("schedule %s is in the past", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+
+	if at, err := ParseScheduleTime("90m", now); err != nil || !at.Equal(now.Add(90*time.Minute)) {
+		t.Fatalf("delay: %v, %v", at, err)
+	}
+	if at, err := ParseScheduleTime("2026-10-17 09:30", now); err != nil || !at.Equal(time.Date(2026, 10, 17, 9, 30, 0, 0, time.Local)) {
+		t.Fatalf("time: %v, %v", at, err)
+	}
+	for _, bad := range []string{"2026-10-16 11:00", "-1h", "tomorrow"} {
+		if _, err := ParseScheduleTime(bad, now); err == nil {
+			t.Fatalf("%q accepted", bad)
+		}
+	}
+
+	s := Schedule{At: now, Every: time.Hour}
+	if got := s.Time(2); !got.Equal(now.Add(2 * time.Hour)) {
+		t.Fatalf("Time(2) = %v", got)
+	}
+	if got := (Schedule{}).Time(2); !got.IsZero() {
+		t.Fatalf("unscheduled Time(2) = %v", got)
+	}
+}
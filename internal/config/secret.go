@@ -0,0 +1,50 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringService is the OS keyring service secrets are stored under
+const KeyringService = "tg-assistant"
+
+// keyringPrefix marks a value to look up in the OS keyring, e.g.
+// api_hash: keyring:api_hash
+const keyringPrefix = "keyring:"
+
+// resolveSecret returns the secret set inline (or as keyring:<name>), or
+// else read from file (Docker secrets style). Setting both is an error.
+func resolveSecret(name, value, file string) (string, error) {
+	if value != "" && file != "" {
+		return "", fmt.Errorf("set either %s or %s_file, not both", name, name)
+	}
+
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_file: %w", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if user, ok := strings.CutPrefix(value, keyringPrefix); ok {
+		secret, err := keyring.Get(KeyringService, user)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return "", fmt.Errorf("%s: %q not found in the OS keyring (store it with `cli config secret %s`)", name, user, user)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to read the OS keyring: %w", name, err)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
+
+// SetKeyringSecret stores a secret in the OS keyring for keyring:<name> values
+func SetKeyringSecret(name, secret string) error {
+	return keyring.Set(KeyringService, name, secret)
+}
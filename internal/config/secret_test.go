@@ -0,0 +1,24 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "api_hash")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := resolveSecret("api_hash", "", file); err != nil || got != "from-file" {
+		t.Fatalf("file: got %q, %v", got, err)
+	}
+	if got, err := resolveSecret("api_hash", "inline", ""); err != nil || got != "inline" {
+		t.Fatalf("inline: got %q, %v", got, err)
+	}
+	if _, err := resolveSecret("api_hash", "inline", file); err == nil {
+		t.Fatal("value and file both accepted")
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// SetStorageChatID writes chatID as mtproto.storage_chat_id of path, or of
+// the named profile. Only that line changes, so comments and layout stay.
+// It returns the value it replaced, if any.
+func SetStorageChatID(path, profile string, chatID int64) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	keys := []string{"mtproto", "storage_chat_id"}
+	if profile != "" {
+		keys = append([]string{"profiles", profile}, keys...)
+	}
+	out, old, err := setScalar(string(raw), keys, strconv.FormatInt(chatID, 10))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return old, os.WriteFile(path, []byte(out), info.Mode().Perm())
+}
+
+// setScalar sets the value at keys in the yaml document src by editing its
+// lines, adding the missing keys in block style
+func setScalar(src string, keys []string, value string) (string, string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		return "", "", fmt.Errorf("parse yaml failed: %w", err)
+	}
+	lines := strings.Split(src, "\n")
+
+	if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+		// Empty document: the keys start the file
+		return strings.Join(append(missingKeys(keys, 0, value), lines...), "\n"), "", nil
+	}
+	node := doc.Content[0]
+	for i, key := range keys {
+		if node.Kind != yaml.MappingNode || node.Style&yaml.FlowStyle != 0 {
+			return "", "", fmt.Errorf("%s must be a block mapping", strings.Join(keys[:i], "."))
+		}
+		var next *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key {
+				next = node.Content[j+1]
+			}
+		}
+		if next == nil {
+			// New top-level sections go at the end of the file, nested keys
+			// above the first key of their mapping
+			first := node.Content[0]
+			at := first.Line - 1
+			if i == 0 {
+				at = len(lines)
+				if lines[at-1] == "" {
+					at--
+				}
+			}
+			added := missingKeys(keys[i:], first.Column-1, value)
+			lines = append(lines[:at], append(added, lines[at:]...)...)
+			return strings.Join(lines, "\n"), "", nil
+		}
+		node = next
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return "", "", fmt.Errorf("%s must be a single-line value", strings.Join(keys, "."))
+	}
+	line := lines[node.Line-1]
+	start := node.Column - 1
+	end := len(line)
+	if node.LineComment != "" {
+		if c := strings.Index(line[start:], " #"); c >= 0 {
+			end = start + c
+		}
+	}
+	old := strings.TrimSpace(line[start:end])
+	lines[node.Line-1] = line[:start] + value + line[end:]
+	return strings.Join(lines, "\n"), old, nil
+}
+
+// missingKeys renders keys as nested block mappings ending in value
+func missingKeys(keys []string, indent int, value string) []string {
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = strings.Repeat(" ", indent+2*i) + key + ":"
+	}
+	lines[len(keys)-1] += " " + value
+	return lines
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetStorageChatID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	raw := `mtproto:
+  # where uploads go
+  storage_chat_id: ${CHAT_ID}
+  local_dir: ./in
+profiles:
+  work:
+    index:
+      path: ./work.json
+`
+	if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := SetStorageChatID(path, "", -1001234567890)
+	if err != nil || old != "${CHAT_ID}" {
+		t.Fatalf("SetStorageChatID = %q, %v", old, err)
+	}
+	if _, err := SetStorageChatID(path, "work", -1009876543210); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"  # where uploads go\n  storage_chat_id: -1001234567890\n  local_dir: ./in\n",
+		"    mtproto:\n      storage_chat_id: -1009876543210\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestSetScalarAddsKeys(t *testing.T) {
+	out, old, err := setScalar("bot:\n  token: x\n", []string{"mtproto", "storage_chat_id"}, "-1001")
+	if err != nil || old != "" || out != "bot:\n  token: x\nmtproto:\n  storage_chat_id: -1001\n" {
+		t.Fatalf("setScalar = %q, %q, %v", out, old, err)
+	}
+	out, _, err = setScalar("", []string{"mtproto", "storage_chat_id"}, "-1001")
+	if err != nil || out != "mtproto:\n  storage_chat_id: -1001\n" {
+		t.Fatalf("empty file: %q, %v", out, err)
+	}
+	out, old, err = setScalar("mtproto:\n  storage_chat_id: 5 # old\n", []string{"mtproto", "storage_chat_id"}, "-1001")
+	if err != nil || old != "5" || out != "mtproto:\n  storage_chat_id: -1001 # old\n" {
+		t.Fatalf("replace: %q, %q, %v", out, old, err)
+	}
+}
@@ -10,14 +10,16 @@ import (
 	"golang.org/x/net/proxy"
 )
 
-func CreateProxyDialerFromURL(proxyURL string) (proxy.ContextDialer, error) {
+// CreateProxyDialerFromURL returns a dialer through the proxy at proxyURL,
+// whose host is looked up with resolver (nil for the system resolver)
+func CreateProxyDialerFromURL(proxyURL string, resolver *Resolver) (proxy.ContextDialer, error) {
 	u, err := url.Parse(proxyURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid proxy URL: %w", err)
 	}
 
 	switch u.Scheme {
-	case "socks5":
+	case "socks5", "socks5h":
 		// SOCKS5 proxy
 		var auth *proxy.Auth
 		if u.User != nil {
@@ -28,7 +30,7 @@ func CreateProxyDialerFromURL(proxyURL string) (proxy.ContextDialer, error) {
 			}
 		}
 
-		dialer, err := proxy.SOCKS5("tcp", u.Host, auth, proxy.Direct)
+		dialer, err := proxy.SOCKS5("tcp", u.Host, auth, resolver)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create SOCKS5 dialer: %w", err)
 		}
@@ -40,6 +42,7 @@ func CreateProxyDialerFromURL(proxyURL string) (proxy.ContextDialer, error) {
 		// HTTP proxy
 		return &httpProxyDialer{
 			proxyURL: u,
+			resolver: resolver,
 		}, nil
 
 	default:
@@ -59,14 +62,12 @@ func (d *contextDialer) DialContext(ctx context.Context, network, addr string) (
 // httpProxyDialer implements proxy.ContextDialer for HTTP proxies
 type httpProxyDialer struct {
 	proxyURL *url.URL
+	resolver *Resolver
 }
 
 func (d *httpProxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
-	// Create a dialer with proxy
-	dialer := &net.Dialer{}
-
 	// First connect to proxy
-	proxyConn, err := dialer.DialContext(ctx, "tcp", d.proxyURL.Host)
+	proxyConn, err := d.resolver.DialContext(ctx, "tcp", d.proxyURL.Host)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
@@ -0,0 +1,188 @@
+package dialer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohMinTTL keeps answers with a tiny TTL from causing a lookup per dial
+const dohMinTTL = time.Minute
+
+// Resolver looks up host names with DNS-over-HTTPS (RFC 8484), for networks
+// where plain DNS answers for proxy hosts are forged. A nil Resolver uses
+// the system resolver.
+type Resolver struct {
+	url    string
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]dohAnswer
+}
+
+type dohAnswer struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewResolver returns a resolver asking dohURL, e.g.
+// https://1.1.1.1/dns-query. Its own host is looked up with the system
+// resolver, so an IP address avoids plain DNS entirely.
+func NewResolver(dohURL string) (*Resolver, error) {
+	u, err := url.Parse(dohURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid DNS-over-HTTPS URL %q, want https://<server>/<path>", dohURL)
+	}
+	return &Resolver{
+		url:    dohURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+		cache:  make(map[string]dohAnswer),
+	}, nil
+}
+
+// LookupHost returns the IPv4 addresses of host, or else its IPv6 ones
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if r == nil {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	r.mu.Lock()
+	a, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(a.expires) {
+		return a.addrs, nil
+	}
+
+	addrs, ttl, err := r.query(ctx, host, dnsmessage.TypeA)
+	if err == nil && len(addrs) == 0 {
+		addrs, ttl, err = r.query(ctx, host, dnsmessage.TypeAAAA)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DNS-over-HTTPS lookup of %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("DNS-over-HTTPS lookup of %s: no addresses", host)
+	}
+
+	r.mu.Lock()
+	r.cache[host] = dohAnswer{addrs: addrs, expires: time.Now().Add(max(ttl, dohMinTTL))}
+	r.mu.Unlock()
+	return addrs, nil
+}
+
+// query asks for the records of one type, returning their addresses and
+// the lowest TTL
+func (r *Resolver) query(ctx context.Context, host string, typ dnsmessage.Type) ([]string, time.Duration, error) {
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, 0, err
+	}
+	// ID 0 lets HTTP caches share answers, see RFC 8484 section 4.1
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	body, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("server returned %s", resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var answer dnsmessage.Message
+	if err := answer.Unpack(raw); err != nil {
+		return nil, 0, fmt.Errorf("invalid answer: %w", err)
+	}
+	if answer.RCode == dnsmessage.RCodeNameError {
+		return nil, 0, errors.New("no such host")
+	}
+	if answer.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("server answered %s", answer.RCode)
+	}
+	var addrs []string
+	var ttl time.Duration
+	for _, rr := range answer.Answers {
+		var ip net.IP
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = body.A[:]
+		case *dnsmessage.AAAAResource:
+			ip = body.AAAA[:]
+		default:
+			continue // e.g. the CNAMEs leading to them
+		}
+		addrs = append(addrs, ip.String())
+		if t := time.Duration(rr.Header.TTL) * time.Second; ttl == 0 || t < ttl {
+			ttl = t
+		}
+	}
+	return addrs, ttl, nil
+}
+
+// dnsName is host as a fully qualified name
+func dnsName(host string) string {
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		return host
+	}
+	return host + "."
+}
+
+// DialContext looks up the host of addr and connects to its addresses in
+// turn
+func (r *Resolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if r == nil {
+		return d.DialContext(ctx, network, addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, ip := range addrs {
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Dial is DialContext without a context, for proxy.Dialer
+func (r *Resolver) Dial(network, addr string) (net.Conn, error) {
+	return r.DialContext(context.Background(), network, addr)
+}
@@ -0,0 +1,67 @@
+package dialer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestResolver(t *testing.T) {
+	queries := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		body, _ := io.ReadAll(r.Body)
+		var q dnsmessage.Message
+		if r.Header.Get("Content-Type") != "application/dns-message" || q.Unpack(body) != nil || len(q.Questions) != 1 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		question := q.Questions[0]
+		answer := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		switch {
+		case question.Name.String() != "proxy.example.":
+			answer.RCode = dnsmessage.RCodeNameError
+		case question.Type == dnsmessage.TypeA:
+			answer.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+				Body:   &dnsmessage.AResource{A: [4]byte{203, 0, 113, 7}},
+			}}
+		}
+		out, _ := answer.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(out)
+	}))
+	defer srv.Close()
+
+	if _, err := NewResolver("http://1.1.1.1/dns-query"); err == nil {
+		t.Error("NewResolver accepted a plain HTTP URL")
+	}
+	r, err := NewResolver(srv.URL + "/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.client = srv.Client()
+
+	ctx := context.Background()
+	addrs, err := r.LookupHost(ctx, "proxy.example")
+	if err != nil || !slices.Equal(addrs, []string{"203.0.113.7"}) {
+		t.Fatalf("LookupHost = %v, %v, want 203.0.113.7", addrs, err)
+	}
+	if _, err := r.LookupHost(ctx, "proxy.example"); err != nil || queries != 1 {
+		t.Errorf("a cached name was asked again: %d queries, %v", queries, err)
+	}
+	if addrs, err := r.LookupHost(ctx, "192.0.2.1"); err != nil || addrs[0] != "192.0.2.1" || queries != 1 {
+		t.Errorf("an IP address was looked up: %v, %v", addrs, err)
+	}
+	if _, err := r.LookupHost(ctx, "missing.example"); err == nil {
+		t.Error("LookupHost of an unknown name succeeded")
+	}
+}
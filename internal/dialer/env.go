@@ -0,0 +1,87 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// getenv returns the upper or lower case variable, like curl
+func getenv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+// withScheme makes "host:port" a URL, as proxies are often given without
+// a scheme
+func withScheme(proxyURL string) string {
+	if proxyURL != "" && !strings.Contains(proxyURL, "://") {
+		return "http://" + proxyURL
+	}
+	return proxyURL
+}
+
+// EnvironmentProxy returns the proxy MTProto connections use when none is
+// configured: ALL_PROXY, or else HTTPS_PROXY. "" when neither is set.
+func EnvironmentProxy() string {
+	if v := getenv("ALL_PROXY"); v != "" {
+		return withScheme(v)
+	}
+	return withScheme(getenv("HTTPS_PROXY"))
+}
+
+// FromEnvironment returns a dialer through EnvironmentProxy that connects
+// directly to the hosts NO_PROXY lists, nil when no proxy is set. Host
+// names are looked up with resolver.
+func FromEnvironment(resolver *Resolver) (proxy.ContextDialer, error) {
+	proxyURL := EnvironmentProxy()
+	if proxyURL == "" {
+		return nil, nil
+	}
+	through, err := CreateProxyDialerFromURL(proxyURL, resolver)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &httpproxy.Config{HTTPSProxy: proxyURL, NoProxy: getenv("NO_PROXY")}
+	return &envDialer{through: through, direct: resolver, proxyFor: cfg.ProxyFunc()}, nil
+}
+
+// envDialer picks the proxy or a direct connection per address
+type envDialer struct {
+	through  proxy.ContextDialer
+	direct   *Resolver
+	proxyFor func(*url.URL) (*url.URL, error)
+}
+
+func (d *envDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if u, err := d.proxyFor(&url.URL{Scheme: "https", Host: addr}); err == nil && u == nil {
+		return d.direct.DialContext(ctx, network, addr)
+	}
+	return d.through.DialContext(ctx, network, addr)
+}
+
+// ProxyFromEnvironment is http.ProxyFromEnvironment that also falls back
+// to ALL_PROXY, for the Bot API clients
+func ProxyFromEnvironment(req *http.Request) (*url.URL, error) {
+	all := withScheme(getenv("ALL_PROXY"))
+	cfg := &httpproxy.Config{
+		HTTPProxy:  withScheme(getenv("HTTP_PROXY")),
+		HTTPSProxy: withScheme(getenv("HTTPS_PROXY")),
+		NoProxy:    getenv("NO_PROXY"),
+	}
+	if cfg.HTTPProxy == "" {
+		cfg.HTTPProxy = all
+	}
+	if cfg.HTTPSProxy == "" {
+		cfg.HTTPSProxy = all
+	}
+	return cfg.ProxyFunc()(req.URL)
+}
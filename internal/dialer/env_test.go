@@ -0,0 +1,57 @@
+package dialer
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestEnvironmentProxy(t *testing.T) {
+	for _, k := range []string{"ALL_PROXY", "all_proxy", "HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "NO_PROXY", "no_proxy"} {
+		t.Setenv(k, "")
+	}
+	if got := EnvironmentProxy(); got != "" {
+		t.Errorf("EnvironmentProxy() = %q without variables", got)
+	}
+	if d, err := FromEnvironment(nil); d != nil || err != nil {
+		t.Errorf("FromEnvironment() = %v, %v without variables", d, err)
+	}
+
+	t.Setenv("https_proxy", "127.0.0.1:3128")
+	if got := EnvironmentProxy(); got != "http://127.0.0.1:3128" {
+		t.Errorf("EnvironmentProxy() = %q, want https_proxy with a scheme", got)
+	}
+	t.Setenv("ALL_PROXY", "socks5://127.0.0.1:1080")
+	if got := EnvironmentProxy(); got != "socks5://127.0.0.1:1080" {
+		t.Errorf("EnvironmentProxy() = %q, want ALL_PROXY first", got)
+	}
+
+	t.Setenv("NO_PROXY", "149.154.160.0/20")
+	d, err := FromEnvironment(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := d.(*envDialer)
+	if u, _ := env.proxyFor(urlOf(t, "https://149.154.167.51:443")); u != nil {
+		t.Errorf("a NO_PROXY address goes through %v", u)
+	}
+	if u, _ := env.proxyFor(urlOf(t, "https://91.108.56.100:443")); u == nil {
+		t.Error("an address outside NO_PROXY goes direct")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.telegram.org/bot", nil)
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("https_proxy", "")
+	if u, err := ProxyFromEnvironment(req); err != nil || u == nil || u.String() != "socks5://127.0.0.1:1080" {
+		t.Errorf("ProxyFromEnvironment = %v, %v, want the ALL_PROXY fallback", u, err)
+	}
+}
+
+func urlOf(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package errs
+
+import "errors"
+
+// isDiskFull matches ErrDiskFull
+func isDiskFull(err error) bool {
+	return errors.Is(err, ErrDiskFull)
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package errs
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// isDiskFull matches ErrDiskFull and the errors Windows reports for a full
+// disk instead of ENOSPC
+func isDiskFull(err error) bool {
+	var errno syscall.Errno
+	if errors.As(err, &errno) && (errno == windows.ERROR_DISK_FULL || errno == windows.ERROR_HANDLE_DISK_FULL) {
+		return true
+	}
+	return errors.Is(err, ErrDiskFull)
+}
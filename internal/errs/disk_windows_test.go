@@ -0,0 +1,22 @@
+//go:build windows
+
+package errs
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestDiskFullWindows(t *testing.T) {
+	for _, errno := range []error{windows.ERROR_DISK_FULL, windows.ERROR_HANDLE_DISK_FULL} {
+		err := &os.PathError{Op: "write", Path: `C:\tmp\x`, Err: errno}
+		if got := ExitCode(err); got != ExitDiskFull {
+			t.Errorf("ExitCode(%v) = %d, want %d", err, got, ExitDiskFull)
+		}
+		if got := Category(err); got != "disk_full" {
+			t.Errorf("Category(%v) = %q, want disk_full", err, got)
+		}
+	}
+}
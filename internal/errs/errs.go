@@ -0,0 +1,95 @@
+// Package errs defines the failures that wrapper scripts can tell apart by
+// the exit code of the uploader and the cli, and that reports and metrics
+// group by category
+package errs
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	ErrAuthRequired = errors.New("telegram login required")
+	ErrFloodWait    = errors.New("telegram flood wait")
+	ErrPeerNotFound = errors.New("chat not found")
+	ErrFFmpegFailed = errors.New("ffmpeg failed")
+	ErrTooLarge     = errors.New("file too large")
+	ErrSessionInUse = errors.New("session file in use")
+	// ErrBroken means a file can't be uploaded as it is, retrying won't help
+	ErrBroken = errors.New("broken file")
+	// ErrDiskFull is what writes to a full disk fail with. Windows fails
+	// with its own codes, which ExitCode and Category match as well.
+	ErrDiskFull error = syscall.ENOSPC
+)
+
+// Exit codes; any other error exits with 1
+const (
+	ExitAuthRequired = 3 // log in again, retrying won't help
+	ExitFloodWait    = 4 // transient, retry later
+	ExitPeerNotFound = 5
+	ExitFFmpegFailed = 6
+	ExitTooLarge     = 7
+	ExitSessionInUse = 8 // another process runs with the session, retry later or pass --wait
+	ExitDiskFull     = 9 // free space in temp_dir or the download directory
+)
+
+// kinds is ordered by precedence, for errors that wrap several failures
+var kinds = []struct {
+	err      error
+	code     int
+	category string
+}{
+	{ErrAuthRequired, ExitAuthRequired, "auth"},
+	{ErrPeerNotFound, ExitPeerNotFound, "peer_missing"},
+	{ErrFloodWait, ExitFloodWait, "flood_wait"},
+	{ErrSessionInUse, ExitSessionInUse, "session_in_use"},
+	{ErrDiskFull, ExitDiskFull, "disk_full"},
+	{ErrFFmpegFailed, ExitFFmpegFailed, "ffmpeg"},
+	{ErrTooLarge, ExitTooLarge, "too_large"},
+	{ErrBroken, 1, "broken"},
+}
+
+// is reports whether err is target, with a full disk told apart per OS
+func is(err, target error) bool {
+	if target == ErrDiskFull {
+		return isDiskFull(err)
+	}
+	return errors.Is(err, target)
+}
+
+// ExitCode returns the process exit code for err, 0 for nil
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	for _, k := range kinds {
+		if is(err, k.err) {
+			return k.code
+		}
+	}
+	return 1
+}
+
+// Category names the kind of failure err is, "other" when it is none of
+// Categories and "" for nil. Telegram errors are only recognized once
+// client.Classify wrapped them.
+func Category(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, k := range kinds {
+		if is(err, k.err) {
+			return k.category
+		}
+	}
+	return "other"
+}
+
+// Categories lists what Category returns, by precedence
+func Categories() []string {
+	names := make([]string, 0, len(kinds)+1)
+	for _, k := range kinds {
+		names = append(names, k.category)
+	}
+	return append(names, "other")
+}
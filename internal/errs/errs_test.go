@@ -0,0 +1,47 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("boom"), 1},
+		{fmt.Errorf("upload: %w", ErrFloodWait), ExitFloodWait},
+		{fmt.Errorf("%w: exit status 1", ErrFFmpegFailed), ExitFFmpegFailed},
+		{fmt.Errorf("%w by PID 42", ErrSessionInUse), ExitSessionInUse},
+		{&os.PathError{Op: "write", Path: "/tmp/x", Err: syscall.ENOSPC}, ExitDiskFull},
+		// Auth problems win over transient failures of other files
+		{errors.Join(fmt.Errorf("a: %w", ErrFloodWait), fmt.Errorf("b: %w", ErrAuthRequired)), ExitAuthRequired},
+	} {
+		if got := ExitCode(tc.err); got != tc.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestCategory(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{errors.New("boom"), "other"},
+		{fmt.Errorf("%w: exit status 1", ErrFFmpegFailed), "ffmpeg"},
+		{fmt.Errorf("copy: %w", &os.PathError{Op: "write", Path: "/tmp/x", Err: syscall.ENOSPC}), "disk_full"},
+		{fmt.Errorf("%w: a.mp4 is empty", ErrBroken), "broken"},
+		{errors.Join(fmt.Errorf("a: %w", ErrTooLarge), fmt.Errorf("b: %w", ErrPeerNotFound)), "peer_missing"},
+	} {
+		if got := Category(tc.err); got != tc.want {
+			t.Errorf("Category(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Feed is the common subset of RSS 2.0 and Atom
+type Feed struct {
+	Title string
+	Items []Item
+}
+
+// Item is a feed entry with a downloadable enclosure
+type Item struct {
+	GUID         string
+	Title        string
+	EnclosureURL string
+}
+
+type rssDoc struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			GUID      string `xml:"guid"`
+			Title     string `xml:"title"`
+			Link      string `xml:"link"`
+			Enclosure struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomDoc struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Parse decodes an RSS 2.0 or Atom document. Items without an enclosure are
+// dropped.
+func Parse(data []byte) (*Feed, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid feed: %w", err)
+	}
+
+	switch root.XMLName.Local {
+	case "rss":
+		var doc rssDoc
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid rss feed: %w", err)
+		}
+		f := &Feed{Title: strings.TrimSpace(doc.Channel.Title)}
+		for _, it := range doc.Channel.Items {
+			if it.Enclosure.URL == "" {
+				continue
+			}
+			guid := strings.TrimSpace(it.GUID)
+			if guid == "" {
+				guid = it.Enclosure.URL
+			}
+			f.Items = append(f.Items, Item{
+				GUID:         guid,
+				Title:        strings.TrimSpace(it.Title),
+				EnclosureURL: it.Enclosure.URL,
+			})
+		}
+		return f, nil
+
+	case "feed":
+		var doc atomDoc
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid atom feed: %w", err)
+		}
+		f := &Feed{Title: strings.TrimSpace(doc.Title)}
+		for _, e := range doc.Entries {
+			for _, l := range e.Links {
+				if l.Rel != "enclosure" || l.Href == "" {
+					continue
+				}
+				guid := strings.TrimSpace(e.ID)
+				if guid == "" {
+					guid = l.Href
+				}
+				f.Items = append(f.Items, Item{
+					GUID:         guid,
+					Title:        strings.TrimSpace(e.Title),
+					EnclosureURL: l.Href,
+				})
+				break
+			}
+		}
+		return f, nil
+	}
+
+	return nil, fmt.Errorf("unsupported feed format: <%s>", root.XMLName.Local)
+}
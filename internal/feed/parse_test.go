@@ -0,0 +1,59 @@
+package feed
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		doc  string
+		want *Feed
+	}{
+		{
+			name: "rss",
+			doc: `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+  <title> My Podcast </title>
+  <item><guid>ep-2</guid><title>Episode 2</title><enclosure url="https://example.com/2.mp3" type="audio/mpeg"/></item>
+  <item><title>Episode 1</title><enclosure url="https://example.com/1.mp3"/></item>
+  <item><guid>post</guid><title>Show notes</title><link>https://example.com/notes</link></item>
+</channel></rss>`,
+			want: &Feed{Title: "My Podcast", Items: []Item{
+				{GUID: "ep-2", Title: "Episode 2", EnclosureURL: "https://example.com/2.mp3"},
+				{GUID: "https://example.com/1.mp3", Title: "Episode 1", EnclosureURL: "https://example.com/1.mp3"},
+			}},
+		},
+		{
+			name: "atom",
+			doc: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Video Channel</title>
+  <entry>
+    <id>urn:video:1</id><title>First</title>
+    <link rel="alternate" href="https://example.com/watch/1"/>
+    <link rel="enclosure" href="https://example.com/1.mp4"/>
+  </entry>
+  <entry><id>urn:video:2</id><title>Text only</title><link href="https://example.com/2"/></entry>
+</feed>`,
+			want: &Feed{Title: "Video Channel", Items: []Item{
+				{GUID: "urn:video:1", Title: "First", EnclosureURL: "https://example.com/1.mp4"},
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse([]byte(tc.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte(`<html><body/></html>`)); err == nil {
+		t.Error("html accepted as a feed")
+	}
+}
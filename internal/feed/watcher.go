@@ -0,0 +1,236 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fetch"
+	"tg-storage-assistant/internal/jobs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/pipeline"
+	"tg-storage-assistant/internal/util"
+	"tg-storage-assistant/internal/ytdlp"
+	"time"
+	"unicode"
+)
+
+// itemPayload is the payload of feed_item jobs
+type itemPayload struct {
+	Feed        string `json:"feed"`
+	URL         string `json:"url"`
+	Tag         string `json:"tag"`
+	Description string `json:"description"`
+}
+
+// Watcher polls the configured feeds and queues a job for every enclosure it
+// has not seen before
+type Watcher struct {
+	cfg      *config.FeedsConfig
+	dir      string // staging dir for downloads
+	pipeline *pipeline.Pipeline
+	jobs     *jobs.Queue
+
+	mu   sync.Mutex
+	seen map[string]map[string]bool // feed URL -> item GUIDs
+}
+
+func NewWatcher(cfg *config.FeedsConfig, stagingDir string, p *pipeline.Pipeline, queue *jobs.Queue) (*Watcher, error) {
+	w := &Watcher{
+		cfg:      cfg,
+		dir:      filepath.Join(stagingDir, "feeds"),
+		pipeline: p,
+		jobs:     queue,
+		seen:     make(map[string]map[string]bool),
+	}
+
+	data, err := os.ReadFile(cfg.StatePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read feed state: %w", err)
+	}
+	if err == nil {
+		var state map[string][]string
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse feed state %s: %w", cfg.StatePath, err)
+		}
+		for feedURL, guids := range state {
+			w.seen[feedURL] = make(map[string]bool, len(guids))
+			for _, guid := range guids {
+				w.seen[feedURL][guid] = true
+			}
+		}
+	}
+
+	queue.Register("feed_item", w.runItem)
+	return w, nil
+}
+
+// Run polls every feed on its own interval until ctx is canceled
+func (w *Watcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range w.cfg.Watch {
+		feed := &w.cfg.Watch[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(feed.IntervalDuration)
+			defer ticker.Stop()
+			for {
+				if err := w.poll(ctx, feed); err != nil {
+					logger.Warn.Printf("Feed %s: %v", feed.URL, err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Watcher) poll(ctx context.Context, fc *config.FeedConfig) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fc.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("fetch failed: %w", err)
+	}
+
+	f, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	tag := fc.Tag
+	if tag == "" {
+		tag = tagFromTitle(f.Title)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// On the first poll only the newest Backfill items are queued, the rest of
+	// the back catalogue is marked as seen
+	seen := w.seen[fc.URL]
+	first := seen == nil
+	if first {
+		seen = make(map[string]bool)
+		w.seen[fc.URL] = seen
+	}
+
+	queued := 0
+	for i, item := range f.Items {
+		if seen[item.GUID] {
+			continue
+		}
+		if first && i >= fc.Backfill {
+			seen[item.GUID] = true
+			continue
+		}
+		_, err := w.jobs.Submit("feed_item", itemPayload{
+			Feed:        fc.URL,
+			URL:         item.EnclosureURL,
+			Tag:         tag,
+			Description: ytdlp.Description(item.Title),
+		}, jobs.PriorityLow)
+		if err != nil {
+			return err
+		}
+		seen[item.GUID] = true
+		queued++
+	}
+
+	if first {
+		logger.Info.Printf("Feed %s: tracking %d existing item(s), queued %d", fc.URL, len(f.Items), queued)
+		return w.save()
+	}
+	if queued == 0 {
+		logger.Debug.Printf("Feed %s: no new items", fc.URL)
+		return nil
+	}
+	logger.Info.Printf("Feed %s: queued %d new item(s)", fc.URL, queued)
+	return w.save()
+}
+
+// runItem downloads an enclosure and uploads it with the feed tag
+func (w *Watcher) runItem(ctx context.Context, job *jobs.Job) ([]string, error) {
+	var payload itemPayload
+	if err := job.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	path, err := fetch.Download(ctx, payload.URL, w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := w.pipeline.WithContext(ctx).Upload(path, payload.Tag, payload.Description, "feed")
+	if err != nil {
+		return nil, err
+	}
+	if err := fetch.RemoveStaged(path); err != nil {
+		logger.Warn.Printf("Failed to remove %s: %v", path, err)
+	}
+	return []string{fmt.Sprintf("entry %d", entry.ID)}, nil
+}
+
+// save writes the seen GUIDs. Callers must hold w.mu.
+func (w *Watcher) save() error {
+	state := make(map[string][]string, len(w.seen))
+	for feedURL, guids := range w.seen {
+		for guid := range guids {
+			state[feedURL] = append(state[feedURL], guid)
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(w.cfg.StatePath); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := w.cfg.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return util.ReplaceFile(tmp, w.cfg.StatePath)
+}
+
+// tagFromTitle makes a hashtag-safe tag out of a feed title
+func tagFromTitle(title string) string {
+	tag := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, title)
+	tag = strings.Trim(tag, "_")
+	for strings.Contains(tag, "__") {
+		tag = strings.ReplaceAll(tag, "__", "_")
+	}
+	if tag == "" {
+		return "feed"
+	}
+	return tag
+}
@@ -0,0 +1,16 @@
+package feed
+
+import "testing"
+
+func TestTagFromTitle(t *testing.T) {
+	for title, want := range map[string]string{
+		"My Podcast":            "my_podcast",
+		"  Tech -- News! 2024 ": "tech_news_2024",
+		"Ünïcode Show":          "ünïcode_show",
+		"!!!":                   "feed",
+	} {
+		if got := tagFromTitle(title); got != want {
+			t.Errorf("tagFromTitle(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
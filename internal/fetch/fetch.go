@@ -0,0 +1,219 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/ui"
+)
+
+// Download fetches rawURL and returns the local file path.
+//
+// The file is staged in a subdirectory of dir derived from the URL, so two
+// URLs with the same file name never share a file; remove it with
+// RemoveStaged once uploaded. Data is written to "<name>.part" first; if
+// that file already exists the download resumes from its size using a
+// Range request.
+func Download(ctx context.Context, rawURL, dir string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+
+	sum := sha256.Sum256([]byte(rawURL))
+	dir = filepath.Join(dir, hex.EncodeToString(sum[:8]))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create download dir: %w", err)
+	}
+
+	// The final name may come from Content-Disposition, so probe with HEAD first
+	name := fileNameFromURL(u)
+	remoteSize := int64(-1)
+	if head, err := doRequest(ctx, http.MethodHead, rawURL, 0); err == nil {
+		head.Body.Close()
+		if n := fileNameFromResponse(head); n != "" {
+			name = n
+		}
+		if head.StatusCode == http.StatusOK {
+			remoteSize = head.ContentLength
+		}
+	}
+
+	dst := filepath.Join(dir, name)
+	if _, err := os.Stat(dst); err == nil {
+		logger.Info.Printf("Already downloaded: %s", dst)
+		return dst, nil
+	}
+
+	partPath := dst + ".part"
+	var offset int64
+	if fi, err := os.Stat(partPath); err == nil {
+		offset = fi.Size()
+	}
+
+	resp, err := doRequest(ctx, http.MethodGet, rawURL, offset)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			return "", restart(partPath, fmt.Errorf("unexpected Content-Range %q for offset %d",
+				resp.Header.Get("Content-Range"), offset))
+		}
+		if total >= 0 {
+			remoteSize = total
+		}
+		flags |= os.O_APPEND
+		logger.Info.Printf("Resuming %s at %d bytes", name, offset)
+	case http.StatusOK:
+		// Server ignored the range, start over
+		flags |= os.O_TRUNC
+		offset = 0
+		remoteSize = resp.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Either the part file is complete or it does not match the remote file
+		if _, total, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && total >= 0 {
+			remoteSize = total
+		}
+		if remoteSize < 0 || offset != remoteSize {
+			return "", restart(partPath, fmt.Errorf("partial download of %d bytes does not match remote size %d",
+				offset, remoteSize))
+		}
+		return dst, os.Rename(partPath, dst)
+	default:
+		return "", fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", partPath, err)
+	}
+
+	progress := ui.NewDownloadProgress(name, remoteSize, offset)
+	body := progress.ProxyReader(resp.Body)
+	n, err := io.Copy(f, body)
+	body.Close()
+	progress.Shutdown(err == nil)
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("download interrupted (run again to resume): %w", err)
+	}
+	if remoteSize >= 0 && offset+n != remoteSize {
+		return "", fmt.Errorf("download incomplete: got %d of %d bytes (run again to resume)", offset+n, remoteSize)
+	}
+
+	if err := os.Rename(partPath, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// RemoveStaged deletes a file returned by Download together with its
+// staging subdirectory
+func RemoveStaged(path string) error {
+	return os.RemoveAll(filepath.Dir(path))
+}
+
+// restart drops a part file that can't be resumed so the next run starts over
+func restart(partPath string, cause error) error {
+	if err := os.Remove(partPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%v; failed to remove part file: %w", cause, err)
+	}
+	return fmt.Errorf("%v; partial download discarded, run again to restart", cause)
+}
+
+// parseContentRange parses "bytes <start>-<end>/<total>" or "bytes */<total>".
+// total is -1 when the server reports it as unknown ("*"), start is -1 for
+// the unsatisfied form.
+func parseContentRange(v string) (start, total int64, err error) {
+	rest, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	rng, size, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+		}
+	}
+	if rng == "*" {
+		return -1, total, nil
+	}
+	first, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	return start, total, nil
+}
+
+func doRequest(ctx context.Context, method, rawURL string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func fileNameFromResponse(resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil {
+			if n := sanitize(params["filename"]); n != "" {
+				return n
+			}
+		}
+	}
+	return fileNameFromURL(resp.Request.URL)
+}
+
+func fileNameFromURL(u *url.URL) string {
+	if n := sanitize(path.Base(u.Path)); n != "" {
+		return n
+	}
+	return "download"
+}
+
+// sanitize keeps only the base name so a remote name can't escape the dir
+func sanitize(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,88 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// AudioInfo is what ffprobe reads from an audio file and its tags (ID3,
+// Vorbis comments of FLAC and Ogg, MP4 atoms)
+type AudioInfo struct {
+	Title    string
+	Artist   string
+	Album    string
+	Duration float64 // seconds
+	HasCover bool    // an embedded picture ExtractCover can write
+}
+
+// ProbeAudio reads the tags, duration and cover of an audio file
+func ProbeAudio(path string) (AudioInfo, error) {
+	cmd := exec.Command(
+		Binary("ffprobe"),
+		"-v", "quiet",
+		"-show_format",
+		"-show_streams",
+		"-of", "json",
+		path,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+
+	output, err := combinedOutput(cmd)
+	if err != nil {
+		return AudioInfo{}, fmt.Errorf("failed to probe audio: %w", err)
+	}
+	var probe struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType   string         `json:"codec_type"`
+			Disposition map[string]int `json:"disposition"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return AudioInfo{}, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	// Vorbis comments are usually upper case, ID3 frames lower case
+	tags := make(map[string]string, len(probe.Format.Tags))
+	for k, v := range probe.Format.Tags {
+		tags[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	info := AudioInfo{Title: tags["title"], Artist: tags["artist"], Album: tags["album"]}
+	if info.Artist == "" {
+		info.Artist = tags["album_artist"]
+	}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	for _, s := range probe.Streams {
+		if s.CodecType == "video" && s.Disposition["attached_pic"] == 1 {
+			info.HasCover = true
+		}
+	}
+	return info, nil
+}
+
+// ExtractCover writes the embedded cover of an audio file to outPath as a
+// JPEG of at most 320x320, the size Telegram takes for thumbnails
+func ExtractCover(path, outPath string) error {
+	cmd := exec.Command(
+		Binary("ffmpeg"),
+		"-i", path,
+		"-map", "0:v:0",
+		"-frames:v", "1",
+		"-vf", "scale=320:320:force_original_aspect_ratio=decrease",
+		"-q:v", "4",
+		"-y",
+		outPath,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+
+	if out, err := combinedOutput(cmd); err != nil {
+		return fmt.Errorf("failed to extract cover: %w\n%s", err, out)
+	}
+	return nil
+}
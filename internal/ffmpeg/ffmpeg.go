@@ -5,23 +5,109 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"tg-storage-assistant/internal/errs"
 	"tg-storage-assistant/internal/logger"
+	"time"
 )
 
-func SplitVideoByDuration(videoPath, outputPath string, beginDuration, maxSize int64) error {
-	cmd := exec.Command(
-		"ffmpeg",
-		"-i", videoPath,
+var log = logger.Named("ffmpeg")
+
+// spent is the total time ffmpeg and ffprobe ran, in nanoseconds
+var spent atomic.Int64
+
+// Elapsed returns how long ffmpeg and ffprobe have run in this process.
+// The difference of two calls times the processing of one file.
+func Elapsed() time.Duration {
+	return time.Duration(spent.Load())
+}
+
+// timed adds the time since start to Elapsed
+func timed(start time.Time) {
+	spent.Add(int64(time.Since(start)))
+}
+
+// binaries caches the commands Binary resolved
+var binaries sync.Map
+
+// Binary returns the command to run for name ("ffmpeg" or "ffprobe"): the
+// one in PATH, or else one next to this program, where Windows users often
+// unpack ffmpeg.exe
+func Binary(name string) string {
+	if path, ok := binaries.Load(name); ok {
+		return path.(string)
+	}
+	path := name
+	if _, err := exec.LookPath(name); err != nil {
+		if exe, err := os.Executable(); err == nil {
+			local := filepath.Join(filepath.Dir(exe), name)
+			if runtime.GOOS == "windows" {
+				local += ".exe"
+			}
+			if _, err := os.Stat(local); err == nil {
+				path = local
+			}
+		}
+	}
+	binaries.Store(name, path)
+	return path
+}
+
+// LookPath is exec.LookPath of the command Binary resolves name to
+func LookPath(name string) (string, error) {
+	return exec.LookPath(Binary(name))
+}
+
+// Available returns nil when both ffmpeg and ffprobe are found. Without
+// them only videos can't be processed; images and documents are sent as is.
+func Available() error {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := LookPath(name); err != nil {
+			return fmt.Errorf("%w: %s not found in PATH or next to the program", errs.ErrFFmpegFailed, name)
+		}
+	}
+	return nil
+}
+
+// Version returns the first line of "<binary> -version", e.g.
+// "ffmpeg version 6.1.1 Copyright ..."
+func Version(binary string) (string, error) {
+	out, err := exec.Command(binary, "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s -version failed: %w", binary, err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// SplitOptions adjust how SplitVideoByDuration cuts a part
+type SplitOptions struct {
+	// Generate missing timestamps and shift negative ones to 0, which
+	// some sources need for a part to start with a decodable frame
+	FixTimestamps bool
+	// Fraction of maxSize to stay under, e.g. 0.1 for a part of 90%
+	Shrink float64
+}
+
+func SplitVideoByDuration(videoPath, outputPath string, beginDuration, maxSize int64, opts SplitOptions) error {
+	args := []string{"-i", videoPath}
+	if opts.FixTimestamps {
+		args = []string{"-fflags", "+genpts", "-i", videoPath, "-avoid_negative_ts", "make_zero"}
+	}
+	args = append(args,
 		"-ss", strconv.FormatInt(beginDuration, 10),
-		"-fs", strconv.FormatInt(maxSize, 10),
+		"-fs", strconv.FormatInt(int64(float64(maxSize)*(1-opts.Shrink)), 10),
 		"-c", "copy", // Copy codec (no re-encoding)
 		"-y", // Overwrite output files
 		outputPath)
-	logger.Debug.Println("Command: ", cmd.String())
+	cmd := exec.Command(Binary("ffmpeg"), args...)
+	log.Debug.Println("Command: ", cmd.String())
 
-	_, err := cmd.CombinedOutput()
+	_, err := combinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("failed to split video: %w", err)
 	}
@@ -30,15 +116,15 @@ func SplitVideoByDuration(videoPath, outputPath string, beginDuration, maxSize i
 
 func GetVideoDurationSeconds(videoPath string) (int64, error) {
 	cmd := exec.Command(
-		"ffprobe",
+		Binary("ffprobe"),
 		"-v", "error",
 		"-show_entries", "format=duration",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		videoPath,
 	)
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutput(cmd)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get video duration: %w", err)
 	}
@@ -53,15 +139,15 @@ func GetVideoDurationSeconds(videoPath string) (int64, error) {
 
 func GetVideoBitrate(videoPath string) (int64, error) {
 	cmd := exec.Command(
-		"ffprobe",
+		Binary("ffprobe"),
 		"-v", "error",
 		"-show_entries", "format=bit_rate",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		videoPath,
 	)
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutput(cmd)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get video bitrate: %w", err)
 	}
@@ -76,7 +162,7 @@ func GetVideoBitrate(videoPath string) (int64, error) {
 
 func GenerateTSFiles(outputPath, tmpPattern string, segmentTime int64) error {
 	cmd := exec.Command(
-		"ffmpeg",
+		Binary("ffmpeg"),
 		"-hide_banner", "-loglevel", "info", "-i", outputPath,
 		"-c", "copy", "-map", "0",
 		"-f", "segment",
@@ -84,9 +170,9 @@ func GenerateTSFiles(outputPath, tmpPattern string, segmentTime int64) error {
 		"-reset_timestamps", "1",
 		tmpPattern,
 	)
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	_, err := cmd.CombinedOutput()
+	_, err := combinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("failed to generate TS files: %w", err)
 	}
@@ -95,14 +181,14 @@ func GenerateTSFiles(outputPath, tmpPattern string, segmentTime int64) error {
 
 func RemuxTSFile(tsFile, outMp4 string) error {
 	cmd := exec.Command(
-		"ffmpeg",
+		Binary("ffmpeg"),
 		"-hide_banner", "-loglevel", "info", "-i", tsFile,
 		"-c", "copy", "-bsf:a", "aac_adtstoasc",
 		outMp4,
 	)
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	_, err := cmd.CombinedOutput()
+	_, err := combinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("failed to remux TS file %s -> %s: %w", tsFile, outMp4, err)
 	}
@@ -111,14 +197,14 @@ func RemuxTSFile(tsFile, outMp4 string) error {
 
 func GetVideoDuration(videoPath string) (float64, error) {
 	cmd := exec.Command(
-		"ffprobe",
+		Binary("ffprobe"),
 		"-i", videoPath,
 		"-show_entries", "format=duration",
 		"-v", "quiet",
 		"-of", "default=noprint_wrappers=1:nokey=1")
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutput(cmd)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get video duration: %w", err)
 	}
@@ -131,18 +217,76 @@ func GetVideoDuration(videoPath string) (float64, error) {
 	return duration, nil
 }
 
+// CheckPlayable decodes the first and the last second of a video and
+// fails when ffmpeg reports any error doing so
+func CheckPlayable(videoPath string) error {
+	for _, check := range []struct{ input, output []string }{
+		{output: []string{"-t", "1"}},
+		{input: []string{"-sseof", "-1"}},
+	} {
+		args := append([]string{"-hide_banner", "-v", "error"}, check.input...)
+		args = append(args, "-i", videoPath)
+		args = append(args, check.output...)
+		cmd := exec.Command(Binary("ffmpeg"), append(args, "-f", "null", "-")...)
+		log.Debug.Println("Command: ", cmd.String())
+		out, err := combinedOutput(cmd)
+		said := strings.TrimSpace(string(out))
+		switch {
+		case err != nil && said != "":
+			return fmt.Errorf("%w: %s", err, said)
+		case err != nil:
+			return err
+		case said != "":
+			return fmt.Errorf("decoding errors: %s", said)
+		}
+	}
+	return nil
+}
+
+// ProbeDuration is GetVideoDuration telling what ffprobe said about a file
+// it can't read
+func ProbeDuration(videoPath string) (float64, error) {
+	cmd := exec.Command(
+		Binary("ffprobe"),
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		videoPath,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := run(cmd)
+	said := strings.TrimSpace(stderr.String())
+	if err != nil {
+		if said == "" {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w: %s", err, said)
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(stdout.String()), 64)
+	if err != nil {
+		if said != "" {
+			return 0, fmt.Errorf("no duration: %s", said)
+		}
+		return 0, fmt.Errorf("no duration: %q", strings.TrimSpace(stdout.String()))
+	}
+	return duration, nil
+}
+
 func GetVideoResolution(videoPath string) (int, int, error) {
 	cmd := exec.Command(
-		"ffprobe",
+		Binary("ffprobe"),
 		"-v", "error",
 		"-select_streams", "v:0",
 		"-show_entries", "stream=width,height",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		videoPath,
 	)
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutput(cmd)
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get video resolution: %w", err)
 	}
@@ -165,45 +309,157 @@ func GetVideoResolution(videoPath string) (int, int, error) {
 	return int(width), int(height), nil
 }
 
+// frameWorkers bounds the ffmpeg processes ExtractFrames runs at once
+var frameWorkers = min(runtime.NumCPU(), 8)
+
+// ExtractFrames saves count frames spread evenly over the video to
+// outputPath as frame_NNN.jpg and returns their paths in order
 func ExtractFrames(videoPath, outputPath string, totalDuration float64, count int) ([]string, error) {
+	framePaths := make([]string, count)
+	err := ExtractFramesFunc(videoPath, outputPath, totalDuration, count, func(i int, path string) error {
+		framePaths[i] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return framePaths, nil
+}
+
+// ExtractFramesFunc is ExtractFrames running several ffmpeg processes at
+// once and calling fn with each frame as soon as it is saved, from any of
+// its goroutines. The first error stops it; frames already saved are
+// removed then.
+func ExtractFramesFunc(videoPath, outputPath string, totalDuration float64, count int, fn func(i int, path string) error) error {
 	if totalDuration <= 0 {
-		return nil, fmt.Errorf("invalid video duration: %f", totalDuration)
+		return fmt.Errorf("invalid video duration: %f", totalDuration)
 	}
+	// Elapsed counts the wall time, not that of each process
+	defer timed(time.Now())
 
 	// Calculate timestamps for frame extraction
 	interval := totalDuration / float64(count)
-	var framePaths []string
-
-	for i := 0; i < count; i++ {
-		timestamp := interval * float64(i)
-		framePath := filepath.Join(outputPath, fmt.Sprintf("frame_%03d.jpg", i))
-
-		// Extract frame at timestamp
-		cmd := exec.Command(
-			"ffmpeg",
-			"-ss", fmt.Sprintf("%.2f", timestamp),
-			"-i", videoPath,
-			"-vframes", "1",
-			"-q:v", "2", // High quality
-			"-y", // Overwrite output files
-			framePath,
-		)
-		logger.Debug.Println("Command: ", cmd.String())
-
-		// Run ffmpeg with suppressed output
-		cmd.Stdout = nil
-		cmd.Stderr = nil
-
-		if err := cmd.Run(); err != nil {
-			// Clean up already extracted frames
-			for _, path := range framePaths {
-				os.Remove(path)
+	next := make(chan int)
+	var failed atomic.Bool
+	var mu sync.Mutex
+	var firstErr error
+	var saved []string
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		failed.Store(true)
+	}
+
+	var wg sync.WaitGroup
+	for range min(frameWorkers, count) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if failed.Load() {
+					continue
+				}
+				timestamp := interval * float64(i)
+				framePath := filepath.Join(outputPath, fmt.Sprintf("frame_%03d.jpg", i))
+
+				// Extract frame at timestamp
+				cmd := exec.Command(
+					Binary("ffmpeg"),
+					"-ss", fmt.Sprintf("%.2f", timestamp),
+					"-i", videoPath,
+					"-vframes", "1",
+					"-q:v", "2", // High quality
+					"-y", // Overwrite output files
+					framePath,
+				)
+				log.Debug.Println("Command: ", cmd.String())
+				if err := cmd.Run(); err != nil {
+					fail(fmt.Errorf("failed to extract frame %d: %w: %w", i, errs.ErrFFmpegFailed, err))
+					continue
+				}
+				mu.Lock()
+				saved = append(saved, framePath)
+				mu.Unlock()
+				if err := fn(i, framePath); err != nil {
+					fail(err)
+				}
 			}
-			return nil, fmt.Errorf("failed to extract frame %d: %w", i, err)
+		}()
+	}
+	for i := 0; i < count && !failed.Load(); i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		// Clean up already extracted frames
+		for _, path := range saved {
+			os.Remove(path)
 		}
+		return firstErr
+	}
+	return nil
+}
 
-		framePaths = append(framePaths, framePath)
+// SpriteSheets draws a frame of the video every interval seconds into
+// tiles width pixels wide, cols×rows of them to a sheet, and returns the
+// sheets, saved by outputPattern (e.g. "clip_sprites%02d.jpg") from 1. Only
+// keyframes are decoded, so a tile shows the keyframe closest to its time.
+func SpriteSheets(videoPath, outputPattern string, interval float64, width, cols, rows int) ([]string, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid sprite interval: %f", interval)
+	}
+	cmd := exec.Command(
+		Binary("ffmpeg"),
+		"-hide_banner", "-loglevel", "error",
+		"-skip_frame", "nokey",
+		"-i", videoPath,
+		"-an", "-sn",
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:-2,tile=%dx%d", interval, width, cols, rows),
+		"-q:v", "5",
+		"-start_number", "1",
+		"-y",
+		outputPattern,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+	if out, err := combinedOutput(cmd); err != nil {
+		return nil, fmt.Errorf("failed to generate sprite sheets: %w: %s", err, strings.TrimSpace(string(out)))
 	}
 
-	return framePaths, nil
+	var sheets []string
+	for i := 1; ; i++ {
+		path := fmt.Sprintf(outputPattern, i)
+		if _, err := os.Stat(path); err != nil {
+			break
+		}
+		sheets = append(sheets, path)
+	}
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("%w: no sprite sheets generated", errs.ErrFFmpegFailed)
+	}
+	return sheets, nil
+}
+
+// combinedOutput runs cmd like cmd.CombinedOutput, marking a failure as
+// errs.ErrFFmpegFailed
+func combinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	defer timed(time.Now())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%w: %w", errs.ErrFFmpegFailed, err)
+	}
+	return out, nil
+}
+
+// run runs cmd like cmd.Run, marking a failure as errs.ErrFFmpegFailed
+func run(cmd *exec.Cmd) error {
+	defer timed(time.Now())
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrFFmpegFailed, err)
+	}
+	return nil
 }
@@ -0,0 +1,131 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ColorInfo is how the first video stream of a file stores color
+type ColorInfo struct {
+	PixFmt    string // e.g. yuv420p10le
+	Transfer  string // e.g. smpte2084
+	Primaries string // e.g. bt2020
+}
+
+// HDR tells whether the video uses the PQ (HDR10, Dolby Vision) or HLG
+// transfer
+func (c ColorInfo) HDR() bool {
+	return c.Transfer == "smpte2084" || c.Transfer == "arib-std-b67"
+}
+
+// TenBit tells whether the video has more than 8 bits per sample
+func (c ColorInfo) TenBit() bool {
+	for _, depth := range []string{"p10", "p12", "p16", "10le", "10be", "12le", "12be"} {
+		if strings.Contains(c.PixFmt, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c ColorInfo) String() string {
+	return fmt.Sprintf("%s, %s transfer, %s primaries", c.PixFmt, c.Transfer, c.Primaries)
+}
+
+// ProbeColor reads the ColorInfo of videoPath
+func ProbeColor(videoPath string) (ColorInfo, error) {
+	cmd := exec.Command(
+		Binary("ffprobe"),
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=pix_fmt,color_transfer,color_primaries",
+		"-of", "default=noprint_wrappers=1",
+		videoPath,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+
+	output, err := combinedOutput(cmd)
+	if err != nil {
+		return ColorInfo{}, fmt.Errorf("failed to probe colors: %w", err)
+	}
+	var info ColorInfo
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "pix_fmt":
+			info.PixFmt = value
+		case "color_transfer":
+			info.Transfer = value
+		case "color_primaries":
+			info.Primaries = value
+		}
+	}
+	return info, nil
+}
+
+// HasFilter tells whether ffmpeg was built with the filter name
+func HasFilter(name string) bool {
+	cmd := exec.Command(Binary("ffmpeg"), "-hide_banner", "-filters")
+	output, err := combinedOutput(cmd)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// toneMapFilter maps HDR to 8-bit SDR in BT.709 with the hable curve
+const toneMapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+// ToneMap transcodes videoPath of color into outputDir as 8-bit H.264 in
+// BT.709, which Telegram clients show as intended: HDR is tone-mapped,
+// 10-bit SDR only loses its extra bits. height > 0 also scales it down
+// like ScaleToHeight.
+func ToneMap(videoPath, outputDir string, color ColorInfo, height int) (string, error) {
+	var filters []string
+	if height > 0 {
+		_, h, err := GetVideoResolution(videoPath)
+		if err != nil {
+			return "", err
+		}
+		if h > height {
+			filters = append(filters, fmt.Sprintf("scale=-2:%d", height))
+		}
+	}
+	if color.HDR() {
+		filters = append(filters, toneMapFilter)
+	} else {
+		filters = append(filters, "format=yuv420p")
+	}
+
+	base := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+	outputPath := filepath.Join(outputDir, base+".sdr.mp4")
+	cmd := exec.Command(
+		Binary("ffmpeg"),
+		"-y",
+		"-i", videoPath,
+		"-vf", strings.Join(filters, ","),
+		"-c:v", "libx264",
+		"-preset", "fast",
+		"-crf", "22",
+		"-color_primaries", "bt709",
+		"-color_trc", "bt709",
+		"-colorspace", "bt709",
+		"-c:a", "aac",
+		"-movflags", "+faststart",
+		outputPath,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+
+	out, err := combinedOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg tone mapping failed: %w, output: %s", err, string(out))
+	}
+	return outputPath, nil
+}
@@ -3,10 +3,12 @@ package ffmpeg
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/errs"
+	"time"
 )
 
 func EnsureMP4Compatible(videoPath, outputDir string) (string, error) {
@@ -58,15 +60,16 @@ func EnsureMP4Compatible(videoPath, outputDir string) (string, error) {
 }
 
 func probeCodecs(path string) (videoCodec, audioCodec string, err error) {
+	defer timed(time.Now())
 	vCmd := exec.Command(
-		"ffprobe",
+		Binary("ffprobe"),
 		"-v", "error",
 		"-select_streams", "v:0",
 		"-show_entries", "stream=codec_name",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		path,
 	)
-	logger.Debug.Println("Command: ", vCmd.String())
+	log.Debug.Println("Command: ", vCmd.String())
 
 	var vOut bytes.Buffer
 	vCmd.Stdout = &vOut
@@ -75,14 +78,14 @@ func probeCodecs(path string) (videoCodec, audioCodec string, err error) {
 	}
 
 	aCmd := exec.Command(
-		"ffprobe",
+		Binary("ffprobe"),
 		"-v", "error",
 		"-select_streams", "a:0",
 		"-show_entries", "stream=codec_name",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		path,
 	)
-	logger.Debug.Println("Command: ", aCmd.String())
+	log.Debug.Println("Command: ", aCmd.String())
 
 	var aOut bytes.Buffer
 	aCmd.Stdout = &aOut
@@ -91,7 +94,7 @@ func probeCodecs(path string) (videoCodec, audioCodec string, err error) {
 	}
 
 	if videoCodec == "" && audioCodec == "" {
-		return "", "", fmt.Errorf("no streams detected by ffprobe")
+		return "", "", fmt.Errorf("%w: no streams detected by ffprobe", errs.ErrFFmpegFailed)
 	}
 
 	return videoCodec, audioCodec, nil
@@ -109,16 +112,16 @@ func isCopyCompatible(vCodec, aCodec string) bool {
 
 func remuxToMP4(inputPath, outputPath string) error {
 	cmd := exec.Command(
-		"ffmpeg",
+		Binary("ffmpeg"),
 		"-y",
 		"-i", inputPath,
 		"-c", "copy",
 		"-movflags", "+faststart",
 		outputPath,
 	)
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	out, err := cmd.CombinedOutput()
+	out, err := combinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("ffmpeg remux failed: %w, output: %s", err, string(out))
 	}
@@ -127,7 +130,7 @@ func remuxToMP4(inputPath, outputPath string) error {
 
 func transcodeToMP4(inputPath, outputPath string) error {
 	cmd := exec.Command(
-		"ffmpeg",
+		Binary("ffmpeg"),
 		"-y",
 		"-i", inputPath,
 		"-c:v", "libx264",
@@ -137,11 +140,79 @@ func transcodeToMP4(inputPath, outputPath string) error {
 		"-movflags", "+faststart",
 		outputPath,
 	)
-	logger.Debug.Println("Command: ", cmd.String())
+	log.Debug.Println("Command: ", cmd.String())
 
-	out, err := cmd.CombinedOutput()
+	out, err := combinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("ffmpeg transcode failed: %w, output: %s", err, string(out))
 	}
 	return nil
 }
+
+// ScaleToHeight transcodes videoPath into outputDir so it is at most height
+// pixels high, keeping the aspect ratio. Smaller videos are returned as is.
+func ScaleToHeight(videoPath, outputDir string, height int) (string, error) {
+	_, h, err := GetVideoResolution(videoPath)
+	if err != nil {
+		return "", err
+	}
+	if h <= height {
+		return videoPath, nil
+	}
+
+	base := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s.%dp.mp4", base, height))
+	cmd := exec.Command(
+		Binary("ffmpeg"),
+		"-y",
+		"-i", videoPath,
+		"-vf", fmt.Sprintf("scale=-2:%d", height),
+		"-c:v", "libx264",
+		"-preset", "fast",
+		"-crf", "22",
+		"-c:a", "aac",
+		"-movflags", "+faststart",
+		outputPath,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+
+	out, err := combinedOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg scale failed: %w, output: %s", err, string(out))
+	}
+	return outputPath, nil
+}
+
+// Concat joins video parts into outPath without re-encoding. The parts
+// must share their codecs, like the parts SplitVideoByDuration writes.
+func Concat(parts []string, outPath string) error {
+	var list strings.Builder
+	for _, p := range parts {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		// The list quotes paths in single quotes
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	listPath := outPath + ".txt"
+	if err := os.WriteFile(listPath, []byte(list.String()), 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(listPath)
+
+	cmd := exec.Command(
+		Binary("ffmpeg"),
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-c", "copy",
+		"-y",
+		outPath,
+	)
+	log.Debug.Println("Command: ", cmd.String())
+	if out, err := combinedOutput(cmd); err != nil {
+		return fmt.Errorf("failed to join %d parts: %w\n%s", len(parts), err, out)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/errs"
+	"time"
+)
+
+// StreamPart is one part of a video for StreamMP4
+type StreamPart struct {
+	Start float64               // seconds into the whole video
+	Write func(io.Writer) error // writes the part as it downloads
+}
+
+// StreamMP4 writes the parts of a video to out as one fragmented MP4 that
+// browsers play while it arrives. Each part is remuxed to MPEG-TS with its
+// timestamps moved to its start and fed to the ffmpeg writing out, so
+// nothing is stored locally. With transcode, the video is re-encoded to
+// H.264 and AAC for codecs browsers can't play, otherwise streams are
+// copied. Parts must be MP4 with the index first (+faststart), like those
+// ProcessVideo uploads.
+func StreamMP4(ctx context.Context, parts []StreamPart, out io.Writer, transcode bool) error {
+	defer timed(time.Now())
+
+	codecs := []string{"-c", "copy"}
+	if transcode {
+		codecs = []string{"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-c:a", "aac"}
+	}
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-f", "mpegts", "-i", "pipe:0"}, codecs...)
+	args = append(args, "-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4", "pipe:1")
+	mux := exec.CommandContext(ctx, Binary("ffmpeg"), args...)
+	var muxErr bytes.Buffer
+	mux.Stdout, mux.Stderr = out, &muxErr
+	in, err := mux.StdinPipe()
+	if err != nil {
+		return err
+	}
+	log.Debug.Println("Command: ", mux.String())
+	if err := mux.Start(); err != nil {
+		return err
+	}
+
+	for i, part := range parts {
+		if err = remuxPart(ctx, part, in); err != nil {
+			err = fmt.Errorf("part %d: %w", i+1, err)
+			break
+		}
+	}
+	in.Close()
+	if waitErr := mux.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("%w: %w: %s", errs.ErrFFmpegFailed, waitErr, strings.TrimSpace(muxErr.String()))
+	}
+	return err
+}
+
+// remuxPart writes part to out as MPEG-TS
+func remuxPart(ctx context.Context, part StreamPart, out io.Writer) error {
+	cmd := exec.CommandContext(ctx, Binary("ffmpeg"),
+		"-hide_banner", "-loglevel", "error",
+		"-i", "pipe:0",
+		"-map", "0:v:0", "-map", "0:a?",
+		"-c", "copy",
+		"-output_ts_offset", strconv.FormatFloat(part.Start, 'f', 3, 64),
+		"-f", "mpegts", "pipe:1",
+	)
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = pr, out, &stderr
+	log.Debug.Println("Command: ", cmd.String())
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		err := part.Write(pw)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	err := cmd.Wait()
+	// Stops the download when ffmpeg quit early
+	pr.CloseWithError(io.ErrClosedPipe)
+	if writeErr := <-written; writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w: %s", errs.ErrFFmpegFailed, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
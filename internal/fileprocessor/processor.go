@@ -1,18 +1,132 @@
 package fileprocessor
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/util"
+	"time"
 )
 
 // Stats tracks processing statistics
 type Stats struct {
-	Processed int
-	Succeeded int
-	Failed    int
+	Processed  int            `json:"processed"`
+	Succeeded  int            `json:"succeeded"`
+	Skipped    int            `json:"skipped"` // already in the storage chat
+	Failed     int            `json:"failed"`
+	Failures   []Failure      `json:"failures,omitempty"`
+	Categories map[string]int `json:"categories,omitempty"` // failures by errs.Category
+	Files      []FileStat     `json:"files,omitempty"`      // uploaded files, in order
+	Warnings   []string       `json:"warnings,omitempty"`
+}
+
+// Failure records why a file was not uploaded
+type Failure struct {
+	File string
+	Err  error
+}
+
+// MarshalJSON reports the error as its message and category
+func (f Failure) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File     string `json:"file"`
+		Error    string `json:"error"`
+		Category string `json:"category"`
+	}{f.File, f.Err.Error(), errs.Category(f.Err)})
+}
+
+// FileStat is the timing of one uploaded file. Upload is the time spent
+// outside ffmpeg: reading the file and sending it.
+type FileStat struct {
+	File   string        `json:"file"`
+	Bytes  int64         `json:"bytes"`
+	Upload time.Duration `json:"upload_ns"`
+	FFmpeg time.Duration `json:"ffmpeg_ns"`
+}
+
+// Speed is the upload throughput in bytes per second
+func (f FileStat) Speed() float64 {
+	if f.Upload <= 0 {
+		return 0
+	}
+	return float64(f.Bytes) / f.Upload.Seconds()
+}
+
+// Uploaded records the size of a sent file, the time it took in total and
+// how much of that ffmpeg ran
+func (s *Stats) Uploaded(file string, bytes int64, took, ffmpeg time.Duration) {
+	s.Files = append(s.Files, FileStat{File: file, Bytes: bytes, Upload: max(took-ffmpeg, 0), FFmpeg: ffmpeg})
+}
+
+// Throughput sums the uploaded files: bytes, upload and ffmpeg time, and
+// the average and peak per-file speed in bytes per second
+func (s *Stats) Throughput() (bytes int64, upload, ffmpeg time.Duration, avg, peak float64) {
+	for _, f := range s.Files {
+		bytes += f.Bytes
+		upload += f.Upload
+		ffmpeg += f.FFmpeg
+		peak = max(peak, f.Speed())
+	}
+	if upload > 0 {
+		avg = float64(bytes) / upload.Seconds()
+	}
+	return bytes, upload, ffmpeg, avg, peak
+}
+
+// Fail counts a failed file and remembers the reason
+func (s *Stats) Fail(file string, err error) {
+	s.Failed++
+	s.Failures = append(s.Failures, Failure{File: file, Err: err})
+	if s.Categories == nil {
+		s.Categories = make(map[string]int)
+	}
+	s.Categories[errs.Category(err)]++
+}
+
+// Summary renders the statistics as a short multi-line report
+func (s *Stats) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Processed: %d, succeeded: %d, failed: %d", s.Processed, s.Succeeded, s.Failed)
+	if s.Failed > 0 {
+		var counts []string
+		for _, c := range errs.Categories() {
+			if n := s.Categories[c]; n > 0 {
+				counts = append(counts, fmt.Sprintf("%s %d", c, n))
+			}
+		}
+		fmt.Fprintf(&b, " (%s)", strings.Join(counts, ", "))
+	}
+	if s.Skipped > 0 {
+		fmt.Fprintf(&b, ", skipped: %d", s.Skipped)
+	}
+	if len(s.Files) > 0 {
+		bytes, upload, ffmpeg, avg, peak := s.Throughput()
+		fmt.Fprintf(&b, "\nUploaded %s in %s (avg %s/s, peak %s/s), ffmpeg: %s",
+			util.FormatBytesToHumanReadable(bytes), upload.Round(100*time.Millisecond),
+			util.FormatBytesToHumanReadable(int64(avg)), util.FormatBytesToHumanReadable(int64(peak)),
+			ffmpeg.Round(100*time.Millisecond))
+		for _, f := range s.Files {
+			fmt.Fprintf(&b, "\n+ %s: %s in %s (%s/s), ffmpeg: %s", f.File,
+				util.FormatBytesToHumanReadable(f.Bytes), f.Upload.Round(100*time.Millisecond),
+				util.FormatBytesToHumanReadable(int64(f.Speed())), f.FFmpeg.Round(100*time.Millisecond))
+		}
+	}
+	for _, f := range s.Failures {
+		fmt.Fprintf(&b, "\n- %s [%s]: %v", f.File, errs.Category(f.Err), f.Err)
+	}
+	for _, w := range s.Warnings {
+		fmt.Fprintf(&b, "\n! %s", w)
+	}
+	return b.String()
 }
 
 // Processor handles file scanning, parsing, and moving
@@ -49,6 +163,81 @@ func (p *Processor) ScanFiles() ([]string, error) {
 	return files, nil
 }
 
+// SortFiles orders files by "name", "mtime" or "size", descending when
+// desc is set. Equal keys keep name order; files that can't be read go last.
+func (p *Processor) SortFiles(files []string, by string, desc bool) {
+	key := func(name string) (int64, bool) {
+		info, err := os.Stat(p.GetFilePath(name))
+		if err != nil {
+			return 0, false
+		}
+		if by == "size" {
+			return info.Size(), true
+		}
+		return info.ModTime().UnixNano(), true
+	}
+
+	sort.Strings(files)
+	if by != "mtime" && by != "size" {
+		if desc {
+			slices.Reverse(files)
+		}
+		return
+	}
+	keys := make(map[string]int64, len(files))
+	var unreadable []string
+	readable := files[:0:0]
+	for _, name := range files {
+		if k, ok := key(name); ok {
+			keys[name] = k
+			readable = append(readable, name)
+		} else {
+			unreadable = append(unreadable, name)
+		}
+	}
+	sort.SliceStable(readable, func(i, j int) bool {
+		if desc {
+			return keys[readable[i]] > keys[readable[j]]
+		}
+		return keys[readable[i]] < keys[readable[j]]
+	})
+	copy(files, append(readable, unreadable...))
+}
+
+// StableFiles waits d and splits files into those unchanged in size and
+// modification time since, and those still being written. A zero d returns
+// all files as stable; files that vanish are dropped.
+func (p *Processor) StableFiles(ctx context.Context, files []string, d time.Duration) (stable, busy []string, err error) {
+	if d <= 0 || len(files) == 0 {
+		return files, nil, nil
+	}
+
+	before := make(map[string]os.FileInfo, len(files))
+	for _, name := range files {
+		if info, err := os.Stat(p.GetFilePath(name)); err == nil {
+			before[name] = info
+		}
+	}
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	for _, name := range files {
+		info, err := os.Stat(p.GetFilePath(name))
+		if err != nil {
+			continue
+		}
+		if old, ok := before[name]; ok && old.Size() == info.Size() && old.ModTime().Equal(info.ModTime()) {
+			stable = append(stable, name)
+		} else {
+			busy = append(busy, name)
+		}
+	}
+	return stable, busy, nil
+}
+
 // ParseFilename extracts tag and description from filename
 // Format: TAG_DESCRIPTION.extension
 // Returns: tag, description, error
@@ -72,11 +261,112 @@ func ParseFilename(filename string) (string, string, error) {
 	return tag, description, nil
 }
 
+// BuildCaption builds the album caption: #TAG DESCRIPTION (underscores as spaces)
+func BuildCaption(tag, description string) string {
+	return fmt.Sprintf("#%s %s", tag, strings.ReplaceAll(description, "_", " "))
+}
+
+// The caption line ModTimeLine adds starts with modTimePrefix
+const (
+	modTimePrefix = "🕓 "
+	modTimeLayout = "2006-01-02 15:04:05 -07:00"
+)
+
+// ModTimeLine is the caption line recording the modification time of the
+// original file, e.g. "\n🕓 2024-05-03 14:22:05 +02:00"
+func ModTimeLine(t time.Time) string {
+	return "\n" + modTimePrefix + t.Format(modTimeLayout)
+}
+
+// CaptionModTime reads the time ModTimeLine added to caption, zero when
+// there is none
+func CaptionModTime(caption string) time.Time {
+	for _, line := range strings.Split(caption, "\n") {
+		if rest, ok := strings.CutPrefix(line, modTimePrefix); ok {
+			if t, err := time.Parse(modTimeLayout, rest); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// TotalSize sums the sizes of files in the local directory, skipping
+// those that are gone
+func (p *Processor) TotalSize(files []string) int64 {
+	var total int64
+	for _, name := range files {
+		if info, err := os.Stat(p.GetFilePath(name)); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
 // GetFilePath returns the full path to a file in the local directory
 func (p *Processor) GetFilePath(filename string) string {
 	return filepath.Join(p.localDir, filename)
 }
 
+// NoteType returns "voice" for *.voice.ogg and "video_note" for *.round.mp4
+// files, which are sent as voice and round video messages, or ""
+func NoteType(filename string) string {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".voice.ogg"):
+		return "voice"
+	case strings.HasSuffix(name, ".round.mp4"):
+		return "video_note"
+	default:
+		return ""
+	}
+}
+
+// SHA256 returns the hex SHA-256 of the file at path
+func SHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WithoutVideos filters the videos out of files, in place, and returns how
+// many there were
+func WithoutVideos(files []string) ([]string, int) {
+	rest := files[:0]
+	for _, name := range files {
+		if !IsVideoFile(name) {
+			rest = append(rest, name)
+		}
+	}
+	return rest, len(files) - len(rest)
+}
+
+// IsImageFile checks if a file can be sent as a photo based on extension
+func IsImageFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".webp", ".heic", ".heif":
+		return true
+	}
+	return false
+}
+
+// IsAudioFile checks if a file is music based on extension
+func IsAudioFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mp3", ".m4a", ".flac", ".ogg", ".opus", ".wav", ".aac":
+		return true
+	}
+	return false
+}
+
 // IsVideoFile checks if a file is a video based on extension
 func IsVideoFile(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
@@ -0,0 +1,172 @@
+package fileprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/errs"
+	"time"
+)
+
+func TestStatsThroughput(t *testing.T) {
+	s := &Stats{Processed: 3, Succeeded: 2}
+	s.Uploaded("a.mp4", 10_000_000, 3*time.Second, time.Second)
+	s.Uploaded("b.mp4", 30_000_000, 3*time.Second, 0)
+	s.Fail("c.mp4", errors.New("flood wait"))
+
+	bytes, upload, ffmpeg, avg, peak := s.Throughput()
+	if bytes != 40_000_000 || upload != 5*time.Second || ffmpeg != time.Second {
+		t.Fatalf("totals = %d bytes, upload %s, ffmpeg %s", bytes, upload, ffmpeg)
+	}
+	if avg != 8_000_000 || peak != 10_000_000 {
+		t.Fatalf("avg = %.0f, peak = %.0f", avg, peak)
+	}
+	if summary := s.Summary(); !strings.Contains(summary, "avg 8.00 MB/s, peak 10.00 MB/s") ||
+		!strings.Contains(summary, "+ a.mp4: 10.00 MB in 2s (5.00 MB/s), ffmpeg: 1s") {
+		t.Fatalf("summary:\n%s", summary)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"error":"flood wait"`) || !strings.Contains(string(data), `"upload_ns":2000000000`) {
+		t.Fatalf("json = %s", data)
+	}
+}
+
+func TestStatsCategories(t *testing.T) {
+	s := &Stats{Processed: 3}
+	s.Fail("a.mp4", fmt.Errorf("split: %w", errs.ErrFFmpegFailed))
+	s.Fail("b.mp4", fmt.Errorf("%w: too many parts", errs.ErrTooLarge))
+	s.Fail("c.mp4", fmt.Errorf("%w: %w", errs.ErrFFmpegFailed, errs.ErrDiskFull))
+
+	if s.Categories["ffmpeg"] != 1 || s.Categories["too_large"] != 1 || s.Categories["disk_full"] != 1 {
+		t.Fatalf("categories = %v", s.Categories)
+	}
+	if summary := s.Summary(); !strings.Contains(summary, "failed: 3 (disk_full 1, ffmpeg 1, too_large 1)") ||
+		!strings.Contains(summary, "- b.mp4 [too_large]: file too large: too many parts") {
+		t.Fatalf("summary:\n%s", summary)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"category":"disk_full"`) || !strings.Contains(string(data), `"categories":{`) {
+		t.Fatalf("json = %s", data)
+	}
+}
+
+func TestStableFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_done.mp4", "b_copying.mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewProcessor(dir, t.TempDir())
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f, err := os.OpenFile(filepath.Join(dir, "b_copying.mp4"), os.O_APPEND|os.O_WRONLY, 0)
+		if err == nil {
+			f.WriteString("more")
+			f.Close()
+		}
+	}()
+	stable, busy, err := p.StableFiles(context.Background(), []string{"a_done.mp4", "b_copying.mp4"}, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stable, []string{"a_done.mp4"}) || !slices.Equal(busy, []string{"b_copying.mp4"}) {
+		t.Fatalf("stable = %v, busy = %v", stable, busy)
+	}
+}
+
+func TestSanitizeTag(t *testing.T) {
+	for _, tt := range []struct {
+		tag   string
+		ascii bool
+		want  string
+	}{
+		{"trips", false, "trips"},
+		{"Home Videos", false, "Home_Videos"},
+		{"🎬 movies/2024 ", false, "movies_2024"},
+		{"Café Müller", false, "Café_Müller"},
+		{"Café Müller", true, "Cafe_Mueller"},
+		{"Кино", true, "Kino"},
+		{"2024", false, "_2024"},
+		{"🎉", false, ""},
+	} {
+		if got := SanitizeTag(tt.tag, tt.ascii); got != tt.want {
+			t.Errorf("SanitizeTag(%q, %v) = %q, want %q", tt.tag, tt.ascii, got, tt.want)
+		}
+	}
+}
+
+func TestCaptionModTime(t *testing.T) {
+	mtime := time.Date(2024, 5, 3, 14, 22, 5, 0, time.FixedZone("", 2*3600))
+	caption := BuildCaption("trip", "beach") + "\n📅 2024-05-03 14:20" + ModTimeLine(mtime)
+	if !strings.HasSuffix(caption, "\n🕓 2024-05-03 14:22:05 +02:00") {
+		t.Fatalf("caption = %q", caption)
+	}
+	if got := CaptionModTime(caption); !got.Equal(mtime) {
+		t.Errorf("CaptionModTime = %v, want %v", got, mtime)
+	}
+	if got := CaptionModTime("#trip beach"); !got.IsZero() {
+		t.Errorf("CaptionModTime without the line = %v", got)
+	}
+}
+
+func TestSortFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, f := range []struct {
+		name string
+		size int
+		age  time.Duration
+	}{{"a.mp4", 30, time.Hour}, {"b.mp4", 10, 3 * time.Hour}, {"c.mp4", 20, 2 * time.Hour}} {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, make([]byte, f.size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now, now.Add(-f.age)); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	p := NewProcessor(dir, t.TempDir())
+
+	for _, tt := range []struct {
+		by   string
+		desc bool
+		want []string
+	}{
+		{"name", true, []string{"c.mp4", "b.mp4", "a.mp4"}},
+		{"mtime", false, []string{"b.mp4", "c.mp4", "a.mp4"}},
+		{"size", true, []string{"a.mp4", "c.mp4", "b.mp4"}},
+		{"size", false, []string{"b.mp4", "c.mp4", "a.mp4", "gone.mp4"}},
+	} {
+		files := []string{"a.mp4", "b.mp4", "c.mp4"}
+		if len(tt.want) == 4 {
+			files = append(files, "gone.mp4")
+		}
+		p.SortFiles(files, tt.by, tt.desc)
+		if !slices.Equal(files, tt.want) {
+			t.Errorf("%s desc=%v: %v, want %v", tt.by, tt.desc, files, tt.want)
+		}
+	}
+}
+
+func TestWithoutVideos(t *testing.T) {
+	files, skipped := WithoutVideos([]string{"a.mp4", "b.jpg", "c.MKV", "d.pdf"})
+	if skipped != 2 || strings.Join(files, ",") != "b.jpg,d.pdf" {
+		t.Fatalf("WithoutVideos = %v, %d", files, skipped)
+	}
+}
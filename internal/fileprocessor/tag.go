@@ -0,0 +1,75 @@
+package fileprocessor
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxTagLength keeps hashtags readable; Telegram links longer ones too
+const maxTagLength = 64
+
+// SanitizeTag turns tag into a valid Telegram hashtag: letters, digits and
+// underscores, not all digits. Anything else (spaces, emoji, slashes) becomes
+// a single "_". With ascii, accented Latin, Cyrillic and Greek letters are
+// transliterated first.
+func SanitizeTag(tag string, ascii bool) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range tag {
+		if ascii {
+			if s, ok := translit[unicode.ToLower(r)]; ok {
+				if unicode.IsUpper(r) && s != "" {
+					s = strings.ToUpper(s[:1]) + s[1:]
+				}
+				b.WriteString(s)
+				underscore = false
+				continue
+			}
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+		// Combining accents are dropped, other runs become one "_"
+		if unicode.IsMark(r) || underscore || b.Len() == 0 {
+			continue
+		}
+		b.WriteByte('_')
+		underscore = true
+	}
+
+	out := []rune(strings.TrimRight(b.String(), "_"))
+	if len(out) > maxTagLength {
+		out = []rune(strings.TrimRight(string(out[:maxTagLength]), "_"))
+	}
+	if strings.IndexFunc(string(out), func(r rune) bool { return !unicode.IsDigit(r) }) < 0 && len(out) > 0 {
+		// "#2024" is not linked as a hashtag
+		return "_" + string(out)
+	}
+	return string(out)
+}
+
+// translit maps lower case letters to ASCII
+var translit = map[rune]string{
+	// Latin
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "ae", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "oe", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "ue", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i",
+	'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s",
+	'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+}
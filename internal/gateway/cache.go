@@ -0,0 +1,250 @@
+package gateway
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// fileCache keeps downloaded message media on disk, keyed by chat and
+// message, or chunks of it keyed by chat, message and chunk. When the total
+// size exceeds maxSize the least recently used files are evicted.
+type fileCache struct {
+	client  *client.Client
+	dir     string
+	maxSize int64 // 0 means unlimited
+
+	locks sync.Map // key -> *sync.Mutex, serializes fills of one message
+
+	mu      sync.Mutex // guards entries and size
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+type cacheEntry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+func newFileCache(cl *client.Client, dir string, maxSize int64) *fileCache {
+	c := &fileCache{
+		client:  cl,
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[string]*cacheEntry),
+	}
+
+	// Pick up files cached by a previous run, oldest modification first out
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warn.Printf("Failed to read cache dir %s: %v", dir, err)
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(f.Name(), ".part") {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		c.entries[f.Name()] = &cacheEntry{size: info.Size(), lastUsed: info.ModTime()}
+		c.size += info.Size()
+	}
+	return c
+}
+
+// Path returns the local copy of the message media, downloading it on first use
+func (c *fileCache) Path(chatID int64, msgID int) (string, error) {
+	key := cacheKey(chatID, msgID)
+	dst := filepath.Join(c.dir, key)
+
+	unlock := c.lock(key)
+	defer unlock()
+
+	if c.touch(key) {
+		return dst, nil
+	}
+
+	msgs, err := c.client.GetMessages(chatID, []int{msgID})
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "", os.ErrNotExist
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return "", err
+	}
+	tmp := dst + ".part"
+	if err := c.client.DownloadMessageMediaTo(msgs[0], tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := util.ReplaceFile(tmp, dst); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[key] = &cacheEntry{size: info.Size(), lastUsed: time.Now()}
+	c.size += info.Size()
+	c.mu.Unlock()
+
+	c.evict(key)
+	return dst, nil
+}
+
+// Chunk returns chunk n of the message media (see client.DownloadChunk),
+// downloading it on first use. msg is only called then.
+func (c *fileCache) Chunk(chatID int64, msgID int, n int64, msg func() (*tg.Message, error)) ([]byte, error) {
+	key := fmt.Sprintf("%s_%d", cacheKey(chatID, msgID), n)
+	dst := filepath.Join(c.dir, key)
+
+	unlock := c.lock(key)
+	defer unlock()
+
+	if c.touch(key) {
+		if data, err := os.ReadFile(dst); err == nil {
+			return data, nil
+		}
+		c.mu.Lock()
+		c.drop(key)
+		c.mu.Unlock()
+	}
+
+	m, err := msg()
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.client.DownloadChunk(m, n)
+	if err != nil {
+		return nil, err
+	}
+
+	// A chunk that can't be cached is still served
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		logger.Warn.Printf("Failed to cache chunk %s: %v", key, err)
+		return data, nil
+	}
+	tmp := dst + ".part"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		os.Remove(tmp)
+		logger.Warn.Printf("Failed to cache chunk %s: %v", key, err)
+		return data, nil
+	}
+	if err := util.ReplaceFile(tmp, dst); err != nil {
+		logger.Warn.Printf("Failed to cache chunk %s: %v", key, err)
+		return data, nil
+	}
+	c.mu.Lock()
+	c.entries[key] = &cacheEntry{size: int64(len(data)), lastUsed: time.Now()}
+	c.size += int64(len(data))
+	c.mu.Unlock()
+
+	c.evict(key)
+	return data, nil
+}
+
+// Cached returns the local copy of the message media if there is one
+func (c *fileCache) Cached(chatID int64, msgID int) (string, bool) {
+	key := cacheKey(chatID, msgID)
+	unlock := c.lock(key)
+	defer unlock()
+	return filepath.Join(c.dir, key), c.touch(key)
+}
+
+// Remove drops the cached copy of a message
+func (c *fileCache) Remove(chatID int64, msgID int) {
+	key := cacheKey(chatID, msgID)
+
+	unlock := c.lock(key)
+	defer unlock()
+
+	os.Remove(filepath.Join(c.dir, key))
+	c.mu.Lock()
+	c.drop(key)
+	c.mu.Unlock()
+}
+
+func (c *fileCache) lock(key string) (unlock func()) {
+	mu, _ := c.locks.LoadOrStore(key, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// touch marks key as used and reports whether it is cached
+func (c *fileCache) touch(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, key)); err != nil {
+		c.drop(key)
+		return false
+	}
+	e.lastUsed = time.Now()
+	return true
+}
+
+// evict removes least recently used files until the cache fits maxSize.
+// keep is never evicted. Files used in the last minute are skipped too since
+// a reader may be about to open them, so the limit is a soft one.
+func (c *fileCache) evict(keep string) {
+	if c.maxSize <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	recent := time.Now().Add(-time.Minute)
+	for c.size > c.maxSize {
+		var oldest string
+		for key, e := range c.entries {
+			if key == keep || e.lastUsed.After(recent) {
+				continue
+			}
+			if oldest == "" || e.lastUsed.Before(c.entries[oldest].lastUsed) {
+				oldest = key
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		if err := os.Remove(filepath.Join(c.dir, oldest)); err != nil && !os.IsNotExist(err) {
+			logger.Warn.Printf("Failed to evict cached file %s: %v", oldest, err)
+		}
+		c.drop(oldest)
+	}
+}
+
+// drop forgets key. Caller holds c.mu.
+func (c *fileCache) drop(key string) {
+	if e, ok := c.entries[key]; ok {
+		c.size -= e.size
+		delete(c.entries, key)
+	}
+}
+
+func cacheKey(chatID int64, msgID int) string {
+	return fmt.Sprintf("%d_%d", chatID, msgID)
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"io"
+	"os"
+	"sync"
+	"tg-storage-assistant/internal/client"
+
+	"github.com/gotd/td/tg"
+)
+
+// mediaReader reads the media of a message at any offset, downloading only
+// the chunks holding the bytes asked for, so players can seek in large
+// files without fetching all of them. A file the cache already holds is
+// read from disk instead, and downloaded chunks are kept in chunks so
+// previewing a file again doesn't fetch them again.
+type mediaReader struct {
+	client *client.Client
+	cache  *fileCache
+	chunks *fileCache
+	chatID int64
+	msgID  int
+	size   int64
+
+	mu     sync.Mutex
+	local  *os.File
+	opened bool
+	msg    *tg.Message
+	chunkN int64 // index of chunk, -1 before the first read
+	chunk  []byte
+	offset int64 // of Read and Seek
+}
+
+func newMediaReader(cl *client.Client, cache, chunks *fileCache, chatID int64, msgID int, size int64) *mediaReader {
+	return &mediaReader{client: cl, cache: cache, chunks: chunks, chatID: chatID, msgID: msgID, size: size, chunkN: -1}
+}
+
+// open looks for the whole file in the cache. Caller holds r.mu.
+func (r *mediaReader) open() {
+	if r.opened {
+		return
+	}
+	r.opened = true
+	if path, ok := r.cache.Cached(r.chatID, r.msgID); ok {
+		if f, err := os.Open(path); err == nil {
+			r.local = f
+		}
+	}
+}
+
+// message fetches the message once, for the chunks not cached yet. Caller
+// holds r.mu.
+func (r *mediaReader) message() (*tg.Message, error) {
+	if r.msg != nil {
+		return r.msg, nil
+	}
+	msgs, err := r.client.GetMessages(r.chatID, []int{r.msgID})
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, os.ErrNotExist
+	}
+	r.msg = msgs[0]
+	return r.msg, nil
+}
+
+func (r *mediaReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	r.open()
+	if r.local != nil {
+		return r.local.ReadAt(p, off)
+	}
+
+	read := 0
+	for read < len(p) && off < r.size {
+		n, skip := off/client.DownloadChunkSize, off%client.DownloadChunkSize
+		if n != r.chunkN {
+			chunk, err := r.chunks.Chunk(r.chatID, r.msgID, n, r.message)
+			if err != nil {
+				return read, err
+			}
+			r.chunkN, r.chunk = n, chunk
+		}
+		if skip >= int64(len(r.chunk)) {
+			// The file is shorter than the index says
+			break
+		}
+		c := copy(p[read:], r.chunk[skip:])
+		read += c
+		off += int64(c)
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (r *mediaReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *mediaReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *mediaReader) Close() error {
+	if r.local != nil {
+		return r.local.Close()
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+)
+
+func TestMediaReader(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	cfg := &config.MtprotoConfig{StorageChatID: chatID}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+
+	data := make([]byte, 2*client.DownloadChunkSize+1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	file, size, err := cl.UploadStream(bytes.NewReader(data), "movie.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgID, err := cl.SendDocument(peer, file, "movie.mkv", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	cache := newFileCache(cl, filepath.Join(dir, "cache"), 0)
+	chunks := newFileCache(cl, filepath.Join(dir, "chunks"), 0)
+	r := newMediaReader(cl, cache, chunks, chatID, msgID, size)
+	defer r.Close()
+
+	// Across the first chunk boundary
+	buf := make([]byte, 100)
+	off := int64(client.DownloadChunkSize - 50)
+	if n, err := r.ReadAt(buf, off); err != nil || n != len(buf) || !bytes.Equal(buf, data[off:off+100]) {
+		t.Fatalf("ReadAt(%d) = %d, %v", off, n, err)
+	}
+
+	// The tail, after seeking from the end
+	if _, err := r.Seek(-500, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(tail, data[len(data)-500:]) {
+		t.Fatalf("tail = %d bytes, %v", len(tail), err)
+	}
+	if n, err := r.ReadAt(buf, size); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt(size) = %d, %v, want EOF", n, err)
+	}
+
+	// Another reader finds the chunks on disk, even with the message gone
+	if len(chunks.entries) != 3 {
+		t.Fatalf("%d chunks cached, want 3", len(chunks.entries))
+	}
+	if err := cl.DeleteMessages(chatID, []int{msgID}); err != nil {
+		t.Fatal(err)
+	}
+	again := newMediaReader(cl, cache, chunks, chatID, msgID, size)
+	defer again.Close()
+	if n, err := again.ReadAt(buf, off); err != nil || n != len(buf) || !bytes.Equal(buf, data[off:off+100]) {
+		t.Fatalf("cached ReadAt(%d) = %d, %v", off, n, err)
+	}
+}
@@ -0,0 +1,515 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"time"
+)
+
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// S3Server implements the subset of the S3 API needed by backup tools
+// (ListObjectsV2, GetObject, HeadObject, PutObject, DeleteObject) with
+// path-style addressing. Each object is one document in the storage chat.
+type S3Server struct {
+	cfg    *config.Config
+	store  *index.Store
+	client *client.Client
+	cache  *fileCache
+	chunks *fileCache
+	srv    *http.Server
+}
+
+func NewS3Server(cfg *config.Config, store *index.Store, cl *client.Client) *S3Server {
+	s := &S3Server{
+		cfg:    cfg,
+		store:  store,
+		client: cl,
+		cache:  newFileCache(cl, cfg.S3.CacheDir, cfg.S3.CacheSizeBytes),
+		chunks: newFileCache(cl, cfg.S3.ChunkCacheDir, cfg.S3.ChunkCacheSizeBytes),
+	}
+	s.srv = &http.Server{Addr: cfg.S3.Listen, Handler: http.HandlerFunc(s.handle)}
+	return s
+}
+
+// Start begins serving in the background
+func (s *S3Server) Start() {
+	go func() {
+		logger.Info.Printf("S3 gateway listening on http://%s (bucket %q)", s.cfg.S3.Listen, s.cfg.S3.Bucket)
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error.Printf("S3 gateway stopped: %v", err)
+		}
+	}()
+}
+
+func (s *S3Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *S3Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied", r.URL.Path)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Method not allowed", r.URL.Path)
+			return
+		}
+		s.listBuckets(w)
+		return
+	case bucket != s.cfg.S3.Bucket:
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", bucket)
+		return
+	}
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodGet:
+			s.listObjects(w, r)
+		case http.MethodHead, http.MethodPut:
+			// The bucket always exists, creating it is a no-op
+			w.WriteHeader(http.StatusOK)
+		default:
+			writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Method not allowed", r.URL.Path)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.getObject(w, r, key)
+	case http.MethodPut:
+		s.putObject(w, r, key)
+	case http.MethodDelete:
+		s.deleteObject(w, r, key)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Method not allowed", r.URL.Path)
+	}
+}
+
+// authorized verifies the SigV4 signature of the request. Without an access
+// key (only allowed on a loopback listener) every request is accepted.
+func (s *S3Server) authorized(r *http.Request) bool {
+	if s.cfg.S3.AccessKey == "" {
+		return true
+	}
+	if err := verifySigV4(r, s.cfg.S3.AccessKey, s.cfg.S3.SecretKey, time.Now()); err != nil {
+		logger.Debug.Printf("S3 %s %s rejected: %v", r.Method, r.URL.Path, err)
+		return false
+	}
+	return true
+}
+
+// objects returns the newest entry of every key in the bucket, sorted by key
+func (s *S3Server) objects() []*index.Entry {
+	entries, _ := s.store.Search(index.Query{Tag: s.cfg.S3.Bucket})
+
+	seen := make(map[string]bool)
+	var objects []*index.Entry
+	for _, e := range entries {
+		if e.Source != "s3" || len(e.Files) == 0 || seen[e.FileName] {
+			continue
+		}
+		seen[e.FileName] = true
+		objects = append(objects, e)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].FileName < objects[j].FileName
+	})
+	return objects
+}
+
+func (s *S3Server) lookup(key string) (*index.Entry, bool) {
+	for _, e := range s.objects() {
+		if e.FileName == key {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   struct {
+		ID string `xml:"ID"`
+	} `xml:"Owner"`
+	Buckets []bucketXML `xml:"Buckets>Bucket"`
+}
+
+type bucketXML struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+func (s *S3Server) listBuckets(w http.ResponseWriter) {
+	result := listAllMyBucketsResult{
+		Buckets: []bucketXML{{Name: s.cfg.S3.Bucket, CreationDate: time.Unix(0, 0).UTC().Format(s3TimeFormat)}},
+	}
+	result.Owner.ID = "tg-storage-assistant"
+	writeXML(w, http.StatusOK, result)
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name    `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string      `xml:"Name"`
+	Prefix                string      `xml:"Prefix"`
+	Delimiter             string      `xml:"Delimiter,omitempty"`
+	StartAfter            string      `xml:"StartAfter,omitempty"`
+	ContinuationToken     string      `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string      `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int         `xml:"KeyCount"`
+	MaxKeys               int         `xml:"MaxKeys"`
+	IsTruncated           bool        `xml:"IsTruncated"`
+	Contents              []objectXML `xml:"Contents"`
+	CommonPrefixes        []prefixXML `xml:"CommonPrefixes"`
+}
+
+type objectXML struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type prefixXML struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func (s *S3Server) listObjects(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	maxKeys, err := strconv.Atoi(q.Get("max-keys"))
+	if err != nil || maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	// The continuation token is the last returned key or common prefix
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+
+	result := listBucketResult{
+		Name:              s.cfg.S3.Bucket,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           maxKeys,
+	}
+
+	page := listPage(s.objects(), result.Prefix, result.Delimiter, after, maxKeys)
+	for _, e := range page.objects {
+		result.Contents = append(result.Contents, objectXML{
+			Key:          e.FileName,
+			LastModified: e.CreatedAt.UTC().Format(s3TimeFormat),
+			ETag:         etag(e),
+			Size:         e.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, p := range page.prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, prefixXML{Prefix: p})
+	}
+	result.KeyCount = len(page.objects) + len(page.prefixes)
+	result.IsTruncated = page.next != ""
+	result.NextContinuationToken = page.next
+
+	writeXML(w, http.StatusOK, result)
+}
+
+// objectPage is one page of a bucket listing
+type objectPage struct {
+	objects  []*index.Entry
+	prefixes []string
+	next     string // continuation token, empty on the last page
+}
+
+// listPage pages through objects (sorted by key). Keys sharing a prefix up
+// to the delimiter are rolled up into one common prefix, which counts as a
+// single key and is used as the continuation token when it ends a page.
+func listPage(objects []*index.Entry, prefix, delimiter, after string, maxKeys int) objectPage {
+	var page objectPage
+	count := 0
+	last := ""
+	for _, e := range objects {
+		key := e.FileName
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		// Resuming after a common prefix skips everything under it
+		if delimiter != "" && strings.HasSuffix(after, delimiter) && strings.HasPrefix(key, after) {
+			continue
+		}
+
+		common := ""
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common = key[:len(prefix)+i+len(delimiter)]
+				if common == last {
+					continue
+				}
+			}
+		}
+
+		if count >= maxKeys {
+			page.next = last
+			break
+		}
+		count++
+
+		if common != "" {
+			page.prefixes = append(page.prefixes, common)
+			last = common
+		} else {
+			page.objects = append(page.objects, e)
+			last = key
+		}
+	}
+	return page
+}
+
+func (s *S3Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	entry, ok := s.lookup(key)
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist", key)
+		return
+	}
+
+	w.Header().Set("ETag", etag(entry))
+	w.Header().Set("Last-Modified", entry.CreatedAt.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Ranges are downloaded on their own, whole objects through the cache
+	if r.Header.Get("Range") != "" {
+		reader := newMediaReader(s.client, s.cache, s.chunks, entry.ChatID, entry.MessageID(), entry.Size)
+		defer reader.Close()
+		http.ServeContent(w, r, path.Base(key), entry.CreatedAt, reader)
+		return
+	}
+
+	p, err := s.cache.Path(entry.ChatID, entry.MessageID())
+	if err != nil {
+		logger.Warn.Printf("S3 get %q failed: %v", key, err)
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error(), key)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error(), key)
+		return
+	}
+	defer f.Close()
+
+	http.ServeContent(w, r, path.Base(key), entry.CreatedAt, f)
+}
+
+func (s *S3Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "CopyObject is not supported", key)
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp(s.cfg.Mtproto.TempDir, "s3-put-")
+	if err != nil {
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error(), key)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The document keeps the last path element of the key as its file name
+	tmpPath := filepath.Join(tmpDir, path.Base(key))
+	size, sum, sha, err := writeBody(tmpPath, requestBody(r))
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error(), key)
+		return
+	}
+	// A signed payload hash must match the received body
+	if h := r.Header.Get("X-Amz-Content-Sha256"); len(h) == 64 && !strings.EqualFold(h, sha) {
+		writeS3Error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch",
+			"The provided x-amz-content-sha256 header does not match what was computed", key)
+		return
+	}
+
+	previous, hadPrevious := s.lookup(key)
+
+	peer, err := s.client.ResolvePeer(s.cfg.Mtproto.StorageChatID)
+	if err != nil {
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error(), key)
+		return
+	}
+	msgID, err := s.client.SendMedia(peer, client.MediaItem{
+		FilePath:  tmpPath,
+		MediaType: "document",
+		Caption:   fmt.Sprintf("#%s %s", s.cfg.S3.Bucket, key),
+	})
+	if err != nil {
+		logger.Warn.Printf("S3 put %q failed: %v", key, err)
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error(), key)
+		return
+	}
+
+	entry := &index.Entry{
+		ChatID:      s.cfg.Mtproto.StorageChatID,
+		Files:       []index.File{{MessageID: msgID, Name: path.Base(key), Size: size, MD5: sum}},
+		Tag:         s.cfg.S3.Bucket,
+		Description: key,
+		Caption:     fmt.Sprintf("#%s %s", s.cfg.S3.Bucket, key),
+		FileName:    key,
+		MediaType:   "document",
+		Source:      "s3",
+		Size:        size,
+	}
+	if err := s.store.Add(entry); err != nil {
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error(), key)
+		return
+	}
+
+	// Overwrites replace the previous object
+	if hadPrevious {
+		s.remove(previous)
+	}
+
+	w.Header().Set("ETag", etag(entry))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *S3Server) deleteObject(w http.ResponseWriter, r *http.Request, key string) {
+	// Deleting a missing key succeeds, as in S3
+	if entry, ok := s.lookup(key); ok {
+		s.remove(entry)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *S3Server) remove(entry *index.Entry) {
+	if err := s.client.DeleteMessages(entry.ChatID, append(entry.MessageIDs(), entry.ScrubMessageIDs()...)); err != nil {
+		logger.Warn.Printf("Failed to delete messages of %q: %v", entry.FileName, err)
+	}
+	for _, f := range entry.Files {
+		s.cache.Remove(entry.ChatID, f.MessageID)
+	}
+	if err := s.store.Remove(entry.ID); err != nil {
+		logger.Warn.Printf("Failed to remove %q from index: %v", entry.FileName, err)
+	}
+}
+
+// requestBody decodes aws-chunked uploads (streaming signatures) when needed
+func requestBody(r *http.Request) io.Reader {
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return &chunkedReader{r: bufio.NewReader(r.Body)}
+	}
+	return r.Body
+}
+
+// writeBody stores body in dst and returns its size, MD5 and SHA-256 (hex)
+func writeBody(dst string, body io.Reader) (int64, string, string, error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer f.Close()
+
+	md5Sum := md5.New()
+	shaSum := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, md5Sum, shaSum), body)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return n, hex.EncodeToString(md5Sum.Sum(nil)), hex.EncodeToString(shaSum.Sum(nil)), f.Close()
+}
+
+// chunkedReader decodes the aws-chunked content encoding:
+// <hex size>;chunk-signature=...\r\n<data>\r\n ... 0;chunk-signature=...\r\n
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		sizeStr, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeStr, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid chunk header %q", line)
+		}
+		if size == 0 {
+			c.done = true
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		// Skip the CRLF closing the chunk
+		_, err = c.r.Discard(2)
+	}
+	return n, err
+}
+
+func etag(e *index.Entry) string {
+	if len(e.Files) > 0 && e.Files[0].MD5 != "" {
+		return `"` + e.Files[0].MD5 + `"`
+	}
+	return fmt.Sprintf(`"%d-%d"`, e.ChatID, e.MessageID())
+}
+
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, msg, resource string) {
+	writeXML(w, status, s3Error{Code: code, Message: msg, Resource: resource})
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn.Printf("Failed to encode S3 response: %v", err)
+	}
+}
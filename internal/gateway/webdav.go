@@ -0,0 +1,312 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// WebDAVServer presents the media index as a read-only filesystem:
+//
+//	/<tag>/<entry id>_<description>/<file>
+type WebDAVServer struct {
+	cfg *config.WebDAVConfig
+	srv *http.Server
+}
+
+func NewWebDAVServer(cfg *config.WebDAVConfig, store *index.Store, cl *client.Client) *WebDAVServer {
+	handler := &webdav.Handler{
+		FileSystem: &indexFS{
+			store:  store,
+			client: cl,
+			cache:  newFileCache(cl, cfg.CacheDir, cfg.CacheSizeBytes),
+			chunks: newFileCache(cl, cfg.ChunkCacheDir, cfg.ChunkCacheSizeBytes),
+		},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger.Debug.Printf("WebDAV %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+
+	return &WebDAVServer{
+		cfg: cfg,
+		srv: &http.Server{Addr: cfg.Listen, Handler: handler},
+	}
+}
+
+// Start begins serving in the background
+func (s *WebDAVServer) Start() {
+	go func() {
+		logger.Info.Printf("WebDAV gateway listening on http://%s", s.cfg.Listen)
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error.Printf("WebDAV gateway stopped: %v", err)
+		}
+	}()
+}
+
+func (s *WebDAVServer) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// indexFS implements webdav.FileSystem on top of the media index
+type indexFS struct {
+	store  *index.Store
+	client *client.Client
+	cache  *fileCache
+	chunks *fileCache
+}
+
+// node is a resolved path in the tree; entry and file are set as deep as the path goes
+type node struct {
+	tag   string
+	entry *index.Entry
+	file  *index.File
+}
+
+func (n *node) isDir() bool {
+	return n.file == nil
+}
+
+func (n *node) name() string {
+	switch {
+	case n.file != nil:
+		return n.file.Name
+	case n.entry != nil:
+		return entryDirName(n.entry)
+	case n.tag != "":
+		return n.tag
+	}
+	return "/"
+}
+
+func (n *node) info() os.FileInfo {
+	fi := &fileInfo{name: n.name(), dir: n.isDir()}
+	if n.entry != nil {
+		fi.modTime = n.entry.CreatedAt
+	}
+	if n.file != nil {
+		fi.size = n.file.Size
+	}
+	return fi
+}
+
+func entryDirName(e *index.Entry) string {
+	desc := strings.ReplaceAll(e.Description, "/", "_")
+	return fmt.Sprintf("%d_%s", e.ID, desc)
+}
+
+func (f *indexFS) resolve(name string) (*node, error) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	n := &node{}
+	if parts[0] == "" {
+		return n, nil
+	}
+
+	n.tag = parts[0]
+	if !f.hasTag(n.tag) {
+		return nil, os.ErrNotExist
+	}
+	if len(parts) == 1 {
+		return n, nil
+	}
+
+	idStr, _, _ := strings.Cut(parts[1], "_")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	entry, ok := f.store.Get(id)
+	if !ok || entry.Tag != n.tag || entryDirName(entry) != parts[1] {
+		return nil, os.ErrNotExist
+	}
+	n.entry = entry
+	if len(parts) == 2 {
+		return n, nil
+	}
+
+	if len(parts) > 3 {
+		return nil, os.ErrNotExist
+	}
+	for i := range entry.Files {
+		if entry.Files[i].Name == parts[2] {
+			n.file = &entry.Files[i]
+			return n, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (f *indexFS) hasTag(tag string) bool {
+	for _, t := range f.store.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *indexFS) children(n *node) []os.FileInfo {
+	var infos []os.FileInfo
+	switch {
+	case n.entry != nil:
+		for i := range n.entry.Files {
+			infos = append(infos, (&node{tag: n.tag, entry: n.entry, file: &n.entry.Files[i]}).info())
+		}
+	case n.tag != "":
+		entries, _ := f.store.Search(index.Query{Tag: n.tag})
+		for _, e := range entries {
+			infos = append(infos, (&node{tag: n.tag, entry: e}).info())
+		}
+	default:
+		for _, tag := range f.store.Tags() {
+			infos = append(infos, (&node{tag: tag}).info())
+		}
+	}
+	return infos
+}
+
+func (f *indexFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (f *indexFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (f *indexFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (f *indexFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	n, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+func (f *indexFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	n, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteFile{fs: f, node: n}, nil
+}
+
+// remoteFile is an open node. Reads fetch the chunks of the file they need
+// from Telegram; Seek works without downloading so clients can probe sizes
+// and players can skip ahead.
+type remoteFile struct {
+	fs     *indexFS
+	node   *node
+	reader *mediaReader
+	offset int64
+	listed bool
+}
+
+func (r *remoteFile) Close() error {
+	if r.reader != nil {
+		return r.reader.Close()
+	}
+	return nil
+}
+
+func (r *remoteFile) Read(p []byte) (int, error) {
+	if r.node.isDir() {
+		return 0, os.ErrInvalid
+	}
+	if r.reader == nil {
+		r.reader = newMediaReader(r.fs.client, r.fs.cache, r.fs.chunks, r.node.entry.ChatID, r.node.file.MessageID, r.node.file.Size)
+	}
+
+	n, err := r.reader.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	var size int64
+	if r.node.file != nil {
+		size = r.node.file.Size
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *remoteFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if !r.node.isDir() {
+		return nil, os.ErrInvalid
+	}
+	if r.listed {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	r.listed = true
+	return r.fs.children(r.node), nil
+}
+
+func (r *remoteFile) Stat() (fs.FileInfo, error) {
+	return r.node.info(), nil
+}
+
+func (r *remoteFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0o555
+	}
+	return 0o444
+}
@@ -0,0 +1,480 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+// File is a single message of an entry
+type File struct {
+	MessageID int    `json:"message_id"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	MD5       string `json:"md5,omitempty"`    // hex digest, used as S3 ETag
+	SHA256    string `json:"sha256,omitempty"` // hex digest of video parts, to send them again by reference
+}
+
+// Entry is one logical item in the storage chat. A split video is a single
+// entry covering the whole album (preview + parts).
+type Entry struct {
+	ID          int64     `json:"id"`
+	ChatID      int64     `json:"chat_id"`
+	Files       []File    `json:"files"`
+	Tag         string    `json:"tag"`
+	Description string    `json:"description"`
+	Caption     string    `json:"caption"`
+	FileName    string    `json:"file_name"`
+	MediaType   string    `json:"media_type"`
+	Source      string    `json:"source"` // "uploader", "s3", ...
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time,omitzero"` // of the original file, set again on restore
+	SHA256      string    `json:"sha256,omitempty"`  // of the original file, with done_naming hash
+	Parts       int       `json:"parts"`
+	Scrub       []File    `json:"scrub,omitempty"`         // sprite sheets and WebVTT sent after a video, see scrub_thumbnails
+	Version     int       `json:"version,omitempty"`       // 2 and up for new uploads of a changed file, see versioning
+	Superseded  int64     `json:"superseded_by,omitempty"` // ID of the next version
+	Mirrors     []Mirror  `json:"mirrors,omitempty"`       // copies in the mirror channels
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Mirror is a copy of an entry's messages in another chat
+type Mirror struct {
+	ChatID     int64 `json:"chat_id"`
+	MessageIDs []int `json:"message_ids"`
+}
+
+// MessageID returns the ID of the first message of the entry
+func (e *Entry) MessageID() int {
+	if len(e.Files) == 0 {
+		return 0
+	}
+	return e.Files[0].MessageID
+}
+
+// Link returns the t.me deep link to the first message of the entry, or ""
+// if the storage chat is not a channel (only channels have such links)
+func (e *Entry) Link() string {
+	channelID := -e.ChatID - 1000000000000
+	if channelID <= 0 || e.MessageID() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", channelID, e.MessageID())
+}
+
+// MessageIDs returns the IDs of all messages of the entry in album order
+func (e *Entry) MessageIDs() []int {
+	ids := make([]int, len(e.Files))
+	for i, f := range e.Files {
+		ids[i] = f.MessageID
+	}
+	return ids
+}
+
+// ScrubMessageIDs returns the IDs of the messages of the entry's scrub
+// thumbnails, which follow its album
+func (e *Entry) ScrubMessageIDs() []int {
+	ids := make([]int, len(e.Scrub))
+	for i, f := range e.Scrub {
+		ids[i] = f.MessageID
+	}
+	return ids
+}
+
+// Run is the statistics of one upload run of local_dir
+type Run struct {
+	Started   time.Time     `json:"started"`
+	Finished  time.Time     `json:"finished"`
+	Source    string        `json:"source"` // "uploader" or "daemon"
+	Processed int           `json:"processed"`
+	Succeeded int           `json:"succeeded"`
+	Skipped   int           `json:"skipped"`
+	Failed    int           `json:"failed"`
+	Bytes     int64         `json:"bytes"`
+	Upload    time.Duration `json:"upload_ns"`
+	FFmpeg    time.Duration `json:"ffmpeg_ns"`
+}
+
+// Query filters entries returned by Search
+type Query struct {
+	Text   string    // matched against tag, description, caption and file name
+	Tag    string    // exact tag match (case-insensitive)
+	Since  time.Time // only entries created at or after this time
+	Offset int
+	Limit  int
+}
+
+// Store is a JSON file backed media index.
+//
+// Several processes (daemon, uploader, cli fetch/save) may share the same
+// file: writes take a file lock and reload the latest contents before
+// applying the change, and reads pick up changes made by other processes.
+type Store struct {
+	mu      sync.RWMutex
+	path    string
+	nextID  int64
+	entries []*Entry
+	runs    []Run
+	modTime time.Time // of the file contents currently loaded
+	size    int64
+}
+
+type storeFile struct {
+	NextID  int64    `json:"next_id"`
+	Entries []*Entry `json:"entries"`
+	Runs    []Run    `json:"runs,omitempty"`
+}
+
+// Open loads the index from path, starting empty if the file does not exist
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, nextID: 1}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add assigns an ID to the entry and persists it
+func (s *Store) Add(e *Entry) error {
+	return s.update(func() {
+		e.ID = s.nextID
+		s.nextID++
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now()
+		}
+		s.entries = append(s.entries, e)
+	})
+}
+
+// Replace discards every entry and adds entries in their place, numbered
+// from 1
+func (s *Store) Replace(entries []*Entry) error {
+	return s.update(func() {
+		s.entries = entries
+		for i, e := range entries {
+			e.ID = int64(i + 1)
+		}
+		s.nextID = int64(len(entries) + 1)
+	})
+}
+
+// Update applies fn to the entry with the given ID and persists it
+func (s *Store) Update(id int64, fn func(e *Entry)) error {
+	return s.update(func() {
+		for _, e := range s.entries {
+			if e.ID == id {
+				fn(e)
+				return
+			}
+		}
+	})
+}
+
+// Versions returns the uploads of the file with the given tag and name,
+// oldest first. The last one is current unless it was removed.
+func (s *Store) Versions(tag, fileName string) []*Entry {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var versions []*Entry
+	for _, e := range s.entries {
+		if fileName != "" && e.FileName == fileName && strings.EqualFold(e.Tag, tag) {
+			versions = append(versions, e)
+		}
+	}
+	return versions
+}
+
+// AddRun persists the statistics of an upload run
+func (s *Store) AddRun(r Run) error {
+	return s.update(func() {
+		s.runs = append(s.runs, r)
+	})
+}
+
+// Runs returns the recorded upload runs, oldest first
+func (s *Store) Runs() []Run {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.runs)
+}
+
+// Remove deletes the entry with the given ID
+func (s *Store) Remove(id int64) error {
+	return s.update(func() {
+		for i, e := range s.entries {
+			if e.ID == id {
+				s.entries = append(s.entries[:i], s.entries[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// update applies fn to the latest file contents and saves the result while
+// holding the file lock
+func (s *Store) update(fn func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create index dir failed: %w", err)
+		}
+	}
+	unlock, err := util.LockFile(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock index failed: %w", err)
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	fn()
+	return s.save()
+}
+
+// refresh reloads the index if another process changed the file
+func (s *Store) refresh() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fi, err := os.Stat(s.path)
+	if err != nil || (fi.ModTime().Equal(s.modTime) && fi.Size() == s.size) {
+		return
+	}
+	if err := s.load(); err != nil {
+		logger.Warn.Printf("Failed to reload index: %v", err)
+	}
+}
+
+// load replaces the in-memory state with the file contents. Caller holds the lock.
+func (s *Store) load() error {
+	raw, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read index failed: %w", err)
+	}
+
+	var f storeFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("parse index failed: %w", err)
+	}
+	s.entries = f.Entries
+	s.runs = f.Runs
+	if f.NextID > s.nextID {
+		s.nextID = f.NextID
+	}
+	for _, e := range s.entries {
+		if e.ID >= s.nextID {
+			s.nextID = e.ID + 1
+		}
+	}
+	s.stat()
+	return nil
+}
+
+// stat remembers the file version currently loaded
+func (s *Store) stat() {
+	if fi, err := os.Stat(s.path); err == nil {
+		s.modTime = fi.ModTime()
+		s.size = fi.Size()
+	}
+}
+
+// Get returns the entry with the given ID
+func (s *Store) Get(id int64) (*Entry, bool) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// FindSHA256 returns the first entry of a file with the given hash
+func (s *Store) FindSHA256(sum string) (*Entry, bool) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.entries {
+		if sum != "" && e.SHA256 == sum {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// FindFile returns a file with the SHA-256 sum and size, and its entry
+func (s *Store) FindFile(sum string, size int64) (*Entry, File, bool) {
+	if sum == "" {
+		return nil, File{}, false
+	}
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.entries {
+		for _, f := range e.Files {
+			if f.SHA256 == sum && f.Size == size {
+				return e, f, true
+			}
+		}
+	}
+	return nil, File{}, false
+}
+
+// FindMessage returns the entry one of whose files is message msgID of
+// chatID
+func (s *Store) FindMessage(chatID int64, msgID int) (*Entry, bool) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.entries {
+		if e.ChatID != chatID {
+			continue
+		}
+		for _, f := range e.Files {
+			if f.MessageID == msgID {
+				return e, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Usage returns the bytes stored per chat: the sizes of the entries in
+// their storage chat and in each mirror
+func (s *Store) Usage() map[int64]int64 {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	usage := make(map[int64]int64)
+	for _, e := range s.entries {
+		usage[e.ChatID] += e.Size
+		for _, m := range e.Mirrors {
+			usage[m.ChatID] += e.Size
+		}
+	}
+	return usage
+}
+
+// UploadedSince returns the bytes of the entries created from t on,
+// leaving out imports, which transferred none
+func (s *Store) UploadedSince(t time.Time) int64 {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total int64
+	for _, e := range s.entries {
+		if e.Source != "import" && !e.CreatedAt.Before(t) {
+			total += e.Size
+		}
+	}
+	return total
+}
+
+// Tags returns all distinct tags in the index, sorted
+func (s *Store) Tags() []string {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, e := range s.entries {
+		if !seen[e.Tag] {
+			seen[e.Tag] = true
+			tags = append(tags, e.Tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Search returns the matching entries (newest first) and the total match count
+func (s *Store) Search(q Query) ([]*Entry, int) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	text := strings.ToLower(strings.TrimSpace(q.Text))
+	var matched []*Entry
+	for _, e := range s.entries {
+		if q.Tag != "" && !strings.EqualFold(e.Tag, q.Tag) {
+			continue
+		}
+		if text != "" && !e.matches(text) {
+			continue
+		}
+		if !q.Since.IsZero() && e.CreatedAt.Before(q.Since) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID > matched[j].ID
+	})
+
+	total := len(matched)
+	if q.Offset > 0 {
+		if q.Offset >= total {
+			return nil, total
+		}
+		matched = matched[q.Offset:]
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	return matched, total
+}
+
+func (e *Entry) matches(text string) bool {
+	for _, field := range []string{e.Tag, e.Description, e.Caption, e.FileName} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the index atomically (temp file + rename). Caller holds the
+// lock and the file lock.
+func (s *Store) save() error {
+	raw, err := json.MarshalIndent(storeFile{NextID: s.nextID, Entries: s.entries, Runs: s.runs}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode index failed: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("write index failed: %w", err)
+	}
+	if err := util.ReplaceFile(tmp, s.path); err != nil {
+		return fmt.Errorf("replace index failed: %w", err)
+	}
+	s.stat()
+	return nil
+}
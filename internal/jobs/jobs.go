@@ -0,0 +1,473 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/metrics"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+type State string
+
+const (
+	StateQueued   State = "queued"
+	StateRunning  State = "running"
+	StateDone     State = "done"
+	StateFailed   State = "failed"
+	StateCanceled State = "canceled"
+)
+
+// Priorities, higher runs first
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+var ErrNotFound = errors.New("job not found")
+
+// Job is a long-running operation persisted in the queue file
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Priority    int             `json:"priority"`
+	State       State           `json:"state"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Error       string          `json:"error,omitempty"`
+	Category    string          `json:"category,omitempty"` // errs.Category of Error
+	Progress    string          `json:"progress,omitempty"` // set by the handler while running
+	Percent     float64         `json:"percent,omitempty"`
+	Result      []string        `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	StartedAt   time.Time       `json:"started_at,omitzero"` // of the current attempt
+	NextRunAt   time.Time       `json:"next_run_at"`
+}
+
+// Decode unmarshals the job payload into v
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler runs a job. ctx is canceled when the job is canceled or the queue stops.
+type Handler func(ctx context.Context, job *Job) ([]string, error)
+
+// Queue is a JSON file backed job queue with a single worker
+type Queue struct {
+	mu          sync.Mutex
+	path        string
+	maxAttempts int
+	nextID      int64
+	jobs        []*Job
+	handlers    map[string]Handler
+	cancels     map[int64]context.CancelFunc
+	wake        chan struct{}
+	paused      bool
+
+	// OnFinish, if set, is called once a job reaches done, failed or canceled
+	OnFinish func(job Job)
+}
+
+type queueFile struct {
+	NextID int64  `json:"next_id"`
+	Jobs   []*Job `json:"jobs"`
+}
+
+// Open loads the queue from path. Jobs that were running when the previous
+// process stopped are queued again.
+func Open(path string, maxAttempts int) (*Queue, error) {
+	q := &Queue{
+		path:        path,
+		maxAttempts: maxAttempts,
+		nextID:      1,
+		handlers:    make(map[string]Handler),
+		cancels:     make(map[int64]context.CancelFunc),
+		wake:        make(chan struct{}, 1),
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read job queue failed: %w", err)
+	}
+
+	var f queueFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("parse job queue failed: %w", err)
+	}
+	q.jobs = f.Jobs
+	q.nextID = f.NextID
+	for _, job := range q.jobs {
+		if job.ID >= q.nextID {
+			q.nextID = job.ID + 1
+		}
+		if job.State == StateRunning {
+			job.State = StateQueued
+		}
+	}
+	return q, nil
+}
+
+// Register sets the handler for a job type
+func (q *Queue) Register(typ string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[typ] = h
+	q.notify()
+}
+
+// SetMaxAttempts changes the attempt limit of jobs submitted from now on
+func (q *Queue) SetMaxAttempts(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.maxAttempts = n
+}
+
+// Submit queues a new job with the given payload and priority
+func (q *Queue) Submit(typ string, payload any, priority int) (Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, fmt.Errorf("encode payload failed: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	job := &Job{
+		ID:          q.nextID,
+		Type:        typ,
+		Payload:     raw,
+		Priority:    priority,
+		State:       StateQueued,
+		MaxAttempts: q.maxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		NextRunAt:   now,
+	}
+	q.nextID++
+	q.jobs = append(q.jobs, job)
+	if err := q.save(); err != nil {
+		return Job{}, err
+	}
+
+	q.notify()
+	return *job, nil
+}
+
+// Get returns a copy of the job
+func (q *Queue) Get(id int64) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.find(id)
+	if job == nil {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns copies of all jobs, newest first
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		list = append(list, *job)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID > list[j].ID
+	})
+	return list
+}
+
+// Depth returns the number of queued and running jobs
+func (q *Queue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depth := 0
+	for _, job := range q.jobs {
+		if job.State == StateQueued || job.State == StateRunning {
+			depth++
+		}
+	}
+	return depth
+}
+
+// RunOrder returns the running and queued jobs of list in the order the
+// queue takes them: the running one, then the higher priority first and
+// the older first within a priority
+func RunOrder(list []Job) []Job {
+	var pending []Job
+	for _, job := range list {
+		if job.State == StateRunning || job.State == StateQueued {
+			pending = append(pending, job)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		a, b := pending[i], pending[j]
+		if (a.State == StateRunning) != (b.State == StateRunning) {
+			return a.State == StateRunning
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.ID < b.ID
+	})
+	return pending
+}
+
+// SetProgress records a short status line and the completed percentage of
+// a running job
+func (q *Queue) SetProgress(id int64, progress string, percent float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.find(id)
+	if job == nil || job.State != StateRunning {
+		return
+	}
+	job.Progress = progress
+	job.Percent = percent
+	job.UpdatedAt = time.Now()
+	q.saveOrLog()
+}
+
+// Cancel stops a queued or running job
+func (q *Queue) Cancel(id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.find(id)
+	if job == nil {
+		return ErrNotFound
+	}
+
+	switch job.State {
+	case StateQueued:
+		job.State = StateCanceled
+		job.UpdatedAt = time.Now()
+		return q.save()
+	case StateRunning:
+		// The worker records the canceled state once the handler returns
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+		return nil
+	default:
+		return fmt.Errorf("job %d is already %s", id, job.State)
+	}
+}
+
+// Pause stops the queue from starting jobs until Resume, while a running
+// job finishes. It reports false when the queue was paused already. A
+// restart resumes it.
+func (q *Queue) Pause() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused {
+		return false
+	}
+	q.paused = true
+	logger.Info.Println("Job queue paused")
+	return true
+}
+
+// Resume starts jobs again after Pause. It reports false when the queue
+// wasn't paused.
+func (q *Queue) Resume() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.paused {
+		return false
+	}
+	q.paused = false
+	logger.Info.Println("Job queue resumed")
+	q.notify()
+	return true
+}
+
+// Paused tells whether Pause holds new jobs back
+func (q *Queue) Paused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// Run executes jobs one at a time until ctx is done
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		job, handler, wait := q.next()
+		if job == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-q.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		q.mu.Lock()
+		q.cancels[job.ID] = cancel
+		snapshot := *job
+		q.mu.Unlock()
+
+		logger.Info.Printf("Job %d (%s) started, attempt %d/%d", job.ID, job.Type, job.Attempts, job.MaxAttempts)
+		result, err := handler(jobCtx, &snapshot)
+		// A handler that finished despite the cancel keeps its outcome
+		canceled := err != nil && errors.Is(err, context.Canceled) && jobCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		// Stopping the queue leaves the job to be resumed on the next start
+		if ctx.Err() != nil {
+			return
+		}
+		q.finish(job, result, err, canceled)
+	}
+}
+
+// next picks the highest-priority due job, or reports how long to wait
+func (q *Queue) next() (*Job, Handler, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	wait := time.Minute
+	if q.paused {
+		return nil, nil, wait
+	}
+	var best *Job
+	for _, job := range q.jobs {
+		if job.State != StateQueued {
+			continue
+		}
+		// Jobs of a type nobody handles in this process stay queued
+		if _, ok := q.handlers[job.Type]; !ok {
+			continue
+		}
+		if job.NextRunAt.After(now) {
+			if d := job.NextRunAt.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+		if best == nil || job.Priority > best.Priority ||
+			(job.Priority == best.Priority && job.ID < best.ID) {
+			best = job
+		}
+	}
+	if best == nil {
+		return nil, nil, wait
+	}
+
+	best.State = StateRunning
+	best.Attempts++
+	best.UpdatedAt = now
+	best.StartedAt = now
+	best.Progress, best.Percent = "", 0
+	q.saveOrLog()
+	return best, q.handlers[best.Type], 0
+}
+
+func (q *Queue) finish(job *Job, result []string, err error, canceled bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.cancels, job.ID)
+	job.Result = result
+	job.UpdatedAt = time.Now()
+
+	switch {
+	case canceled:
+		job.State = StateCanceled
+		logger.Info.Printf("Job %d (%s) canceled", job.ID, job.Type)
+	case err == nil:
+		job.State = StateDone
+		job.Error, job.Category = "", ""
+		logger.Info.Printf("Job %d (%s) done", job.ID, job.Type)
+	case job.Attempts < job.MaxAttempts:
+		// Exponential backoff: 30s, 1m, 2m, ...
+		backoff := 30 * time.Second << (job.Attempts - 1)
+		job.State = StateQueued
+		job.Error, job.Category = err.Error(), errs.Category(err)
+		job.NextRunAt = time.Now().Add(backoff)
+		logger.Warn.Printf("Job %d (%s) failed, retrying in %s: %v", job.ID, job.Type, backoff, err)
+	default:
+		job.State = StateFailed
+		job.Error, job.Category = err.Error(), errs.Category(err)
+		logger.Error.Printf("Job %d (%s) failed: %v", job.ID, job.Type, err)
+	}
+	q.saveOrLog()
+	if err != nil && !canceled {
+		metrics.Fail("job", err)
+	}
+
+	if q.OnFinish != nil && job.State != StateQueued {
+		go q.OnFinish(*job)
+	}
+}
+
+func (q *Queue) find(id int64) *Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) saveOrLog() {
+	if err := q.save(); err != nil {
+		logger.Warn.Printf("Failed to persist job queue: %v", err)
+	}
+}
+
+// save writes the queue atomically (temp file + rename). Caller holds the lock.
+func (q *Queue) save() error {
+	raw, err := json.MarshalIndent(queueFile{NextID: q.nextID, Jobs: q.jobs}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode job queue failed: %w", err)
+	}
+
+	if dir := filepath.Dir(q.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create job queue dir failed: %w", err)
+		}
+	}
+
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("write job queue failed: %w", err)
+	}
+	if err := util.ReplaceFile(tmp, q.path); err != nil {
+		return fmt.Errorf("replace job queue failed: %w", err)
+	}
+	return nil
+}
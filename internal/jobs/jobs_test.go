@@ -0,0 +1,244 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestQueue(t *testing.T) (*Queue, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := Open(path, 3)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return q, path
+}
+
+func noop(ctx context.Context, job *Job) ([]string, error) { return nil, nil }
+
+func submit(t *testing.T, q *Queue, typ string, priority int) Job {
+	t.Helper()
+
+	job, err := q.Submit(typ, map[string]int{}, priority)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	return job
+}
+
+func TestNextPriorityOrder(t *testing.T) {
+	q, _ := openTestQueue(t)
+	q.Register("test", noop)
+
+	low := submit(t, q, "test", PriorityLow)
+	high1 := submit(t, q, "test", PriorityHigh)
+	normal := submit(t, q, "test", PriorityNormal)
+	high2 := submit(t, q, "test", PriorityHigh)
+
+	for _, want := range []int64{high1.ID, high2.ID, normal.ID, low.ID} {
+		job, handler, _ := q.next()
+		if job == nil || handler == nil {
+			t.Fatalf("next returned no job, want %d", want)
+		}
+		if job.ID != want {
+			t.Fatalf("next returned job %d, want %d", job.ID, want)
+		}
+		if job.State != StateRunning || job.Attempts != 1 {
+			t.Fatalf("job %d is %s with %d attempts", job.ID, job.State, job.Attempts)
+		}
+	}
+
+	if job, _, _ := q.next(); job != nil {
+		t.Fatalf("next returned job %d from an empty queue", job.ID)
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	list := []Job{
+		{ID: 5, State: StateQueued, Priority: PriorityLow},
+		{ID: 4, State: StateDone, Priority: PriorityHigh},
+		{ID: 3, State: StateQueued, Priority: PriorityHigh},
+		{ID: 2, State: StateRunning, Priority: PriorityNormal},
+		{ID: 1, State: StateQueued, Priority: PriorityNormal},
+	}
+	var ids []int64
+	for _, job := range RunOrder(list) {
+		ids = append(ids, job.ID)
+	}
+	if fmt.Sprint(ids) != "[2 3 1 5]" {
+		t.Errorf("RunOrder = %v, want [2 3 1 5]", ids)
+	}
+}
+
+func TestNextLeavesUnhandledJobsQueued(t *testing.T) {
+	q, _ := openTestQueue(t)
+	job := submit(t, q, "unknown", PriorityNormal)
+
+	if got, _, _ := q.next(); got != nil {
+		t.Fatalf("next returned job %d without a handler", got.ID)
+	}
+	if got, _ := q.Get(job.ID); got.State != StateQueued {
+		t.Fatalf("job is %s, want queued", got.State)
+	}
+
+	q.Register("unknown", noop)
+	if got, _, _ := q.next(); got == nil || got.ID != job.ID {
+		t.Fatal("job not picked up after registering its handler")
+	}
+}
+
+func TestPauseHoldsJobsBack(t *testing.T) {
+	q, _ := openTestQueue(t)
+	q.Register("test", noop)
+	running := submit(t, q, "test", PriorityNormal)
+	if job, _, _ := q.next(); job == nil || job.ID != running.ID {
+		t.Fatalf("next returned %v, want job %d", job, running.ID)
+	}
+	queued := submit(t, q, "test", PriorityNormal)
+
+	if !q.Pause() || q.Pause() || !q.Paused() {
+		t.Fatal("Pause did not pause once")
+	}
+	if job, _, _ := q.next(); job != nil {
+		t.Fatalf("next returned job %d while paused", job.ID)
+	}
+	if got, _ := q.Get(running.ID); got.State != StateRunning {
+		t.Errorf("running job is %s after Pause", got.State)
+	}
+	if !q.Resume() || q.Resume() || q.Paused() {
+		t.Fatal("Resume did not resume once")
+	}
+	if job, _, _ := q.next(); job == nil || job.ID != queued.ID {
+		t.Fatalf("next returned %v after Resume, want job %d", job, queued.ID)
+	}
+}
+
+func TestFinishBackoff(t *testing.T) {
+	q, _ := openTestQueue(t)
+	q.Register("test", noop)
+	submit(t, q, "test", PriorityNormal)
+
+	failure := errors.New("boom")
+	for attempt, backoff := range []time.Duration{30 * time.Second, time.Minute} {
+		job, _, _ := q.next()
+		if job == nil {
+			t.Fatalf("attempt %d: job not due", attempt+1)
+		}
+
+		before := time.Now()
+		q.finish(job, nil, failure, false)
+		if job.State != StateQueued || job.Error != "boom" {
+			t.Fatalf("attempt %d: job is %s (%q), want queued", attempt+1, job.State, job.Error)
+		}
+		if d := job.NextRunAt.Sub(before); d < backoff || d > backoff+time.Second {
+			t.Fatalf("attempt %d: retry in %s, want %s", attempt+1, d, backoff)
+		}
+
+		// Not due before the backoff expires
+		if got, _, wait := q.next(); got != nil || wait <= 0 {
+			t.Fatalf("attempt %d: job ran before its backoff", attempt+1)
+		}
+		job.NextRunAt = time.Now()
+	}
+
+	job, _, _ := q.next()
+	q.finish(job, nil, failure, false)
+	if job.State != StateFailed || job.Attempts != 3 {
+		t.Fatalf("job is %s after %d attempts, want failed after 3", job.State, job.Attempts)
+	}
+}
+
+func TestOpenRequeuesRunningJobs(t *testing.T) {
+	q, path := openTestQueue(t)
+	q.Register("test", noop)
+	job := submit(t, q, "test", PriorityNormal)
+	if got, _, _ := q.next(); got == nil || got.State != StateRunning {
+		t.Fatal("job did not start")
+	}
+
+	reopened, err := Open(path, 3)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, ok := reopened.Get(job.ID)
+	if !ok || got.State != StateQueued || got.Attempts != 1 {
+		t.Fatalf("after restart job is %+v, want queued with 1 attempt", got)
+	}
+}
+
+func runUntilFinished(t *testing.T, q *Queue, h Handler, cancelAfterStart bool) Job {
+	t.Helper()
+
+	started := make(chan struct{})
+	finished := make(chan Job, 1)
+	q.Register("test", func(ctx context.Context, job *Job) ([]string, error) {
+		close(started)
+		return h(ctx, job)
+	})
+	q.OnFinish = func(job Job) { finished <- job }
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	job := submit(t, q, "test", PriorityNormal)
+	go q.Run(ctx)
+
+	<-started
+	if cancelAfterStart {
+		if err := q.Cancel(job.ID); err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+	}
+
+	select {
+	case job := <-finished:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not finish")
+		return Job{}
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	q, _ := openTestQueue(t)
+	job := runUntilFinished(t, q, func(ctx context.Context, job *Job) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, true)
+
+	if job.State != StateCanceled {
+		t.Fatalf("job is %s, want canceled", job.State)
+	}
+}
+
+func TestCancelIgnoredByCompletedHandler(t *testing.T) {
+	q, _ := openTestQueue(t)
+	job := runUntilFinished(t, q, func(ctx context.Context, job *Job) ([]string, error) {
+		<-ctx.Done()
+		return []string{"entry 1"}, nil
+	}, true)
+
+	if job.State != StateDone || len(job.Result) != 1 {
+		t.Fatalf("job is %s with result %v, want done", job.State, job.Result)
+	}
+}
+
+func TestSetProgressOnlyWhileRunning(t *testing.T) {
+	q, _ := openTestQueue(t)
+	q.Register("test", noop)
+	queued := submit(t, q, "test", PriorityNormal)
+
+	q.SetProgress(queued.ID, "ignored", 10)
+	running, _, _ := q.next()
+	q.SetProgress(running.ID, "2/5 files", 40)
+
+	job, _ := q.Get(queued.ID)
+	if job.Progress != "2/5 files" || job.Percent != 40 || job.StartedAt.IsZero() {
+		t.Fatalf("got progress %q, %v%%, started %v", job.Progress, job.Percent, job.StartedAt)
+	}
+}
@@ -1,17 +1,271 @@
 package logger
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
-	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fatih/color"
 )
 
+// Level is the severity of a log line
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff // disables a logger entirely
+)
+
+// levelUnset marks a module without its own level
+const levelUnset = -1
+
+var levelNames = [...]string{"debug", "info", "warn", "error", "off"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelOff {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses "debug", "info", "warn", "error" or "off"
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Module is a set of loggers for one part of the program. Its lines are
+// tagged with the module name and its level can be set independently of the
+// global one.
+type Module struct {
+	Debug *log.Logger
+	Info  *log.Logger
+	Warn  *log.Logger
+	Error *log.Logger
+
+	name  string
+	level atomic.Int32
+}
+
+func newModule(name string) *Module {
+	m := &Module{name: name}
+	m.level.Store(levelUnset)
+	m.Debug = log.New(levelWriter{m, LevelDebug}, "", 0)
+	m.Info = log.New(levelWriter{m, LevelInfo}, "", 0)
+	m.Warn = log.New(levelWriter{m, LevelWarn}, "", 0)
+	m.Error = log.New(levelWriter{m, LevelError}, "", 0)
+	return m
+}
+
+// Named returns the module logger called name, creating it on first use
+func Named(name string) *Module {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if m, ok := modules[name]; ok {
+		return m
+	}
+	m := newModule(name)
+	if l, ok := moduleLevels[name]; ok {
+		m.level.Store(int32(l))
+	}
+	modules[name] = m
+	return m
+}
+
+// SetLevel overrides the global level for this module
+func (m *Module) SetLevel(l Level) {
+	m.level.Store(int32(l))
+}
+
+// Enabled reports whether lines at level l are written by this module
+func (m *Module) Enabled(l Level) bool {
+	min := Level(m.level.Load())
+	if min == levelUnset {
+		min = Level(minLevel.Load())
+	}
+	return l >= min && l < LevelOff
+}
+
+func (m *Module) logger(l Level) *log.Logger {
+	switch l {
+	case LevelDebug:
+		return m.Debug
+	case LevelInfo:
+		return m.Info
+	case LevelWarn:
+		return m.Warn
+	default:
+		return m.Error
+	}
+}
+
+var (
+	root = newModule("")
+
+	Info  = root.Info
+	Warn  = root.Warn
+	Error = root.Error
+	Debug = root.Debug
+)
+
+// Options configures the output of all loggers
+type Options struct {
+	Level      Level
+	JSON       bool   // one JSON object per line instead of text
+	File       string // write to this file instead of stdout/stderr
+	MaxSize    int64  // rotate File once it grows past this size
+	MaxBackups int    // rotated files to keep
+
+	Modules map[string]Level // per-module levels, see Named
+}
+
 var (
-	Info  = log.New(os.Stdout, color.GreenString("[INFO] "), log.LstdFlags|log.Lmsgprefix)
-	Warn  = log.New(os.Stdout, color.YellowString("[WARN] "), log.LstdFlags|log.Lmsgprefix)
-	Error = log.New(os.Stderr, color.RedString("[ERROR] "), log.LstdFlags|log.Lmsgprefix)
-	Debug = log.New(os.Stdout, color.CyanString("[DEBUG] "), log.LstdFlags|log.Lmsgprefix)
-	// Disable Debug logging
-	// Debug = log.New(io.Discard, "", 0)
+	minLevel atomic.Int32
+
+	mu         sync.Mutex
+	jsonOutput bool
+	stdout     io.Writer = color.Output // translates colors on Windows consoles
+	stderr     io.Writer = color.Error
+	file       *rotatingFile
+
+	modules      = make(map[string]*Module)
+	moduleLevels map[string]Level
 )
+
+func init() {
+	minLevel.Store(int32(LevelInfo))
+}
+
+// Configure applies opts to all loggers. It can be called again at any time,
+// e.g. after reloading the config.
+func Configure(opts Options) error {
+	var f *rotatingFile
+	if opts.File != "" {
+		var err error
+		if f, err = openRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file != nil {
+		file.Close()
+	}
+	file = f
+	jsonOutput = opts.JSON
+	if f != nil {
+		stdout, stderr = f, f
+	} else {
+		stdout, stderr = color.Output, color.Error
+	}
+	SetLevel(opts.Level)
+
+	moduleLevels = opts.Modules
+	for name, m := range modules {
+		l, ok := moduleLevels[name]
+		if !ok {
+			l = levelUnset
+		}
+		m.level.Store(int32(l))
+	}
+	return nil
+}
+
+// UseStderr sends all console output to stderr, keeping stdout free for
+// machine-readable output. It has no effect when logging to a file.
+func UseStderr() {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		stdout = color.Error
+	}
+}
+
+// SetLevel drops all lines below l from now on
+func SetLevel(l Level) {
+	minLevel.Store(int32(l))
+}
+
+// Enabled reports whether lines at level l are written by the global loggers
+func Enabled(l Level) bool {
+	return root.Enabled(l)
+}
+
+// levelWriter formats the lines of one logger
+type levelWriter struct {
+	module *Module
+	level  Level
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	level := w.level
+	if !w.module.Enabled(level) {
+		return len(p), nil
+	}
+	msg := strings.TrimSuffix(string(p), "\n")
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	out := stdout
+	if level == LevelError {
+		out = stderr
+	}
+
+	var line []byte
+	if jsonOutput {
+		line, _ = json.Marshal(struct {
+			Time   string `json:"time"`
+			Level  string `json:"level"`
+			Module string `json:"module,omitempty"`
+			Msg    string `json:"msg"`
+		}{now.Format(time.RFC3339Nano), level.String(), w.module.name, msg})
+		line = append(line, '\n')
+	} else {
+		if w.module.name != "" {
+			msg = w.module.name + ": " + msg
+		}
+		line = fmt.Appendf(nil, "%s %s %s\n", now.Format("2006/01/02 15:04:05"), prefix(level, file == nil), msg)
+	}
+
+	if _, err := out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func prefix(level Level, colored bool) string {
+	p := "[" + strings.ToUpper(level.String()) + "]"
+	if !colored {
+		return p
+	}
+	switch level {
+	case LevelDebug:
+		return color.CyanString(p)
+	case LevelInfo:
+		return color.GreenString(p)
+	case LevelWarn:
+		return color.YellowString(p)
+	default:
+		return color.RedString(p)
+	}
+}
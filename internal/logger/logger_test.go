@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestLevelFilteringAndJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := Configure(Options{Level: LevelInfo, JSON: true, File: path}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	t.Cleanup(func() { Configure(Options{Level: LevelInfo}) })
+
+	Debug.Printf("hidden")
+	Info.Printf("shown %d", 1)
+	SetLevel(LevelDebug)
+	Debug.Printf("now shown")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+
+	var line struct{ Level, Msg string }
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", lines[0], err)
+	}
+	if line.Level != "info" || line.Msg != "shown 1" {
+		t.Fatalf("got %+v", line)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, s := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		got, err := os.ReadFile(name)
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q (%v), want %q", filepath.Base(name), got, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("kept more than max_backups files")
+	}
+}
+
+func TestModuleLevels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	err := Configure(Options{Level: LevelWarn, File: path, Modules: map[string]Level{"wire": LevelDebug}})
+	if err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	t.Cleanup(func() { Configure(Options{Level: LevelInfo}) })
+
+	Named("quiet").Info.Printf("hidden")
+	wire := Named("wire")
+	wire.Debug.Printf("shown")
+	wire.Zap().Debug("rpc retry", zap.Int("attempt", 2))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if strings.Contains(got, "hidden") {
+		t.Fatalf("module below the global level was logged:\n%s", got)
+	}
+	if !strings.Contains(got, "[DEBUG] wire: shown") || !strings.Contains(got, `wire: rpc retry {"attempt":2}`) {
+		t.Fatalf("module lines missing:\n%s", got)
+	}
+}
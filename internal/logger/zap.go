@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Zap returns a zap logger that writes through m, for libraries such as gotd
+// that log with zap. Lines are filtered by the level of m.
+func (m *Module) Zap() *zap.Logger {
+	return zap.New(&zapCore{module: m})
+}
+
+type zapCore struct {
+	module *Module
+	fields []zapcore.Field
+}
+
+func (c *zapCore) Enabled(l zapcore.Level) bool {
+	return c.module.Enabled(fromZap(l))
+}
+
+func (c *zapCore) With(fields []zapcore.Field) zapcore.Core {
+	return &zapCore{
+		module: c.module,
+		fields: append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *zapCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *zapCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	msg := e.Message
+	if e.LoggerName != "" {
+		msg = e.LoggerName + ": " + msg
+	}
+	if len(enc.Fields) > 0 {
+		if data, err := json.Marshal(enc.Fields); err == nil {
+			msg += " " + string(data)
+		} else {
+			msg += fmt.Sprintf(" %v", enc.Fields)
+		}
+	}
+	return c.module.logger(fromZap(e.Level)).Output(2, msg)
+}
+
+func (c *zapCore) Sync() error {
+	return nil
+}
+
+func fromZap(l zapcore.Level) Level {
+	switch {
+	case l <= zapcore.DebugLevel:
+		return LevelDebug
+	case l == zapcore.InfoLevel:
+		return LevelInfo
+	case l == zapcore.WarnLevel:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
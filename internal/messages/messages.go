@@ -0,0 +1,107 @@
+// Package messages holds the user-facing texts of the bot and the CLI in
+// every supported language. Logs and errors stay in English.
+package messages
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultLocale is used when no locale is configured, and for texts a
+// locale lacks
+const DefaultLocale = "en"
+
+//go:embed locales/*.yaml
+var files embed.FS
+
+// catalogs maps a locale to its texts by key
+var catalogs = load()
+
+var (
+	mu      sync.RWMutex
+	current = DefaultLocale
+)
+
+func load() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		raw, err := files.ReadFile("locales/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+		texts := make(map[string]string)
+		if err := yaml.Unmarshal(raw, &texts); err != nil {
+			panic(fmt.Sprintf("parse locale %s: %v", e.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(e.Name(), path.Ext(e.Name()))] = texts
+	}
+	return catalogs
+}
+
+// Locales lists the supported locales, sorted
+func Locales() []string {
+	list := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		list = append(list, locale)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// Normalize returns the supported locale of a name like "zh", "zh-CN" or
+// "zh_CN.UTF-8", DefaultLocale when it is empty
+func Normalize(locale string) (string, error) {
+	if locale == "" {
+		return DefaultLocale, nil
+	}
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "-_."); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalogs[lang]; !ok {
+		return "", fmt.Errorf("unsupported locale %q (%s)", locale, strings.Join(Locales(), ", "))
+	}
+	return lang, nil
+}
+
+// SetLocale selects the language of Text
+func SetLocale(locale string) error {
+	lang, err := Normalize(locale)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = lang
+	mu.Unlock()
+	return nil
+}
+
+// Text returns the text of key in the current locale, formatted with args
+// like fmt.Sprintf. Keys missing from the locale fall back to
+// DefaultLocale, unknown keys to the key itself.
+func Text(key string, args ...any) string {
+	mu.RLock()
+	lang := current
+	mu.RUnlock()
+
+	text, ok := catalogs[lang][key]
+	if !ok {
+		if text, ok = catalogs[DefaultLocale][key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
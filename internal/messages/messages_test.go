@@ -0,0 +1,90 @@
+package messages
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// verb matches the verbs of a text, with an optional argument index
+var verb = regexp.MustCompile(`%(\[\d+\])?[-+# 0-9]*[dsvq]`)
+
+// sampleArgs are arguments for the verbs of text in order
+func sampleArgs(text string) []any {
+	var args []any
+	for _, v := range verb.FindAllString(strings.ReplaceAll(text, "%%", ""), -1) {
+		if strings.HasSuffix(v, "d") {
+			args = append(args, 1)
+		} else {
+			args = append(args, "x")
+		}
+	}
+	return args
+}
+
+func TestLocalesMatchDefault(t *testing.T) {
+	base := catalogs[DefaultLocale]
+	for _, locale := range Locales() {
+		texts := catalogs[locale]
+		for key, text := range base {
+			translated, ok := texts[key]
+			if !ok {
+				t.Errorf("%s lacks %s", locale, key)
+				continue
+			}
+			if out := fmt.Sprintf(translated, sampleArgs(text)...); strings.Contains(out, "%!") {
+				t.Errorf("%s %s takes other arguments than %s: %q", locale, key, DefaultLocale, out)
+			}
+		}
+		for key := range texts {
+			if _, ok := base[key]; !ok {
+				t.Errorf("%s has %s, which %s lacks", locale, key, DefaultLocale)
+			}
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		locale, want string
+	}{
+		{"", "en"},
+		{"en", "en"},
+		{"zh", "zh"},
+		{"zh-CN", "zh"},
+		{"zh_CN.UTF-8", "zh"},
+		{"EN_us", "en"},
+	}
+	for _, tt := range tests {
+		if got, err := Normalize(tt.locale); err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", tt.locale, got, err, tt.want)
+		}
+	}
+	if _, err := Normalize("xx"); err == nil {
+		t.Error("Normalize(xx) should fail")
+	}
+}
+
+func TestText(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+
+	if err := SetLocale("zh"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Text("bot.photo_saved", 5); got != "✅ 图片已保存，message_id=5" {
+		t.Errorf("zh text = %q", got)
+	}
+	if got := Text("cli.init_set", int64(-100), "config.yaml"); got != "已在 config.yaml 中设置 storage_chat_id: -100" {
+		t.Errorf("reordered text = %q", got)
+	}
+
+	catalogs["en"]["test.only_en"] = "only %s"
+	defer delete(catalogs["en"], "test.only_en")
+	if got := Text("test.only_en", "english"); got != "only english" {
+		t.Errorf("missing text = %q, want the en fallback", got)
+	}
+	if got := Text("test.unknown"); got != "test.unknown" {
+		t.Errorf("unknown key = %q, want the key", got)
+	}
+}
@@ -0,0 +1,49 @@
+// Package metrics counts the failures of the daemon by errs.Category and
+// serves them in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"tg-storage-assistant/internal/errs"
+)
+
+// Sources of failures: uploads from local_dir (retries included) and daemon
+// jobs
+var sources = []string{"upload", "job"}
+
+var (
+	mu       sync.Mutex
+	failures = make(map[[2]string]int)
+)
+
+// Fail counts err as a failure of source
+func Fail(source string, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	failures[[2]string{source, errs.Category(err)}]++
+}
+
+// WriteText writes the counters in the Prometheus text format. Every known
+// source and category is listed, at 0 until it fails, so rates and alerts
+// work from the start.
+func WriteText(w io.Writer) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := fmt.Fprint(w,
+		"# HELP tg_assistant_failures_total Failed uploads and jobs by category.\n",
+		"# TYPE tg_assistant_failures_total counter\n"); err != nil {
+		return err
+	}
+	for _, source := range sources {
+		for _, category := range errs.Categories() {
+			n := failures[[2]string{source, category}]
+			if _, err := fmt.Fprintf(w, "tg_assistant_failures_total{source=%q,category=%q} %d\n", source, category, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/dialer"
+	"tg-storage-assistant/internal/logger"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+)
+
+var log = logger.Named("bot")
+
+// Notifier delivers short status messages to the user
+type Notifier interface {
+	Notify(text string) error
+}
+
+// New returns the notifier selected by cfg. cl is only used when notifying
+// via "Saved Messages" and must be running; with a nil cl those
+// notifications are dropped.
+func New(cfg *config.NotifyConfig, bot *config.BotConfig, cl *client.Client) Notifier {
+	switch cfg.Via {
+	case "saved_messages":
+		if cl == nil {
+			return nopNotifier{}
+		}
+		return &savedMessages{client: cl}
+	case "bot":
+		return &botNotifier{token: bot.Token, proxy: bot.Proxy, chatID: cfg.ChatID}
+	}
+	return nopNotifier{}
+}
+
+// Switch is a Notifier whose target can be replaced while in use, e.g. when
+// the daemon reloads its config
+type Switch struct {
+	mu sync.RWMutex
+	n  Notifier
+}
+
+func NewSwitch(n Notifier) *Switch {
+	return &Switch{n: n}
+}
+
+// Set replaces the notifier used by later calls
+func (s *Switch) Set(n Notifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n = n
+}
+
+func (s *Switch) Notify(text string) error {
+	s.mu.RLock()
+	n := s.n
+	s.mu.RUnlock()
+	return n.Notify(text)
+}
+
+// Send notifies and only logs failures, so callers never fail because of it
+func Send(n Notifier, text string) {
+	if err := n.Notify(text); err != nil {
+		log.Warn.Printf("Failed to send notification: %v", err)
+	}
+}
+
+// maxMessageLength is Telegram's limit for a text message in UTF-16 units
+const maxMessageLength = 4096
+
+// Truncate shortens text to fit in one Telegram message
+func Truncate(text string) string {
+	const suffix = "\n…"
+	if len(utf16.Encode([]rune(text))) <= maxMessageLength {
+		return text
+	}
+
+	limit := maxMessageLength - len(utf16.Encode([]rune(suffix)))
+	units := 0
+	for i, r := range text {
+		w := utf16.RuneLen(r)
+		if w < 0 {
+			w = 1 // invalid runes are sent as U+FFFD
+		}
+		if units+w > limit {
+			return text[:i] + suffix
+		}
+		units += w
+	}
+	return text
+}
+
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(string) error { return nil }
+
+// savedMessages posts into the user account's own "Saved Messages" chat
+type savedMessages struct {
+	client *client.Client
+}
+
+func (n *savedMessages) Notify(text string) error {
+	_, err := n.client.SendMessage(&tg.InputPeerSelf{}, Truncate(text))
+	return err
+}
+
+// botNotifier sends a DM through the Bot API
+type botNotifier struct {
+	token  string
+	proxy  string
+	chatID int64
+}
+
+func (n *botNotifier) Notify(text string) error {
+	return callBotAPI(n.token, n.proxy, "sendMessage", map[string]any{
+		"chat_id": n.chatID,
+		"text":    Truncate(text),
+	}, nil)
+}
+
+// BotUsername asks the Bot API for the username of the bot of cfg
+func BotUsername(cfg *config.BotConfig) (string, error) {
+	if cfg.Token == "" {
+		return "", fmt.Errorf("bot.token is not set")
+	}
+	var me struct {
+		Username string `json:"username"`
+	}
+	if err := callBotAPI(cfg.Token, cfg.Proxy, "getMe", struct{}{}, &me); err != nil {
+		return "", err
+	}
+	return me.Username, nil
+}
+
+// callBotAPI calls a Bot API method with params as JSON and decodes its
+// result into result, unless that is nil
+func callBotAPI(token, proxy, method string, params, result any) error {
+	transport := &http.Transport{}
+	switch proxy {
+	case "direct":
+	case "":
+		transport.Proxy = dialer.ProxyFromEnvironment
+	default:
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid bot proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	httpClient := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("https://api.telegram.org/bot%s/%s", token, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// *url.Error embeds the request URL, which contains the bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var apiResp struct {
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&apiResp)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %s: %s", method, resp.Status, apiResp.Description)
+	}
+	if result != nil {
+		if err := json.Unmarshal(apiResp.Result, result); err != nil {
+			return fmt.Errorf("%s: invalid result: %w", method, err)
+		}
+	}
+	return nil
+}
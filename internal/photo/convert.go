@@ -0,0 +1,88 @@
+package photo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Formats Telegram does not show as photos and that are converted to JPEG
+// by an external tool first
+var (
+	heifExts = []string{".heic", ".heif"}
+	rawExts  = []string{".arw", ".cr2", ".cr3", ".dng", ".nef", ".orf", ".raf", ".rw2"}
+)
+
+// converters are the commands tried in order for each kind of file
+var converters = map[string][][]string{
+	"heif": {
+		{"heif-convert", "-q", "{quality}", "{in}", "{out}"},
+		{"magick", "{in}", "-quality", "{quality}", "{out}"},
+	},
+	"raw": {
+		{"magick", "{in}", "-quality", "{quality}", "{out}"},
+		{"darktable-cli", "{in}", "{out}"},
+	},
+}
+
+// Kind returns "heif" or "raw" for files that must be converted before they
+// can be sent as photos, "" for any other file
+func Kind(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case slices.Contains(heifExts, ext):
+		return "heif"
+	case slices.Contains(rawExts, ext):
+		return "raw"
+	}
+	return ""
+}
+
+// Convert converts the HEIC/HEIF or RAW image at path to a JPEG in dir with
+// the first converter found (libheif's heif-convert, ImageMagick or
+// darktable) and returns its path. ErrNotPhoto is returned when none is
+// installed. The caller removes the JPEG.
+func Convert(path, dir string, quality int) (string, error) {
+	kind := Kind(path)
+	if kind == "" {
+		return "", fmt.Errorf("%s is not a HEIF or RAW image", filepath.Base(path))
+	}
+
+	for _, args := range converters[kind] {
+		if !hasTool(args[0]) {
+			continue
+		}
+		out, err := os.CreateTemp(dir, "convert-*.jpg")
+		if err != nil {
+			return "", err
+		}
+		out.Close()
+		// darktable-cli refuses to overwrite its output
+		os.Remove(out.Name())
+
+		if err := runTool(args[0], expand(args[1:], path, out.Name(), quality)...); err != nil {
+			os.Remove(out.Name())
+			return "", fmt.Errorf("failed to convert %s: %w", filepath.Base(path), err)
+		}
+		return out.Name(), nil
+	}
+
+	var tools []string
+	for _, args := range converters[kind] {
+		tools = append(tools, args[0])
+	}
+	return "", fmt.Errorf("%w: converting %s needs one of %s", ErrNotPhoto, filepath.Base(path), strings.Join(tools, ", "))
+}
+
+// expand fills the {in}, {out} and {quality} placeholders of args
+func expand(args []string, in, out string, quality int) []string {
+	r := strings.NewReplacer("{in}", in, "{out}", out, "{quality}", strconv.Itoa(quality))
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = r.Replace(arg)
+	}
+	return expanded
+}
@@ -0,0 +1,227 @@
+package photo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exif is what is read from the EXIF of a photo
+type Exif struct {
+	Taken       time.Time // capture time, in the camera's local time
+	Make        string
+	Model       string
+	HasGPS      bool
+	Lat, Lon    float64
+	Orientation int // 1-8, 0 when unknown
+}
+
+// Camera is the make and model, without the make when the model repeats it
+func (e Exif) Camera() string {
+	if e.Make == "" || strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(e.Make)) {
+		return e.Model
+	}
+	return strings.TrimSpace(e.Make + " " + e.Model)
+}
+
+// EXIF tags
+const (
+	tagMake        = 0x010f
+	tagModel       = 0x0110
+	tagOrientation = 0x0112
+	tagExifIFD     = 0x8769
+	tagGPSIFD      = 0x8825
+	tagDateTaken   = 0x9003 // DateTimeOriginal
+	tagLatRef      = 0x0001
+	tagLat         = 0x0002
+	tagLonRef      = 0x0003
+	tagLon         = 0x0004
+)
+
+// typeSizes are the byte sizes of the TIFF field types used here
+var typeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// ReadExif reads the EXIF of a JPEG file. Other files and JPEGs without
+// EXIF return an empty Exif.
+func ReadExif(path string) (Exif, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Exif{}, err
+	}
+	defer f.Close()
+
+	raw, err := exifSegment(bufio.NewReader(f))
+	if err != nil || raw == nil {
+		return Exif{}, err
+	}
+	return parseExif(raw)
+}
+
+// exifSegment returns the TIFF data of the APP1 Exif segment of a JPEG,
+// nil when there is none
+func exifSegment(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return nil, nil
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, nil
+		}
+		if marker[0] != 0xff || marker[1] == 0xda { // start of the image data
+			return nil, nil
+		}
+		n := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if n < 0 {
+			return nil, nil
+		}
+		if marker[1] != 0xe1 {
+			if _, err := r.Discard(n); err != nil {
+				return nil, nil
+			}
+			continue
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("truncated EXIF: %w", err)
+		}
+		if raw, ok := bytes.CutPrefix(data, []byte("Exif\x00\x00")); ok {
+			return raw, nil
+		}
+	}
+}
+
+// tiff reads the IFDs of EXIF data
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// field is an IFD entry with its value bytes
+type field struct {
+	typ   uint16
+	count int
+	value []byte
+}
+
+var errBadExif = errors.New("malformed EXIF")
+
+func parseExif(raw []byte) (Exif, error) {
+	if len(raw) < 8 {
+		return Exif{}, errBadExif
+	}
+	t := tiff{b: raw}
+	switch string(raw[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return Exif{}, errBadExif
+	}
+
+	ifd0, err := t.ifd(t.order.Uint32(raw[4:]))
+	if err != nil {
+		return Exif{}, err
+	}
+	e := Exif{
+		Make:        t.str(ifd0[tagMake]),
+		Model:       t.str(ifd0[tagModel]),
+		Orientation: int(t.uint(ifd0[tagOrientation])),
+	}
+	if f, ok := ifd0[tagExifIFD]; ok {
+		if sub, err := t.ifd(t.uint(f)); err == nil {
+			e.Taken, _ = time.Parse("2006:01:02 15:04:05", t.str(sub[tagDateTaken]))
+		}
+	}
+	if f, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := t.ifd(t.uint(f)); err == nil {
+			lat, okLat := t.degrees(gps[tagLat])
+			lon, okLon := t.degrees(gps[tagLon])
+			if okLat && okLon {
+				if t.str(gps[tagLatRef]) == "S" {
+					lat = -lat
+				}
+				if t.str(gps[tagLonRef]) == "W" {
+					lon = -lon
+				}
+				e.HasGPS, e.Lat, e.Lon = true, lat, lon
+			}
+		}
+	}
+	return e, nil
+}
+
+// ifd reads the IFD at offset
+func (t tiff) ifd(offset uint32) (map[uint16]field, error) {
+	if uint64(offset)+2 > uint64(len(t.b)) {
+		return nil, errBadExif
+	}
+	n := int(t.order.Uint16(t.b[offset:]))
+	start := int(offset) + 2
+	if start+12*n > len(t.b) {
+		return nil, errBadExif
+	}
+	fields := make(map[uint16]field, n)
+	for i := range n {
+		entry := t.b[start+12*i : start+12*i+12]
+		typ, count := t.order.Uint16(entry[2:]), int(t.order.Uint32(entry[4:]))
+		size, ok := typeSizes[typ]
+		if !ok || count < 0 || count > len(t.b) {
+			continue
+		}
+		value := entry[8:12]
+		if size*count > 4 {
+			off := int(t.order.Uint32(entry[8:]))
+			if off < 0 || off+size*count > len(t.b) {
+				continue
+			}
+			value = t.b[off : off+size*count]
+		}
+		fields[t.order.Uint16(entry)] = field{typ: typ, count: count, value: value[:min(size*count, len(value))]}
+	}
+	return fields, nil
+}
+
+// str is an ASCII value without its NUL and padding
+func (t tiff) str(f field) string {
+	if f.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(f.value), "\x00")
+	return strings.TrimSpace(s)
+}
+
+// uint is a SHORT or LONG value
+func (t tiff) uint(f field) uint32 {
+	switch {
+	case f.typ == 3 && len(f.value) >= 2:
+		return uint32(t.order.Uint16(f.value))
+	case f.typ == 4 && len(f.value) >= 4:
+		return t.order.Uint32(f.value)
+	}
+	return 0
+}
+
+// degrees converts three RATIONALs of degrees, minutes and seconds
+func (t tiff) degrees(f field) (float64, bool) {
+	if f.typ != 5 || f.count != 3 || len(f.value) < 24 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num, den := t.order.Uint32(f.value[8*i:]), t.order.Uint32(f.value[8*i+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
@@ -0,0 +1,131 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+func ascii(tag uint16, s string) testEntry {
+	return testEntry{tag, 2, uint32(len(s) + 1), []byte(s + "\x00")}
+}
+
+func long(tag uint16, v int) testEntry {
+	return testEntry{tag, 4, 1, binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func dms(tag uint16, d, m, s100 uint32) testEntry {
+	var b []byte
+	for _, r := range [][2]uint32{{d, 1}, {m, 1}, {s100, 100}} {
+		b = binary.LittleEndian.AppendUint32(b, r[0])
+		b = binary.LittleEndian.AppendUint32(b, r[1])
+	}
+	return testEntry{tag, 5, 3, b}
+}
+
+// ifdBlock lays out an IFD at offset with its values right after it
+func ifdBlock(entries []testEntry, offset int) []byte {
+	le := binary.LittleEndian
+	b := le.AppendUint16(nil, uint16(len(entries)))
+	var data []byte
+	dataOff := offset + 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		b = le.AppendUint16(b, e.tag)
+		b = le.AppendUint16(b, e.typ)
+		b = le.AppendUint32(b, e.count)
+		if len(e.data) > 4 {
+			b = le.AppendUint32(b, uint32(dataOff+len(data)))
+			data = append(data, e.data...)
+		} else {
+			b = append(b, e.data...)
+			b = append(b, make([]byte, 4-len(e.data))...)
+		}
+	}
+	b = le.AppendUint32(b, 0)
+	return append(b, data...)
+}
+
+// writeJPEG writes a w×h JPEG whose EXIF has a date, camera, GPS position
+// and orientation
+func writeJPEG(t *testing.T, w, h, orientation int) string {
+	t.Helper()
+	exifIFD := []testEntry{ascii(tagDateTaken, "2024:05:03 14:22:10")}
+	gpsIFD := []testEntry{ascii(tagLatRef, "N"), dms(tagLat, 48, 51, 3012), ascii(tagLonRef, "W"), dms(tagLon, 2, 17, 4000)}
+	ifd0 := func(exifAt, gpsAt int) []testEntry {
+		return []testEntry{
+			ascii(tagMake, "Canon"), ascii(tagModel, "Canon EOS R5"), {tagOrientation, 3, 1, []byte{byte(orientation), 0}},
+			long(tagExifIFD, exifAt), long(tagGPSIFD, gpsAt),
+		}
+	}
+	size0 := len(ifdBlock(ifd0(0, 0), 8))
+	exifAt := 8 + size0
+	gpsAt := exifAt + len(ifdBlock(exifIFD, exifAt))
+
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	tiff = append(tiff, ifdBlock(ifd0(exifAt, gpsAt), 8)...)
+	tiff = append(tiff, ifdBlock(exifIFD, exifAt)...)
+	tiff = append(tiff, ifdBlock(gpsIFD, gpsAt)...)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	out := []byte{0xff, 0xd8, 0xff, 0xe1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(app1)+2))
+	out = append(out, app1...)
+	out = append(out, img.Bytes()[2:]...)
+
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadExif(t *testing.T) {
+	e, err := ReadExif(writeJPEG(t, 64, 48, 6))
+	if err != nil {
+		t.Fatalf("ReadExif: %v", err)
+	}
+	if want := time.Date(2024, 5, 3, 14, 22, 10, 0, time.UTC); !e.Taken.Equal(want) {
+		t.Fatalf("Taken = %v, want %v", e.Taken, want)
+	}
+	if e.Camera() != "Canon EOS R5" || e.Orientation != 6 {
+		t.Fatalf("camera %q, orientation %d", e.Camera(), e.Orientation)
+	}
+	if !e.HasGPS || math.Abs(e.Lat-48.858367) > 1e-5 || math.Abs(e.Lon+2.294444) > 1e-5 {
+		t.Fatalf("GPS = %v %f, %f", e.HasGPS, e.Lat, e.Lon)
+	}
+
+	if e, err := ReadExif(writePNG(t, 10, 10)); err != nil || e != (Exif{}) {
+		t.Fatalf("ReadExif(png) = %+v, %v, want nothing", e, err)
+	}
+}
+
+func TestPrepareRotates(t *testing.T) {
+	got, err := Prepare(writeJPEG(t, 300, 100, 6), t.TempDir(), 150, 87)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if cfg, _, err := image.DecodeConfig(f); err != nil || cfg.Width != 50 || cfg.Height != 150 {
+		t.Fatalf("rotated to %dx%d, %v; want 50x150", cfg.Width, cfg.Height, err)
+	}
+}
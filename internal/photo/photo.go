@@ -0,0 +1,151 @@
+// Package photo prepares images to be sent as Telegram photos
+package photo
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	stddraw "image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxBytes      = 10 * 1024 * 1024 // the largest file Telegram takes as a photo
+	maxDimensions = 10000            // width + height
+	maxRatio      = 20               // of the long to the short side
+	minQuality    = 50               // re-encoding stops lowering the quality here
+)
+
+// ErrNotPhoto is returned for images Telegram would not show as a photo
+// however they are scaled; they are sent as documents instead
+var ErrNotPhoto = errors.New("can't be sent as a photo")
+
+// Prepare returns the file to send for the image at path: path itself when
+// Telegram accepts it as a photo, otherwise a JPEG in dir whose longest side
+// is at most maxSide, encoded at quality (lowered while over 10MB). The
+// caller removes the returned file when it is not path.
+func Prepare(path, dir string, maxSide, quality int) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotPhoto, err)
+	}
+	w, h := cfg.Width, cfg.Height
+	if w == 0 || h == 0 || max(w, h) > maxRatio*min(w, h) {
+		return "", fmt.Errorf("%w: %dx%d is too narrow", ErrNotPhoto, w, h)
+	}
+	if info.Size() <= MaxBytes && max(w, h) <= maxSide && w+h <= maxDimensions {
+		return path, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", info.Name(), err)
+	}
+	scaled := scale(img, min(float64(maxSide)/float64(max(w, h)), float64(maxDimensions)/float64(w+h), 1))
+	if format == "jpeg" {
+		// The EXIF is not copied, so its rotation is applied to the pixels
+		if exif, err := ReadExif(path); err == nil {
+			scaled = orient(scaled, exif.Orientation)
+		}
+	}
+
+	out, err := os.CreateTemp(dir, "photo-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	for {
+		size, err := encode(out, scaled, quality)
+		if err == nil && size > MaxBytes && quality-10 < minQuality {
+			err = fmt.Errorf("%w: still %d bytes at quality %d", ErrNotPhoto, size, quality)
+		}
+		if err != nil {
+			os.Remove(out.Name())
+			return "", err
+		}
+		if size <= MaxBytes {
+			return out.Name(), nil
+		}
+		quality -= 10
+	}
+}
+
+// scale resizes img by factor onto white, which is what transparent areas
+// become in a JPEG
+func scale(img image.Image, factor float64) *image.RGBA {
+	b := img.Bounds()
+	w, h := max(int(float64(b.Dx())*factor+0.5), 1), max(int(float64(b.Dy())*factor+0.5), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	stddraw.Draw(dst, dst.Bounds(), image.White, image.Point{}, stddraw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, stddraw.Over, nil)
+	return dst
+}
+
+// orient turns img upright according to an EXIF orientation (1-8)
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2: // flip horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotate 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip vertically
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], img.Pix[img.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// encode overwrites f with img as a JPEG and returns its size
+func encode(f *os.File, img image.Image, quality int) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: quality}); err != nil {
+		return 0, fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+	return f.Seek(0, io.SeekCurrent)
+}
@@ -0,0 +1,61 @@
+package photo
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePNG(t *testing.T, w, h int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "image.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrepare(t *testing.T) {
+	dir := t.TempDir()
+	small := writePNG(t, 800, 600)
+	if got, err := Prepare(small, dir, 1280, 87); err != nil || got != small {
+		t.Fatalf("Prepare(800x600) = %q, %v, want the original", got, err)
+	}
+
+	got, err := Prepare(writePNG(t, 3000, 1000), dir, 1280, 87)
+	if err != nil {
+		t.Fatalf("Prepare(3000x1000): %v", err)
+	}
+	f, err := os.Open(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil || format != "jpeg" || cfg.Width != 1280 || cfg.Height != 427 {
+		t.Fatalf("resized to %s %dx%d, %v; want jpeg 1280x427", format, cfg.Width, cfg.Height, err)
+	}
+
+	if _, err := Prepare(writePNG(t, 2100, 100), dir, 1280, 87); !errors.Is(err, ErrNotPhoto) {
+		t.Fatalf("Prepare(2100x100) = %v, want ErrNotPhoto", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	if Kind("IMG_0001.HEIC") != "heif" || Kind("DSC_0001.nef") != "raw" || Kind("a.jpg") != "" {
+		t.Fatal("Kind misses HEIF or RAW extensions")
+	}
+	t.Setenv("PATH", t.TempDir())
+	_, err := Convert(filepath.Join(t.TempDir(), "IMG_0001.heic"), t.TempDir(), 87)
+	if !errors.Is(err, ErrNotPhoto) {
+		t.Fatalf("Convert without a converter = %v, want ErrNotPhoto", err)
+	}
+}
@@ -0,0 +1,102 @@
+package photo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+// Documents Preview renders
+var (
+	pdfExts    = []string{".pdf"}
+	officeExts = []string{".doc", ".docx", ".odt", ".rtf", ".xls", ".xlsx", ".ods", ".ppt", ".pptx", ".odp"}
+)
+
+// toolTimeout bounds each run of an external tool; LibreOffice can hang on
+// broken files
+const toolTimeout = 2 * time.Minute
+
+// HasPreview reports whether Preview can render the file at path
+func HasPreview(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return slices.Contains(pdfExts, ext) || slices.Contains(officeExts, ext)
+}
+
+// Preview renders the first page of the PDF or office document at path as
+// a JPEG in dir and returns its path. PDFs are rendered with pdftoppm
+// (poppler) or ImageMagick, office documents are converted to PDF with
+// LibreOffice first. ErrNotPhoto is returned when the tools are missing.
+// The caller removes the JPEG.
+func Preview(path, dir string) (string, error) {
+	work, err := os.MkdirTemp(dir, "preview-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(work)
+
+	pdf := path
+	if slices.Contains(officeExts, strings.ToLower(filepath.Ext(path))) {
+		if pdf, err = officeToPDF(path, work); err != nil {
+			return "", err
+		}
+	}
+
+	page := filepath.Join(work, "page.jpg")
+	switch {
+	case hasTool("pdftoppm"):
+		err = runTool("pdftoppm", "-jpeg", "-r", "110", "-f", "1", "-l", "1", "-singlefile", pdf, strings.TrimSuffix(page, ".jpg"))
+	case hasTool("magick"):
+		err = runTool("magick", "-density", "110", pdf+"[0]", "-background", "white", "-flatten", "-quality", "87", page)
+	default:
+		return "", fmt.Errorf("%w: previewing %s needs pdftoppm or magick", ErrNotPhoto, filepath.Base(path))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(dir, filepath.Base(work)+".jpg")
+	if err := util.ReplaceFile(page, out); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// officeToPDF converts an office document to a PDF in dir with LibreOffice
+func officeToPDF(path, dir string) (string, error) {
+	bin := ""
+	for _, name := range []string{"soffice", "libreoffice"} {
+		if hasTool(name) {
+			bin = name
+			break
+		}
+	}
+	if bin == "" {
+		return "", fmt.Errorf("%w: previewing %s needs LibreOffice (soffice)", ErrNotPhoto, filepath.Base(path))
+	}
+	if err := runTool(bin, "--headless", "--convert-to", "pdf", "--outdir", dir, path); err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	return filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name))+".pdf"), nil
+}
+
+func hasTool(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// runTool runs an external tool, returning its output on failure
+func runTool(name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), toolTimeout)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", name, err, output)
+	}
+	return nil
+}
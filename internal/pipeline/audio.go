@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/ui"
+
+	"github.com/gotd/td/tg"
+)
+
+// IsAudio reports whether fileName is sent as music for Telegram's player.
+// That needs ffprobe; without it music is sent as a plain document.
+func IsAudio(proc config.Processing, fileName string) bool {
+	return !proc.AsDocument && fileprocessor.NoteType(fileName) == "" &&
+		fileprocessor.IsAudioFile(fileName) && ffmpeg.Available() == nil
+}
+
+// audioCaption adds a line of the artist, title and album of a music file
+// to caption
+func audioCaption(filePath, caption string) string {
+	info, err := ffmpeg.ProbeAudio(filePath)
+	if err != nil {
+		logger.Warn.Printf("Failed to read the tags of %s - %v", filepath.Base(filePath), err)
+		return caption
+	}
+	empty := func(s string) bool { return s == "" }
+	line := strings.Join(slices.DeleteFunc([]string{info.Artist, info.Title}, empty), " — ")
+	line = strings.Join(slices.DeleteFunc([]string{line, info.Album}, empty), " · ")
+	if line == "" {
+		return caption
+	}
+	return caption + "\n🎵 " + line
+}
+
+// SendAudio sends a music file with the title, performer, duration and
+// embedded cover from its tags, so Telegram shows it in its player
+func SendAudio(cl *client.Client, cfg *config.MtprotoConfig, peer tg.InputPeerClass, filePath, caption string, maxSize int64) (files []index.File, err error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	fileName := filepath.Base(filePath)
+	if fileInfo.Size() > maxSize {
+		return nil, fmt.Errorf("%w: %s is larger than max_size and is sent whole, which can't be split", errs.ErrTooLarge, fileName)
+	}
+	info, err := ffmpeg.ProbeAudio(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	item := client.MediaItem{
+		FilePath:  filePath,
+		MediaType: "audio",
+		Caption:   caption,
+		Duration:  info.Duration,
+		Title:     info.Title,
+		Performer: info.Artist,
+	}
+	if info.HasCover {
+		if cover, err := extractCover(filePath, cfg.TempDir); err != nil {
+			// The player works without it
+			logger.Warn.Printf("No cover for %s - %v", fileName, err)
+		} else {
+			defer os.Remove(cover)
+			item.Thumb = cover
+		}
+	}
+
+	ui.EmitFileStarted(filePath, fileInfo.Size())
+	defer func() { ui.EmitFileResult(filePath, err) }()
+	msgID, err := cl.SendMedia(peer, item)
+	if err != nil {
+		return nil, err
+	}
+	return []index.File{{MessageID: msgID, Name: fileName, Size: fileInfo.Size()}}, nil
+}
+
+// extractCover writes the cover of a music file to a new JPEG in dir
+func extractCover(filePath, dir string) (string, error) {
+	f, err := os.CreateTemp(dir, "cover-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if err := ffmpeg.ExtractCover(filePath, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
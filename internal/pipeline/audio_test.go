@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+
+	"github.com/gotd/td/tg"
+)
+
+// fakeFFmpeg puts ffprobe and ffmpeg scripts first in PATH: ffprobe prints
+// the tags of a song with a cover, ffmpeg writes its last argument
+func fakeFFmpeg(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	bin := t.TempDir()
+	probe := `#!/bin/sh
+echo '{"streams": [{"codec_type": "audio"}, {"codec_type": "video", "disposition": {"attached_pic": 1}}],
+ "format": {"duration": "215.4", "tags": {"TITLE": "Song", "ARTIST": "Band", "ALBUM": "Record"}}}'
+`
+	scripts := map[string]string{
+		"ffprobe": probe,
+		"ffmpeg":  "#!/bin/sh\nfor last; do :; done\necho cover > \"$last\"\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+}
+
+func TestSendAudio(t *testing.T) {
+	fakeFFmpeg(t)
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{StorageChatID: chatID, TempDir: dir, MaxSizeBytes: 1 << 20}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "music_song.flac")
+	if err := os.WriteFile(path, []byte("fLaC"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	caption := Caption(cfg, path, "music", "song")
+	if caption != "#music song\n🎵 Band — Song · Record" {
+		t.Fatalf("caption = %q", caption)
+	}
+	if _, err := SendAudio(cl, cfg, peer, path, caption, cfg.MaxSizeBytes); err != nil {
+		t.Fatalf("SendAudio: %v", err)
+	}
+	doc := fake.Messages(chatID)[0].Media.(*tg.MessageMediaDocument).Document.(*tg.Document)
+	var audio *tg.DocumentAttributeAudio
+	for _, attr := range doc.Attributes {
+		if a, ok := attr.(*tg.DocumentAttributeAudio); ok {
+			audio = a
+		}
+	}
+	if audio == nil || audio.Title != "Song" || audio.Performer != "Band" || audio.Duration != 215 {
+		t.Fatalf("audio attribute = %+v", audio)
+	}
+	if covers, _ := filepath.Glob(filepath.Join(dir, "cover-*")); len(covers) != 0 {
+		t.Fatalf("cover left behind: %v", covers)
+	}
+}
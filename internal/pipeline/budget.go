@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+// WithinBudget returns the leading files of local_dir, in upload order,
+// that fit in what daily_budget leaves of today (since local midnight),
+// and a warning when the rest has to wait for the next day. On a day
+// nothing was uploaded yet the first file is always taken, so one larger
+// than the budget doesn't wait forever.
+func WithinBudget(store *index.Store, cfg *config.MtprotoConfig, processor *fileprocessor.Processor, files []string, now time.Time) ([]string, string) {
+	if cfg.DailyBudgetBytes <= 0 {
+		return files, ""
+	}
+	year, month, day := now.Date()
+	used := store.UploadedSince(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	for i, name := range files {
+		var size int64
+		if info, err := os.Stat(processor.GetFilePath(name)); err == nil {
+			size = info.Size()
+		}
+		if used > 0 && used+size > cfg.DailyBudgetBytes {
+			deferred := files[i:]
+			return files[:i], fmt.Sprintf("Daily budget of %s reached, %d file(s) (%s) left for tomorrow",
+				cfg.DailyBudget, len(deferred), util.FormatBytesToHumanReadable(processor.TotalSize(deferred)))
+		}
+		used += size
+	}
+	return files, ""
+}
@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"time"
+)
+
+func TestWithinBudget(t *testing.T) {
+	dir := t.TempDir()
+	store, err := index.Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	localDir := filepath.Join(dir, "local")
+	if err := os.Mkdir(localDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"a.mp4", "b.mp4", "c.mp4"}
+	for i, name := range files {
+		if err := os.WriteFile(filepath.Join(localDir, name), make([]byte, 400+100*i), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	processor := fileprocessor.NewProcessor(localDir, filepath.Join(dir, "done"))
+	cfg := &config.MtprotoConfig{DailyBudget: "1KB", DailyBudgetBytes: 1024}
+	now := time.Date(2026, 5, 2, 12, 0, 0, 0, time.Local)
+
+	kept, w := WithinBudget(store, cfg, processor, files, now)
+	if !slices.Equal(kept, files[:2]) || !strings.HasPrefix(w, "Daily budget of 1KB reached, 1 file(s)") {
+		t.Errorf("empty day = %v, %q, want a and b", kept, w)
+	}
+
+	// Uploads of yesterday and imports don't count
+	for _, e := range []*index.Entry{
+		{Size: 300, CreatedAt: now.Add(-time.Hour)},
+		{Size: 5000, CreatedAt: now.Add(-24 * time.Hour)},
+		{Size: 5000, Source: "import", CreatedAt: now},
+	} {
+		if err := store.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if kept, _ := WithinBudget(store, cfg, processor, files, now); !slices.Equal(kept, files[:1]) {
+		t.Errorf("after 300 bytes = %v, want a", kept)
+	}
+
+	// A file larger than the budget goes alone on a day with nothing else
+	cfg.DailyBudgetBytes = 100
+	if kept, _ := WithinBudget(store, cfg, processor, files, now.Add(24*time.Hour)); !slices.Equal(kept, files[:1]) {
+		t.Errorf("next day = %v, want a alone", kept)
+	}
+	if kept, _ := WithinBudget(store, cfg, processor, files, now); len(kept) != 0 {
+		t.Errorf("spent budget = %v, want none", kept)
+	}
+
+	cfg.DailyBudgetBytes = 0
+	if kept, w := WithinBudget(store, cfg, processor, files, now); !slices.Equal(kept, files) || w != "" {
+		t.Errorf("no budget = %v, %q", kept, w)
+	}
+}
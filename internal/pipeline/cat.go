@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/index"
+)
+
+// Cat writes the media of message msgID in chatID to w as it downloads.
+// When the index knows the message as part of a split upload, all parts
+// are written in order, so a piped upload comes out whole. Split videos
+// need ffmpeg to be joined and are refused; cli restore handles them.
+func Cat(cl *client.Client, store *index.Store, chatID int64, msgID int, w io.Writer) error {
+	ids := []int{msgID}
+	if entry, ok := store.FindMessage(chatID, msgID); ok {
+		files := OriginalFiles(entry)
+		if entry.MediaType == "video" && len(files) > 1 {
+			return fmt.Errorf("media %d is a video split in %d parts, restore it instead", entry.ID, len(files))
+		}
+		if len(files) > 1 {
+			ids = ids[:0]
+			for _, f := range files {
+				ids = append(ids, f.MessageID)
+			}
+		}
+	}
+
+	msgs, err := cl.GetMessages(chatID, ids)
+	if err != nil {
+		return err
+	}
+	if len(msgs) != len(ids) {
+		return fmt.Errorf("%d of %d messages are gone from the chat", len(ids)-len(msgs), len(ids))
+	}
+	for _, msg := range msgs {
+		if err := cl.StreamMessageMedia(msg, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
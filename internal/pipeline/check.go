@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/video"
+	"time"
+)
+
+// ErrBroken means a file can't be uploaded as it is, retrying won't help
+var ErrBroken = errs.ErrBroken
+
+// CheckInput tells apart files that would only fail deep inside
+// processing: unreadable or empty ones, and with probe (videos going
+// through ffmpeg) those ffprobe finds no duration in.
+func CheckInput(filePath string, probe bool) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("%w: can't open it: %w", ErrBroken, err)
+	}
+	defer f.Close()
+	n, err := f.Read(make([]byte, 1))
+	switch {
+	case n == 0 && (err == nil || err == io.EOF):
+		return fmt.Errorf("%w: it is empty", ErrBroken)
+	case n == 0:
+		return fmt.Errorf("%w: can't read it: %w", ErrBroken, err)
+	}
+
+	if !probe || ffmpeg.Available() != nil {
+		return nil
+	}
+	duration, err := ffmpeg.ProbeDuration(filePath)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: ffprobe can't read it: %w", ErrBroken, err)
+	case duration <= 0:
+		return fmt.Errorf("%w: ffprobe finds a duration of %gs", ErrBroken, duration)
+	}
+	return nil
+}
+
+// Quarantine moves name, found broken by CheckInput, from local_dir to
+// quarantine_dir with a <name>.txt telling why. Without quarantine_dir it
+// stays in local_dir.
+func Quarantine(cfg *config.MtprotoConfig, name string, reason error) {
+	if cfg.QuarantineDir == "" {
+		logger.Error.Printf("%s is broken, fix or remove it - %v", name, reason)
+		return
+	}
+	moved, err := video.QuarantineFile(cfg, name)
+	if err != nil {
+		logger.Error.Printf("%s is broken but failed to quarantine it - %v (%v)", name, reason, err)
+		return
+	}
+	note := fmt.Sprintf("%s\n%s\n%v\n", filepath.Base(moved), time.Now().Format(time.DateTime), reason)
+	if err := os.WriteFile(moved+".txt", []byte(note), 0o644); err != nil {
+		logger.Warn.Printf("Failed to write why %s is quarantined - %v", name, err)
+	}
+	logger.Error.Printf("%s is broken, moved it to %s - %v", name, cfg.QuarantineDir, reason)
+}
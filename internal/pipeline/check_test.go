@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/config"
+)
+
+func TestCheckInputQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{LocalDir: filepath.Join(dir, "local"), QuarantineDir: filepath.Join(dir, "quarantine")}
+	for _, d := range []string{cfg.LocalDir, cfg.QuarantineDir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	empty := filepath.Join(cfg.LocalDir, "#trip empty.mp4")
+	fine := filepath.Join(cfg.LocalDir, "#trip notes.txt")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fine, []byte("notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckInput(fine, false); err != nil {
+		t.Errorf("CheckInput(%s) = %v", fine, err)
+	}
+	if err := CheckInput(filepath.Join(cfg.LocalDir, "gone.mp4"), true); !errors.Is(err, ErrBroken) {
+		t.Errorf("missing file: %v, want ErrBroken", err)
+	}
+	err := CheckInput(empty, true)
+	if !errors.Is(err, ErrBroken) {
+		t.Fatalf("empty file: %v, want ErrBroken", err)
+	}
+
+	Quarantine(cfg, filepath.Base(empty), err)
+	if _, err := os.Stat(empty); !os.IsNotExist(err) {
+		t.Errorf("%s is still in local_dir", empty)
+	}
+	note, err := os.ReadFile(filepath.Join(cfg.QuarantineDir, "#trip empty.mp4.txt"))
+	if err != nil || !strings.Contains(string(note), "it is empty") {
+		t.Errorf("diagnostic = %q, %v", note, err)
+	}
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"fmt"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/video"
+
+	"github.com/gotd/td/tg"
+)
+
+// maxAlbum is Telegram's limit of items in one album
+const maxAlbum = 10
+
+// FindUploaded looks in the storage chat for an earlier upload with the same
+// caption, for users whose index was lost. Documents must also match in
+// size; videos are split and converted, so only the caption is compared.
+// It returns nil when duplicate_check is off or nothing matches.
+func FindUploaded(cl *client.Client, cfg *config.MtprotoConfig, tag, description, caption string, size int64, asDocument bool) (*index.Entry, error) {
+	if cfg.DuplicateCheck == "off" {
+		return nil, nil
+	}
+
+	msgs, err := cl.FindCaption(cfg.StorageChatID, caption, cfg.DuplicateScan)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate check failed: %w", err)
+	}
+	for _, msg := range msgs {
+		if asDocument && client.DocumentSize(msg) != size {
+			continue
+		}
+
+		files, err := albumFiles(cl, cfg.StorageChatID, msg)
+		if err != nil {
+			return nil, fmt.Errorf("duplicate check failed: %w", err)
+		}
+		entry := &index.Entry{
+			ChatID:      cfg.StorageChatID,
+			Files:       files,
+			Tag:         tag,
+			Description: description,
+			Caption:     caption,
+			MediaType:   "video",
+			Source:      "history",
+			Size:        size,
+			Parts:       len(files) - 1,
+		}
+		if asDocument {
+			entry.MediaType, entry.Parts = "document", 0
+		} else if _, ok := msg.Media.(*tg.MessageMediaPhoto); ok && len(files) == 1 {
+			// Videos are albums behind their preview, a photo stands alone
+			entry.MediaType, entry.Parts = "photo", 0
+		}
+		return entry, nil
+	}
+	return nil, nil
+}
+
+// ContentHash returns the SHA-256 of filePath when done_naming is hash or
+// versioning is on, otherwise ""
+func ContentHash(cfg *config.MtprotoConfig, filePath string) (string, error) {
+	if !hashed(cfg) {
+		return "", nil
+	}
+	return fileprocessor.SHA256(filePath)
+}
+
+// hashed reports whether uploads record the SHA-256 of their content
+func hashed(cfg *config.MtprotoConfig) bool {
+	return cfg.DoneNaming == "hash" || cfg.Versioning
+}
+
+// FindHashed returns the indexed upload of the same content, nil when
+// duplicate_check is off or sum is unknown. Unlike FindUploaded, the entry
+// is already in the index.
+func FindHashed(store *index.Store, cfg *config.MtprotoConfig, sum string) *index.Entry {
+	if cfg.DuplicateCheck == "off" || sum == "" {
+		return nil
+	}
+	entry, _ := store.FindSHA256(sum)
+	return entry
+}
+
+// KnownFile finds video parts in the index for video.ProcessVideo, which
+// sends them again by reference
+func KnownFile(store *index.Store) video.KnownFile {
+	return func(sum string, size int64) (int64, int, bool) {
+		entry, f, ok := store.FindFile(sum, size)
+		if !ok {
+			return 0, 0, false
+		}
+		return entry.ChatID, f.MessageID, true
+	}
+}
+
+// albumFiles returns the messages of the album msg starts, or just msg
+func albumFiles(cl *client.Client, chatID int64, msg *tg.Message) ([]index.File, error) {
+	files := []index.File{{MessageID: msg.ID}}
+	if msg.GroupedID == 0 {
+		return files, nil
+	}
+
+	ids := make([]int, 0, maxAlbum-1)
+	for id := msg.ID + 1; id < msg.ID+maxAlbum; id++ {
+		ids = append(ids, id)
+	}
+	msgs, err := cl.GetMessages(chatID, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		if m.GroupedID == msg.GroupedID {
+			files = append(files, index.File{MessageID: m.ID, Size: client.DocumentSize(m)})
+		}
+	}
+	return files, nil
+}
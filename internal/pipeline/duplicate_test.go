@@ -0,0 +1,72 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/priority"
+	"tg-storage-assistant/internal/retry"
+	"time"
+)
+
+func TestHashDoneNaming(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{
+		StorageChatID:  chatID,
+		LocalDir:       filepath.Join(dir, "local"),
+		DoneDir:        filepath.Join(dir, "done"),
+		MaxSizeBytes:   1 << 20,
+		DuplicateCheck: "skip",
+		DoneNaming:     "hash",
+	}
+	for _, d := range []string{cfg.LocalDir, cfg.DoneDir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	store, err := index.Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := retry.Open(filepath.Join(dir, "retry.json"), 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marks, err := priority.Open(filepath.Join(dir, "priority.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(client.NewWithAPI(context.Background(), cfg, fake), cfg, store)
+
+	// The same content under two names is uploaded once
+	for _, name := range []string{"notes_first.txt", "notes_second.txt"} {
+		if err := os.WriteFile(filepath.Join(cfg.LocalDir, name), []byte("same content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := p.UploadLocal("notes_first.txt", q, marks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.UploadLocal("notes_second.txt", q, marks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.SHA256) != 64 || second.ID != first.ID || len(fake.Messages(chatID)) != 1 {
+		t.Fatalf("first = %+v, second = %+v, %d messages", first, second, len(fake.Messages(chatID)))
+	}
+
+	for _, name := range []string{"notes_first.txt", "notes_second.txt"} {
+		done := filepath.Join(cfg.DoneDir, first.SHA256[:16]+"__"+name)
+		if _, err := os.Stat(done); err != nil {
+			t.Fatalf("%s not in done_dir by hash: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// Import posts the media of messages ids of chatID, which the account can
+// read, into the storage chat by reference and indexes each as its own
+// entry. Nothing is downloaded or uploaded, so it is instant whatever the
+// size. An empty description takes the original caption, file name or
+// date.
+func (p *Pipeline) Import(chatID int64, ids []int, tag, description string) ([]*index.Entry, error) {
+	msgs, err := p.client.GetMessages(chatID, ids)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := p.client.ResolvePeer(p.cfg.StorageChatID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve peer: %w", err)
+	}
+
+	var entries []*index.Entry
+	for _, msg := range msgs {
+		var name string
+		var size int64
+		switch msg.Media.(type) {
+		case *tg.MessageMediaPhoto:
+		case *tg.MessageMediaDocument:
+			name, size = client.MediaName(msg), client.DocumentSize(msg)
+		default:
+			return entries, fmt.Errorf("message %d has no photo or document", msg.ID)
+		}
+		desc := importDescription(msg, name, description)
+		caption := fileprocessor.BuildCaption(tag, desc)
+		msgID, err := p.client.SendMedia(peer, client.MediaItem{Existing: msg, Caption: caption})
+		if err != nil {
+			return entries, fmt.Errorf("import message %d failed: %w", msg.ID, err)
+		}
+
+		entry := &index.Entry{
+			ChatID:      p.cfg.StorageChatID,
+			Files:       []index.File{{MessageID: msgID, Name: name, Size: size}},
+			Tag:         tag,
+			Description: desc,
+			Caption:     caption,
+			FileName:    name,
+			MediaType:   mediaType(msg),
+			Source:      "import",
+			Size:        size,
+		}
+		if name == "" {
+			entry.FileName = tag + "_" + strings.ReplaceAll(desc, " ", "_") + ".jpg"
+		}
+		if entry.MediaType == "video" {
+			entry.Parts = 1
+		}
+		Mirror(p.client, p.cfg, entry)
+		if err := p.store.Add(entry); err != nil {
+			logger.Warn.Printf("Imported message %d but failed to update index - %v", msg.ID, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// importDescription is description, or else the first line of the caption
+// of msg, the file name of its document or the date it was sent
+func importDescription(msg *tg.Message, name, description string) string {
+	if description != "" {
+		return description
+	}
+	if line, _, _ := strings.Cut(strings.TrimSpace(msg.Message), "\n"); line != "" {
+		return line
+	}
+	if name != "" {
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return time.Unix(int64(msg.Date), 0).Format(time.DateOnly)
+}
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestImport(t *testing.T) {
+	const storageID, otherID = int64(-1001234567890), int64(-1009876543210)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{StorageChatID: storageID}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(storageID, "storage")
+	fake.AddChannel(otherID, "friends")
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+	store, err := index.Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cl.ResolvePeer(otherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "talk.pdf")
+	if err := os.WriteFile(path, make([]byte, 40), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.SendMedia(other, client.MediaItem{FilePath: path, MediaType: "document", Caption: "Slides of the talk\nenjoy"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.SendMessage(other, "no media"); err != nil {
+		t.Fatal(err)
+	}
+	original := fake.Messages(otherID)[0]
+
+	entries, err := New(cl, cfg, store).Import(otherID, []int{original.ID}, "work", "")
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	msgs := fake.Messages(storageID)
+	if len(entries) != 1 || len(msgs) != 1 {
+		t.Fatalf("%d entries and %d messages, want 1", len(entries), len(msgs))
+	}
+	doc := func(m *tg.Message) int64 { return m.Media.(*tg.MessageMediaDocument).Document.GetID() }
+	if doc(msgs[0]) != doc(original) || msgs[0].Message != "#work Slides of the talk" {
+		t.Errorf("sent document %d with %q, want %d referred to with the first caption line", doc(msgs[0]), msgs[0].Message, doc(original))
+	}
+	e := entries[0]
+	if e.MessageID() != msgs[0].ID || e.FileName != "talk.pdf" || e.Size != 40 || e.MediaType != "document" || e.Source != "import" {
+		t.Errorf("entry = %+v", e)
+	}
+	if _, ok := store.Get(e.ID); !ok {
+		t.Error("entry not in the index")
+	}
+
+	if _, err := New(cl, cfg, store).Import(otherID, []int{original.ID + 1}, "work", ""); err == nil {
+		t.Error("Import of a text message succeeded")
+	}
+}
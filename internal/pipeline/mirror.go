@@ -0,0 +1,23 @@
+package pipeline
+
+import (
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+)
+
+// Mirror copies the messages of a new entry to every mirror chat and records
+// the copies in entry.Mirrors. The upload already succeeded, so a mirror
+// that fails is only logged.
+func Mirror(cl *client.Client, cfg *config.MtprotoConfig, entry *index.Entry) {
+	for _, chatID := range cfg.Mirrors {
+		ids, err := cl.CopyMessages(entry.ChatID, chatID, entry.MessageIDs())
+		if err != nil {
+			logger.Warn.Printf("Failed to mirror %s to %d - %v", entry.FileName, chatID, err)
+			continue
+		}
+		entry.Mirrors = append(entry.Mirrors, index.Mirror{ChatID: chatID, MessageIDs: ids})
+		logger.Info.Printf("Mirrored %s to %d (%d messages)", entry.FileName, chatID, len(ids))
+	}
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+)
+
+// ParseName returns the tag and description of the file at path: from the
+// first matching filename template, then TAG_DESCRIPTION, then with
+// filename_fallback dir the directory name as tag and the name as
+// description. The tag is made a valid hashtag.
+func ParseName(cfg *config.MtprotoConfig, path string) (tag, description string, err error) {
+	tag, description, err = parseName(cfg, path)
+	if err != nil {
+		return "", "", err
+	}
+	return sanitizeTag(cfg, tag, description, filepath.Base(path))
+}
+
+func parseName(cfg *config.MtprotoConfig, path string) (tag, description string, err error) {
+	name := filepath.Base(path)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+
+	for _, t := range cfg.FilenameTemplates {
+		m := t.Regexp.FindStringSubmatch(stem)
+		if m == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for i, group := range t.Regexp.SubexpNames() {
+			if group != "" {
+				groups[group] = strings.TrimSpace(m[i])
+			}
+		}
+		tag := groups["tag"]
+		if tag == "" {
+			tag = dirTag(path)
+		}
+		var parts []string
+		for _, group := range []string{"series", "episode", "description", "date"} {
+			if groups[group] != "" {
+				parts = append(parts, strings.ReplaceAll(groups[group], " ", "_"))
+			}
+		}
+		if tag == "" || len(parts) == 0 {
+			return "", "", fmt.Errorf("template %s matched %s without a tag or description", t.Name, name)
+		}
+		return tag, strings.Join(parts, "_"), nil
+	}
+
+	tag, description, err = fileprocessor.ParseFilename(name)
+	if err == nil || cfg.FilenameFallback != "dir" {
+		return tag, description, err
+	}
+	if tag := dirTag(path); tag != "" {
+		return tag, strings.ReplaceAll(stem, " ", "_"), nil
+	}
+	return "", "", err
+}
+
+// sanitizeTag makes tag a hashtag. If that changed more than its spaces,
+// the original tag leads the description so the caption still shows it.
+func sanitizeTag(cfg *config.MtprotoConfig, tag, description, name string) (string, string, error) {
+	clean := fileprocessor.SanitizeTag(tag, cfg.TagTransliteration == "ascii")
+	if clean == "" {
+		return "", "", fmt.Errorf("tag %q of %s has no letters or digits", tag, name)
+	}
+	if clean != strings.ReplaceAll(tag, " ", "_") {
+		description = strings.ReplaceAll(tag, " ", "_") + "_" + description
+	}
+	return clean, description, nil
+}
+
+// dirTag is the name of the directory of path
+func dirTag(path string) string {
+	dir := filepath.Base(filepath.Dir(path))
+	if dir == "." || dir == string(filepath.Separator) {
+		return ""
+	}
+	return dir
+}
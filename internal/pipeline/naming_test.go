@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"testing"
+	"tg-storage-assistant/internal/config"
+)
+
+func TestParseName(t *testing.T) {
+	cfg := &config.MtprotoConfig{
+		FilenameTemplates: []config.FilenameTemplate{
+			{Name: "episodes", Pattern: `^(?P<series>.+?)\.(?P<episode>S\d+E\d+)(?:\.(?P<description>.*))?$`},
+			{Name: "dated", Pattern: `^(?P<date>\d{4}-\d{2}-\d{2}) (?P<tag>\w+) (?P<description>.+)$`},
+		},
+		FilenameFallback: "dir",
+	}
+	for i := range cfg.FilenameTemplates {
+		if err := cfg.FilenameTemplates[i].Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct{ path, tag, description string }{
+		{"/lib/My Show/Show.S01E02.Pilot.mkv", "My_Show", "Show_S01E02_Pilot"},
+		{"/lib/x/2024-05-01 trips Lake day.mp4", "trips", "Lake_day_2024-05-01"},
+		{"/lib/x/vlog_first_day.mp4", "vlog", "first_day"},
+		{"/lib/Home Videos/birthday.mp4", "Home_Videos", "birthday"},
+		{"/lib/x/🎬 films_Lake day.mp4", "films", "🎬_films_Lake day"},
+	} {
+		tag, description, err := ParseName(cfg, tt.path)
+		if err != nil || tag != tt.tag || description != tt.description {
+			t.Errorf("ParseName(%s) = %q, %q, %v; want %q, %q", tt.path, tag, description, err, tt.tag, tt.description)
+		}
+	}
+
+	cfg.FilenameFallback = "none"
+	if _, _, err := ParseName(cfg, "/lib/x/birthday.mp4"); err == nil {
+		t.Error("a name without a tag was accepted without the dir fallback")
+	}
+	bad := config.FilenameTemplate{Pattern: `(?P<season>\d+)`}
+	if err := bad.Validate(); err == nil {
+		t.Error("unknown group accepted")
+	}
+}
@@ -0,0 +1,197 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/photo"
+	"tg-storage-assistant/internal/ui"
+
+	"github.com/gotd/td/tg"
+)
+
+// Caption is the caption of the file at filePath: #TAG DESCRIPTION, then
+// for images the photo_date_tag and a line of the photo_exif fields, for
+// music a line of its artist, title and album, and with caption_mtime a
+// line of its modification time
+func Caption(cfg *config.MtprotoConfig, filePath, tag, description string) string {
+	caption := fileprocessor.BuildCaption(tag, description)
+	switch {
+	case fileprocessor.IsImageFile(filePath):
+		caption = exifCaption(cfg, filePath, caption)
+	case IsAudio(cfg.Processing(tag), filePath):
+		caption = audioCaption(filePath, caption)
+	}
+	if cfg.CaptionMTime {
+		if info, err := os.Stat(filePath); err == nil {
+			caption += fileprocessor.ModTimeLine(info.ModTime())
+		}
+	}
+	return caption
+}
+
+// exifCaption adds the photo_date_tag and photo_exif fields to caption
+func exifCaption(cfg *config.MtprotoConfig, filePath, caption string) string {
+	if len(cfg.PhotoExif) == 0 && !cfg.PhotoDateTag {
+		return caption
+	}
+	exif, err := photo.ReadExif(filePath)
+	if err != nil {
+		logger.Warn.Printf("Failed to read the EXIF of %s - %v", filepath.Base(filePath), err)
+		return caption
+	}
+
+	if cfg.PhotoDateTag && !exif.Taken.IsZero() {
+		caption += exif.Taken.Format(" #2006_01")
+	}
+	var details []string
+	for _, field := range cfg.PhotoExif {
+		switch {
+		case field == "date" && !exif.Taken.IsZero():
+			details = append(details, "📅 "+exif.Taken.Format("2006-01-02 15:04"))
+		case field == "camera" && exif.Camera() != "":
+			details = append(details, "📷 "+exif.Camera())
+		case field == "gps" && exif.HasGPS:
+			details = append(details, fmt.Sprintf("📍 %.5f, %.5f", exif.Lat, exif.Lon))
+		}
+	}
+	if len(details) > 0 {
+		caption += "\n" + strings.Join(details, " · ")
+	}
+	return caption
+}
+
+// IsPhoto reports whether fileName is sent as a photo: images, and camera
+// RAW files with photo_convert_raw, unless a rule sends them as documents
+func IsPhoto(cfg *config.MtprotoConfig, proc config.Processing, fileName string) bool {
+	if proc.AsDocument {
+		return false
+	}
+	return fileprocessor.IsImageFile(fileName) || (cfg.PhotoConvertRaw && photo.Kind(fileName) == "raw")
+}
+
+// SendPhoto sends the image at filePath as a photo, converted to JPEG first
+// when it is HEIF or RAW and scaled down when Telegram would reject it.
+// With photo_originals the file itself follows as a document: albums can't
+// mix photos and documents. Images that can't be photos at all are sent as
+// documents. It returns the sent files and the media type of the first.
+func SendPhoto(cl *client.Client, cfg *config.MtprotoConfig, peer tg.InputPeerClass, filePath, caption string, maxSize int64) (files []index.File, mediaType string, err error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	ui.EmitFileStarted(filePath, fileInfo.Size())
+	defer func() { ui.EmitFileResult(filePath, err) }()
+
+	fileName := filepath.Base(filePath)
+	original := index.File{Name: fileName, Size: fileInfo.Size()}
+	sendOriginal := func(caption string) error {
+		if fileInfo.Size() > maxSize {
+			return fmt.Errorf("%w: %s is larger than max_size and is sent as a document, which can't be split", errs.ErrTooLarge, fileName)
+		}
+		id, err := cl.SendMedia(peer, client.MediaItem{FilePath: filePath, MediaType: "document", Caption: caption})
+		original.MessageID = id
+		return err
+	}
+
+	source := filePath
+	if photo.Kind(filePath) != "" {
+		source, err = photo.Convert(filePath, cfg.TempDir, cfg.PhotoQuality)
+		if err == nil {
+			defer os.Remove(source)
+			logger.Info.Printf("Converted %s to JPEG", fileName)
+		}
+	}
+	sent := source
+	if err == nil {
+		sent, err = photo.Prepare(source, cfg.TempDir, cfg.PhotoMaxSide, cfg.PhotoQuality)
+	}
+	if errors.Is(err, photo.ErrNotPhoto) {
+		logger.Warn.Printf("%s %v, sending it as a document", fileName, err)
+		if err := sendOriginal(caption); err != nil {
+			return nil, "", err
+		}
+		return []index.File{original}, "document", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to prepare photo: %w", err)
+	}
+	if sent != source {
+		defer os.Remove(sent)
+		logger.Info.Printf("Scaled %s down to be sent as a photo", fileName)
+	}
+
+	msgID, err := cl.SendMedia(peer, client.MediaItem{FilePath: sent, MediaType: "photo", Caption: caption})
+	if err != nil {
+		return nil, "", err
+	}
+	files = []index.File{{MessageID: msgID, Name: fileName}}
+	if info, err := os.Stat(sent); err == nil {
+		files[0].Size = info.Size()
+	}
+	if cfg.PhotoOriginals {
+		if err := sendOriginal(""); err != nil {
+			// The photo is stored, the original stays in done_dir
+			logger.Warn.Printf("Sent %s as a photo but not the original - %v", fileName, err)
+		} else {
+			files = append(files, original)
+		}
+	}
+	return files, "photo", nil
+}
+
+// SendDocument sends filePath whole as a document. With document_previews
+// a picture of the first page of PDFs and office documents is sent right
+// before it; the document comes first in the returned files and carries
+// the caption, so duplicate checks and downloads find it.
+func SendDocument(cl *client.Client, cfg *config.MtprotoConfig, peer tg.InputPeerClass, filePath, caption string, maxSize int64) (files []index.File, err error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	fileName := filepath.Base(filePath)
+	if fileInfo.Size() > maxSize {
+		return nil, fmt.Errorf("%w: %s is larger than max_size and is sent as a document, which can't be split", errs.ErrTooLarge, fileName)
+	}
+
+	ui.EmitFileStarted(filePath, fileInfo.Size())
+	defer func() { ui.EmitFileResult(filePath, err) }()
+
+	var preview *index.File
+	if cfg.DocumentPreviews && photo.HasPreview(filePath) {
+		// A document without its preview is still worth storing
+		if page, err := photo.Preview(filePath, cfg.TempDir); err != nil {
+			logger.Warn.Printf("No preview of %s - %v", fileName, err)
+		} else {
+			defer os.Remove(page)
+			if id, err := cl.SendMedia(peer, client.MediaItem{FilePath: page, MediaType: "photo"}); err != nil {
+				logger.Warn.Printf("Failed to send the preview of %s - %v", fileName, err)
+			} else {
+				preview = &index.File{MessageID: id, Name: filepath.Base(page)}
+			}
+		}
+	}
+
+	msgID, err := cl.SendMedia(peer, client.MediaItem{FilePath: filePath, MediaType: "document", Caption: caption})
+	if err != nil {
+		if preview != nil {
+			if err := cl.DeleteMessages(cfg.StorageChatID, []int{preview.MessageID}); err != nil {
+				logger.Warn.Printf("Failed to delete the preview of %s - %v", fileName, err)
+			}
+		}
+		return nil, err
+	}
+	files = []index.File{{MessageID: msgID, Name: fileName, Size: fileInfo.Size()}}
+	if preview != nil {
+		files = append(files, *preview)
+	}
+	return files, nil
+}
@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestUploadPhotoWithOriginal(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{
+		StorageChatID:  chatID,
+		TempDir:        dir,
+		MaxSizeBytes:   20 << 20,
+		DuplicateCheck: "off",
+		PhotoMaxSide:   1280,
+		PhotoQuality:   87,
+		PhotoOriginals: true,
+	}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	store, err := index.Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(client.NewWithAPI(context.Background(), cfg, fake), cfg, store)
+
+	path := filepath.Join(dir, "beach_sunset.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 3000, 2000))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	info, _ := os.Stat(path)
+
+	entry, err := p.Upload(path, "beach", "sunset", "test")
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	msgs := fake.Messages(chatID)
+	if entry.MediaType != "photo" || len(entry.Files) != 2 || len(msgs) != 2 {
+		t.Fatalf("entry = %+v, %d messages, want the photo and the original", entry, len(msgs))
+	}
+	if _, ok := msgs[0].Media.(*tg.MessageMediaPhoto); !ok || msgs[0].Message != "#beach sunset" {
+		t.Fatalf("first message = %T %q, want the captioned photo", msgs[0].Media, msgs[0].Message)
+	}
+	if size := client.DocumentSize(msgs[1]); size != info.Size() {
+		t.Fatalf("original document size = %d, want %d", size, info.Size())
+	}
+	if scaled, _ := filepath.Glob(filepath.Join(dir, "photo-*.jpg")); len(scaled) != 0 {
+		t.Fatalf("scaled photo left behind: %v", scaled)
+	}
+}
+
+func TestSendDocumentPreview(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake pdftoppm is a shell script")
+	}
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{StorageChatID: chatID, TempDir: dir, DocumentPreviews: true}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pdftoppm writes <prefix>.jpg, its last argument
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\necho page > \"$last.jpg\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "pdftoppm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	pdf := filepath.Join(dir, "manual.pdf")
+	if err := os.WriteFile(pdf, []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := SendDocument(cl, cfg, peer, pdf, "#docs manual", 1<<20)
+	if err != nil {
+		t.Fatalf("SendDocument: %v", err)
+	}
+	msgs := fake.Messages(chatID)
+	if len(files) != 2 || len(msgs) != 2 || files[0].MessageID != msgs[1].ID || msgs[1].Message != "#docs manual" {
+		t.Fatalf("files = %+v, messages = %+v, want the preview then the captioned document", files, msgs)
+	}
+	if _, ok := msgs[0].Media.(*tg.MessageMediaPhoto); !ok {
+		t.Fatalf("preview is a %T", msgs[0].Media)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "preview-*")); len(left) != 0 {
+		t.Fatalf("preview files left behind: %v", left)
+	}
+}
@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/ui"
+	"tg-storage-assistant/internal/video"
+)
+
+// Pipeline uploads a local file to the storage chat and records it in the
+// media index. Videos go through video.ProcessVideo, anything else is sent
+// as a single document.
+type Pipeline struct {
+	client *client.Client
+	cfg    *config.MtprotoConfig
+	store  *index.Store
+}
+
+func New(cl *client.Client, cfg *config.MtprotoConfig, store *index.Store) *Pipeline {
+	return &Pipeline{client: cl, cfg: cfg, store: store}
+}
+
+// WithContext returns a pipeline whose Telegram calls are aborted when ctx
+// is done, for jobs that can be canceled
+func (p *Pipeline) WithContext(ctx context.Context) *Pipeline {
+	return New(p.client.WithContext(ctx), p.cfg, p.store)
+}
+
+// Upload sends filePath with the given tag and description. source is
+// recorded in the index entry (e.g. "fetch").
+func (p *Pipeline) Upload(filePath, tag, description, source string) (*index.Entry, error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	peer, err := p.client.ResolvePeer(p.cfg.StorageChatID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve peer: %w", err)
+	}
+
+	fileName := filepath.Base(filePath)
+	caption := Caption(p.cfg, filePath, tag, description)
+
+	// Voice and video notes and music are sent whole like documents, images
+	// as photos
+	proc := p.cfg.Processing(tag)
+	note := fileprocessor.NoteType(fileName)
+	isPhoto := IsPhoto(p.cfg, proc, fileName)
+	asDocument := proc.AsDocument || note != "" || (!isPhoto && !fileprocessor.IsVideoFile(fileName))
+	if err := CheckInput(filePath, !asDocument && !isPhoto); err != nil {
+		return nil, err
+	}
+	sum, err := ContentHash(p.cfg, filePath)
+	if err != nil {
+		return nil, err
+	}
+	previous := CurrentVersion(p.store, p.cfg, tag, fileName)
+	if previous != nil && Unchanged(previous, sum, fileInfo.Size()) {
+		logger.Info.Printf("%s is unchanged since media %d", fileName, previous.ID)
+		return previous, nil
+	}
+	if existing := FindHashed(p.store, p.cfg, sum); existing != nil {
+		logger.Warn.Printf("%s has the content of media %d (message %d)", fileName, existing.ID, existing.MessageID())
+		if p.cfg.DuplicateCheck == "skip" {
+			return existing, nil
+		}
+	} else if previous != nil {
+		// Searching the caption would find the version this one replaces
+	} else if existing, err := FindUploaded(p.client, p.cfg, tag, description, caption, fileInfo.Size(), asDocument); err != nil {
+		logger.Warn.Printf("%v", err)
+	} else if existing != nil {
+		logger.Warn.Printf("%s looks already uploaded (message %d)", fileName, existing.MessageID())
+		if p.cfg.DuplicateCheck == "skip" {
+			existing.FileName = fileName
+			existing.SHA256 = sum
+			if err := p.store.Add(existing); err != nil {
+				logger.Warn.Printf("Failed to record %s in the index - %v", fileName, err)
+			}
+			return existing, nil
+		}
+	}
+
+	if (!asDocument && !isPhoto) || note != "" {
+		if err := ffmpeg.Available(); err != nil {
+			return nil, fmt.Errorf("can't process %s: %w", fileName, err)
+		}
+	}
+
+	var files, scrub []index.File
+	var parts int
+	mediaType := "video"
+	switch {
+	case isPhoto:
+		files, mediaType, err = SendPhoto(p.client, p.cfg, peer, filePath, caption, proc.MaxSizeBytes)
+		if err != nil {
+			return nil, err
+		}
+	case !asDocument:
+		sent, err := video.ProcessVideo(p.client, peer, filePath, sum, tag, description,
+			proc, KnownFile(p.store), p.cfg.TempDir, p.cfg.CleanupTempDir)
+		if err != nil {
+			return nil, err
+		}
+		files, parts, scrub = sent.Files, sent.Parts, sent.Scrub
+		if parts == 0 {
+			// Only the contact sheet was sent
+			mediaType = "photo"
+		}
+	case IsAudio(proc, fileName):
+		mediaType = "audio"
+		files, err = SendAudio(p.client, p.cfg, peer, filePath, caption, proc.MaxSizeBytes)
+		if err != nil {
+			return nil, err
+		}
+	case note == "":
+		mediaType = "document"
+		files, err = SendDocument(p.client, p.cfg, peer, filePath, caption, proc.MaxSizeBytes)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if fileInfo.Size() > proc.MaxSizeBytes {
+			return nil, fmt.Errorf("%w: %s is larger than max_size and is sent as a document, which can't be split", errs.ErrTooLarge, fileName)
+		}
+		item, err := noteItem(client.MediaItem{FilePath: filePath, Caption: caption}, note)
+		if err != nil {
+			return nil, err
+		}
+		mediaType = item.MediaType
+		ui.EmitFileStarted(filePath, fileInfo.Size())
+		msgID, err := p.client.SendMedia(peer, item)
+		ui.EmitFileResult(filePath, err)
+		if err != nil {
+			return nil, err
+		}
+		files = []index.File{{MessageID: msgID, Name: fileName, Size: fileInfo.Size()}}
+	}
+
+	entry := &index.Entry{
+		ChatID:      p.cfg.StorageChatID,
+		Files:       files,
+		Tag:         tag,
+		Description: description,
+		Caption:     caption,
+		FileName:    fileName,
+		MediaType:   mediaType,
+		Source:      source,
+		Size:        fileInfo.Size(),
+		ModTime:     fileInfo.ModTime(),
+		SHA256:      sum,
+	}
+	if mediaType == "video" {
+		entry.Parts = parts
+		entry.Scrub = scrub
+	}
+	NextVersion(entry, previous)
+	MarkStatus(p.client, p.cfg, entry)
+	Mirror(p.client, p.cfg, entry)
+	if err := p.store.Add(entry); err != nil {
+		logger.Warn.Printf("Uploaded %s but failed to update index - %v", fileName, err)
+		return entry, nil
+	}
+	Supersede(p.client, p.store, previous, entry)
+	return entry, nil
+}
+
+// noteItem turns item into a voice or round video message of the file's
+// duration (and size, for video notes)
+func noteItem(item client.MediaItem, note string) (client.MediaItem, error) {
+	duration, err := ffmpeg.GetVideoDuration(item.FilePath)
+	if err != nil {
+		return item, err
+	}
+	item.MediaType, item.Duration = note, duration
+	if note == "video_note" {
+		w, _, err := ffmpeg.GetVideoResolution(item.FilePath)
+		if err != nil {
+			return item, err
+		}
+		item.W = w
+	}
+	return item, nil
+}
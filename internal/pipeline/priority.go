@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/priority"
+)
+
+// QueuedFile is a file of local_dir waiting for upload
+type QueuedFile struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Priority bool   `json:"priority"`
+}
+
+// Prioritize moves the high priority files ahead of the others, keeping
+// the order within each lane, and returns how many there are. Files are
+// high priority when marked (`cli queue -p`, bot /priority) or when a rule
+// with priority: true matches their tag.
+func Prioritize(cfg *config.MtprotoConfig, marks *priority.Marks, files []string) ([]string, int) {
+	marked := make(map[string]bool)
+	for _, name := range marks.List() {
+		marked[name] = true
+	}
+	high := make([]string, 0, len(files))
+	var low []string
+	for _, name := range files {
+		if marked[name] || tagPriority(cfg, name) {
+			high = append(high, name)
+		} else {
+			low = append(low, name)
+		}
+	}
+	return append(high, low...), len(high)
+}
+
+// tagPriority tells whether the rule of the tag of name has priority: true
+func tagPriority(cfg *config.MtprotoConfig, name string) bool {
+	if len(cfg.Rules) == 0 {
+		return false
+	}
+	tag, _, err := ParseName(cfg, filepath.Join(cfg.LocalDir, name))
+	return err == nil && cfg.Processing(tag).Priority
+}
+
+// LocalQueue lists the files of local_dir in the order the next upload run
+// takes them: scan_order within the high and the normal priority lane
+func LocalQueue(cfg *config.MtprotoConfig, marks *priority.Marks) ([]QueuedFile, error) {
+	processor := fileprocessor.NewProcessor(cfg.LocalDir, cfg.DoneDir)
+	files, err := processor.ScanFiles()
+	if err != nil {
+		return nil, err
+	}
+	processor.SortFiles(files, cfg.ScanOrderBy, cfg.ScanOrderDesc)
+	files, high := Prioritize(cfg, marks, files)
+
+	queued := make([]QueuedFile, len(files))
+	for i, name := range files {
+		queued[i] = QueuedFile{Name: name, Priority: i < high}
+		if info, err := os.Stat(processor.GetFilePath(name)); err == nil {
+			queued[i].Size = info.Size()
+		}
+	}
+	return queued, nil
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/priority"
+	"tg-storage-assistant/internal/retry"
+	"time"
+)
+
+func TestPrioritize(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{
+		LocalDir: dir,
+		Rules:    []config.RuleConfig{{Tag: "urgent", Priority: true}},
+	}
+	marks, err := priority.Open(filepath.Join(t.TempDir(), "priority.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"trip_a.mp4", "urgent_b.mp4", "trip_c.mp4", "trip_d.mp4"}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, high := Prioritize(cfg, marks, files); high != 1 || !slices.Equal(got, []string{"urgent_b.mp4", "trip_a.mp4", "trip_c.mp4", "trip_d.mp4"}) {
+		t.Errorf("by rule = %v, %d high", got, high)
+	}
+	if err := marks.Mark("trip_d.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if got, high := Prioritize(cfg, marks, files); high != 2 || !slices.Equal(got, []string{"urgent_b.mp4", "trip_d.mp4", "trip_a.mp4", "trip_c.mp4"}) {
+		t.Errorf("marked = %v, %d high", got, high)
+	}
+
+	// Uploading the file clears its mark
+	q, err := retry.Open(filepath.Join(t.TempDir(), "retry.json"), 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Forget(q, marks, "trip_d.mp4")
+	if marked := marks.List(); len(marked) != 0 {
+		t.Errorf("marks after Forget = %v", marked)
+	}
+}
@@ -0,0 +1,25 @@
+package pipeline
+
+import (
+	"fmt"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/util"
+)
+
+// QuotaWarning returns a warning for each chat that uploading batch more
+// bytes takes past the quota: the storage chat and the mirrors
+func QuotaWarning(store *index.Store, cfg *config.MtprotoConfig, batch int64) []string {
+	if cfg.QuotaBytes <= 0 || batch <= 0 {
+		return nil
+	}
+	usage := store.Usage()
+	var warnings []string
+	for _, chatID := range append([]int64{cfg.StorageChatID}, cfg.Mirrors...) {
+		if used := usage[chatID]; used+batch > cfg.QuotaBytes {
+			warnings = append(warnings, fmt.Sprintf("Chat %d would hold %s of its %s quota after %s more",
+				chatID, util.FormatBytesToHumanReadable(used+batch), cfg.Quota, util.FormatBytesToHumanReadable(batch)))
+		}
+	}
+	return warnings
+}
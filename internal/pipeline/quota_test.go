@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+)
+
+func TestQuotaWarning(t *testing.T) {
+	const chatID, mirrorID = int64(-1001), int64(-1002)
+	store, err := index.Open(filepath.Join(t.TempDir(), "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*index.Entry{
+		{ChatID: chatID, Size: 600, Mirrors: []index.Mirror{{ChatID: mirrorID}}},
+		{ChatID: chatID, Size: 300},
+	} {
+		if err := store.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if usage := store.Usage(); usage[chatID] != 900 || usage[mirrorID] != 600 {
+		t.Fatalf("usage = %v", usage)
+	}
+
+	cfg := &config.MtprotoConfig{StorageChatID: chatID, Mirrors: []int64{mirrorID}, Quota: "1KB", QuotaBytes: 1024}
+	if w := QuotaWarning(store, cfg, 100); len(w) != 0 {
+		t.Errorf("100 bytes more warned: %q", w)
+	}
+	w := QuotaWarning(store, cfg, 200)
+	if len(w) != 1 || !strings.HasPrefix(w[0], "Chat -1001 would hold 1.10 KB of its 1KB quota") {
+		t.Errorf("200 bytes more = %q, want a warning for the storage chat only", w)
+	}
+	cfg.QuotaBytes = 0
+	if w := QuotaWarning(store, cfg, 1<<30); len(w) != 0 {
+		t.Errorf("no quota warned: %q", w)
+	}
+}
@@ -0,0 +1,200 @@
+package pipeline
+
+import (
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/video"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// partSuffix is what splitting added to the name of a video before
+// video.PartName
+var partSuffix = regexp.MustCompile(`_part\d{3}$`)
+
+// dateTag is the #YYYY_MM tag photo_date_tag adds to captions
+var dateTag = regexp.MustCompile(` #\d{4}_\d{2}$`)
+
+// ParseCaption returns the tag and description of a caption built by
+// Caption, "" when it doesn't start with a hashtag
+func ParseCaption(caption string) (tag, description string) {
+	line, _, _ := strings.Cut(caption, "\n")
+	line = dateTag.ReplaceAllString(strings.TrimSpace(line), "")
+	if !strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	tag, description, _ = strings.Cut(line[1:], " ")
+	return tag, strings.TrimSpace(description)
+}
+
+// RebuildIndex reads the whole history of chatID and returns an index
+// entry for every stored item, oldest first, for users whose index was
+// lost. Albums become one entry, and a photo followed by its original or a
+// preview followed by its document are joined again, as are the parts of
+// a video that forwarding sent one by one and the scrub thumbnails
+// following a video. Mirrors, sources and
+// SHA-256 sums are not in the chat and stay empty.
+func RebuildIndex(cl *client.Client, chatID int64) ([]*index.Entry, error) {
+	albums, err := cl.GetAlbums(chatID, client.HistoryOptions{Limit: math.MaxInt})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*index.Entry
+	for i := len(albums) - 1; i >= 0; i-- {
+		entry := albumEntry(chatID, albums[i])
+		if entry == nil {
+			continue
+		}
+		if n := len(entries); n > 0 && (joinPair(entries[n-1], entry) || joinParts(entries[n-1], entry) || joinScrub(entries[n-1], entry)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// albumEntry is the index entry of a, nil when it holds no media
+func albumEntry(chatID int64, a *client.Album) *index.Entry {
+	var files []index.File
+	var size int64
+	for _, m := range a.Messages {
+		file := index.File{MessageID: m.ID}
+		switch m.Media.(type) {
+		case *tg.MessageMediaPhoto:
+		case *tg.MessageMediaDocument:
+			file.Name, file.Size = client.MediaName(m), client.DocumentSize(m)
+			size += file.Size
+		default:
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	caption := a.Caption()
+	tag, description := ParseCaption(caption)
+	entry := &index.Entry{
+		ChatID:      chatID,
+		Files:       files,
+		Tag:         tag,
+		Description: description,
+		Caption:     caption,
+		FileName:    files[0].Name,
+		MediaType:   mediaType(a.Messages[0]),
+		Source:      "history",
+		Size:        size,
+		ModTime:     fileprocessor.CaptionModTime(caption),
+		CreatedAt:   time.Unix(int64(a.Messages[0].Date), 0),
+	}
+	if len(files) > 1 && entry.MediaType == "photo" {
+		// A video is its preview followed by the parts
+		entry.MediaType, entry.Parts = "video", len(files)-1
+		if name := files[1].Name; name != "" {
+			ext := filepath.Ext(name)
+			entry.FileName = partSuffix.ReplaceAllString(strings.TrimSuffix(name, ext), "") + ext
+		}
+	}
+	if p, ok := video.ParsePartName(files[len(files)-1].Name); ok && entry.MediaType == "video" {
+		// Parts without their preview
+		entry.FileName, entry.Parts = p.Name, len(files)
+		if !isPart(files[0]) {
+			entry.Parts--
+		}
+	}
+	if entry.FileName == "" && tag != "" {
+		entry.FileName = tag + "_" + strings.ReplaceAll(description, " ", "_") + ".jpg"
+	}
+	return entry
+}
+
+// joinPair adds next to prev when they were sent as one item: a photo
+// with its uncaptioned original, or an uncaptioned document preview with
+// its document
+func joinPair(prev, next *index.Entry) bool {
+	if len(prev.Files) != 1 || len(next.Files) != 1 || next.Files[0].MessageID != prev.Files[0].MessageID+1 {
+		return false
+	}
+	switch {
+	case prev.MediaType == "photo" && prev.Caption != "" && next.MediaType == "document" && next.Caption == "":
+		prev.Files = append(prev.Files, next.Files[0])
+		prev.FileName, prev.Size = next.FileName, next.Size
+	case prev.MediaType == "photo" && prev.Caption == "" && next.MediaType == "document" && next.Caption != "":
+		*prev = *next
+		prev.Files = append(prev.Files, index.File{MessageID: prev.Files[0].MessageID - 1})
+	default:
+		return false
+	}
+	return true
+}
+
+// joinParts adds the video parts in next to prev when they are of the same
+// file (the hash in their names matches), or to the captioned preview
+// right before them
+func joinParts(prev, next *index.Entry) bool {
+	first, ok := video.ParsePartName(next.Files[0].Name)
+	if !ok || next.Caption != "" {
+		return false
+	}
+	last := prev.Files[len(prev.Files)-1]
+	switch p, ok := video.ParsePartName(last.Name); {
+	case ok && p.Hash == first.Hash:
+	case prev.MediaType == "photo" && len(prev.Files) == 1 && prev.Caption != "" && next.Files[0].MessageID == last.MessageID+1:
+		prev.MediaType, prev.FileName = "video", first.Name
+	default:
+		return false
+	}
+	prev.Files = append(prev.Files, next.Files...)
+	prev.Parts += len(next.Files)
+	prev.Size += next.Size
+	return true
+}
+
+// joinScrub adds the scrub thumbnails in next to the video before them
+func joinScrub(prev, next *index.Entry) bool {
+	if prev.MediaType != "video" || next.Caption != "" {
+		return false
+	}
+	for _, f := range next.Files {
+		if !video.IsScrubName(f.Name) {
+			return false
+		}
+	}
+	prev.Scrub = append(prev.Scrub, next.Files...)
+	return true
+}
+
+// mediaType is the index media type of what msg holds
+func mediaType(msg *tg.Message) string {
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return "photo"
+	}
+	doc, _ := media.Document.(*tg.Document)
+	if doc == nil {
+		return "document"
+	}
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeAudio:
+			if a.Voice {
+				return "voice"
+			}
+			return "audio"
+		case *tg.DocumentAttributeVideo:
+			if a.RoundMessage {
+				return "video_note"
+			}
+			return "video"
+		}
+	}
+	return "document"
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+)
+
+func TestParseCaption(t *testing.T) {
+	tests := []struct {
+		caption, tag, description string
+	}{
+		{"#trip beach day", "trip", "beach day"},
+		{"#trip beach #2024_05\n📅 2024-05-01 · 📷 Canon", "trip", "beach"},
+		{"#notes", "notes", ""},
+		{"no tag here", "", ""},
+	}
+	for _, tt := range tests {
+		tag, description := ParseCaption(tt.caption)
+		if tag != tt.tag || description != tt.description {
+			t.Errorf("ParseCaption(%q) = %q, %q, want %q, %q", tt.caption, tag, description, tt.tag, tt.description)
+		}
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{StorageChatID: chatID}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := func(name string, size int) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// A split video, a note, a photo with its original and a PDF behind its preview
+	if _, err := cl.SendMultiMedia(peer, []client.MediaItem{
+		{FilePath: file("preview.jpg", 10), MediaType: "photo", Caption: "#trip beach"},
+		{FilePath: file("trip_beach_part000.mp4", 100), MediaType: "video"},
+		{FilePath: file("trip_beach_part001.mp4", 50), MediaType: "video"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.SendMessage(peer, "just a note"); err != nil {
+		t.Fatal(err)
+	}
+	sends := []client.MediaItem{
+		{FilePath: file("sunset.jpg", 10), MediaType: "photo", Caption: "#trip sunset #2024_05"},
+		{FilePath: file("sunset.heic", 30), MediaType: "document"},
+		{FilePath: file("page.jpg", 10), MediaType: "photo"},
+		{FilePath: file("tax_2024.pdf", 40), MediaType: "document", Caption: "#tax 2024"},
+	}
+	for _, item := range sends {
+		if _, err := cl.SendMedia(peer, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := RebuildIndex(cl, chatID)
+	if err != nil {
+		t.Fatalf("RebuildIndex: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(entries), entries)
+	}
+	video, photo, doc := entries[0], entries[1], entries[2]
+	if video.MediaType != "video" || video.Parts != 2 || video.FileName != "trip_beach.mp4" || video.Size != 150 || video.Tag != "trip" || video.Description != "beach" {
+		t.Errorf("video = %+v", video)
+	}
+	if photo.MediaType != "photo" || len(photo.Files) != 2 || photo.FileName != "sunset.heic" || photo.Description != "sunset" {
+		t.Errorf("photo = %+v", photo)
+	}
+	if doc.MediaType != "document" || len(doc.Files) != 2 || doc.Files[1].MessageID != doc.Files[0].MessageID-1 || doc.FileName != "tax_2024.pdf" || doc.Tag != "tax" {
+		t.Errorf("document = %+v", doc)
+	}
+	if path, err := RestorePath(doc); err != nil || path != "tax_2024.pdf" {
+		t.Errorf("RestorePath(document) = %q, %v", path, err)
+	}
+}
+
+func TestRebuildIndexForwardedParts(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{StorageChatID: chatID}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A split video forwarded message by message, parts out of order, then
+	// its scrub thumbnails
+	sends := []client.MediaItem{
+		{FilePath: "preview.jpg", MediaType: "photo", Caption: "#trip beach"},
+		{FilePath: "trip_beach_part02of02_3f2a9c0d1e4b.mp4", MediaType: "video"},
+		{FilePath: "trip_beach_part01of02_3f2a9c0d1e4b.mp4", MediaType: "video"},
+		{FilePath: "trip_beach_thumbnails.vtt", MediaType: "document"},
+	}
+	for _, item := range sends {
+		item.FilePath = filepath.Join(dir, item.FilePath)
+		if err := os.WriteFile(item.FilePath, make([]byte, 10), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cl.SendMedia(peer, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := RebuildIndex(cl, chatID)
+	if err != nil {
+		t.Fatalf("RebuildIndex: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1: %+v", len(entries), entries)
+	}
+	video := entries[0]
+	if video.MediaType != "video" || video.Parts != 2 || len(video.Files) != 3 || len(video.Scrub) != 1 || video.FileName != "trip_beach.mp4" || video.Tag != "trip" {
+		t.Errorf("video = %+v", video)
+	}
+	ordered, err := orderParts(video, OriginalFiles(video))
+	if err != nil || ordered[0].Name != "trip_beach_part01of02_3f2a9c0d1e4b.mp4" {
+		t.Errorf("parts in restore order = %+v, %v", ordered, err)
+	}
+}
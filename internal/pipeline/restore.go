@@ -0,0 +1,210 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+	"tg-storage-assistant/internal/video"
+	"time"
+)
+
+// ErrRestored is returned by Restore when the file is already in place
+var ErrRestored = errors.New("already restored")
+
+// RestorePath is where Restore writes entry, relative to the output
+// directory: its file name, or the S3 key with its directories. Videos
+// that were converted or split become .mp4, photos sent without their
+// original .jpg.
+func RestorePath(entry *index.Entry) (string, error) {
+	rel := filepath.FromSlash(entry.FileName)
+	if rel == "" {
+		rel = "media-" + strconv.FormatInt(entry.ID, 10)
+	}
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("media %d has an unsafe file name %q", entry.ID, entry.FileName)
+	}
+
+	files := OriginalFiles(entry)
+	if len(files) == 0 {
+		return "", fmt.Errorf("media %d has no messages", entry.ID)
+	}
+	ext := filepath.Ext(rel)
+	switch {
+	case entry.MediaType == "video":
+		ext = strings.ToLower(filepath.Ext(files[0].Name))
+	case entry.MediaType == "photo" && len(entry.Files) == 1:
+		ext = ".jpg"
+	}
+	if ext == "" {
+		return rel, nil
+	}
+	return strings.TrimSuffix(rel, filepath.Ext(rel)) + ext, nil
+}
+
+// OriginalFiles are the messages holding the original of entry: the parts
+// after the preview of videos (all files when forwarding lost the
+// preview), the document after photos sent with their original, the parts
+// of split streams, otherwise the first message
+func OriginalFiles(entry *index.Entry) []index.File {
+	switch {
+	case len(entry.Files) == 0:
+		return nil
+	case entry.MediaType == "video" && isPart(entry.Files[0]):
+		return entry.Files
+	case entry.MediaType == "video" && len(entry.Files) > 1:
+		return entry.Files[1:]
+	case entry.MediaType == "photo" && len(entry.Files) > 1:
+		return entry.Files[1:2]
+	case entry.MediaType == "document" && entry.Parts > 1:
+		return entry.Files[:min(entry.Parts, len(entry.Files))]
+	}
+	return entry.Files[:1]
+}
+
+// Restore downloads entry into outDir at its RestorePath, joining the
+// parts of split videos and streams, and returns the written path. It
+// gets the modification time of the original. Files that exist
+// are kept unless overwrite is set. When the index knows the SHA-256 of
+// the original, a restored file that differs is reported.
+func Restore(cl *client.Client, entry *index.Entry, outDir string, overwrite bool) (string, error) {
+	rel, err := RestorePath(entry)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(outDir, rel)
+	if _, err := os.Stat(target); err == nil && !overwrite {
+		return target, ErrRestored
+	}
+
+	files, err := orderParts(entry, OriginalFiles(entry))
+	if err != nil {
+		return "", err
+	}
+	ids := make([]int, len(files))
+	for i, f := range files {
+		ids[i] = f.MessageID
+	}
+	msgs, err := cl.GetMessages(entry.ChatID, ids)
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) != len(ids) {
+		return "", fmt.Errorf("media %d: %d of %d messages are gone from the chat", entry.ID, len(ids)-len(msgs), len(ids))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	// Downloads go next to the target, so moving them in place is a rename
+	work, err := os.MkdirTemp(filepath.Dir(target), ".restore-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(work)
+
+	parts := make([]string, len(msgs))
+	for i, msg := range msgs {
+		parts[i] = filepath.Join(work, fmt.Sprintf("part%03d%s", i, filepath.Ext(files[i].Name)))
+		if err := cl.DownloadMessageMediaTo(msg, parts[i]); err != nil {
+			return "", err
+		}
+	}
+	restored := parts[0]
+	if len(parts) > 1 {
+		restored = filepath.Join(work, "joined"+filepath.Ext(target))
+		join := ffmpeg.Concat
+		if entry.MediaType != "video" {
+			join = joinFiles
+		}
+		if err := join(parts, restored); err != nil {
+			return "", err
+		}
+	}
+
+	// Videos are converted and photos recompressed, other files are the
+	// original
+	original := entry.MediaType != "video" && (entry.MediaType != "photo" || len(entry.Files) > 1)
+	if entry.SHA256 != "" && original {
+		if sum, err := fileprocessor.SHA256(restored); err != nil {
+			return "", err
+		} else if sum != entry.SHA256 {
+			logger.Warn.Printf("%s differs from the uploaded file (SHA-256 %s, was %s)", rel, sum, entry.SHA256)
+		}
+	}
+	if err := util.ReplaceFile(restored, target); err != nil {
+		return "", err
+	}
+	SetModTime(target, entry.ModTime)
+	return target, nil
+}
+
+// SetModTime gives path the modification time t of its original file,
+// unless t is unknown
+func SetModTime(path string, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if err := os.Chtimes(path, time.Time{}, t); err != nil {
+		logger.Warn.Printf("Failed to set the modification time of %s - %v", path, err)
+	}
+}
+
+// isPart reports whether f is a video part named by video.PartName
+func isPart(f index.File) bool {
+	_, ok := video.ParsePartName(f.Name)
+	return ok
+}
+
+// orderParts sorts video parts by the numbers in their names and checks
+// that none is missing, as forwarded parts may have lost their order.
+// Files without such names are returned as they are.
+func orderParts(entry *index.Entry, files []index.File) ([]index.File, error) {
+	ordered := make([]index.File, len(files))
+	var hash string
+	for _, f := range files {
+		p, ok := video.ParsePartName(f.Name)
+		if !ok {
+			return files, nil
+		}
+		if hash == "" {
+			hash = p.Hash
+		}
+		if p.Total != len(files) || p.Hash != hash || ordered[p.Index-1].MessageID != 0 {
+			return nil, fmt.Errorf("media %d: the parts of %s don't add up, %d files for %d parts", entry.ID, p.Name, len(files), p.Total)
+		}
+		ordered[p.Index-1] = f
+	}
+	return ordered, nil
+}
+
+// joinFiles writes the parts one after the other to outPath
+func joinFiles(parts []string, outPath string) error {
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		in, err := os.Open(part)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/index"
+)
+
+func TestRestorePath(t *testing.T) {
+	tests := []struct {
+		entry index.Entry
+		want  string
+	}{
+		{index.Entry{FileName: "docs_manual.pdf", MediaType: "document", Files: []index.File{{Name: "docs_manual.pdf"}, {Name: "preview-1.jpg"}}}, "docs_manual.pdf"},
+		{index.Entry{FileName: "backups/2024/db.tar", MediaType: "document", Files: []index.File{{Name: "db.tar"}}}, "backups/2024/db.tar"},
+		{index.Entry{FileName: "trip_day1.mkv", MediaType: "video", Files: []index.File{{Name: "preview.jpg"}, {Name: "trip_0.mp4"}, {Name: "trip_1.mp4"}}}, "trip_day1.mp4"},
+		{index.Entry{FileName: "beach_sunset.heic", MediaType: "photo", Files: []index.File{{Name: "beach_sunset.heic"}}}, "beach_sunset.jpg"},
+		{index.Entry{FileName: "beach_sunset.heic", MediaType: "photo", Files: []index.File{{Name: "beach_sunset.heic"}, {Name: "beach_sunset.heic"}}}, "beach_sunset.heic"},
+		{index.Entry{ID: 7, MediaType: "document", Files: []index.File{{}}}, "media-7"},
+	}
+	for _, tt := range tests {
+		got, err := RestorePath(&tt.entry)
+		if err != nil || got != filepath.FromSlash(tt.want) {
+			t.Errorf("RestorePath(%s) = %q, %v, want %q", tt.entry.FileName, got, err, tt.want)
+		}
+	}
+
+	if _, err := RestorePath(&index.Entry{FileName: "../../etc/passwd", Files: []index.File{{}}}); err == nil {
+		t.Error("a file name leaving --out was accepted")
+	}
+}
+
+func TestOrderParts(t *testing.T) {
+	files := []index.File{
+		{MessageID: 12, Name: "trip_part03of03_3f2a.mp4"},
+		{MessageID: 10, Name: "trip_part01of03_3f2a.mp4"},
+		{MessageID: 11, Name: "trip_part02of03_3f2a.mp4"},
+	}
+	ordered, err := orderParts(&index.Entry{}, files)
+	if err != nil || ordered[0].MessageID != 10 || ordered[1].MessageID != 11 || ordered[2].MessageID != 12 {
+		t.Errorf("orderParts = %v, %v", ordered, err)
+	}
+	if _, err := orderParts(&index.Entry{}, files[:2]); err == nil {
+		t.Error("a missing part went unnoticed")
+	}
+	old := []index.File{{MessageID: 2, Name: "trip_1.mp4"}, {MessageID: 1, Name: "trip_0.mp4"}}
+	if ordered, err := orderParts(&index.Entry{}, old); err != nil || ordered[0].MessageID != 2 {
+		t.Errorf("parts without numbers were reordered: %v, %v", ordered, err)
+	}
+}
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"time"
+)
+
+// Expired returns the entries that retention rules delete at now, oldest
+// first: those older than max_age, and all but the newest keep_versions
+// uploads of each file name
+func Expired(rules []config.RetentionRule, entries []*index.Entry, now time.Time) []*index.Entry {
+	expired := make(map[int64]*index.Entry)
+	for _, rule := range rules {
+		versions := make(map[string][]*index.Entry)
+		for _, e := range entries {
+			if rule.Tag != "" && !strings.EqualFold(e.Tag, rule.Tag) {
+				continue
+			}
+			if rule.MaxAgeDuration > 0 && now.Sub(e.CreatedAt) > rule.MaxAgeDuration {
+				expired[e.ID] = e
+			}
+			if rule.KeepVersions > 0 && e.FileName != "" {
+				key := strings.ToLower(e.Tag) + "/" + e.FileName
+				versions[key] = append(versions[key], e)
+			}
+		}
+		for _, uploads := range versions {
+			sort.Slice(uploads, func(i, j int) bool { return uploads[i].ID > uploads[j].ID })
+			for _, e := range uploads[min(rule.KeepVersions, len(uploads)):] {
+				expired[e.ID] = e
+			}
+		}
+	}
+
+	list := make([]*index.Entry, 0, len(expired))
+	for _, e := range expired {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Delete removes the messages of entry, its scrub thumbnails and its mirror
+// copies, then the entry itself from the index
+func Delete(cl *client.Client, store *index.Store, entry *index.Entry) error {
+	if err := cl.DeleteMessages(entry.ChatID, append(entry.MessageIDs(), entry.ScrubMessageIDs()...)); err != nil {
+		return err
+	}
+	for _, m := range entry.Mirrors {
+		if err := cl.DeleteMessages(m.ChatID, m.MessageIDs); err != nil {
+			logger.Warn.Printf("Failed to delete the copy of media %d in chat %d - %v", entry.ID, m.ChatID, err)
+		}
+	}
+	return store.Remove(entry.ID)
+}
+
+// ApplyRetention deletes the media the rules expire and returns them. With
+// dryRun nothing is deleted.
+func ApplyRetention(cl *client.Client, store *index.Store, cfg *config.RetentionConfig, dryRun bool) ([]*index.Entry, error) {
+	all, _ := store.Search(index.Query{})
+	expired := Expired(cfg.Rules, all, time.Now())
+	if dryRun {
+		return expired, nil
+	}
+
+	var deleted []*index.Entry
+	var failures []error
+	for _, e := range expired {
+		if err := Delete(cl, store, e); err != nil {
+			failures = append(failures, fmt.Errorf("media %d: %w", e.ID, err))
+			continue
+		}
+		logger.Info.Printf("Deleted media %d (%s #%s) by retention", e.ID, e.FileName, e.Tag)
+		deleted = append(deleted, e)
+	}
+	return deleted, errors.Join(failures...)
+}
+
+// RunRetention applies the retention rules every interval until ctx is done
+func RunRetention(ctx context.Context, cl *client.Client, store *index.Store, cfg *config.RetentionConfig) {
+	ticker := time.NewTicker(cfg.IntervalDuration)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := ApplyRetention(cl, store, cfg, false)
+		if err != nil {
+			logger.Warn.Printf("Retention failed for some media: %v", err)
+		}
+		if len(deleted) > 0 {
+			logger.Info.Printf("Retention deleted %d media", len(deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
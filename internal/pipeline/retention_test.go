@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"time"
+)
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	entries := []*index.Entry{
+		{ID: 1, Tag: "tmp", FileName: "a.txt", CreatedAt: now.Add(-40 * day)},
+		{ID: 2, Tag: "tmp", FileName: "b.txt", CreatedAt: now.Add(-10 * day)},
+		{ID: 3, Tag: "docs", FileName: "cv.pdf", CreatedAt: now.Add(-90 * day)},
+		{ID: 4, Tag: "Docs", FileName: "cv.pdf", CreatedAt: now.Add(-60 * day)},
+		{ID: 5, Tag: "docs", FileName: "cv.pdf", CreatedAt: now.Add(-1 * day)},
+		{ID: 6, Tag: "notes", FileName: "cv.pdf", CreatedAt: now.Add(-1 * day)},
+	}
+	rules := []config.RetentionRule{
+		{Tag: "tmp", MaxAgeDuration: 30 * day},
+		{KeepVersions: 2},
+	}
+
+	var ids []int64
+	for _, e := range Expired(rules, entries, now) {
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatalf("expired = %v, want [1 3]", ids)
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	const chatID, mirrorID = int64(-1001234567890), int64(-1009876543210)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{StorageChatID: chatID}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	fake.AddChannel(mirrorID, "mirror")
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+	store, err := index.Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chat := range []int64{chatID, chatID, mirrorID} {
+		peer, err := cl.ResolvePeer(chat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cl.SendMessage(peer, "media"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := &index.Entry{ChatID: chatID, Tag: "tmp", Files: []index.File{{MessageID: 1}}, CreatedAt: time.Now().Add(-48 * time.Hour),
+		Mirrors: []index.Mirror{{ChatID: mirrorID, MessageIDs: []int{1}}}}
+	fresh := &index.Entry{ChatID: chatID, Tag: "tmp", Files: []index.File{{MessageID: 2}}}
+	for _, e := range []*index.Entry{old, fresh} {
+		if err := store.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retention := &config.RetentionConfig{Rules: []config.RetentionRule{{Tag: "tmp", MaxAgeDuration: 24 * time.Hour}}}
+	if listed, err := ApplyRetention(cl, store, retention, true); err != nil || len(listed) != 1 || len(fake.Messages(chatID)) != 2 {
+		t.Fatalf("dry run = %d media, %v, %d messages left", len(listed), err, len(fake.Messages(chatID)))
+	}
+	deleted, err := ApplyRetention(cl, store, retention, false)
+	if err != nil || len(deleted) != 1 || deleted[0].ID != old.ID {
+		t.Fatalf("ApplyRetention = %v, %v", deleted, err)
+	}
+	if msgs := fake.Messages(chatID); len(msgs) != 1 || msgs[0].ID != 2 {
+		t.Errorf("storage chat keeps %d messages, want message 2", len(msgs))
+	}
+	if len(fake.Messages(mirrorID)) != 0 {
+		t.Errorf("mirror copy was kept")
+	}
+	if _, ok := store.Get(old.ID); ok {
+		t.Errorf("expired media is still indexed")
+	}
+}
@@ -0,0 +1,205 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/metrics"
+	"tg-storage-assistant/internal/priority"
+	"tg-storage-assistant/internal/retry"
+	"tg-storage-assistant/internal/ui"
+	"tg-storage-assistant/internal/video"
+	"time"
+)
+
+// retryInterval is how often the retry queue is checked for due files
+const retryInterval = time.Minute
+
+// ErrGone means a file is no longer in local_dir
+var ErrGone = errors.New("no longer in local_dir")
+
+// localMu serializes uploads from local_dir, which the retry loop and
+// upload_local jobs both take files from
+var localMu sync.Mutex
+
+// UploadLocal uploads name from local_dir like the uploader does: the file
+// is moved to done_dir afterwards, and a failure is queued for retry. A
+// broken file is quarantined instead.
+func (p *Pipeline) UploadLocal(name string, q *retry.Queue, marks *priority.Marks) (entry *index.Entry, err error) {
+	localMu.Lock()
+	defer localMu.Unlock()
+	defer func() {
+		if err != nil && !errors.Is(err, ErrGone) {
+			metrics.Fail("upload", err)
+		}
+	}()
+
+	filePath := filepath.Join(p.cfg.LocalDir, name)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		Forget(q, marks, name)
+		return nil, ErrGone
+	}
+	tag, description, err := ParseName(p.cfg, filePath)
+	if err != nil {
+		// Retrying can't fix the name
+		Forget(q, marks, name)
+		return nil, err
+	}
+
+	entry, err = p.Upload(filePath, tag, description, "uploader")
+	if errors.Is(err, ErrBroken) {
+		Quarantine(p.cfg, name, err)
+		Forget(q, marks, name)
+		return nil, err
+	}
+	if err != nil {
+		if _, qErr := q.Fail(name, err); qErr != nil {
+			logger.Warn.Printf("Failed to queue %s for retry - %v", name, qErr)
+		}
+		return nil, err
+	}
+
+	if err := video.MoveVideoFiles(p.cfg, name, entry.SHA256); err != nil {
+		logger.Warn.Printf("Uploaded %s but failed to move file - %v", name, err)
+	}
+	Forget(q, marks, name)
+	return entry, nil
+}
+
+// Forget drops name from the retry queue and the priority marks once it was
+// uploaded or can't be
+func Forget(q *retry.Queue, marks *priority.Marks, name string) {
+	if err := q.Done(name); err != nil {
+		logger.Warn.Printf("Failed to update the retry queue - %v", err)
+	}
+	if err := marks.Unmark(name); err != nil {
+		logger.Warn.Printf("Failed to update the priority marks - %v", err)
+	}
+}
+
+// RunRetries uploads the files of the retry queue as they come due, until
+// ctx is done. None starts while paused returns true. onGiveUp is called
+// when a file failed its last attempt.
+func (p *Pipeline) RunRetries(ctx context.Context, q *retry.Queue, marks *priority.Marks, paused func() bool, onGiveUp func(retry.Entry)) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, e := range q.Due(time.Now()) {
+			if ctx.Err() != nil || paused() {
+				break
+			}
+			p.retry(q, marks, e, onGiveUp)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pipeline) retry(q *retry.Queue, marks *priority.Marks, e retry.Entry, onGiveUp func(retry.Entry)) {
+	logger.Info.Printf("Retrying %s after %d failed attempt(s)", e.FileName, e.Attempts)
+	_, err := p.UploadLocal(e.FileName, q, marks)
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, ErrGone):
+		logger.Info.Printf("%s is no longer in local_dir, dropping its retry", e.FileName)
+		return
+	}
+
+	entry, ok := q.Get(e.FileName)
+	if !ok {
+		// Dropped from the queue, e.g. because of an invalid file name
+		logger.Error.Printf("Retry of %s failed: %v", e.FileName, err)
+		return
+	}
+	if q.GaveUp(entry) {
+		logger.Error.Printf("Giving up on %s after %d attempts: %v", e.FileName, entry.Attempts, err)
+		onGiveUp(entry)
+		return
+	}
+	logger.Warn.Printf("Retry of %s failed, next attempt at %s: %v",
+		e.FileName, entry.NextRetryAt.Format(time.DateTime), err)
+}
+
+// UploadLocalDir uploads every file in local_dir, calling progress before
+// each one, and returns the run statistics
+func (p *Pipeline) UploadLocalDir(ctx context.Context, q *retry.Queue, marks *priority.Marks, progress func(done, total int, name string)) (*fileprocessor.Stats, error) {
+	processor := fileprocessor.NewProcessor(p.cfg.LocalDir, p.cfg.DoneDir)
+	files, err := processor.ScanFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan files: %w", err)
+	}
+	files, busy, err := processor.StableFiles(ctx, files, p.cfg.StableForDuration)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range busy {
+		logger.Info.Printf("%s is still being written, leaving it for the next run", name)
+	}
+	processor.SortFiles(files, p.cfg.ScanOrderBy, p.cfg.ScanOrderDesc)
+	if err := ffmpeg.Available(); err != nil {
+		var skipped int
+		if files, skipped = fileprocessor.WithoutVideos(files); skipped > 0 {
+			logger.Warn.Printf("%v, leaving %d video(s) in local_dir", err, skipped)
+		}
+	}
+	files, _ = Prioritize(p.cfg, marks, files)
+
+	started := time.Now()
+	files, budget := WithinBudget(p.store, p.cfg, processor, files, started)
+	stats := &fileprocessor.Stats{Warnings: QuotaWarning(p.store, p.cfg, processor.TotalSize(files))}
+	if budget != "" {
+		stats.Warnings = append(stats.Warnings, budget)
+	}
+	for _, w := range stats.Warnings {
+		logger.Warn.Print(w)
+	}
+	marked := marks.List()
+	for i := range files {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		// Files marked during the run jump ahead of the ones left
+		if now := marks.List(); !slices.Equal(now, marked) {
+			marked = now
+			rest, _ := Prioritize(p.cfg, marks, files[i:])
+			copy(files[i:], rest)
+		}
+		name := files[i]
+		progress(i, len(files), name)
+		stats.Processed++
+		started, ffmpegBefore := time.Now(), ffmpeg.Elapsed()
+		entry, err := p.UploadLocal(name, q, marks)
+		if err != nil {
+			if errors.Is(err, ErrGone) {
+				stats.Processed--
+				continue
+			}
+			stats.Fail(name, err)
+			continue
+		}
+		stats.Uploaded(name, entry.Size, time.Since(started), ffmpeg.Elapsed()-ffmpegBefore)
+		stats.Succeeded++
+	}
+	ui.EmitRunFinished(stats)
+	RecordRun(p.store, "daemon", started, stats)
+	if stats.Succeeded > 0 {
+		if err := p.client.MarkRead(p.cfg.StorageChatID, 0); err != nil {
+			logger.Warn.Printf("Failed to mark the storage chat read: %v", err)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"sort"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"time"
+)
+
+// RecordRun persists the statistics of an upload run that started at
+// started. Runs that found nothing to do are not recorded.
+func RecordRun(store *index.Store, source string, started time.Time, stats *fileprocessor.Stats) {
+	if stats.Processed == 0 {
+		return
+	}
+	bytes, upload, ffmpeg, _, _ := stats.Throughput()
+	run := index.Run{
+		Started:   started,
+		Finished:  time.Now(),
+		Source:    source,
+		Processed: stats.Processed,
+		Succeeded: stats.Succeeded,
+		Skipped:   stats.Skipped,
+		Failed:    stats.Failed,
+		Bytes:     bytes,
+		Upload:    upload,
+		FFmpeg:    ffmpeg,
+	}
+	if err := store.AddRun(run); err != nil {
+		logger.Warn.Printf("Failed to record the run statistics - %v", err)
+	}
+}
+
+// Month sums the upload runs and the media archived in a calendar month
+type Month struct {
+	Month     string // YYYY-MM
+	Runs      int
+	Succeeded int
+	Failed    int
+	Bytes     int64 // uploaded by runs
+	Upload    time.Duration
+	Media     int   // entries created, whatever uploaded them
+	Archived  int64 // bytes of those entries
+}
+
+// Monthly groups runs and entries by the month they started or were
+// created in, newest month first
+func Monthly(runs []index.Run, entries []*index.Entry) []Month {
+	months := make(map[string]*Month)
+	month := func(t time.Time) *Month {
+		key := t.Local().Format("2006-01")
+		if months[key] == nil {
+			months[key] = &Month{Month: key}
+		}
+		return months[key]
+	}
+	for _, r := range runs {
+		m := month(r.Started)
+		m.Runs++
+		m.Succeeded += r.Succeeded
+		m.Failed += r.Failed
+		m.Bytes += r.Bytes
+		m.Upload += r.Upload
+	}
+	for _, e := range entries {
+		m := month(e.CreatedAt)
+		m.Media++
+		m.Archived += e.Size
+	}
+
+	list := make([]Month, 0, len(months))
+	for _, m := range months {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Month > list[j].Month })
+	return list
+}
@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"time"
+)
+
+func TestRecordRunMonthly(t *testing.T) {
+	store, err := index.Open(filepath.Join(t.TempDir(), "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	may := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	june := time.Date(2024, 6, 2, 12, 0, 0, 0, time.Local)
+
+	stats := &fileprocessor.Stats{Processed: 3, Succeeded: 2, Failed: 1}
+	stats.Uploaded("a.mp4", 300, 3*time.Second, time.Second)
+	stats.Uploaded("b.pdf", 100, time.Second, 0)
+	RecordRun(store, "uploader", may, stats)
+	RecordRun(store, "daemon", june, &fileprocessor.Stats{})
+
+	runs := store.Runs()
+	if len(runs) != 1 || runs[0].Bytes != 400 || runs[0].Upload != 3*time.Second || runs[0].FFmpeg != time.Second {
+		t.Fatalf("runs = %+v, want the uploader run only", runs)
+	}
+
+	entries := []*index.Entry{{Size: 300, CreatedAt: may}, {Size: 50, CreatedAt: june}}
+	months := Monthly(runs, entries)
+	if len(months) != 2 || months[0].Month != "2024-06" || months[1].Month != "2024-05" {
+		t.Fatalf("months = %+v", months)
+	}
+	if m := months[1]; m.Runs != 1 || m.Succeeded != 2 || m.Failed != 1 || m.Bytes != 400 || m.Media != 1 || m.Archived != 300 {
+		t.Errorf("May = %+v", m)
+	}
+	if m := months[0]; m.Runs != 0 || m.Media != 1 || m.Archived != 50 {
+		t.Errorf("June = %+v", m)
+	}
+}
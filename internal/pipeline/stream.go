@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+)
+
+// UploadStream sends everything read from r as documents named name, e.g.
+// a backup piped from tar, without a local copy. Streams larger than
+// max_size are cut into documents of max_size named name.part001,
+// name.part002, ...; only the first carries the caption. As the size is
+// unknown until the end, there is no duplicate check.
+func UploadStream(cl *client.Client, store *index.Store, cfg *config.MtprotoConfig, r io.Reader, name, tag, description, source string) (*index.Entry, error) {
+	peer, err := cl.ResolvePeer(cfg.StorageChatID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve peer: %w", err)
+	}
+
+	var sum hash.Hash
+	if hashed(cfg) {
+		sum = sha256.New()
+		r = io.TeeReader(r, sum)
+	}
+	br := bufio.NewReader(r)
+	maxSize := cfg.Processing(tag).MaxSizeBytes
+	caption := fileprocessor.BuildCaption(tag, description)
+
+	var files []index.File
+	var size int64
+	for more := true; more; {
+		file, n, err := cl.UploadStream(io.LimitReader(br, maxSize), name)
+		if err != nil {
+			deleteParts(cl, cfg.StorageChatID, name, files)
+			return nil, fmt.Errorf("upload %s: %w", name, err)
+		}
+		// The name of a part is only known once it's clear whether more
+		// follow
+		_, err = br.Peek(1)
+		if err != nil && !errors.Is(err, io.EOF) {
+			deleteParts(cl, cfg.StorageChatID, name, files)
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		more = err == nil
+		partName, partCaption := name, caption
+		if len(files) > 0 || more {
+			partName = fmt.Sprintf("%s.part%03d", name, len(files)+1)
+		}
+		if len(files) > 0 {
+			partCaption = ""
+		}
+		msgID, err := cl.SendDocument(peer, file, partName, partCaption)
+		if err != nil {
+			deleteParts(cl, cfg.StorageChatID, name, files)
+			return nil, fmt.Errorf("send %s: %w", partName, err)
+		}
+		files = append(files, index.File{MessageID: msgID, Name: partName, Size: n})
+		size += n
+	}
+
+	entry := &index.Entry{
+		ChatID:      cfg.StorageChatID,
+		Files:       files,
+		Tag:         tag,
+		Description: description,
+		Caption:     caption,
+		FileName:    name,
+		MediaType:   "document",
+		Source:      source,
+		Size:        size,
+	}
+	if sum != nil {
+		entry.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	}
+	if len(files) > 1 {
+		entry.Parts = len(files)
+	}
+	previous := CurrentVersion(store, cfg, tag, name)
+	NextVersion(entry, previous)
+	MarkStatus(cl, cfg, entry)
+	Mirror(cl, cfg, entry)
+	if err := store.Add(entry); err != nil {
+		logger.Warn.Printf("Uploaded %s but failed to update index - %v", name, err)
+		return entry, nil
+	}
+	Supersede(cl, store, previous, entry)
+	return entry, nil
+}
+
+// deleteParts removes the documents of a stream that failed to upload
+func deleteParts(cl *client.Client, chatID int64, name string, files []index.File) {
+	if len(files) == 0 {
+		return
+	}
+	ids := make([]int, len(files))
+	for i, f := range files {
+		ids[i] = f.MessageID
+	}
+	if err := cl.DeleteMessages(chatID, ids); err != nil {
+		logger.Warn.Printf("Failed to delete the uploaded parts of %s - %v", name, err)
+	}
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestUploadStream(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{
+		StorageChatID:       chatID,
+		MaxSizeBytes:        2500,
+		UploadPartSizeBytes: 1024,
+		DoneNaming:          "hash",
+	}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	store, err := index.Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+
+	data := bytes.Repeat([]byte("0123456789"), 600)
+	entry, err := UploadStream(cl, store, cfg, bytes.NewReader(data), "backup.tar.zst", "backups", "nightly", "stdin")
+	if err != nil {
+		t.Fatalf("UploadStream: %v", err)
+	}
+	if entry.Size != 6000 || entry.Parts != 3 || entry.SHA256 == "" {
+		t.Errorf("entry = %d bytes in %d parts, sha256 %q", entry.Size, entry.Parts, entry.SHA256)
+	}
+	msgs := fake.Messages(chatID)
+	if len(msgs) != 3 {
+		t.Fatalf("sent %d messages, want 3", len(msgs))
+	}
+	for i, want := range []int64{2500, 2500, 1000} {
+		name := fmt.Sprintf("backup.tar.zst.part%03d", i+1)
+		if got, size := documentOf(msgs[i]); got != name || size != want {
+			t.Errorf("part %d = %s of %d bytes, want %s of %d", i+1, got, size, name, want)
+		}
+	}
+	if msgs[0].Message != "#backups nightly" || msgs[1].Message != "" {
+		t.Errorf("captions = %q, %q, want only the first", msgs[0].Message, msgs[1].Message)
+	}
+
+	// Exactly max_size is a single document under its own name
+	if _, err := UploadStream(cl, store, cfg, strings.NewReader(string(data[:2500])), "db.sql", "backups", "db", "stdin"); err != nil {
+		t.Fatalf("UploadStream: %v", err)
+	}
+	msgs = fake.Messages(chatID)
+	if name, size := documentOf(msgs[len(msgs)-1]); len(msgs) != 4 || name != "db.sql" || size != 2500 {
+		t.Errorf("small stream = %d messages, last %s of %d bytes", len(msgs), name, size)
+	}
+
+	if _, err := UploadStream(cl, store, cfg, strings.NewReader(""), "empty", "backups", "", "stdin"); err == nil {
+		t.Error("an empty stream was uploaded")
+	}
+}
+
+// documentOf returns the file name and size of the document in msg
+func documentOf(msg *tg.Message) (string, int64) {
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return "", 0
+	}
+	doc, ok := media.Document.(*tg.Document)
+	if !ok {
+		return "", 0
+	}
+	for _, attr := range doc.Attributes {
+		if name, ok := attr.(*tg.DocumentAttributeFilename); ok {
+			return name.FileName, doc.Size
+		}
+	}
+	return "", doc.Size
+}
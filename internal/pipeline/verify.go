@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+)
+
+// Verify fetches the messages of entry back and returns the IDs of those
+// that are missing or whose document size differs from the uploaded file
+func Verify(cl *client.Client, entry *index.Entry) ([]int, error) {
+	msgs, err := cl.GetMessages(entry.ChatID, entry.MessageIDs())
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[int]int64, len(msgs))
+	for _, msg := range msgs {
+		sizes[msg.ID] = client.DocumentSize(msg)
+	}
+
+	var bad []int
+	for _, f := range entry.Files {
+		size, ok := sizes[f.MessageID]
+		// Photos (previews) have no document size to compare
+		if !ok || size >= 0 && f.Size > 0 && size != f.Size {
+			bad = append(bad, f.MessageID)
+		}
+	}
+	return bad, nil
+}
+
+// MarkStatus verifies a new entry and, when status_reactions is on, reacts
+// with ✅ to its first message or with ⚠️ to each bad one. Like Mirror, it
+// only logs failures.
+func MarkStatus(cl *client.Client, cfg *config.MtprotoConfig, entry *index.Entry) {
+	if !cfg.StatusReactions {
+		return
+	}
+	bad, err := Verify(cl, entry)
+	if err != nil {
+		logger.Warn.Printf("Failed to verify %s - %v", entry.FileName, err)
+		return
+	}
+
+	marks := map[int]string{entry.MessageID(): client.ReactionVerified}
+	if len(bad) > 0 {
+		logger.Warn.Printf("%s looks corrupted in the storage chat (messages %v)", entry.FileName, bad)
+		marks = make(map[int]string, len(bad))
+		for _, id := range bad {
+			marks[id] = client.ReactionCorrupted
+		}
+	}
+	for id, emoji := range marks {
+		if err := cl.SetReaction(entry.ChatID, id, emoji); err != nil {
+			logger.Warn.Printf("Failed to mark %s - %v", entry.FileName, err)
+		}
+	}
+}
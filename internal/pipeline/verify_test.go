@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestMarkStatus(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	cfg := &config.MtprotoConfig{StorageChatID: chatID, StatusReactions: true}
+	cl := client.NewWithAPI(context.Background(), cfg, fake)
+
+	peer, err := cl.ResolvePeer(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []index.File
+	for _, name := range []string{"part1.bin", "part2.bin"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, make([]byte, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		id, err := cl.SendMedia(peer, client.MediaItem{FilePath: path, MediaType: "document"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, index.File{MessageID: id, Name: name, Size: 100})
+	}
+
+	reaction := func(id int) string {
+		for _, msg := range fake.Messages(chatID) {
+			if msg.ID == id && len(msg.Reactions.Results) > 0 {
+				return msg.Reactions.Results[0].Reaction.(*tg.ReactionEmoji).Emoticon
+			}
+		}
+		return ""
+	}
+
+	MarkStatus(cl, cfg, &index.Entry{ChatID: chatID, Files: files, FileName: "ok"})
+	if reaction(files[0].MessageID) != client.ReactionVerified || reaction(files[1].MessageID) != "" {
+		t.Fatalf("verified entry reactions: %q %q", reaction(files[0].MessageID), reaction(files[1].MessageID))
+	}
+
+	files[1].Size = 99
+	files = append(files, index.File{MessageID: 42, Size: 100})
+	bad, err := Verify(cl, &index.Entry{ChatID: chatID, Files: files})
+	if err != nil || !slices.Equal(bad, []int{files[1].MessageID, 42}) {
+		t.Fatalf("Verify = %v, %v, want the resized and the missing message", bad, err)
+	}
+	MarkStatus(cl, cfg, &index.Entry{ChatID: chatID, Files: files[:2], FileName: "bad"})
+	if reaction(files[1].MessageID) != client.ReactionCorrupted {
+		t.Fatalf("corrupted part reaction = %q", reaction(files[1].MessageID))
+	}
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+)
+
+// supersededLine is added to the caption of a file's previous version
+const supersededLine = "\n🔁 Superseded by a newer version"
+
+// CurrentVersion returns the latest upload of fileName under tag, nil when
+// versioning is off or the file is new
+func CurrentVersion(store *index.Store, cfg *config.MtprotoConfig, tag, fileName string) *index.Entry {
+	if !cfg.Versioning {
+		return nil
+	}
+	versions := store.Versions(tag, fileName)
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// Unchanged reports whether a file of the given size and SHA-256 is the
+// content of entry. Entries recorded without a hash are compared by size.
+func Unchanged(entry *index.Entry, sum string, size int64) bool {
+	if entry.SHA256 != "" {
+		return entry.SHA256 == sum
+	}
+	return entry.Size == size
+}
+
+// NextVersion numbers entry after previous, which may be nil
+func NextVersion(entry, previous *index.Entry) {
+	if previous != nil {
+		entry.Version = max(previous.Version, 1) + 1
+	}
+}
+
+// Supersede records the indexed entry as the next version of previous and
+// adds a line pointing to it to the caption of previous. Like Mirror, it
+// only logs failures.
+func Supersede(cl *client.Client, store *index.Store, previous, entry *index.Entry) {
+	if previous == nil {
+		return
+	}
+	if err := store.Update(previous.ID, func(e *index.Entry) { e.Superseded = entry.ID }); err != nil {
+		logger.Warn.Printf("Failed to record the new version of %s - %v", entry.FileName, err)
+	}
+
+	caption := previous.Caption + supersededLine
+	if link := entry.Link(); link != "" {
+		caption += ": " + link
+	}
+	if err := cl.EditCaption(previous.ChatID, previous.MessageID(), caption, nil); err != nil {
+		logger.Warn.Printf("Failed to mark the previous version of %s - %v", entry.FileName, err)
+	}
+}
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tg-storage-assistant/internal/client"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+)
+
+func TestUploadVersions(t *testing.T) {
+	const chatID = int64(-1001234567890)
+	dir := t.TempDir()
+	cfg := &config.MtprotoConfig{
+		StorageChatID:  chatID,
+		TempDir:        dir,
+		MaxSizeBytes:   20 << 20,
+		DuplicateCheck: "skip",
+		DuplicateScan:  200,
+		Versioning:     true,
+	}
+	fake := client.NewFakeAPI()
+	fake.AddChannel(chatID, "storage")
+	store, err := index.Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(client.NewWithAPI(context.Background(), cfg, fake), cfg, store)
+
+	path := filepath.Join(dir, "notes_todo.txt")
+	upload := func(content string) *index.Entry {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := p.Upload(path, "notes", "todo", "test")
+		if err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		return entry
+	}
+
+	first := upload("milk")
+	if again := upload("milk"); again.ID != first.ID || len(fake.Messages(chatID)) != 1 {
+		t.Fatalf("unchanged file was uploaded again as media %d", again.ID)
+	}
+
+	// Same size, other content: the caption search alone would skip it
+	second := upload("eggs")
+	if second.ID == first.ID || second.Version != 2 {
+		t.Fatalf("changed file = media %d version %d, want a new media of version 2", second.ID, second.Version)
+	}
+	if old, _ := store.Get(first.ID); old.Superseded != second.ID {
+		t.Errorf("first version superseded by %d, want %d", old.Superseded, second.ID)
+	}
+	msgs := fake.Messages(chatID)
+	if len(msgs) != 2 || !strings.HasPrefix(msgs[0].Message, "#notes todo\n🔁 Superseded") || !strings.HasSuffix(msgs[0].Message, second.Link()) {
+		t.Errorf("first caption = %q", msgs[0].Message)
+	}
+	if versions := store.Versions("notes", "notes_todo.txt"); len(versions) != 2 || versions[1].ID != second.ID {
+		t.Errorf("versions = %d, want the first and second upload", len(versions))
+	}
+}
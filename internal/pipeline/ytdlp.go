@@ -0,0 +1,28 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/index"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/ytdlp"
+)
+
+// SaveURL downloads an online video with yt-dlp and uploads it, using the
+// video title as the description
+func (p *Pipeline) SaveURL(ctx context.Context, cfg *config.YtDlpConfig, url string) (*index.Entry, error) {
+	res, err := ytdlp.Download(ctx, cfg.Binary, url, filepath.Join(p.cfg.StagingDir, "ytdlp"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.Remove(res.Path); err != nil && !os.IsNotExist(err) {
+			logger.Warn.Printf("Failed to remove %s: %v", res.Path, err)
+		}
+	}()
+
+	logger.Info.Printf("Saved %q to %s", res.Title, res.Path)
+	return p.Upload(res.Path, cfg.Tag, ytdlp.Description(res.Title), "ytdlp")
+}
@@ -0,0 +1,127 @@
+// Package priority keeps the files of local_dir marked to upload before
+// the others (`cli queue -p`, bot /priority). The marks are a JSON file
+// shared by uploader runs, the cli and the daemon the same way as the retry
+// queue: writes take a file lock and apply to the latest file contents.
+package priority
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+)
+
+// Marks is the list of marked file names, in marking order
+type Marks struct {
+	mu    sync.Mutex
+	path  string
+	files []string
+}
+
+type marksFile struct {
+	Files []string `json:"files"`
+}
+
+// Open loads the marks from path, starting empty if the file does not exist
+func Open(path string) (*Marks, error) {
+	m := &Marks{path: path}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Mark marks files of local_dir to upload before the others
+func (m *Marks) Mark(names ...string) error {
+	return m.update(func() {
+		for _, name := range names {
+			if !slices.Contains(m.files, name) {
+				m.files = append(m.files, name)
+			}
+		}
+	})
+}
+
+// Unmark removes the mark of name, e.g. once it was uploaded
+func (m *Marks) Unmark(name string) error {
+	if !slices.Contains(m.List(), name) {
+		return nil
+	}
+	return m.update(func() {
+		m.files = slices.DeleteFunc(m.files, func(n string) bool { return n == name })
+	})
+}
+
+// List returns the marked files in marking order
+func (m *Marks) List() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.load(); err != nil {
+		logger.Warn.Printf("Failed to reload priority marks: %v", err)
+	}
+	return slices.Clone(m.files)
+}
+
+// update applies fn to the latest file contents and saves the result while
+// holding the file lock
+func (m *Marks) update(fn func()) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if dir := filepath.Dir(m.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create priority marks dir failed: %w", err)
+		}
+	}
+	unlock, err := util.LockFile(m.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock priority marks failed: %w", err)
+	}
+	defer unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+	fn()
+	return m.save()
+}
+
+// load replaces the in-memory marks with the file contents. Caller holds the lock.
+func (m *Marks) load() error {
+	raw, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		m.files = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read priority marks failed: %w", err)
+	}
+
+	var f marksFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("parse priority marks failed: %w", err)
+	}
+	m.files = f.Files
+	return nil
+}
+
+// save writes the marks atomically (temp file + rename). Caller holds the lock.
+func (m *Marks) save() error {
+	raw, err := json.MarshalIndent(marksFile{Files: m.files}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode priority marks failed: %w", err)
+	}
+
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("write priority marks failed: %w", err)
+	}
+	if err := util.ReplaceFile(tmp, m.path); err != nil {
+		return fmt.Errorf("replace priority marks failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package retry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"tg-storage-assistant/internal/errs"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+	"time"
+)
+
+// maxDelay caps the exponential backoff between attempts
+const maxDelay = 6 * time.Hour
+
+// Entry is a file in local_dir whose upload failed and will be tried again
+type Entry struct {
+	FileName    string    `json:"file_name"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	Category    string    `json:"category,omitempty"` // errs.Category of LastError
+	NextRetryAt time.Time `json:"next_retry_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Queue is a JSON file backed list of failed uploads, shared by uploader
+// runs and the daemon the same way as the index: writes take a file lock
+// and apply to the latest file contents.
+type Queue struct {
+	mu          sync.Mutex
+	path        string
+	maxAttempts int
+	baseDelay   time.Duration
+	entries     []*Entry
+}
+
+type queueFile struct {
+	Entries []*Entry `json:"entries"`
+}
+
+// Open loads the queue from path, starting empty if the file does not exist.
+// A file is retried after baseDelay, then twice as long after each failure,
+// until it failed maxAttempts times.
+func Open(path string, maxAttempts int, baseDelay time.Duration) (*Queue, error) {
+	q := &Queue{path: path, maxAttempts: maxAttempts, baseDelay: baseDelay}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Fail records a failed attempt to upload name and schedules the next one
+func (q *Queue) Fail(name string, cause error) (Entry, error) {
+	var entry Entry
+	err := q.update(func() {
+		now := time.Now()
+		e := q.find(name)
+		if e == nil {
+			e = &Entry{FileName: name, CreatedAt: now}
+			q.entries = append(q.entries, e)
+		}
+		e.Attempts++
+		e.LastError, e.Category = cause.Error(), errs.Category(cause)
+		e.UpdatedAt = now
+		e.NextRetryAt = now.Add(q.delay(e.Attempts))
+		entry = *e
+	})
+	return entry, err
+}
+
+// Done removes name after it was uploaded (or is gone)
+func (q *Queue) Done(name string) error {
+	if _, ok := q.Get(name); !ok {
+		return nil
+	}
+	return q.update(func() {
+		for i, e := range q.entries {
+			if e.FileName == name {
+				q.entries = append(q.entries[:i], q.entries[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// Get returns the entry of name
+func (q *Queue) Get(name string) (Entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reload()
+
+	if e := q.find(name); e != nil {
+		return *e, true
+	}
+	return Entry{}, false
+}
+
+// Due returns the entries whose next attempt is due, oldest first
+func (q *Queue) Due(now time.Time) []Entry {
+	var due []Entry
+	for _, e := range q.List() {
+		if !q.GaveUp(e) && !e.NextRetryAt.After(now) {
+			due = append(due, e)
+		}
+	}
+	return due
+}
+
+// List returns copies of all entries, oldest first
+func (q *Queue) List() []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reload()
+
+	list := make([]Entry, 0, len(q.entries))
+	for _, e := range q.entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// GaveUp reports whether e used all of its attempts
+func (q *Queue) GaveUp(e Entry) bool {
+	return e.Attempts >= q.maxAttempts
+}
+
+// delay is the wait after the given number of failed attempts
+func (q *Queue) delay(attempts int) time.Duration {
+	d := q.baseDelay
+	for i := 1; i < attempts && d < maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxDelay)
+}
+
+func (q *Queue) find(name string) *Entry {
+	for _, e := range q.entries {
+		if e.FileName == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// update applies fn to the latest file contents and saves the result while
+// holding the file lock
+func (q *Queue) update(fn func()) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if dir := filepath.Dir(q.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create retry queue dir failed: %w", err)
+		}
+	}
+	unlock, err := util.LockFile(q.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock retry queue failed: %w", err)
+	}
+	defer unlock()
+
+	if err := q.load(); err != nil {
+		return err
+	}
+	fn()
+	return q.save()
+}
+
+// reload picks up changes made by other processes. Caller holds the lock.
+func (q *Queue) reload() {
+	if err := q.load(); err != nil {
+		logger.Warn.Printf("Failed to reload retry queue: %v", err)
+	}
+}
+
+// load replaces the in-memory state with the file contents. Caller holds the lock.
+func (q *Queue) load() error {
+	raw, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		q.entries = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read retry queue failed: %w", err)
+	}
+
+	var f queueFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("parse retry queue failed: %w", err)
+	}
+	q.entries = f.Entries
+	return nil
+}
+
+// save writes the queue atomically (temp file + rename). Caller holds the lock.
+func (q *Queue) save() error {
+	raw, err := json.MarshalIndent(queueFile{Entries: q.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode retry queue failed: %w", err)
+	}
+
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("write retry queue failed: %w", err)
+	}
+	if err := util.ReplaceFile(tmp, q.path); err != nil {
+		return fmt.Errorf("replace retry queue failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package retry
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFailBacksOffAndGivesUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retry.json")
+	q, err := Open(path, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := q.Fail("a.mp4", errors.New("flood wait"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.Fail("a.mp4", errors.New("timeout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Attempts != 2 || second.LastError != "timeout" {
+		t.Fatalf("got %+v", second)
+	}
+	if wait := second.NextRetryAt.Sub(second.UpdatedAt); wait != 2*time.Minute {
+		t.Fatalf("second delay = %s, want 2m", wait)
+	}
+	if len(q.Due(first.UpdatedAt)) != 0 || len(q.Due(second.NextRetryAt)) != 1 {
+		t.Fatal("entry due at the wrong time")
+	}
+
+	// Another process sees the same queue
+	other, err := Open(path, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := other.Fail("a.mp4", errors.New("again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.GaveUp(third) || len(q.Due(third.NextRetryAt)) != 0 {
+		t.Fatalf("still retried after %d attempts", third.Attempts)
+	}
+
+	if err := q.Done("a.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.Get("a.mp4"); ok {
+		t.Fatal("entry not removed")
+	}
+}
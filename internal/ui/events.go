@@ -0,0 +1,229 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"tg-storage-assistant/internal/logger"
+	"time"
+)
+
+// Event types of the JSON progress stream
+const (
+	EventFileStarted   = "file_started"   // a local file starts processing
+	EventFileCompleted = "file_completed" // all of its parts are sent
+	EventFileFailed    = "file_failed"
+	EventPartStarted   = "part_started" // one upload (video part, preview, document) starts
+	EventProgress      = "progress"
+	EventPartUploaded  = "part_uploaded"
+	EventRunFinished   = "run_finished" // the run statistics, in Report
+)
+
+// eventInterval throttles progress events per upload
+const eventInterval = time.Second
+
+// Event is one line of the JSON progress stream
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	File    string    `json:"file"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Total   int64     `json:"total,omitempty"`
+	Percent float64   `json:"percent,omitempty"`
+	Speed   float64   `json:"speed,omitempty"` // bytes per second
+	Error   string    `json:"error,omitempty"`
+	Report  any       `json:"report,omitempty"`
+}
+
+var events struct {
+	mu  sync.Mutex
+	out io.WriteCloser
+}
+
+// OpenEvents starts writing newline-delimited JSON events to target: "-" for
+// stdout, or the path of a unix socket that clients can connect to.
+func OpenEvents(target string) error {
+	var out io.WriteCloser
+	if target == "-" {
+		out = nopCloser{os.Stdout}
+	} else {
+		b, err := listenBroadcast(target)
+		if err != nil {
+			return err
+		}
+		out = b
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if events.out != nil {
+		events.out.Close()
+	}
+	events.out = out
+	return nil
+}
+
+// Setup applies the progress mode and opens the JSON event stream when
+// eventsTarget is set. Events on stdout move the console log to stderr.
+func Setup(m ProgressMode, eventsTarget string) error {
+	if err := SetMode(m); err != nil {
+		return err
+	}
+	if eventsTarget == "" {
+		return nil
+	}
+	if eventsTarget == "-" {
+		logger.UseStderr()
+	}
+	return OpenEvents(eventsTarget)
+}
+
+// CloseEvents stops the event stream
+func CloseEvents() {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if events.out != nil {
+		events.out.Close()
+		events.out = nil
+	}
+}
+
+// Emit writes e to the event stream, if one is open
+func Emit(e Event) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if events.out == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := events.out.Write(append(data, '\n')); err != nil {
+		logger.Warn.Printf("Failed to write progress event: %v", err)
+	}
+}
+
+// EmitFileStarted reports that a local file starts processing
+func EmitFileStarted(path string, size int64) {
+	Emit(Event{Type: EventFileStarted, File: filepath.Base(path), Total: size})
+}
+
+// EmitFileResult reports whether a local file was sent
+func EmitFileResult(path string, err error) {
+	if err != nil {
+		Emit(Event{Type: EventFileFailed, File: filepath.Base(path), Error: err.Error()})
+		return
+	}
+	Emit(Event{Type: EventFileCompleted, File: filepath.Base(path)})
+}
+
+// EmitRunFinished reports the statistics of an upload run
+func EmitRunFinished(report any) {
+	Emit(Event{Type: EventRunFinished, Report: report})
+}
+
+// uploadEvents tracks one upload for the event stream
+type uploadEvents struct {
+	name     string
+	total    int64
+	lastTime time.Time
+	lastSize int64
+}
+
+func (u *uploadEvents) update(uploaded int64) {
+	now := time.Now()
+	elapsed := now.Sub(u.lastTime)
+	if elapsed < eventInterval {
+		return
+	}
+
+	e := Event{Type: EventProgress, File: u.name, Bytes: uploaded, Total: u.total,
+		Speed: float64(uploaded-u.lastSize) / elapsed.Seconds()}
+	if u.total > 0 {
+		e.Percent = float64(uploaded) * 100 / float64(u.total)
+	}
+	Emit(e)
+	u.lastTime, u.lastSize = now, uploaded
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// broadcast writes every event to all connected clients. Clients that can't
+// keep up are dropped rather than blocking uploads.
+type broadcast struct {
+	path string
+	ln   net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func listenBroadcast(path string) (*broadcast, error) {
+	// A socket left behind by a previous run would make Listen fail
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	b := &broadcast{path: path, ln: ln, conns: make(map[net.Conn]struct{})}
+	go b.accept()
+	return b, nil
+}
+
+func (b *broadcast) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		if b.conns == nil {
+			conn.Close()
+		} else {
+			b.conns[conn] = struct{}{}
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *broadcast) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for conn := range b.conns {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(p); err != nil {
+			conn.Close()
+			delete(b.conns, conn)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *broadcast) Close() error {
+	err := b.ln.Close()
+
+	b.mu.Lock()
+	for conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+	b.mu.Unlock()
+
+	os.Remove(b.path)
+	return err
+}
@@ -0,0 +1,126 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/util"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// ProgressMode selects how transfers are reported
+type ProgressMode string
+
+const (
+	ProgressAuto  ProgressMode = "auto"  // bars on a terminal, plain otherwise
+	ProgressBars  ProgressMode = "bars"  // mpb progress bars on stderr
+	ProgressPlain ProgressMode = "plain" // periodic single-line log updates
+	ProgressOff   ProgressMode = "off"
+)
+
+// plainInterval is how often plain mode logs a transfer
+const plainInterval = 10 * time.Second
+
+var mode atomic.Value // ProgressMode, never ProgressAuto
+
+// SetMode selects the progress output for transfers started from now on
+func SetMode(m ProgressMode) error {
+	switch m {
+	case ProgressAuto, "":
+		m = ProgressPlain
+		if isTerminal(os.Stderr) {
+			m = ProgressBars
+		}
+	case ProgressBars, ProgressPlain, ProgressOff:
+	default:
+		return fmt.Errorf("unknown progress mode %q (auto, bars, plain or off)", m)
+	}
+	mode.Store(m)
+	return nil
+}
+
+// Mode returns the resolved progress mode
+func Mode() ProgressMode {
+	if m, ok := mode.Load().(ProgressMode); ok {
+		return m
+	}
+	SetMode(ProgressAuto)
+	return mode.Load().(ProgressMode)
+}
+
+// isTerminal reports whether f is a console. A character device is not
+// enough: NUL is one on Windows, and mintty/Cygwin terminals are pipes.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// lineProgress logs "Uploading [name]: 45% (12.00 MB / 26.70 MB), 1.20 MB/s" at
+// most once per plainInterval
+type lineProgress struct {
+	verb  string
+	name  string
+	total int64
+
+	start     time.Time
+	startSize int64
+	lastLog   time.Time
+	lastSize  int64
+}
+
+func newLineProgress(verb, name string, total, current int64) *lineProgress {
+	now := time.Now()
+	l := &lineProgress{
+		verb:      verb,
+		name:      util.SafeBase(name),
+		total:     total,
+		start:     now,
+		startSize: current,
+		lastLog:   now,
+		lastSize:  current,
+	}
+	logger.Info.Printf("%s [%s]: started%s", l.verb, l.name, l.sizeSuffix(current))
+	return l
+}
+
+func (l *lineProgress) update(current int64) {
+	now := time.Now()
+	elapsed := now.Sub(l.lastLog)
+	if elapsed < plainInterval {
+		return
+	}
+
+	speed := float64(current-l.lastSize) / elapsed.Seconds()
+	logger.Info.Printf("%s [%s]: %s, %s/s", l.verb, l.name, l.progress(current),
+		util.FormatBytesToHumanReadable(int64(speed)))
+	l.lastLog, l.lastSize = now, current
+}
+
+func (l *lineProgress) done(current int64) {
+	elapsed := time.Since(l.start)
+	speed := float64(current-l.startSize) / max(elapsed.Seconds(), 0.001)
+	logger.Info.Printf("%s [%s]: done, %s in %s (%s/s)", l.verb, l.name,
+		util.FormatBytesToHumanReadable(current), elapsed.Round(time.Second),
+		util.FormatBytesToHumanReadable(int64(speed)))
+}
+
+func (l *lineProgress) progress(current int64) string {
+	if l.total <= 0 {
+		return util.FormatBytesToHumanReadable(current)
+	}
+	return fmt.Sprintf("%d%% (%s / %s)", current*100/l.total,
+		util.FormatBytesToHumanReadable(current), util.FormatBytesToHumanReadable(l.total))
+}
+
+func (l *lineProgress) sizeSuffix(current int64) string {
+	switch {
+	case current > 0 && l.total > 0:
+		return fmt.Sprintf(" at %s of %s", util.FormatBytesToHumanReadable(current), util.FormatBytesToHumanReadable(l.total))
+	case l.total > 0:
+		return ", " + util.FormatBytesToHumanReadable(l.total)
+	default:
+		return ""
+	}
+}
@@ -3,6 +3,7 @@ package ui
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 	"tg-storage-assistant/internal/util"
@@ -15,28 +16,57 @@ import (
 
 type UploadProgress struct {
 	mu       sync.Mutex
+	mode     ProgressMode
 	p        *mpb.Progress
 	bars     map[int64]*mpb.Bar // upload ID -> bar
 	last     map[int64]int64    // upload ID -> last uploaded bytes
 	lastTime map[int64]time.Time
+	lines    map[int64]*lineProgress // plain mode
+	events   map[int64]*uploadEvents
 }
 
 func NewUploadProgress() *UploadProgress {
-	return &UploadProgress{
-		p: mpb.New(
-			mpb.WithOutput(os.Stderr),
-			mpb.WithWidth(60),
-		),
+	p := &UploadProgress{
+		mode:     Mode(),
 		bars:     make(map[int64]*mpb.Bar),
 		last:     make(map[int64]int64),
 		lastTime: make(map[int64]time.Time),
+		lines:    make(map[int64]*lineProgress),
+		events:   make(map[int64]*uploadEvents),
+	}
+	if p.mode == ProgressBars {
+		p.p = mpb.New(
+			mpb.WithOutput(os.Stderr),
+			mpb.WithWidth(60),
+		)
 	}
+	return p
 }
 
 func (p *UploadProgress) Chunk(ctx context.Context, st uploader.ProgressState) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.emit(st)
+
+	switch p.mode {
+	case ProgressOff:
+		return nil
+	case ProgressPlain:
+		line, ok := p.lines[st.ID]
+		if !ok {
+			line = newLineProgress("Uploading", st.Name, st.Total, 0)
+			p.lines[st.ID] = line
+		}
+		if st.Total > 0 && st.Uploaded >= st.Total {
+			line.done(st.Uploaded)
+			delete(p.lines, st.ID)
+		} else {
+			line.update(st.Uploaded)
+		}
+		return nil
+	}
+
 	bar, ok := p.bars[st.ID]
 	if !ok && st.Total > 0 {
 		name := util.SafeBase(st.Name)
@@ -101,12 +131,129 @@ func (p *UploadProgress) Chunk(ctx context.Context, st uploader.ProgressState) e
 	return nil
 }
 
+// emit reports st on the JSON event stream
+func (p *UploadProgress) emit(st uploader.ProgressState) {
+	ev, ok := p.events[st.ID]
+	if !ok {
+		ev = &uploadEvents{name: util.SafeBase(st.Name), total: st.Total, lastTime: time.Now()}
+		p.events[st.ID] = ev
+		Emit(Event{Type: EventPartStarted, File: ev.name, Total: st.Total})
+	}
+
+	if st.Total > 0 && st.Uploaded >= st.Total {
+		Emit(Event{Type: EventPartUploaded, File: ev.name, Bytes: st.Uploaded, Total: st.Total, Percent: 100})
+		delete(p.events, st.ID)
+		return
+	}
+	ev.update(st.Uploaded)
+}
+
 func (p *UploadProgress) Shutdown() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.p == nil {
+		return
+	}
 	for _, bar := range p.bars {
 		bar.Abort(true)
 	}
 	p.p.Wait()
 }
+
+// DownloadProgress renders a single bar for an HTTP download
+type DownloadProgress struct {
+	p    *mpb.Progress
+	bar  *mpb.Bar
+	line *lineProgress // plain mode
+	read int64
+}
+
+// NewDownloadProgress starts a bar at current bytes. total <= 0 means the
+// size is unknown.
+func NewDownloadProgress(name string, total, current int64) *DownloadProgress {
+	switch Mode() {
+	case ProgressOff:
+		return &DownloadProgress{}
+	case ProgressPlain:
+		return &DownloadProgress{line: newLineProgress("Downloading", name, total, current), read: current}
+	}
+
+	p := mpb.New(
+		mpb.WithOutput(os.Stderr),
+		mpb.WithWidth(60),
+	)
+	if total < 0 {
+		total = 0
+	}
+	bar := p.New(
+		total,
+		mpb.BarStyle().Lbound("|").Rbound("|").Filler("█").Tip("█").Padding(" ").Refiller(" "),
+		mpb.PrependDecorators(
+			decor.Name(
+				fmt.Sprintf("Downloading %-25s ", "["+util.SafeBase(name)+"]"),
+				decor.WC{W: 37, C: decor.DSyncWidthR},
+			),
+			decor.Percentage(decor.WC{W: 6}),
+		),
+		mpb.AppendDecorators(
+			decor.CountersKibiByte("% .2f / % .2f"),
+
+			decor.Name(" ", decor.WC{W: 1}),
+			decor.EwmaSpeed(decor.SizeB1000(0), "(% .2f)", 10,
+				decor.WC{W: 10}),
+
+			decor.Name(" ", decor.WC{W: 1}),
+			decor.OnComplete(
+				decor.EwmaETA(decor.ET_STYLE_GO, 10),
+				"✅",
+			),
+		),
+	)
+	bar.SetCurrent(current)
+
+	return &DownloadProgress{p: p, bar: bar}
+}
+
+// ProxyReader wraps r so reads advance the bar
+func (d *DownloadProgress) ProxyReader(r io.Reader) io.ReadCloser {
+	switch {
+	case d.bar != nil:
+		return d.bar.ProxyReader(r)
+	case d.line != nil:
+		return io.NopCloser(&countingReader{r: r, d: d})
+	default:
+		return io.NopCloser(r)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	d *DownloadProgress
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.d.read += int64(n)
+	c.d.line.update(c.d.read)
+	return n, err
+}
+
+// Shutdown completes or aborts the bar and waits for the final render
+func (d *DownloadProgress) Shutdown(completed bool) {
+	if d.line != nil {
+		if completed {
+			d.line.done(d.read)
+		}
+		return
+	}
+	if d.bar == nil {
+		return
+	}
+	if completed {
+		d.bar.SetTotal(-1, true)
+	} else {
+		d.bar.Abort(false)
+	}
+	d.p.Wait()
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package util
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns the number of bytes available to the user on the
+// volume containing path
+func FreeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by TryLockFile when another process holds the lock
+var ErrLocked = errors.New("file is locked")
+
+// writePID records the current process as the holder of the lock file f
+func writePID(f *os.File) {
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+}
+
+// LockHolder returns the PID stored in a lock file by TryLockFile, 0 when
+// it is unknown
+func LockHolder(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
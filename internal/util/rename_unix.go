@@ -0,0 +1,20 @@
+//go:build !windows
+
+package util
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ReplaceFile renames src over dst
+func ReplaceFile(src, dst string) error {
+	return os.Rename(src, dst)
+}
+
+// IsCrossDevice reports whether a rename failed because src and dst are on
+// different filesystems
+func IsCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
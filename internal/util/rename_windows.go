@@ -0,0 +1,35 @@
+//go:build windows
+
+package util
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// replaceAttempts bounds the retries of ReplaceFile while another process
+// has dst open
+const replaceAttempts = 20
+
+// ReplaceFile renames src over dst. Windows refuses while another process
+// (e.g. the daemon reading the index) has dst open, so it is retried for a
+// moment.
+func ReplaceFile(src, dst string) error {
+	var err error
+	for range replaceAttempts {
+		if err = os.Rename(src, dst); err == nil || !errors.Is(err, windows.ERROR_ACCESS_DENIED) && !errors.Is(err, windows.ERROR_SHARING_VIOLATION) {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return err
+}
+
+// IsCrossDevice reports whether a rename failed because src and dst are on
+// different volumes
+func IsCrossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // parseSize parses a size string like "2G", "500M", "1.5G" to bytes
@@ -54,6 +55,19 @@ func ParseSize(sizeStr string) (int64, error) {
 	return int64(value * float64(multiplier)), nil
 }
 
+// ParseDuration parses a Go duration like "36h" or a number of days like "30d"
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
 func FormatBytesToHumanReadable(n int64) string {
 	units := []string{"B", "KB", "MB", "GB", "TB"}
 	v := float64(n)
@@ -0,0 +1,100 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"tg-storage-assistant/internal/util"
+)
+
+// maxSuffix bounds the " (N)" names tried when the destination is taken
+const maxSuffix = 1000
+
+// move moves src to dst without replacing an existing file: a taken name
+// gets a " (N)" suffix before the extension. Across filesystems or
+// volumes, where rename fails, the file is copied, synced and then removed.
+// It returns the path the file was moved to.
+func move(src, dst string) (string, error) {
+	for n := 0; n < maxSuffix; n++ {
+		target := suffixed(dst, n)
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		err := os.Rename(src, target)
+		if util.IsCrossDevice(err) {
+			err = copyRemove(src, target)
+			if errors.Is(err, os.ErrExist) {
+				// Taken since the check
+				continue
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		if n > 0 {
+			log.Warn.Printf("%s already exists, moved %s as %s", filepath.Base(dst), filepath.Base(src), filepath.Base(target))
+		}
+		return target, nil
+	}
+	return "", fmt.Errorf("no free name for %s after %d tries", filepath.Base(dst), maxSuffix)
+}
+
+// suffixed returns path with " (n)" before its extension, or path for 0
+func suffixed(path string, n int) string {
+	if n == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// copyRemove copies src to the new file dst, syncs it and removes src. A
+// failed copy leaves src alone and removes the partial dst.
+func copyRemove(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copy to %s: %w", filepath.Dir(dst), err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		log.Warn.Printf("Failed to keep the modification time of %s: %v", filepath.Base(dst), err)
+	}
+
+	in.Close()
+	if err := os.Remove(src); err != nil {
+		// Both copies exist now; keeping src is safer than losing dst
+		log.Warn.Printf("Copied %s but failed to remove it: %v", src, err)
+	}
+	return nil
+}
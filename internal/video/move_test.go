@@ -0,0 +1,59 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveKeepsExistingFiles(t *testing.T) {
+	src, done := t.TempDir(), t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(done, "a_clip.mp4"), "old")
+	write(filepath.Join(done, "a_clip (1).mp4"), "older")
+	write(filepath.Join(src, "a_clip.mp4"), "new")
+
+	got, err := move(filepath.Join(src, "a_clip.mp4"), filepath.Join(done, "a_clip.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(done, "a_clip (2).mp4"); got != want {
+		t.Fatalf("moved to %s, want %s", got, want)
+	}
+	if b, _ := os.ReadFile(filepath.Join(done, "a_clip.mp4")); string(b) != "old" {
+		t.Fatalf("existing file overwritten with %q", b)
+	}
+}
+
+func TestCopyRemove(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "a.bin")
+	dst := filepath.Join(t.TempDir(), "a.bin")
+	if err := os.WriteFile(src, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("taken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyRemove(src, dst); !os.IsExist(err) {
+		t.Fatalf("copy over an existing file: %v", err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "taken" {
+		t.Fatalf("existing file removed or changed: %q", b)
+	}
+
+	os.Remove(dst)
+	if err := copyRemove(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "data" {
+		t.Fatalf("copy = %q", b)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("source kept: %v", err)
+	}
+}
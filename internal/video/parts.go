@@ -0,0 +1,48 @@
+package video
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// partHashLen is how many hex digits of the original's SHA-256 part names
+// carry
+const partHashLen = 12
+
+// partPattern matches the names PartName gives
+var partPattern = regexp.MustCompile(`^(.*)_part(\d+)of(\d+)_([0-9a-f]+)$`)
+
+// Part is what the name of a video part tells about it
+type Part struct {
+	Name  string // of the original file
+	Index int    // from 1
+	Total int
+	Hash  string // SHA-256 prefix of the original file
+}
+
+// PartName is the name of part i (from 1) of total cut from the file name
+// with SHA-256 sum, e.g. "trip_part02of07_3f2a9c0d1e4b.mp4". Restore can
+// order and group parts by it even when forwarding lost the album.
+func PartName(name string, i, total int, sum string) string {
+	ext := filepath.Ext(name)
+	width := max(len(strconv.Itoa(total)), 2)
+	return fmt.Sprintf("%s_part%0*dof%0*d_%s%s", strings.TrimSuffix(name, ext), width, i, width, total, sum[:min(len(sum), partHashLen)], ext)
+}
+
+// ParsePartName reads a name given by PartName
+func ParsePartName(name string) (Part, bool) {
+	ext := filepath.Ext(name)
+	m := partPattern.FindStringSubmatch(strings.TrimSuffix(name, ext))
+	if m == nil {
+		return Part{}, false
+	}
+	i, _ := strconv.Atoi(m[2])
+	total, _ := strconv.Atoi(m[3])
+	if i < 1 || i > total {
+		return Part{}, false
+	}
+	return Part{Name: m[1] + ext, Index: i, Total: total, Hash: m[4]}, true
+}
@@ -0,0 +1,100 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"tg-storage-assistant/internal/ffmpeg"
+	"time"
+)
+
+const (
+	spriteWidth = 160 // of a tile
+	spriteCols  = 10
+	spriteRows  = 10 // at most, fewer for short videos
+)
+
+// scrubPattern matches the names makeScrub gives
+var scrubPattern = regexp.MustCompile(`_(sprites\d+\.jpg|thumbnails\.vtt)$`)
+
+// IsScrubName tells whether name is that of a sprite sheet or WebVTT sent
+// for scrubbing
+func IsScrubName(name string) bool {
+	return scrubPattern.MatchString(name)
+}
+
+// makeScrub draws a frame of the video at filePath every interval into
+// sprite sheets named after the original file and writes the WebVTT
+// mapping times to their tiles. It returns the sheets, then the WebVTT.
+func makeScrub(filePath, originalPath, tempDir string, interval time.Duration) ([]string, error) {
+	duration, err := ffmpeg.GetVideoDuration(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video duration: %w", err)
+	}
+	seconds := interval.Seconds()
+	frames := int(math.Ceil(duration / seconds))
+	rows := min(spriteRows, (frames+spriteCols-1)/spriteCols)
+
+	base := filepath.Base(originalPath)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	// % is a pattern to ffmpeg
+	pattern := filepath.Join(tempDir, strings.ReplaceAll(base, "%", "%%")+"_sprites%02d.jpg")
+	sheets, err := ffmpeg.SpriteSheets(filePath, pattern, seconds, spriteWidth, spriteCols, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tiles are scaled by the aspect ratio of the video
+	f, err := os.Open(sheets[0])
+	if err != nil {
+		return nil, err
+	}
+	sheet, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sprite sheet: %w", err)
+	}
+	names := make([]string, len(sheets))
+	for i, path := range sheets {
+		names[i] = filepath.Base(path)
+	}
+	vtt := scrubVTT(duration, seconds, sheet.Width/spriteCols, sheet.Height/rows, rows, names)
+
+	vttPath := filepath.Join(tempDir, base+"_thumbnails.vtt")
+	if err := os.WriteFile(vttPath, []byte(vtt), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write WebVTT: %w", err)
+	}
+	return append(sheets, vttPath), nil
+}
+
+// scrubVTT is the WebVTT of a video of duration seconds with a tile every
+// interval seconds, spriteCols×rows to a sheet. Sheets are referred to by
+// their names, relative to the WebVTT.
+func scrubVTT(duration, interval float64, tileW, tileH, rows int, sheets []string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	perSheet := spriteCols * rows
+	for i := 0; float64(i)*interval < duration; i++ {
+		sheet := i / perSheet
+		if sheet >= len(sheets) {
+			break
+		}
+		tile := i % perSheet
+		end := min(float64(i+1)*interval, duration)
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTime(float64(i)*interval), vttTime(end), url.PathEscape(sheets[sheet]),
+			tile%spriteCols*tileW, tile/spriteCols*tileH, tileW, tileH)
+	}
+	return b.String()
+}
+
+// vttTime formats seconds as a WebVTT timestamp, e.g. 01:02:03.500
+func vttTime(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -5,75 +5,122 @@ import (
 	"image"
 	stddraw "image/draw"
 	"image/jpeg"
+	"math"
 	"os"
-	"tg-storage-assistant/internal/logger"
+	"sync"
 
 	"golang.org/x/image/draw"
 )
 
+// PreviewGrid returns the columns and rows of the contact sheet of a video
+// lasting seconds. The frames grow with the square root of the duration,
+// 4 per √minute: 4 for a 1-minute clip, 30 for an hour, 56 for three
+// hours, kept within minFrames and maxFrames. Rows are never fewer than
+// columns by more than one.
+func PreviewGrid(seconds float64, minFrames, maxFrames int) (cols, rows int) {
+	n := int(math.Round(4 * math.Sqrt(seconds/60)))
+	n = min(max(n, minFrames, 1), maxFrames)
+	rows = int(math.Ceil(math.Sqrt(float64(n))))
+	cols = max(int(math.Round(float64(n)/float64(rows))), 1)
+	// Rounding may leave the grid outside the bounds
+	for cols*rows > maxFrames && cols > 1 {
+		cols--
+	}
+	for cols*rows < minFrames {
+		cols++
+	}
+	return cols, rows
+}
+
 // ComposeGrid arranges frames into a grid and saves as a single JPEG
 func ComposeGrid(framePaths []string, cols, rows int, outputPath string) error {
 	if len(framePaths) == 0 {
 		return fmt.Errorf("no frames to compose")
 	}
 
-	if cols <= 0 || rows <= 0 {
-		return fmt.Errorf("invalid grid dimensions: %dx%d", cols, rows)
-	}
-
 	expectedFrames := cols * rows
 	if len(framePaths) != expectedFrames {
 		return fmt.Errorf("frame count mismatch: got %d frames, expected %d (%dx%d grid)",
 			len(framePaths), expectedFrames, cols, rows)
 	}
 
-	// Load first frame to get original dimensions
-	firstFrame, err := loadImage(framePaths[0])
+	g, err := newGrid(cols, rows)
 	if err != nil {
-		return fmt.Errorf("failed to load first frame: %w", err)
+		return err
 	}
-	originalBounds := firstFrame.Bounds()
-	originalWidth := originalBounds.Dx()
-	originalHeight := originalBounds.Dy()
-
-	// Calculate thumbnail size for each frame
-	// Target: final grid should be around 1920-2560 pixels wide (suitable for Telegram)
-	// With 6 columns, each thumbnail should be ~320 pixels wide
-	thumbnailWidth := 320
-	thumbnailHeight := thumbnailWidth * originalHeight / originalWidth
-
-	// Ensure minimum size
-	if thumbnailHeight < 180 {
-		thumbnailHeight = 180
-		thumbnailWidth = thumbnailHeight * originalWidth / originalHeight
+	for i, framePath := range framePaths {
+		if err := g.addFile(i, framePath); err != nil {
+			return err
+		}
 	}
+	return g.save(outputPath)
+}
 
-	// Create output image
-	gridWidth := thumbnailWidth * cols
-	gridHeight := thumbnailHeight * rows
-	grid := image.NewRGBA(image.Rect(0, 0, gridWidth, gridHeight))
+// grid is a contact sheet frames are drawn into as they arrive, from any
+// goroutine. Cells take the aspect of the first frame added.
+type grid struct {
+	cols, rows int
 
-	// Draw frames onto grid
-	for i, framePath := range framePaths {
-		frame, err := loadImage(framePath)
-		if err != nil {
-			return fmt.Errorf("failed to load frame %d: %w", i, err)
-		}
+	mu              sync.Mutex
+	img             *image.RGBA
+	thumbnailWidth  int
+	thumbnailHeight int
+}
 
-		// Calculate position in grid
-		col := i % cols
-		row := i / cols
-		x := col * thumbnailWidth
-		y := row * thumbnailHeight
+func newGrid(cols, rows int) (*grid, error) {
+	if cols <= 0 || rows <= 0 {
+		return nil, fmt.Errorf("invalid grid dimensions: %dx%d", cols, rows)
+	}
+	return &grid{cols: cols, rows: rows}, nil
+}
 
-		// Create thumbnail rectangle
-		thumbRect := image.Rect(x, y, x+thumbnailWidth, y+thumbnailHeight)
+// addFile draws the frame at path into cell i
+func (g *grid) addFile(i int, path string) error {
+	frame, err := loadImage(path)
+	if err != nil {
+		return fmt.Errorf("failed to load frame %d: %w", i, err)
+	}
+	g.add(i, frame)
+	return nil
+}
 
-		// Resize and draw frame at position using bilinear interpolation
-		draw.BiLinear.Scale(grid, thumbRect, frame, frame.Bounds(), stddraw.Over, nil)
+// add draws frame into cell i. Cells don't overlap, so frames are scaled
+// into the grid concurrently.
+func (g *grid) add(i int, frame image.Image) {
+	g.mu.Lock()
+	if g.img == nil {
+		originalWidth := frame.Bounds().Dx()
+		originalHeight := frame.Bounds().Dy()
+
+		// Calculate thumbnail size for each frame
+		// Target: final grid should be around 1920-2560 pixels wide (suitable for Telegram)
+		// With 6 columns, each thumbnail should be ~320 pixels wide
+		g.thumbnailWidth = 320
+		g.thumbnailHeight = g.thumbnailWidth * originalHeight / originalWidth
+
+		// Ensure minimum size
+		if g.thumbnailHeight < 180 {
+			g.thumbnailHeight = 180
+			g.thumbnailWidth = g.thumbnailHeight * originalWidth / originalHeight
+		}
+		g.img = image.NewRGBA(image.Rect(0, 0, g.thumbnailWidth*g.cols, g.thumbnailHeight*g.rows))
 	}
+	w, h := g.thumbnailWidth, g.thumbnailHeight
+	g.mu.Unlock()
+
+	// Calculate position in grid
+	x := (i % g.cols) * w
+	y := (i / g.cols) * h
+
+	// Resize and draw frame at position using bilinear interpolation
+	draw.BiLinear.Scale(g.img, image.Rect(x, y, x+w, y+h), frame, frame.Bounds(), stddraw.Over, nil)
+}
 
-	// Save grid as JPEG
+// save writes the grid as a JPEG
+func (g *grid) save(outputPath string) error {
+	if g.img == nil {
+		return fmt.Errorf("no frames to compose")
+	}
 	outFile, err := os.Create(outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
@@ -81,12 +128,12 @@ func ComposeGrid(framePaths []string, cols, rows int, outputPath string) error {
 	defer outFile.Close()
 
 	// Encode with quality 85
-	if err := jpeg.Encode(outFile, grid, &jpeg.Options{Quality: 85}); err != nil {
+	if err := jpeg.Encode(outFile, g.img, &jpeg.Options{Quality: 85}); err != nil {
 		return fmt.Errorf("failed to encode JPEG: %w", err)
 	}
 
-	logger.Debug.Printf("Grid composed into [%s](%dx%d)",
-		outputPath, grid.Bounds().Dx(), grid.Bounds().Dy())
+	log.Debug.Printf("Grid composed into [%s](%dx%d)",
+		outputPath, g.img.Bounds().Dx(), g.img.Bounds().Dy())
 	return nil
 }
 
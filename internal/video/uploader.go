@@ -7,132 +7,392 @@ import (
 	"strings"
 	"tg-storage-assistant/internal/client"
 	"tg-storage-assistant/internal/config"
+	"tg-storage-assistant/internal/errs"
 	"tg-storage-assistant/internal/ffmpeg"
+	"tg-storage-assistant/internal/fileprocessor"
+	"tg-storage-assistant/internal/index"
 	"tg-storage-assistant/internal/logger"
+	"tg-storage-assistant/internal/ui"
 	"tg-storage-assistant/internal/util"
+	"time"
 
 	"github.com/gotd/td/tg"
 )
 
+var log = logger.Named("uploader")
+
 type MediaItem = client.MediaItem
 
+// KnownFile finds a file with the SHA-256 sum and size already in a chat
+type KnownFile func(sum string, size int64) (chatID int64, msgID int, ok bool)
+
+// Sent is what ProcessVideo sent
+type Sent struct {
+	Files []index.File // the album: preview first, then the parts
+	Parts int          // 0 when only the contact sheet was sent
+	Scrub []index.File // sprite sheets, then their WebVTT
+}
+
+// ProcessVideo converts, previews, splits and uploads a video as one album,
+// followed by the scrub thumbnails when proc.ScrubInterval is set. Parts is
+// 0 when proc.Preview is only and just the contact sheet was sent. Parts
+// are named by PartName with sum, the SHA-256 of the file, computed here
+// when "". Parts that known finds are sent again by reference instead of
+// being uploaded, e.g. when only the tag of a video changed. Canceling the
+// client's context aborts it between steps or during the upload, and its
+// work directory under tempDir is removed.
 func ProcessVideo(
 	client *client.Client,
 	peer tg.InputPeerClass,
-	filePath, tag, description string,
-	maxSize int64,
+	filePath, sum, tag, description string,
+	proc config.Processing,
+	known KnownFile,
 	tempDir string,
 	cleanupTempDir bool,
-) error {
-	defer func() error {
-		if cleanupTempDir {
-			entries, err := os.ReadDir(tempDir)
-			if err != nil {
-				return err
-			}
+) (sent Sent, err error) {
+	ctx := client.Context()
+	defer func(path string) { ui.EmitFileResult(path, err) }(filePath)
 
-			for _, entry := range entries {
-				path := filepath.Join(tempDir, entry.Name())
-				err = os.RemoveAll(path)
-				if err != nil {
-					return err
-				}
-			}
-
-			logger.Info.Printf("Cleaned up temporary directory: %s (%d files)", tempDir, len(entries))
+	// Each video gets its own work directory, so an aborted upload only
+	// removes its own files
+	workDir, err := os.MkdirTemp(tempDir, "upload-*")
+	if err != nil {
+		return Sent{}, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer func() {
+		if !cleanupTempDir && ctx.Err() == nil {
+			return
 		}
-		return nil
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Warn.Printf("Failed to clean up %s - %v", workDir, err)
+			return
+		}
+		log.Info.Printf("Cleaned up temporary directory: %s", workDir)
 	}()
+	tempDir = workDir
+	originalPath := filePath
 
-	logger.Info.Println("┏━━━━━━━━━━━━━━━ Processing video... ━━━━━━━━━━━━━━━┓")
+	log.Info.Println("┏━━━━━━━━━━━━━━━ Processing video... ━━━━━━━━━━━━━━━┓")
 
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
+		return Sent{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+	ui.EmitFileStarted(filePath, fileInfo.Size())
+	log.Info.Printf("  FILE_NAME: %s", filePath)
+	log.Info.Printf("  TAG: %s", tag)
+	log.Info.Printf("  DESCRIPTION: %s", description)
+	log.Info.Printf("  SIZE: %s", util.FormatBytesToHumanReadable(fileInfo.Size()))
+
+	baseCaption := fileprocessor.BuildCaption(tag, description)
+	if proc.CaptionMTime {
+		baseCaption += fileprocessor.ModTimeLine(fileInfo.ModTime())
+	}
+	preview := proc.Preview
+	if preview == "full" && proc.PreviewMinDuration > 0 {
+		dur, err := ffmpeg.GetVideoDuration(filePath)
+		if err != nil {
+			return Sent{}, fmt.Errorf("failed to get video duration: %w", err)
+		}
+		if dur < proc.PreviewMinDuration.Seconds() {
+			log.Info.Printf("Skipping the preview of a %s clip", util.FormatSecondsToHumanReadable(dur))
+			preview = "none"
+		}
+	}
+
+	// Only the contact sheet: nothing to convert or split
+	if preview == "only" {
+		previewPath, err := makePreview(filePath, tempDir, tag, description, proc)
+		if err != nil {
+			return Sent{}, err
+		}
+		if err := ctx.Err(); err != nil {
+			return Sent{}, err
+		}
+		item := MediaItem{FilePath: previewPath, MediaType: "photo", Caption: baseCaption}
+		msgID, err := client.SendMedia(peer, item)
+		if err != nil {
+			return Sent{}, fmt.Errorf("failed to send preview: %w", err)
+		}
+		log.Info.Println("┗━━━━━━━━━━━ Video preview uploaded ━━━━━━━━━━━┛")
+		return Sent{Files: sentFiles([]MediaItem{item}, []int{msgID})}, nil
 	}
-	logger.Info.Printf("  FILE_NAME: %s", filePath)
-	logger.Info.Printf("  TAG: %s", tag)
-	logger.Info.Printf("  DESCRIPTION: %s", description)
-	logger.Info.Printf("  SIZE: %s", util.FormatBytesToHumanReadable(fileInfo.Size()))
 
 	// Step 1: Validate media format, convert to mp4 if needed
 	mp4Path, err := ffmpeg.EnsureMP4Compatible(filePath, tempDir)
 	if err != nil {
-		return fmt.Errorf("failed to ensure mp4 compatible: %w", err)
+		return Sent{}, fmt.Errorf("failed to ensure mp4 compatible: %w", err)
 	}
 	if mp4Path != filePath {
-		logger.Info.Printf("Ensure MP4 compatible: %s -> %s", filePath, mp4Path)
+		log.Info.Printf("Ensure MP4 compatible: %s -> %s", filePath, mp4Path)
 		filePath = mp4Path
 	} else {
-		logger.Info.Printf("MP4 already compatible: %s", filePath)
+		log.Info.Printf("MP4 already compatible: %s", filePath)
 	}
-
-	// Step 2: Generate preview thumbnail (5×6 grid, 30 frames)
-	durTotal, err := ffmpeg.GetVideoDuration(filePath)
+	sdr, err := toneMap(filePath, tempDir, proc)
 	if err != nil {
-		return fmt.Errorf("failed to get video duration: %w", err)
+		return Sent{}, err
 	}
-	logger.Info.Printf("Extracting 30 frames for preview (total duration: %s)", util.FormatSecondsToHumanReadable(durTotal))
-	frames, err := ffmpeg.ExtractFrames(filePath, tempDir, durTotal, 30)
-	if err != nil {
-		return fmt.Errorf("failed to extract frames: %w", err)
+	if sdr != filePath {
+		// Scaled down to the transcode height as well
+		filePath = sdr
+	} else if proc.TranscodeHeight > 0 {
+		scaled, err := ffmpeg.ScaleToHeight(filePath, tempDir, proc.TranscodeHeight)
+		if err != nil {
+			return Sent{}, fmt.Errorf("failed to transcode to %dp: %w", proc.TranscodeHeight, err)
+		}
+		if scaled != filePath {
+			log.Info.Printf("Transcoded to %dp: %s -> %s", proc.TranscodeHeight, filePath, scaled)
+			filePath = scaled
+		}
 	}
 
-	previewPath := filepath.Join(tempDir, fmt.Sprintf("%s_%s_preview.jpg", tag, description))
-	logger.Info.Printf("Composing preview grid...")
-	if err := ComposeGrid(frames, 5, 6, previewPath); err != nil {
-		return fmt.Errorf("failed to compose grid: %w", err)
+	if err := ctx.Err(); err != nil {
+		return Sent{}, err
+	}
+
+	// Step 2: Generate preview thumbnail (a grid of frames growing with the duration)
+	var previewPath string
+	if preview == "full" {
+		if previewPath, err = makePreview(filePath, tempDir, tag, description, proc); err != nil {
+			return Sent{}, err
+		}
+		if err := ctx.Err(); err != nil {
+			return Sent{}, err
+		}
 	}
 
 	// Step 3: Split video if needed
-	logger.Info.Printf("Splitting video into parts if needed...")
-	videoParts, err := splitVideo(filePath, maxSize, tempDir)
+	log.Info.Printf("Splitting video into parts if needed...")
+	videoParts, err := splitVideo(filePath, proc.MaxSizeBytes, tempDir)
 	if err != nil {
-		return fmt.Errorf("failed to split video: %w", err)
+		return Sent{}, fmt.Errorf("failed to split video: %w", err)
 	}
 
 	// Step 4: Validate media group size
-	if 1+len(videoParts) > 10 {
-		return fmt.Errorf("media group would have %d items (1 preview + %d video parts), exceeds Telegram limit of 10",
-			1+len(videoParts), len(videoParts))
+	previews := 0
+	if previewPath != "" {
+		previews = 1
+	}
+	if previews+len(videoParts) > 10 {
+		return Sent{}, fmt.Errorf("%w: media group would have %d items (%d preview + %d video parts), exceeds Telegram limit of 10",
+			errs.ErrTooLarge, previews+len(videoParts), previews, len(videoParts))
+	}
+	if len(videoParts) > 1 {
+		if videoParts, err = nameParts(videoParts, originalPath, sum); err != nil {
+			return Sent{}, err
+		}
 	}
 
 	// Step 5: Build media group
-	baseCaption := fmt.Sprintf("#%s %s", tag, strings.ReplaceAll(description, "_", " "))
 	var mediaItems []MediaItem
+	var sums []string // of the items, "" for the preview
 
 	// First item: preview photo with caption (this is the only caption for the entire album)
-	mediaItems = append(mediaItems, MediaItem{
-		FilePath:  previewPath,
-		MediaType: "photo",
-		Caption:   baseCaption,
-	})
-
-	// Remaining items: video parts with empty captions
-	// Telegram only shows the first item's caption for the entire album
+	if previewPath != "" {
+		mediaItems = append(mediaItems, MediaItem{
+			FilePath:  previewPath,
+			MediaType: "photo",
+			Caption:   baseCaption,
+		})
+		sums = append(sums, "")
+	}
+
+	// Remaining items: video parts with empty captions, unless there is no
+	// preview to carry it. Telegram only shows the first item's caption
+	// for the entire album
 	for _, partPath := range videoParts {
 		w, h, err := ffmpeg.GetVideoResolution(partPath)
 		if err != nil {
-			return fmt.Errorf("failed to get file info: %w", err)
+			return Sent{}, fmt.Errorf("failed to get file info: %w", err)
 		}
-		mediaItems = append(mediaItems, MediaItem{
+		caption := ""
+		if len(mediaItems) == 0 {
+			caption = baseCaption
+		}
+		item := MediaItem{
 			FilePath:  partPath,
 			MediaType: "video",
-			Caption:   "",
+			Caption:   caption,
 			W:         w,
 			H:         h,
-		})
+		}
+		partSum := sum
+		if partPath != originalPath || sum == "" {
+			if partSum, err = fileprocessor.SHA256(partPath); err != nil {
+				return Sent{}, fmt.Errorf("failed to hash %s: %w", partPath, err)
+			}
+		}
+		if known != nil {
+			item.Existing = existingPart(client, known, partSum, partPath)
+		}
+		mediaItems = append(mediaItems, item)
+		sums = append(sums, partSum)
 	}
 
-	logger.Info.Printf("Preparing album with %d items: 1 preview + %d video parts...", len(mediaItems), len(videoParts))
+	log.Info.Printf("Preparing album with %d items: %d preview + %d video parts...", len(mediaItems), previews, len(videoParts))
+	if err := ctx.Err(); err != nil {
+		return Sent{}, err
+	}
 
-	err = client.SendMultiMedia(peer, mediaItems)
+	var msgIDs []int
+	if len(mediaItems) == 1 {
+		// An album needs two items
+		msgID, err := client.SendMedia(peer, mediaItems[0])
+		if err != nil {
+			return Sent{}, fmt.Errorf("failed to send media: %w", err)
+		}
+		msgIDs = []int{msgID}
+	} else if msgIDs, err = client.SendMultiMedia(peer, mediaItems); err != nil {
+		return Sent{}, fmt.Errorf("failed to send multi media: %w", err)
+	}
+
+	sent = Sent{Files: sentFiles(mediaItems, msgIDs), Parts: len(videoParts)}
+	for i := range min(len(sent.Files), len(sums)) {
+		sent.Files[i].SHA256 = sums[i]
+	}
+	if proc.ScrubInterval > 0 {
+		// The video is in the chat already, so this doesn't fail its upload
+		if scrub, err := sendScrub(client, peer, filePath, originalPath, tempDir, proc.ScrubInterval); err != nil {
+			log.Warn.Printf("Failed to send scrub thumbnails - %v", err)
+		} else {
+			sent.Scrub = scrub
+		}
+	}
+	log.Info.Println("┗━━━━━━━━━━━ Video successfully uploaded ━━━━━━━━━━━┛")
+	return sent, nil
+}
+
+// existingPart returns the message holding the part at path that known
+// finds, nil when it isn't in a chat anymore
+func existingPart(cl *client.Client, known KnownFile, sum, path string) *tg.Message {
+	info, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("failed to send multi media: %w", err)
+		return nil
+	}
+	chatID, msgID, ok := known(sum, info.Size())
+	if !ok {
+		return nil
+	}
+	msgs, err := cl.GetMessages(chatID, []int{msgID})
+	if err != nil || len(msgs) == 0 || client.DocumentSize(msgs[0]) != info.Size() {
+		return nil
 	}
+	log.Info.Printf("%s is message %d already, sending it by reference", filepath.Base(path), msgID)
+	return msgs[0]
+}
 
-	logger.Info.Println("┗━━━━━━━━━━━ Video successfully uploaded ━━━━━━━━━━━┛")
-	return nil
+// sendScrub sends the sprite sheets and WebVTT of makeScrub as an album of
+// documents
+func sendScrub(client *client.Client, peer tg.InputPeerClass, filePath, originalPath, tempDir string, interval time.Duration) ([]index.File, error) {
+	paths, err := makeScrub(filePath, originalPath, tempDir, interval)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Context().Err(); err != nil {
+		return nil, err
+	}
+	items := make([]MediaItem, len(paths))
+	for i, path := range paths {
+		items[i] = MediaItem{FilePath: path, MediaType: "document"}
+	}
+	log.Info.Printf("Sending %d sprite sheets and their WebVTT for scrubbing...", len(paths)-1)
+	msgIDs, err := client.SendMultiMedia(peer, items)
+	if err != nil {
+		return nil, err
+	}
+	return sentFiles(items, msgIDs), nil
+}
+
+// toneMap converts HDR and 10-bit video to 8-bit SDR with proc.ToneMap
+// and returns the path of the result, or filePath when it is left as is
+func toneMap(filePath, tempDir string, proc config.Processing) (string, error) {
+	color, err := ffmpeg.ProbeColor(filePath)
+	if err != nil {
+		log.Warn.Printf("Failed to probe the colors of %s - %v", filePath, err)
+		return filePath, nil
+	}
+	switch {
+	case !color.HDR() && !color.TenBit():
+		return filePath, nil
+	case !proc.ToneMap:
+		if color.HDR() {
+			log.Warn.Printf("%s is HDR (%s), which many Telegram clients show washed out; tone_map converts it to SDR", filePath, color)
+		}
+		return filePath, nil
+	case color.HDR() && !ffmpeg.HasFilter("zscale"):
+		log.Warn.Printf("Can't tone-map %s: ffmpeg lacks the zscale filter (libzimg)", filePath)
+		return filePath, nil
+	}
+
+	sdr, err := ffmpeg.ToneMap(filePath, tempDir, color, proc.TranscodeHeight)
+	if err != nil {
+		return "", fmt.Errorf("failed to tone-map: %w", err)
+	}
+	log.Info.Printf("Converted %s (%s) to 8-bit SDR: %s", filePath, color, sdr)
+	return sdr, nil
+}
+
+// makePreview composes the contact sheet of the video at filePath, a grid
+// of PreviewGrid frames, and returns its path
+func makePreview(filePath, tempDir, tag, description string, proc config.Processing) (string, error) {
+	durTotal, err := ffmpeg.GetVideoDuration(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get video duration: %w", err)
+	}
+	cols, rows := PreviewGrid(durTotal, proc.PreviewMinFrames, proc.PreviewMaxFrames)
+	g, err := newGrid(cols, rows)
+	if err != nil {
+		return "", err
+	}
+
+	// Frames are drawn into the grid as they are extracted
+	log.Info.Printf("Extracting %d frames into a %d×%d preview grid (total duration: %s)", cols*rows, cols, rows, util.FormatSecondsToHumanReadable(durTotal))
+	if err := ffmpeg.ExtractFramesFunc(filePath, tempDir, durTotal, cols*rows, g.addFile); err != nil {
+		return "", fmt.Errorf("failed to extract frames: %w", err)
+	}
+
+	previewPath := filepath.Join(tempDir, fmt.Sprintf("%s_%s_preview.jpg", tag, description))
+	if err := g.save(previewPath); err != nil {
+		return "", fmt.Errorf("failed to compose grid: %w", err)
+	}
+	return previewPath, nil
+}
+
+// nameParts renames the parts of the video at originalPath by PartName
+func nameParts(parts []string, originalPath, sum string) ([]string, error) {
+	if sum == "" {
+		var err error
+		if sum, err = fileprocessor.SHA256(originalPath); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", originalPath, err)
+		}
+	}
+	base := filepath.Base(originalPath)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	named := make([]string, len(parts))
+	for i, part := range parts {
+		named[i] = filepath.Join(filepath.Dir(part), PartName(base+filepath.Ext(part), i+1, len(parts), sum))
+		if err := os.Rename(part, named[i]); err != nil {
+			return nil, fmt.Errorf("failed to rename part: %w", err)
+		}
+	}
+	return named, nil
+}
+
+// sentFiles pairs the album items with the IDs of the messages they became
+func sentFiles(items []MediaItem, msgIDs []int) []index.File {
+	files := make([]index.File, 0, len(msgIDs))
+	for i, id := range msgIDs {
+		file := index.File{MessageID: id}
+		if i < len(items) {
+			file.Name = filepath.Base(items[i].FilePath)
+			if info, err := os.Stat(items[i].FilePath); err == nil {
+				file.Size = info.Size()
+			}
+		}
+		files = append(files, file)
+	}
+	return files
 }
 
 func LogFileInfo(filename string, size int64, success bool, err error) {
@@ -143,29 +403,57 @@ func LogFileInfo(filename string, size int64, success bool, err error) {
 
 	sizeKB := float64(size) / 1024.0
 	if err != nil {
-		logger.Error.Printf("[%s] %s (%.2f KB) - Error: %v", status, filename, sizeKB, err)
+		log.Error.Printf("[%s] %s (%.2f KB) - Error: %v", status, filename, sizeKB, err)
 	} else {
-		logger.Info.Printf("[%s] %s (%.2f KB)", status, filename, sizeKB)
+		log.Info.Printf("[%s] %s (%.2f KB)", status, filename, sizeKB)
 	}
 }
 
-func MoveVideoFiles(cfg *config.MtprotoConfig, originalFilename string) error {
+func MoveVideoFiles(cfg *config.MtprotoConfig, originalFilename, sum string) error {
 	sourcePath := filepath.Join(cfg.LocalDir, originalFilename)
-	ext := filepath.Ext(originalFilename)
-	nameWithoutExt := strings.TrimSuffix(originalFilename, ext)
+	destPath := filepath.Join(cfg.DoneDir, DoneName(cfg, originalFilename, sum))
 
-	newFilename := fmt.Sprintf("%s%s", nameWithoutExt, ext)
-	destPath := filepath.Join(cfg.DoneDir, newFilename)
-
-	if err := move(sourcePath, destPath); err != nil {
+	if _, err := move(sourcePath, destPath); err != nil {
 		return fmt.Errorf("failed to move original video: %w", err)
 	}
 
 	return nil
 }
 
-func move(src, dst string) error {
-	return os.Rename(src, dst)
+// QuarantineFile moves originalFilename from local_dir to quarantine_dir
+// and returns its new path
+func QuarantineFile(cfg *config.MtprotoConfig, originalFilename string) (string, error) {
+	return move(filepath.Join(cfg.LocalDir, originalFilename), filepath.Join(cfg.QuarantineDir, originalFilename))
+}
+
+// segmentFiles lists the <basename>_NNN.ts segments in dir in order. Names
+// are compared as is: brackets or backslashes in video names would be
+// patterns to filepath.Glob.
+func segmentFiles(dir, basename string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, basename+"_") && strings.HasSuffix(name, ".ts") {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files, nil
+}
+
+// doneHashPrefix is how many hex digits of the SHA-256 prefix done names
+const doneHashPrefix = 16
+
+// DoneName is the name of an uploaded file in done_dir. With done_naming
+// hash it is "<sha256 prefix>__<name>" when the hash sum is known.
+func DoneName(cfg *config.MtprotoConfig, filename, sum string) string {
+	if cfg.DoneNaming != "hash" || len(sum) < doneHashPrefix {
+		return filename
+	}
+	return sum[:doneHashPrefix] + "__" + filename
 }
 
 func splitVideo(videoPath string, maxSize int64, outputDir string) ([]string, error) {
@@ -204,17 +492,12 @@ func splitVideo(videoPath string, maxSize int64, outputDir string) ([]string, er
 	for curDuration < totalDuration {
 		// Split video by maxSize
 		outputPath := fmt.Sprintf(outputPattern, i)
-		err := ffmpeg.SplitVideoByDuration(videoPath, outputPath, int64(curDuration), maxSize)
+		newDuration, err := splitPart(videoPath, outputPath, int64(curDuration), maxSize)
 		if err != nil {
 			return nil, err
 		}
 		result = append(result, outputPath)
 
-		newDuration, err := ffmpeg.GetVideoDuration(outputPath)
-		if err != nil {
-			return nil, err
-		}
-
 		curDuration += newDuration
 		i++
 	}
@@ -222,6 +505,36 @@ func splitVideo(videoPath string, maxSize int64, outputDir string) ([]string, er
 	return result, nil
 }
 
+// splitAttempts are the ways of cutting a part, tried in turn while it
+// comes out unplayable
+var splitAttempts = []ffmpeg.SplitOptions{{}, {FixTimestamps: true}, {FixTimestamps: true, Shrink: 0.1}}
+
+// splitPart cuts the part of the video starting at begin seconds and
+// returns its duration. A part that doesn't play is cut again.
+func splitPart(videoPath, outputPath string, begin, maxSize int64) (float64, error) {
+	var lastErr error
+	for n, opts := range splitAttempts {
+		if n > 0 {
+			log.Warn.Printf("%s is not playable (%v), splitting it again", filepath.Base(outputPath), lastErr)
+		}
+		if err := ffmpeg.SplitVideoByDuration(videoPath, outputPath, begin, maxSize, opts); err != nil {
+			return 0, err
+		}
+		duration, err := ffmpeg.ProbeDuration(outputPath)
+		if err == nil && duration <= 0 {
+			err = fmt.Errorf("its duration is %gs", duration)
+		}
+		if err == nil {
+			err = ffmpeg.CheckPlayable(outputPath)
+		}
+		if err == nil {
+			return duration, nil
+		}
+		lastErr = err
+	}
+	return 0, fmt.Errorf("%w: the part starting at %s is not playable: %w", errs.ErrFFmpegFailed, util.FormatSecondsToHumanReadable(float64(begin)), lastErr)
+}
+
 func splitVideoV2(videoPath string, maxSize int64, outputDir string) ([]string, error) {
 	fileInfo, err := os.Stat(videoPath)
 	if err != nil {
@@ -255,7 +568,7 @@ func splitVideoV2(videoPath string, maxSize int64, outputDir string) ([]string,
 	}
 	if bitrate <= 0 {
 		bitrate = (fileSize * 8) / durSec
-		logger.Warn.Printf("No metadata bitrate, estimate bitrate=%d bps", bitrate)
+		log.Warn.Printf("No metadata bitrate, estimate bitrate=%d bps", bitrate)
 	}
 
 	segmentTime := (maxSize * 8) / bitrate
@@ -263,15 +576,16 @@ func splitVideoV2(videoPath string, maxSize int64, outputDir string) ([]string,
 		segmentTime = 1
 	}
 
-	logger.Debug.Printf("Video: [%s], duration=%s, bitrate=%d bps, segment_time≈%s (target %s/segment)",
+	log.Debug.Printf("Video: [%s], duration=%s, bitrate=%d bps, segment_time≈%s (target %s/segment)",
 		videoPath,
 		util.FormatSecondsToHumanReadable(float64(durSec)),
 		bitrate,
 		util.FormatSecondsToHumanReadable(float64(segmentTime)),
 		util.FormatBytesToHumanReadable(maxSize))
 
-	tmpPattern := filepath.Join(outputDir, basename+"_%03d.ts")
-	logger.Info.Printf("Splitting video (generate .ts): [%s]", tmpPattern)
+	// "%" in the name would be read as part of ffmpeg's number pattern
+	tmpPattern := filepath.Join(outputDir, strings.ReplaceAll(basename, "%", "%%")+"_%03d.ts")
+	log.Info.Printf("Splitting video (generate .ts): [%s]", tmpPattern)
 
 	err = ffmpeg.GenerateTSFiles(videoPath, tmpPattern, segmentTime)
 	if err != nil {
@@ -279,8 +593,10 @@ func splitVideoV2(videoPath string, maxSize int64, outputDir string) ([]string,
 	}
 
 	// remux each .ts -> mp4
-	tsGlob := filepath.Join(outputDir, basename+"_*"+".ts")
-	tsFiles, _ := filepath.Glob(tsGlob)
+	tsFiles, err := segmentFiles(outputDir, basename)
+	if err != nil {
+		return nil, err
+	}
 
 	result := []string{}
 
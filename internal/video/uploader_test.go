@@ -0,0 +1,128 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSegmentFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"[HD] clip_001.ts", "[HD] clip_000.ts", "H clip_000.ts", "[HD] clip_000.mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := segmentFiles(dir, "[HD] clip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "[HD] clip_000.ts"), filepath.Join(dir, "[HD] clip_001.ts")}
+	if !slices.Equal(files, want) {
+		t.Fatalf("segments = %v, want %v", files, want)
+	}
+}
+
+func TestPartName(t *testing.T) {
+	name := PartName("trip_beach.mp4", 2, 7, "3f2a9c0d1e4b5a6978")
+	if name != "trip_beach_part02of07_3f2a9c0d1e4b.mp4" {
+		t.Fatalf("PartName = %q", name)
+	}
+	p, ok := ParsePartName(name)
+	if !ok || p != (Part{Name: "trip_beach.mp4", Index: 2, Total: 7, Hash: "3f2a9c0d1e4b"}) {
+		t.Errorf("ParsePartName(%q) = %+v, %v", name, p, ok)
+	}
+	for _, name := range []string{"trip_beach_part001.mp4", "trip_part08of07_3f2a.mp4", "preview.jpg"} {
+		if _, ok := ParsePartName(name); ok {
+			t.Errorf("ParsePartName(%q) accepted it", name)
+		}
+	}
+}
+
+func TestPreviewGrid(t *testing.T) {
+	tests := []struct {
+		seconds              float64
+		minFrames, maxFrames int
+		cols, rows           int
+	}{
+		{30, 4, 64, 2, 2},
+		{3600, 4, 64, 5, 6},
+		{3 * 3600, 4, 64, 7, 8},
+		{10 * 3600, 4, 64, 8, 8},
+		{60, 9, 12, 3, 3},
+		{3600, 4, 20, 4, 5},
+	}
+	for _, tt := range tests {
+		cols, rows := PreviewGrid(tt.seconds, tt.minFrames, tt.maxFrames)
+		if cols != tt.cols || rows != tt.rows {
+			t.Errorf("PreviewGrid(%v, %d, %d) = %dx%d, want %dx%d", tt.seconds, tt.minFrames, tt.maxFrames, cols, rows, tt.cols, tt.rows)
+		}
+	}
+}
+
+func TestGridConcurrent(t *testing.T) {
+	g, err := newGrid(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			frame := image.NewGray(image.Rect(0, 0, 16, 9))
+			draw.Draw(frame, frame.Bounds(), image.NewUniform(color.Gray{Y: uint8(40 * i)}), image.Point{}, draw.Src)
+			g.add(i, frame)
+		}()
+	}
+	wg.Wait()
+	if g.img == nil {
+		t.Fatal("no grid after adding frames")
+	}
+
+	// Each frame lands in its own cell, row by row
+	w, h := g.thumbnailWidth, g.thumbnailHeight
+	for i := range 6 {
+		x, y := (i%3)*w+w/2, (i/3)*h+h/2
+		if r, _, _, _ := g.img.At(x, y).RGBA(); uint8(r>>8) != uint8(40*i) {
+			t.Errorf("cell %d has gray %d, want %d", i, r>>8, 40*i)
+		}
+	}
+	if err := g.save(filepath.Join(t.TempDir(), "grid.jpg")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScrubVTT(t *testing.T) {
+	// 25s at one tile every 10s, 10×1 to a sheet
+	vtt := scrubVTT(25, 10, 160, 90, 1, []string{"my trip_sprites01.jpg"})
+	want := `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+my%20trip_sprites01.jpg#xywh=0,0,160,90
+
+00:00:10.000 --> 00:00:20.000
+my%20trip_sprites01.jpg#xywh=160,0,160,90
+
+00:00:20.000 --> 00:00:25.000
+my%20trip_sprites01.jpg#xywh=320,0,160,90
+`
+	if vtt != want {
+		t.Errorf("scrubVTT = %q, want %q", vtt, want)
+	}
+
+	// Tile 101 starts the second sheet
+	vtt = scrubVTT(3601, 10, 160, 90, 10, []string{"a_sprites01.jpg", "a_sprites02.jpg"})
+	if !strings.Contains(vtt, "00:16:40.000 --> 00:16:50.000\na_sprites02.jpg#xywh=0,0,160,90\n") {
+		t.Errorf("no tile 101 on the second sheet in %s", vtt)
+	}
+	if !IsScrubName("a_sprites02.jpg") || !IsScrubName("a_thumbnails.vtt") || IsScrubName("a_preview.jpg") {
+		t.Error("IsScrubName doesn't tell the scrub thumbnails")
+	}
+}
@@ -0,0 +1,79 @@
+package ytdlp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"tg-storage-assistant/internal/logger"
+	"unicode"
+)
+
+// Result describes a video saved by yt-dlp
+type Result struct {
+	Path  string
+	Title string
+}
+
+// Download runs yt-dlp for url and stores the merged mp4 in dir
+func Download(ctx context.Context, binary, url, dir string) (*Result, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create download dir: %w", err)
+	}
+
+	args := []string{
+		"--no-playlist",
+		"--no-progress",
+		"--restrict-filenames",
+		"-f", "bv*+ba/b",
+		"--merge-output-format", "mp4",
+		"-o", dir + "/%(id)s.%(ext)s",
+		// Printing disables the download unless --no-simulate is given
+		"--no-simulate",
+		"--print", "title:%(title)s",
+		"--print", "after_move:path:%(filepath)s",
+		url,
+	}
+	logger.Debug.Printf("Running %s %s", binary, strings.Join(args, " "))
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("yt-dlp failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	res := &Result{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if title, ok := strings.CutPrefix(line, "title:"); ok {
+			res.Title = title
+		} else if path, ok := strings.CutPrefix(line, "path:"); ok {
+			res.Path = path
+		}
+	}
+	if res.Path == "" {
+		return nil, fmt.Errorf("yt-dlp did not report an output file")
+	}
+	return res, nil
+}
+
+// Description turns a video title into an index description (words joined by
+// underscores, like upload file names). Path separators and characters that
+// are unsafe in file names are replaced, since descriptions end up in cache
+// and preview paths.
+func Description(title string) string {
+	desc := strings.Join(strings.FieldsFunc(title, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r) || strings.ContainsRune(`/\:*?"<>|`, r)
+	}), "_")
+	desc = strings.Trim(desc, "._")
+	if desc == "" {
+		return "untitled"
+	}
+	return desc
+}